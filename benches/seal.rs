@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//! Compares enforcing a sealed configuration with parsing, resolving, and
+//! building it for each enforcement, e.g. on a fork/exec path.
+//!
+//! Run with `cargo bench --bench seal`.
+
+use landlockconfig::Config;
+use std::hint::black_box;
+use std::thread;
+use std::time::{Duration, Instant};
+
+const JSON: &str = r#"{
+    "ruleset": [
+        {
+            "handledAccessFs": [ "read_file", "read_dir" ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "read_file", "read_dir" ],
+            "parent": [ "/usr", "/tmp", "/dev", "/proc" ]
+        }
+    ]
+}"#;
+
+const RUNS: usize = 100;
+
+/// Prints the minimum and median durations of `f`, each run in a dedicated
+/// thread because enforcing a ruleset cannot be undone.
+fn bench<F>(name: &str, f: F)
+where
+    F: Fn() + Sync,
+{
+    let mut durations: Vec<Duration> = (0..RUNS)
+        .map(|_| {
+            thread::scope(|s| {
+                s.spawn(|| {
+                    let start = Instant::now();
+                    f();
+                    start.elapsed()
+                })
+                .join()
+                .unwrap()
+            })
+        })
+        .collect();
+    durations.sort();
+    println!(
+        "{name:<20} min {:>10?}  median {:>10?}",
+        durations[0],
+        durations[RUNS / 2]
+    );
+}
+
+fn main() {
+    let config = Config::parse_json(JSON.as_bytes()).unwrap();
+    let (sealed, _) = config.resolve().unwrap().seal().unwrap();
+
+    bench("sealed", || {
+        black_box(sealed.restrict_self().unwrap());
+    });
+    bench("parse and build", || {
+        let (status, _) = Config::parse_json(black_box(JSON).as_bytes())
+            .unwrap()
+            .resolve()
+            .unwrap()
+            .restrict_self()
+            .unwrap();
+        black_box(status);
+    });
+}
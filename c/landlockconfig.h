@@ -7,8 +7,25 @@
 
 #include <stdint.h>
 
+/**
+ * Rejects configurations with warnings (e.g. a handled network access right
+ * without any rule allowing it) with -EINVAL, instead of parsing them.
+ */
+#define LANDLOCKCONFIG_PARSE_STRICT (1 << 0)
+
+/**
+ * Accepts duplicate keys in JSON objects, the last one overriding the
+ * previous ones.  Only supported when parsing a JSON file or buffer.
+ */
+#define LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS (1 << 1)
+
 struct landlockconfig;
 
+/**
+ * Callback opening a rule path, see landlockconfig_build_ruleset_opener().
+ */
+typedef int (*landlockconfig_opener)(const char *path, void *data);
+
 #ifdef __cplusplus
 extern "C" {
 #endif // __cplusplus
@@ -19,12 +36,16 @@ extern "C" {
  * # Parameters
  *
  * * `config_fd`: A file descriptor referring to a JSON configuration file.
- * * `flags`: Must be 0.
+ *   It is read from its current offset but is never closed: the caller
+ *   still owns it and must close it.
+ * * `flags`: A combination of LANDLOCKCONFIG_PARSE_* flags, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unknown flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_json_file(int config_fd, uint32_t flags);
@@ -35,12 +56,16 @@ struct landlockconfig *landlockconfig_parse_json_file(int config_fd, uint32_t fl
  * # Parameters
  *
  * * `config_fd`: A file descriptor referring to a TOML configuration file.
- * * `flags`: Must be 0.
+ *   It is read from its current offset but is never closed: the caller
+ *   still owns it and must close it.
+ * * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unsupported flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_toml_file(int config_fd, uint32_t flags);
@@ -52,12 +77,14 @@ struct landlockconfig *landlockconfig_parse_toml_file(int config_fd, uint32_t fl
  *
  * * `buffer_ptr`: Pointer to the buffer containing JSON data.
  * * `buffer_size`: Size of the buffer in bytes, or 0 if `buffer_ptr` is null-terminated.
- * * `flags`: Must be 0.
+ * * `flags`: A combination of LANDLOCKCONFIG_PARSE_* flags, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unknown flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_json_buffer(const uint8_t *buffer_ptr,
@@ -71,12 +98,14 @@ struct landlockconfig *landlockconfig_parse_json_buffer(const uint8_t *buffer_pt
  *
  * * `buffer_ptr`: Pointer to the buffer containing TOML data.
  * * `buffer_size`: Size of the buffer in bytes, or 0 if `buffer_ptr` is null-terminated.
- * * `flags`: Must be 0.
+ * * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unsupported flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_toml_buffer(const uint8_t *buffer_ptr,
@@ -89,12 +118,15 @@ struct landlockconfig *landlockconfig_parse_toml_buffer(const uint8_t *buffer_pt
  * # Parameters
  *
  * * `dir_path`: A pointer to a null-terminated string containing the directory path.
- * * `flags`: Must be 0.
+ * * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unsupported flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the composed configuration has
+ *   warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_json_directory(const char *dir_path, uint32_t flags);
@@ -105,12 +137,15 @@ struct landlockconfig *landlockconfig_parse_json_directory(const char *dir_path,
  * # Parameters
  *
  * * `dir_path`: A pointer to a null-terminated string containing the directory path.
- * * `flags`: Must be 0.
+ * * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
  *
  * # Return values
  *
  * * Pointer to a landlockconfig object on success. This object must be freed
  *   with landlockconfig_free().
+ * * -EINVAL if `flags` contains unsupported flags, or if
+ *   LANDLOCKCONFIG_PARSE_STRICT is set and the composed configuration has
+ *   warnings.
  * * -errno on error.
  */
 struct landlockconfig *landlockconfig_parse_toml_directory(const char *dir_path, uint32_t flags);
@@ -118,9 +153,15 @@ struct landlockconfig *landlockconfig_parse_toml_directory(const char *dir_path,
 /**
  * Frees a landlockconfig object
  *
+ * NULL and -errno values returned by landlockconfig_parse_*() on error are
+ * ignored, which makes it safe to call this function whatever the parsing
+ * result.
+ *
  * # Safety
  *
- * The pointer must have been returned by landlockconfig_parse_*().
+ * The pointer must have been returned by landlockconfig_parse_*(), and must
+ * not be used anymore.  Freeing the same object twice is undefined behavior:
+ * set the pointer to NULL after freeing it.
  */
 void landlockconfig_free(struct landlockconfig *config);
 
@@ -130,7 +171,8 @@ void landlockconfig_free(struct landlockconfig *config);
  * # Parameters
  *
  * * `config`: A pointer to a landlockconfig object.
- * * `flags`: Must be 0.
+ * * `flags`: landlock_create_ruleset(2) flags creating a ruleset, of which
+ *   there is none yet, so it must be 0.
  *
  * # Safety
  *
@@ -140,10 +182,74 @@ void landlockconfig_free(struct landlockconfig *config);
  * # Returns
  *
  * * The ruleset file descriptor on success.
+ * * -EINVAL if `flags` contains unknown flags.
+ * * -EOPNOTSUPP if Landlock is not supported by the running kernel.
  * * -errno on error.
  */
 int landlockconfig_build_ruleset(const struct landlockconfig *config, uint32_t flags);
 
+/**
+ * Creates a ruleset from a landlockconfig object, opening rule paths with a
+ * callback
+ *
+ * This is useful when the library should not open paths itself, e.g. when
+ * paths are opened by a broker, or to test a configuration with fake files.
+ *
+ * # Parameters
+ *
+ * * `config`: A pointer to a landlockconfig object.
+ * * `flags`: Must be 0.
+ * * `opener`: A callback called for each rule path with `data`.  It must
+ *   return a file descriptor referring to `path` (e.g. opened with
+ *   `O_PATH | O_CLOEXEC`), or -errno on error.  The ownership of the returned
+ *   file descriptor is transferred to the library, which closes it.  An error
+ *   is not fatal, the related rule is then ignored.  `path` is only valid
+ *   during the call, and the callback must not unwind (e.g. with longjmp(3)).
+ * * `data`: An opaque pointer passed as is to `opener`.
+ *
+ * # Safety
+ *
+ * `config` must have been returned by landlockconfig_parse_json() or
+ * landlockconfig_parse_toml(), and `opener` must be safe to call with `data`.
+ *
+ * # Returns
+ *
+ * * The ruleset file descriptor on success.
+ * * -EOPNOTSUPP if Landlock is not supported by the running kernel.
+ * * -errno on error.
+ */
+int landlockconfig_build_ruleset_opener(const struct landlockconfig *config,
+                                        uint32_t flags,
+                                        landlockconfig_opener opener,
+                                        void *data);
+
+/**
+ * Enforces a landlockconfig object on the calling thread
+ *
+ * This also sets the no_new_privs attribute of the calling thread.
+ *
+ * # Parameters
+ *
+ * * `config`: A pointer to a landlockconfig object.
+ * * `flags`: A combination of landlock_restrict_self(2) flags (e.g.
+ *   LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF, available since the Landlock
+ *   ABI version 7), or 0.
+ *
+ * # Safety
+ *
+ * `config` must have been returned by landlockconfig_parse_json() or
+ * landlockconfig_parse_toml().
+ *
+ * # Returns
+ *
+ * * 0 on success.
+ * * -EINVAL if `flags` contains unknown flags.
+ * * -EOPNOTSUPP if Landlock or one of the `flags` is not supported by the
+ *   running kernel.  Nothing is enforced in this case.
+ * * -errno on error.
+ */
+int landlockconfig_restrict_self(const struct landlockconfig *config, uint32_t flags);
+
 #ifdef __cplusplus
 }  // extern "C"
 #endif  // __cplusplus
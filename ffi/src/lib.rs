@@ -1,12 +1,15 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
 use landlock::Errno;
-use landlockconfig::{Config, ConfigFormat};
+use landlockconfig::{
+    BuildRulesetError, Config, ConfigFormat, FlagsError, ParseOptions, RulesetOptions,
+};
 use libc::c_char;
-use std::ffi::{c_int, CStr};
+use std::ffi::{c_int, c_void, CStr, CString};
 use std::fs::File;
 use std::io::{Error, ErrorKind};
-use std::os::unix::io::{BorrowedFd, IntoRawFd, OwnedFd, RawFd};
+use std::os::unix::ffi::OsStrExt;
+use std::os::unix::io::{BorrowedFd, FromRawFd, IntoRawFd, OwnedFd, RawFd};
 
 fn unwrap_errno<T>(err: T) -> c_int
 where
@@ -33,18 +36,65 @@ fn io_error_to_errno(err: Error) -> Errno {
     }
 }
 
-fn parse_file<F>(config_fd: RawFd, flags: u32, parser: F) -> Result<*mut Config, Errno>
+/// Rejects configurations with warnings (e.g. a handled network access right
+/// without any rule allowing it) with -EINVAL, instead of parsing them.
+pub const LANDLOCKCONFIG_PARSE_STRICT: u32 = 1 << 0;
+
+/// Accepts duplicate keys in JSON objects, the last one overriding the
+/// previous ones.  Only supported when parsing a JSON file or buffer.
+pub const LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS: u32 = 1 << 1;
+
+/// Parse flags supported for each format.
+const PARSE_FLAGS_JSON: u32 = LANDLOCKCONFIG_PARSE_STRICT | LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS;
+const PARSE_FLAGS_TOML: u32 = LANDLOCKCONFIG_PARSE_STRICT;
+const PARSE_FLAGS_DIRECTORY: u32 = LANDLOCKCONFIG_PARSE_STRICT;
+
+/// Checks that all `flags` are in `supported`, and converts them to parse
+/// options.
+fn parse_options(flags: u32, supported: u32) -> Result<ParseOptions, Errno> {
+    if flags & !supported != 0 {
+        return Err(Errno::new(libc::EINVAL));
+    }
+    Ok(
+        ParseOptions::new()
+            .json_last_key_wins(flags & LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS != 0),
+    )
+}
+
+/// Returns `config` as an object, unless it has warnings and `flags` contains
+/// LANDLOCKCONFIG_PARSE_STRICT.
+fn into_object(config: Config, flags: u32) -> Result<*mut Config, Errno> {
+    if flags & LANDLOCKCONFIG_PARSE_STRICT != 0 {
+        // TODO: Report the warnings with the buffers for warnings and errors.
+        if !config.warnings().is_empty() {
+            return Err(Errno::new(libc::EINVAL));
+        }
+    }
+    Ok(Box::into_raw(Box::new(config)))
+}
+
+fn parse_file<F>(
+    config_fd: RawFd,
+    flags: u32,
+    supported: u32,
+    parser: F,
+) -> Result<*mut Config, Errno>
 where
-    F: FnOnce(File) -> Result<Config, Error>,
+    F: FnOnce(File, &ParseOptions) -> Result<Config, Error>,
 {
-    if flags != 0 {
-        return Err(Errno::new(libc::EINVAL));
+    let options = parse_options(flags, supported)?;
+
+    // BorrowedFd must not wrap a negative value (e.g. an unchecked error code).
+    if config_fd < 0 {
+        return Err(Errno::new(libc::EBADF));
     }
 
+    // The caller keeps the ownership of config_fd, and only the duplicated
+    // file descriptor is closed.
     let fd = unsafe { BorrowedFd::borrow_raw(config_fd) };
     // Checks if it is a valid file descriptor.
-    let file = File::from(fd.try_clone_to_owned()?);
-    Ok(Box::into_raw(Box::new(parser(file)?)))
+    let file = File::from(fd.try_clone_to_owned().map_err(io_error_to_errno)?);
+    into_object(parser(file, &options)?, flags)
 }
 
 // TODO: Pass a set of buffers for warnings and errors.
@@ -58,17 +108,21 @@ where
 /// # Parameters
 ///
 /// * `config_fd`: A file descriptor referring to a JSON configuration file.
-/// * `flags`: Must be 0.
+///   It is read from its current offset but is never closed: the caller
+///   still owns it and must close it.
+/// * `flags`: A combination of LANDLOCKCONFIG_PARSE_* flags, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unknown flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_json_file(config_fd: RawFd, flags: u32) -> *mut Config {
-    parse_file(config_fd, flags, |file| {
-        Config::parse_json(file).map_err(|e| Error::new(ErrorKind::InvalidData, e))
+    parse_file(config_fd, flags, PARSE_FLAGS_JSON, |file, options| {
+        Config::parse_json_with(file, options).map_err(|e| Error::new(ErrorKind::InvalidData, e))
     })
     .unwrap_or_else(|e| unwrap_errno(e) as *mut Config)
 }
@@ -78,19 +132,23 @@ pub extern "C" fn landlockconfig_parse_json_file(config_fd: RawFd, flags: u32) -
 /// # Parameters
 ///
 /// * `config_fd`: A file descriptor referring to a TOML configuration file.
-/// * `flags`: Must be 0.
+///   It is read from its current offset but is never closed: the caller
+///   still owns it and must close it.
+/// * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unsupported flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_toml_file(config_fd: RawFd, flags: u32) -> *mut Config {
-    parse_file(config_fd, flags, |mut file| {
+    parse_file(config_fd, flags, PARSE_FLAGS_TOML, |mut file, options| {
         let mut buffer = String::new();
         std::io::Read::read_to_string(&mut file, &mut buffer)?;
-        Config::parse_toml(&buffer).map_err(|e| Error::new(ErrorKind::InvalidData, e))
+        Config::parse_toml_with(&buffer, options).map_err(|e| Error::new(ErrorKind::InvalidData, e))
     })
     .unwrap_or_else(|e| unwrap_errno(e) as *mut Config)
 }
@@ -99,14 +157,13 @@ fn parse_buffer<F>(
     buffer_ptr: *const u8,
     buffer_size: usize,
     flags: u32,
+    supported: u32,
     parser: F,
 ) -> Result<*mut Config, Errno>
 where
-    F: FnOnce(&[u8]) -> Result<Config, Error>,
+    F: FnOnce(&[u8], &ParseOptions) -> Result<Config, Error>,
 {
-    if flags != 0 {
-        return Err(Errno::new(libc::EINVAL));
-    }
+    let options = parse_options(flags, supported)?;
 
     if buffer_ptr.is_null() {
         return Err(Errno::new(libc::EFAULT));
@@ -120,8 +177,8 @@ where
         unsafe { std::slice::from_raw_parts(buffer_ptr, buffer_size) }
     };
 
-    let config = parser(buffer).map_err(Errno::from)?;
-    Ok(Box::into_raw(Box::new(config)))
+    let config = parser(buffer, &options).map_err(Errno::from)?;
+    into_object(config, flags)
 }
 
 /// Parses a JSON configuration from a memory buffer
@@ -130,12 +187,14 @@ where
 ///
 /// * `buffer_ptr`: Pointer to the buffer containing JSON data.
 /// * `buffer_size`: Size of the buffer in bytes, or 0 if `buffer_ptr` is null-terminated.
-/// * `flags`: Must be 0.
+/// * `flags`: A combination of LANDLOCKCONFIG_PARSE_* flags, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unknown flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_json_buffer(
@@ -143,10 +202,16 @@ pub extern "C" fn landlockconfig_parse_json_buffer(
     buffer_size: usize,
     flags: u32,
 ) -> *mut Config {
-    parse_buffer(buffer_ptr, buffer_size, flags, |buffer| {
-        Config::parse_json(std::io::Cursor::new(buffer))
-            .map_err(|e| Error::new(ErrorKind::InvalidData, e))
-    })
+    parse_buffer(
+        buffer_ptr,
+        buffer_size,
+        flags,
+        PARSE_FLAGS_JSON,
+        |buffer, options| {
+            Config::parse_json_with(std::io::Cursor::new(buffer), options)
+                .map_err(|e| Error::new(ErrorKind::InvalidData, e))
+        },
+    )
     .unwrap_or_else(|e| unwrap_errno(e) as *mut Config)
 }
 
@@ -156,12 +221,14 @@ pub extern "C" fn landlockconfig_parse_json_buffer(
 ///
 /// * `buffer_ptr`: Pointer to the buffer containing TOML data.
 /// * `buffer_size`: Size of the buffer in bytes, or 0 if `buffer_ptr` is null-terminated.
-/// * `flags`: Must be 0.
+/// * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unsupported flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the configuration has warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_toml_buffer(
@@ -169,11 +236,18 @@ pub extern "C" fn landlockconfig_parse_toml_buffer(
     buffer_size: usize,
     flags: u32,
 ) -> *mut Config {
-    parse_buffer(buffer_ptr, buffer_size, flags, |buffer| {
-        let data =
-            std::str::from_utf8(buffer).map_err(|e| Error::new(ErrorKind::InvalidData, e))?;
-        Config::parse_toml(data).map_err(|e| Error::new(ErrorKind::InvalidData, e))
-    })
+    parse_buffer(
+        buffer_ptr,
+        buffer_size,
+        flags,
+        PARSE_FLAGS_TOML,
+        |buffer, options| {
+            let data =
+                std::str::from_utf8(buffer).map_err(|e| Error::new(ErrorKind::InvalidData, e))?;
+            Config::parse_toml_with(data, options)
+                .map_err(|e| Error::new(ErrorKind::InvalidData, e))
+        },
+    )
     .unwrap_or_else(|e| unwrap_errno(e) as *mut Config)
 }
 
@@ -182,9 +256,7 @@ fn parse_directory(
     flags: u32,
     format: ConfigFormat,
 ) -> Result<*mut Config, Errno> {
-    if flags != 0 {
-        return Err(Errno::new(libc::EINVAL));
-    }
+    parse_options(flags, PARSE_FLAGS_DIRECTORY)?;
 
     if dir_path.is_null() {
         return Err(Errno::new(libc::EFAULT));
@@ -193,7 +265,7 @@ fn parse_directory(
     let path = unsafe { CStr::from_ptr(dir_path) }.to_str()?;
     let config =
         Config::parse_directory(path, format).map_err(|e| io_error_to_errno(Error::from(e)))?;
-    Ok(Box::into_raw(Box::new(config)))
+    into_object(config, flags)
 }
 
 /// Parses all JSON configuration files in a directory
@@ -201,12 +273,15 @@ fn parse_directory(
 /// # Parameters
 ///
 /// * `dir_path`: A pointer to a null-terminated string containing the directory path.
-/// * `flags`: Must be 0.
+/// * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unsupported flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the composed configuration has
+///   warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_json_directory(
@@ -222,12 +297,15 @@ pub extern "C" fn landlockconfig_parse_json_directory(
 /// # Parameters
 ///
 /// * `dir_path`: A pointer to a null-terminated string containing the directory path.
-/// * `flags`: Must be 0.
+/// * `flags`: LANDLOCKCONFIG_PARSE_STRICT, or 0.
 ///
 /// # Return values
 ///
 /// * Pointer to a landlockconfig object on success. This object must be freed
 ///   with landlockconfig_free().
+/// * -EINVAL if `flags` contains unsupported flags, or if
+///   LANDLOCKCONFIG_PARSE_STRICT is set and the composed configuration has
+///   warnings.
 /// * -errno on error.
 #[no_mangle]
 pub extern "C" fn landlockconfig_parse_toml_directory(
@@ -240,24 +318,52 @@ pub extern "C" fn landlockconfig_parse_toml_directory(
 
 /// Frees a landlockconfig object
 ///
+/// NULL and -errno values returned by landlockconfig_parse_*() on error are
+/// ignored, which makes it safe to call this function whatever the parsing
+/// result.
+///
 /// # Safety
 ///
-/// The pointer must have been returned by landlockconfig_parse_*().
+/// The pointer must have been returned by landlockconfig_parse_*(), and must
+/// not be used anymore.  Freeing the same object twice is undefined behavior:
+/// set the pointer to NULL after freeing it.
 #[no_mangle]
 pub unsafe extern "C" fn landlockconfig_free(config: *mut Config) {
-    if !config.is_null() {
+    if !is_err_or_null(config) {
         drop(Box::from_raw(config));
     }
 }
 
-// TODO: Also return RestrictionStatus
+/// Highest errno value that can be encoded in a pointer, see the kernel's
+/// MAX_ERRNO.
+const MAX_ERRNO: isize = 4095;
+
+/// Returns true if `ptr` is NULL or a -errno value returned instead of an
+/// object.
+fn is_err_or_null<T>(ptr: *const T) -> bool {
+    ptr.is_null() || (-MAX_ERRNO..0).contains(&(ptr as isize))
+}
+
+/// Converts a ruleset file descriptor to a value that can be returned to the
+/// caller, making sure it can never be mistaken for an -errno.
+fn ruleset_fd(fd: Option<OwnedFd>) -> Result<RawFd, Errno> {
+    // The ruleset is not created if Landlock is not supported.
+    let fd = fd.ok_or(Errno::new(libc::EOPNOTSUPP))?;
+    let raw_fd = fd.into_raw_fd();
+    if raw_fd < 0 {
+        // This should never happen.
+        return Err(Errno::new(libc::EBADF));
+    }
+    Ok(raw_fd)
+}
 
 /// Creates a ruleset from a landlockconfig object
 ///
 /// # Parameters
 ///
 /// * `config`: A pointer to a landlockconfig object.
-/// * `flags`: Must be 0.
+/// * `flags`: landlock_create_ruleset(2) flags creating a ruleset, of which
+///   there is none yet, so it must be 0.
 ///
 /// # Safety
 ///
@@ -267,28 +373,156 @@ pub unsafe extern "C" fn landlockconfig_free(config: *mut Config) {
 /// # Returns
 ///
 /// * The ruleset file descriptor on success.
+/// * -EINVAL if `flags` contains unknown flags.
+/// * -EOPNOTSUPP if Landlock is not supported by the running kernel.
 /// * -errno on error.
 #[no_mangle]
 pub unsafe extern "C" fn landlockconfig_build_ruleset(config: *const Config, flags: u32) -> RawFd {
+    build_ruleset(config, flags)
+        .and_then(ruleset_fd)
+        .unwrap_or_else(unwrap_errno)
+}
+
+fn build_ruleset(config: *const Config, flags: u32) -> Result<Option<OwnedFd>, Errno> {
+    if is_err_or_null(config) {
+        return Err(Errno::new(libc::EFAULT));
+    }
+
+    // TODO: Avoid cloning the config.
+    let resolved = unsafe { &*config }.clone().resolve().map_err(Errno::from)?;
+    let options = RulesetOptions::new().create_flags(flags);
+    let (ruleset, _) = resolved
+        .build_ruleset_with_options(&options)
+        .map_err(build_error_to_errno)?;
+    Ok(ruleset.into())
+}
+
+/// Callback opening a rule path, see landlockconfig_build_ruleset_opener().
+pub type Opener = unsafe extern "C" fn(path: *const c_char, data: *mut c_void) -> c_int;
+
+/// Creates a ruleset from a landlockconfig object, opening rule paths with a
+/// callback
+///
+/// This is useful when the library should not open paths itself, e.g. when
+/// paths are opened by a broker, or to test a configuration with fake files.
+///
+/// # Parameters
+///
+/// * `config`: A pointer to a landlockconfig object.
+/// * `flags`: Must be 0.
+/// * `opener`: A callback called for each rule path with `data`.  It must
+///   return a file descriptor referring to `path` (e.g. opened with
+///   `O_PATH | O_CLOEXEC`), or -errno on error.  The ownership of the returned
+///   file descriptor is transferred to the library, which closes it.  An error
+///   is not fatal, the related rule is then ignored.  `path` is only valid
+///   during the call, and the callback must not unwind (e.g. with longjmp(3)).
+/// * `data`: An opaque pointer passed as is to `opener`.
+///
+/// # Safety
+///
+/// `config` must have been returned by landlockconfig_parse_json() or
+/// landlockconfig_parse_toml(), and `opener` must be safe to call with `data`.
+///
+/// # Returns
+///
+/// * The ruleset file descriptor on success.
+/// * -EOPNOTSUPP if Landlock is not supported by the running kernel.
+/// * -errno on error.
+#[no_mangle]
+pub unsafe extern "C" fn landlockconfig_build_ruleset_opener(
+    config: *const Config,
+    flags: u32,
+    opener: Option<Opener>,
+    data: *mut c_void,
+) -> RawFd {
     if flags != 0 {
         return unwrap_errno(Errno::new(libc::EINVAL));
     }
-
-    if config.is_null() {
+    let Some(opener) = opener else {
         return unwrap_errno(Errno::new(libc::EFAULT));
+    };
+
+    build_ruleset_opener(config, opener, data)
+        .and_then(ruleset_fd)
+        .unwrap_or_else(unwrap_errno)
+}
+
+fn build_ruleset_opener(
+    config: *const Config,
+    opener: Opener,
+    data: *mut c_void,
+) -> Result<Option<OwnedFd>, Errno> {
+    if is_err_or_null(config) {
+        return Err(Errno::new(libc::EFAULT));
     }
 
-    // TODO: Avoid cloning the config.
-    let resolved = match unsafe { &*config }.clone().resolve() {
-        Ok(resolved) => resolved,
-        Err(e) => return unwrap_errno(e),
-    };
-    resolved
-        .build_ruleset()
-        .map(|(r, _)| {
-            let fd: Option<OwnedFd> = r.into();
-            fd.map(|fd| fd.into_raw_fd()).unwrap_or(-1)
+    let resolved = unsafe { &*config }.clone().resolve().map_err(Errno::from)?;
+    let (ruleset, _) = resolved
+        .build_ruleset_with(|path| {
+            let path = CString::new(path.as_os_str().as_bytes())
+                .map_err(|_| Error::from(ErrorKind::InvalidInput))?;
+            match unsafe { opener(path.as_ptr(), data) } {
+                fd if fd >= 0 => Ok(unsafe { OwnedFd::from_raw_fd(fd) }),
+                errno => Err(Error::from_raw_os_error(errno.saturating_neg())),
+            }
         })
+        .map_err(Errno::from)?;
+    Ok(ruleset.into())
+}
+
+/// Maps the flag and system call errors to the errno documented by the C API.
+fn build_error_to_errno(error: BuildRulesetError) -> Errno {
+    let errno = match &error {
+        BuildRulesetError::Flags(FlagsError::Unknown(_)) => Some(libc::EINVAL),
+        BuildRulesetError::Flags(FlagsError::Unsupported { .. }) => Some(libc::EOPNOTSUPP),
+        BuildRulesetError::Syscall(e) => e.errno(),
+        _ => None,
+    };
+    errno.map_or_else(|| Errno::from(error), Errno::new)
+}
+
+fn restrict_self(config: *const Config, flags: u32) -> Result<(), Errno> {
+    if is_err_or_null(config) {
+        return Err(Errno::new(libc::EFAULT));
+    }
+
+    let resolved = unsafe { &*config }.clone().resolve().map_err(Errno::from)?;
+    let options = RulesetOptions::new().restrict_flags(flags);
+    match resolved.restrict_self_with_options(&options) {
+        Ok((true, _)) => Ok(()),
+        // The ruleset is not created if Landlock is not supported.
+        Ok((false, _)) => Err(Errno::new(libc::EOPNOTSUPP)),
+        Err(error) => Err(build_error_to_errno(error)),
+    }
+}
+
+/// Enforces a landlockconfig object on the calling thread
+///
+/// This also sets the no_new_privs attribute of the calling thread.
+///
+/// # Parameters
+///
+/// * `config`: A pointer to a landlockconfig object.
+/// * `flags`: A combination of landlock_restrict_self(2) flags (e.g.
+///   LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF, available since the Landlock
+///   ABI version 7), or 0.
+///
+/// # Safety
+///
+/// `config` must have been returned by landlockconfig_parse_json() or
+/// landlockconfig_parse_toml().
+///
+/// # Returns
+///
+/// * 0 on success.
+/// * -EINVAL if `flags` contains unknown flags.
+/// * -EOPNOTSUPP if Landlock or one of the `flags` is not supported by the
+///   running kernel.  Nothing is enforced in this case.
+/// * -errno on error.
+#[no_mangle]
+pub unsafe extern "C" fn landlockconfig_restrict_self(config: *const Config, flags: u32) -> c_int {
+    restrict_self(config, flags)
+        .map(|()| 0)
         .unwrap_or_else(unwrap_errno)
 }
 
@@ -296,6 +530,8 @@ pub unsafe extern "C" fn landlockconfig_build_ruleset(config: *const Config, fla
 mod tests {
     use super::*;
     use std::ffi::CString;
+    use std::io::{Read, Seek, SeekFrom};
+    use std::os::unix::io::AsRawFd;
 
     #[test]
     fn test_parse_directory_enotdir() {
@@ -321,11 +557,237 @@ mod tests {
     fn test_parse_directory_invalid_flags() {
         let file_path =
             CString::new(std::env::current_exe().unwrap().as_path().to_str().unwrap()).unwrap();
-        let result = parse_directory(file_path.as_ptr(), 1, ConfigFormat::Json);
+        let result = parse_directory(file_path.as_ptr(), 1 << 31, ConfigFormat::Json);
 
         assert!(result.is_err());
         let err = result.unwrap_err();
         assert_eq!(*err, libc::EINVAL);
+
+        // JSON-only flag.
+        let result = parse_directory(
+            file_path.as_ptr(),
+            LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS,
+            ConfigFormat::Json,
+        );
+        assert_eq!(*result.unwrap_err(), libc::EINVAL);
+    }
+
+    fn parse_json_buffer(json: &str, flags: u32) -> *mut Config {
+        landlockconfig_parse_json_buffer(json.as_ptr(), json.len(), flags)
+    }
+
+    #[test]
+    fn test_parse_flags_unknown() {
+        let json = r#"{ "ruleset": [ { "handledAccessFs": [ "execute" ] } ] }"#;
+        for flags in [1 << 2, 1 << 31] {
+            assert_eq!(
+                parse_json_buffer(json, flags) as isize,
+                -libc::EINVAL as isize
+            );
+        }
+        let toml = "[[ruleset]]\nhandled_access_fs = [ \"execute\" ]\n";
+        let config = landlockconfig_parse_toml_buffer(
+            toml.as_ptr(),
+            toml.len(),
+            LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS,
+        );
+        assert_eq!(config as isize, -libc::EINVAL as isize);
+    }
+
+    #[test]
+    fn test_parse_flags_strict() {
+        // Handles a network access right without allowing any port.
+        let json = r#"{ "ruleset": [ { "handledAccessNet": [ "bind_tcp" ] } ] }"#;
+        let config = parse_json_buffer(json, 0);
+        assert!(!is_err_or_null(config));
+        unsafe { landlockconfig_free(config) };
+        assert_eq!(
+            parse_json_buffer(json, LANDLOCKCONFIG_PARSE_STRICT) as isize,
+            -libc::EINVAL as isize
+        );
+
+        let toml = "[[ruleset]]\nhandled_access_net = [ \"bind_tcp\" ]\n";
+        let config = landlockconfig_parse_toml_buffer(
+            toml.as_ptr(),
+            toml.len(),
+            LANDLOCKCONFIG_PARSE_STRICT,
+        );
+        assert_eq!(config as isize, -libc::EINVAL as isize);
+
+        // Without warning.
+        let json = r#"{ "ruleset": [ { "handledAccessFs": [ "execute" ] } ] }"#;
+        let config = parse_json_buffer(json, LANDLOCKCONFIG_PARSE_STRICT);
+        assert!(!is_err_or_null(config));
+        unsafe { landlockconfig_free(config) };
+    }
+
+    #[test]
+    fn test_parse_flags_json_last_key_wins() {
+        let json = r#"{ "ruleset": [ { "handledAccessFs": [ "execute" ], "handledAccessFs": [ "read_file" ] } ] }"#;
+        assert!(is_err_or_null(parse_json_buffer(json, 0)));
+
+        let config = parse_json_buffer(
+            json,
+            LANDLOCKCONFIG_PARSE_STRICT | LANDLOCKCONFIG_PARSE_JSON_LAST_KEY_WINS,
+        );
+        assert!(!is_err_or_null(config));
+        let expected = Config::parse_json(
+            r#"{ "ruleset": [ { "handledAccessFs": [ "read_file" ] } ] }"#.as_bytes(),
+        )
+        .unwrap();
+        assert_eq!(unsafe { &*config }, &expected);
+        unsafe { landlockconfig_free(config) };
+    }
+
+    #[test]
+    fn test_parse_file_negative_fd() {
+        let result = parse_file(-1, 0, 0, |_, _| unreachable!());
+
+        assert!(result.is_err());
+        let err = result.unwrap_err();
+        assert_eq!(*err, libc::EBADF);
+    }
+
+    #[test]
+    fn test_parse_file_unopened_fd() {
+        // Higher than the default RLIMIT_NOFILE hard limit.
+        let result = parse_file(RawFd::MAX, 0, 0, |_, _| unreachable!());
+
+        assert!(result.is_err());
+        let err = result.unwrap_err();
+        assert_eq!(*err, libc::EBADF);
+    }
+
+    #[test]
+    fn test_parse_json_file_caller_owned() {
+        let json =
+            r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/" ] } ] }"#;
+        let path =
+            std::env::temp_dir().join(format!("landlockconfig-ffi-{}.json", std::process::id()));
+        std::fs::write(&path, json).unwrap();
+        let mut file = File::open(&path).unwrap();
+        std::fs::remove_file(&path).unwrap();
+
+        let config = landlockconfig_parse_json_file(file.as_raw_fd(), 0);
+        assert!(config as isize > 0);
+        unsafe { landlockconfig_free(config) };
+
+        // The file descriptor is still usable, and can then be closed.
+        file.seek(SeekFrom::Start(0)).unwrap();
+        let mut buffer = String::new();
+        file.read_to_string(&mut buffer).unwrap();
+        assert_eq!(buffer, json);
+        assert_eq!(unsafe { libc::close(file.into_raw_fd()) }, 0);
+    }
+
+    unsafe extern "C" fn fake_opener(path: *const c_char, data: *mut c_void) -> c_int {
+        let (fds, opened) = unsafe { &mut *(data as *mut (Vec<OwnedFd>, Vec<CString>)) };
+        opened.push(unsafe { CStr::from_ptr(path) }.into());
+        match fds.pop() {
+            Some(fd) => fd.into_raw_fd(),
+            None => -libc::EACCES,
+        }
+    }
+
+    #[test]
+    fn test_build_ruleset_opener() {
+        let json = r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/a", "/b" ] } ] }"#;
+        let config = landlockconfig_parse_json_buffer(json.as_ptr(), json.len(), 0);
+        assert!(config as isize > 0);
+
+        // Only one pre-opened file descriptor, the second path is denied.
+        let fd = OwnedFd::from(File::open(env!("CARGO_MANIFEST_DIR")).unwrap());
+        let mut data = (vec![fd], Vec::<CString>::new());
+        let data_ptr = &mut data as *mut _ as *mut c_void;
+        assert!(build_ruleset_opener(config, fake_opener, data_ptr).is_ok());
+        assert!(data.0.is_empty());
+        assert_eq!(data.1, [c"/a", c"/b"]);
+
+        assert_eq!(
+            unsafe { landlockconfig_build_ruleset_opener(config, 0, None, data_ptr) },
+            -libc::EFAULT
+        );
+        assert_eq!(
+            unsafe { landlockconfig_build_ruleset_opener(config, 1, Some(fake_opener), data_ptr) },
+            -libc::EINVAL
+        );
+        unsafe { landlockconfig_free(config) };
+    }
+
+    #[test]
+    fn test_free_null_and_errors() {
+        unsafe { landlockconfig_free(std::ptr::null_mut()) };
+
+        // A failed parsing returns an -errno value, which must be ignored.
+        let config = landlockconfig_parse_json_file(-1, 0);
+        assert_eq!(config as isize, -libc::EBADF as isize);
+        unsafe { landlockconfig_free(config) };
+        unsafe { landlockconfig_free(config) };
+        assert_eq!(*build_ruleset(config, 0).unwrap_err(), libc::EFAULT);
+
+        let json = r#"{ "foo": [] }"#;
+        let config = landlockconfig_parse_json_buffer(json.as_ptr(), json.len(), 0);
+        assert_eq!(config as isize, -libc::EINVAL as isize);
+        unsafe { landlockconfig_free(config) };
+    }
+
+    #[test]
+    fn test_is_err_or_null() {
+        assert!(is_err_or_null(std::ptr::null::<Config>()));
+        assert!(is_err_or_null(-1isize as *const Config));
+        assert!(is_err_or_null(-MAX_ERRNO as *const Config));
+        assert!(!is_err_or_null((-MAX_ERRNO - 1) as *const Config));
+        let config = Box::new(0u8);
+        assert!(!is_err_or_null(&*config));
+    }
+
+    #[test]
+    fn test_parse_json_file_negative_fd() {
+        let result = landlockconfig_parse_json_file(-libc::EINVAL, 0);
+
+        assert_eq!(result as isize, -libc::EBADF as isize);
+    }
+
+    #[test]
+    fn test_ruleset_fd_not_created() {
+        let result = ruleset_fd(None);
+
+        assert!(result.is_err());
+        let err = result.unwrap_err();
+        assert_eq!(*err, libc::EOPNOTSUPP);
+        assert_eq!(unwrap_errno(err), -libc::EOPNOTSUPP);
+    }
+
+    #[test]
+    fn test_build_ruleset_unknown_flags() {
+        let json =
+            r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/" ] } ] }"#;
+        let config = Config::parse_json(json.as_bytes()).unwrap();
+        assert_eq!(*build_ruleset(&config, 1 << 0).unwrap_err(), libc::EINVAL);
+    }
+
+    // The flags are checked before building the ruleset, which is then never
+    // enforced on the test thread.
+    #[test]
+    fn test_restrict_self_unknown_flags() {
+        let json =
+            r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/" ] } ] }"#;
+        let config = Config::parse_json(json.as_bytes()).unwrap();
+        assert_eq!(*restrict_self(&config, 1 << 31).unwrap_err(), libc::EINVAL);
+        assert_eq!(
+            *restrict_self(std::ptr::null(), 0).unwrap_err(),
+            libc::EFAULT
+        );
+    }
+
+    #[test]
+    fn test_build_error_to_errno() {
+        let error = BuildRulesetError::Flags(FlagsError::Unsupported {
+            flags: 1,
+            min_abi: 7,
+            abi: 6,
+        });
+        assert_eq!(*build_error_to_errno(error), libc::EOPNOTSUPP);
     }
 
     #[test]
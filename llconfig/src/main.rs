@@ -3,8 +3,8 @@
 use anyhow::{bail, Context};
 use clap::{Parser, Subcommand};
 use landlock::RulesetStatus;
-use landlockconfig::{Config, ConfigFormat, OptionalConfig};
-use std::fs::File;
+use landlockconfig::{format_toml, Config, ConfigFormat, OptionalConfig};
+use std::fs;
 use std::io::Read;
 use std::os::unix::process::CommandExt;
 use std::path::Path;
@@ -57,6 +57,14 @@ enum Commands {
         #[arg(short, long, help = "Print resolved configuration and ignored errors")]
         debug: bool,
 
+        #[arg(
+            long,
+            help = "Fail on rule errors instead of ignoring them",
+            long_help = "Fail if a rule cannot be fully applied (e.g. a missing path, or \
+                directory access rights granted on a file) instead of ignoring it."
+        )]
+        strict: bool,
+
         #[arg(
             trailing_var_arg = true,
             required = true,
@@ -73,12 +81,31 @@ enum Commands {
             stdout in JSON format."
     )]
     Schema,
+
+    #[command(
+        about = "Format TOML configuration files",
+        long_about = "Normalize the layout of TOML configuration files (key order, spacing, and \
+            sorted arrays) while keeping their comments. Formatted files are printed to stdout, \
+            unless --write is specified."
+    )]
+    Fmt {
+        #[arg(short, long, help = "Write the formatted files in place")]
+        write: bool,
+
+        #[arg(
+            required = true,
+            num_args = 1..,
+            help = "TOML configuration file(s) to format"
+        )]
+        files: Vec<String>,
+    },
 }
 
 fn run(
     json: Vec<String>,
     toml: Vec<String>,
     debug: bool,
+    strict: bool,
     mut command: Vec<String>,
 ) -> anyhow::Result<()> {
     let stdin_count = json.iter().filter(|&path| path == "-").count()
@@ -97,7 +124,8 @@ fn run(
             if json_path.is_dir() {
                 Config::parse_directory(json_path, ConfigFormat::Json)?
             } else {
-                Config::parse_json(File::open(json_path).context("Failed to open JSON file")?)?
+                Config::parse_file(json_path, ConfigFormat::Json)
+                    .context("Failed to load JSON file")?
             }
         };
         full_config.compose(&config);
@@ -113,22 +141,27 @@ fn run(
             if toml_path.is_dir() {
                 Config::parse_directory(toml_path, ConfigFormat::Toml)?
             } else {
-                let data =
-                    std::fs::read_to_string(toml_path).context("Failed to open TOML file")?;
-                Config::parse_toml(data.as_str())?
+                Config::parse_file(toml_path, ConfigFormat::Toml)
+                    .context("Failed to load TOML file")?
             }
         };
         full_config.compose(&config);
     }
 
-    let resolved = full_config
-        .context("No configuration file provided")?
-        .resolve()?;
+    let full_config = full_config.context("No configuration file provided")?;
+    for warning in full_config.warnings() {
+        eprintln!("Warning: {warning}");
+    }
+    let resolved = full_config.resolve()?;
     if debug {
         eprintln!("{:#?}", resolved);
     }
 
     let (ruleset, rule_errors) = resolved.build_ruleset()?;
+    if strict && !rule_errors.is_empty() {
+        let errors: Vec<_> = rule_errors.iter().map(ToString::to_string).collect();
+        bail!("Rule errors:\n{}", errors.join("\n"));
+    }
     if debug {
         eprintln!("Ignored rule errors: {:#?}", rule_errors);
     }
@@ -146,13 +179,20 @@ fn run(
 }
 
 fn schema() {
-    print!(
-        "{}",
-        include_str!(concat!(
-            env!("CARGO_MANIFEST_DIR"),
-            "/../schema/landlockconfig.json"
-        ))
-    );
+    print!("{}", landlockconfig::JSON_SCHEMA);
+}
+
+fn fmt(write: bool, files: Vec<String>) -> anyhow::Result<()> {
+    for file in files {
+        let data = fs::read_to_string(&file).with_context(|| format!("Failed to read {file}"))?;
+        let formatted = format_toml(&data).with_context(|| format!("Failed to format {file}"))?;
+        if !write {
+            print!("{formatted}");
+        } else if formatted != data {
+            fs::write(&file, formatted).with_context(|| format!("Failed to write {file}"))?;
+        }
+    }
+    Ok(())
 }
 
 fn main() -> anyhow::Result<()> {
@@ -163,11 +203,13 @@ fn main() -> anyhow::Result<()> {
             json,
             toml,
             debug,
+            strict,
             command,
-        } => run(json, toml, debug, command),
+        } => run(json, toml, debug, strict, command),
         Commands::Schema => {
             schema();
             Ok(())
         }
+        Commands::Fmt { write, files } => fmt(write, files),
     }
 }
@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::names::{fs_access_names, net_access_names, scope_names, standard_names};
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope};
+use serde::de::{EnumAccess, IntoDeserializer, VariantAccess, Visitor};
+use serde::Deserializer;
+use std::cmp::Ordering;
+use std::collections::BTreeMap;
+use std::fmt;
+use std::marker::PhantomData;
+use std::sync::{PoisonError, RwLock};
+use thiserror::Error;
+
+type Aliases<A> = RwLock<BTreeMap<String, BitFlags<A>>>;
+
+static FS_ALIASES: Aliases<AccessFs> = RwLock::new(BTreeMap::new());
+static NET_ALIASES: Aliases<AccessNet> = RwLock::new(BTreeMap::new());
+static SCOPE_ALIASES: Aliases<Scope> = RwLock::new(BTreeMap::new());
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum AliasError {
+    /// The name is already a standard name or a registered alias of the same
+    /// kind.
+    #[error("access right name already exists: {0}")]
+    Collision(String),
+    /// The name is empty, or uses the `abi.` prefix reserved for the groups.
+    #[error("invalid access right alias name: {0:?}")]
+    InvalidName(String),
+    #[error("no access right for the alias {0}")]
+    EmptyAccess(String),
+}
+
+pub(crate) trait AliasAccess: Access {
+    fn aliases() -> &'static Aliases<Self>;
+
+    fn names() -> &'static [&'static str];
+}
+
+impl AliasAccess for AccessFs {
+    fn aliases() -> &'static Aliases<Self> {
+        &FS_ALIASES
+    }
+
+    fn names() -> &'static [&'static str] {
+        fs_access_names()
+    }
+}
+
+impl AliasAccess for AccessNet {
+    fn aliases() -> &'static Aliases<Self> {
+        &NET_ALIASES
+    }
+
+    fn names() -> &'static [&'static str] {
+        net_access_names()
+    }
+}
+
+impl AliasAccess for Scope {
+    fn aliases() -> &'static Aliases<Self> {
+        &SCOPE_ALIASES
+    }
+
+    fn names() -> &'static [&'static str] {
+        scope_names()
+    }
+}
+
+/// Registered alias found in a configuration.
+///
+/// An alias cannot be unregistered nor changed, so its name identifies it.
+#[derive(Debug, Clone)]
+pub(crate) struct Alias<A>
+where
+    A: Access,
+{
+    pub(crate) name: String,
+    pub(crate) access: BitFlags<A>,
+}
+
+impl<A> PartialEq for Alias<A>
+where
+    A: Access,
+{
+    fn eq(&self, other: &Self) -> bool {
+        self.name == other.name
+    }
+}
+
+impl<A> Eq for Alias<A> where A: Access {}
+
+impl<A> PartialOrd for Alias<A>
+where
+    A: Access,
+{
+    fn partial_cmp(&self, other: &Self) -> Option<Ordering> {
+        Some(self.cmp(other))
+    }
+}
+
+impl<A> Ord for Alias<A>
+where
+    A: Access,
+{
+    fn cmp(&self, other: &Self) -> Ordering {
+        self.name.cmp(&other.name)
+    }
+}
+
+fn register<A>(name: &str, access: BitFlags<A>) -> Result<(), AliasError>
+where
+    A: AliasAccess,
+{
+    if name.is_empty() || name.starts_with("abi.") {
+        return Err(AliasError::InvalidName(name.into()));
+    }
+    if access.is_empty() {
+        return Err(AliasError::EmptyAccess(name.into()));
+    }
+    if A::names().contains(&name) {
+        return Err(AliasError::Collision(name.into()));
+    }
+    let mut aliases = A::aliases().write().unwrap_or_else(PoisonError::into_inner);
+    if aliases.contains_key(name) {
+        return Err(AliasError::Collision(name.into()));
+    }
+    aliases.insert(name.into(), access);
+    Ok(())
+}
+
+fn lookup<A>(name: &str) -> Option<Alias<A>>
+where
+    A: AliasAccess,
+{
+    let aliases = A::aliases().read().unwrap_or_else(PoisonError::into_inner);
+    Some(Alias {
+        name: name.into(),
+        access: *aliases.get(name)?,
+    })
+}
+
+/// Registers `name` for the parser to accept it as the filesystem access
+/// rights `access`, e.g. for an organization-specific vocabulary.
+///
+/// Aliases are process-global and permanent: they apply to all the
+/// configurations parsed afterward, from any thread.  Registering a standard
+/// name (see [`fs_access_names()`]) or an already registered alias returns
+/// [`AliasError::Collision`].
+///
+/// Aliases are not part of the [`JSON_SCHEMA`](crate::JSON_SCHEMA), and
+/// serialized configurations use the standard names instead.
+pub fn register_fs_alias(name: &str, access: BitFlags<AccessFs>) -> Result<(), AliasError> {
+    register(name, access)
+}
+
+/// Registers `name` for the parser to accept it as the network access rights
+/// `access`, like [`register_fs_alias()`].
+pub fn register_net_alias(name: &str, access: BitFlags<AccessNet>) -> Result<(), AliasError> {
+    register(name, access)
+}
+
+/// Registers `name` for the parser to accept it as the scopes `scope`, like
+/// [`register_fs_alias()`].
+pub fn register_scope_alias(name: &str, scope: BitFlags<Scope>) -> Result<(), AliasError> {
+    register(name, scope)
+}
+
+/// Access right item of the parser, which is a standard name or an alias.
+pub(crate) trait AccessItem: Sized {
+    type Access: AliasAccess;
+
+    const NAME: &'static str;
+
+    /// Deserializes a standard name, i.e. without the aliases.
+    fn deserialize_standard<'de, D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>;
+
+    fn from_alias(alias: Alias<Self::Access>) -> Self;
+}
+
+struct AccessItemVisitor<I>(PhantomData<I>);
+
+impl<'de, I> Visitor<'de> for AccessItemVisitor<I>
+where
+    I: AccessItem,
+{
+    type Value = I;
+
+    fn expecting(&self, formatter: &mut fmt::Formatter) -> fmt::Result {
+        formatter.write_str("an access right name")
+    }
+
+    fn visit_enum<E>(self, data: E) -> Result<Self::Value, E::Error>
+    where
+        E: EnumAccess<'de>,
+    {
+        let (name, variant) = data.variant::<String>()?;
+        variant.unit_variant()?;
+        match lookup(&name) {
+            Some(alias) => Ok(I::from_alias(alias)),
+            None => I::deserialize_standard(name.into_deserializer()),
+        }
+    }
+}
+
+/// Deserializes a standard name like the derived implementation (with the
+/// same errors), or a registered alias.
+pub(crate) fn deserialize_item<'de, D, I>(deserializer: D) -> Result<I, D::Error>
+where
+    D: Deserializer<'de>,
+    I: AccessItem,
+{
+    deserializer.deserialize_enum(
+        I::NAME,
+        standard_names::<I>(),
+        AccessItemVisitor(PhantomData),
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use crate::Config;
+
+    #[test]
+    fn test_fs_alias() {
+        register_fs_alias(
+            "test-log-write",
+            AccessFs::WriteFile | AccessFs::Truncate | AccessFs::MakeReg,
+        )
+        .unwrap();
+        // The schema only knows the standard names.
+        let config = Config::parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file", "test-log-write" ],
+                        "parent": [ "/var/log" ]
+                    }
+                ]
+            }"#
+            .as_bytes(),
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        let access =
+            AccessFs::ReadFile | AccessFs::WriteFile | AccessFs::Truncate | AccessFs::MakeReg;
+        assert_eq!(config.handled_fs, access);
+        assert_eq!(
+            config.rules_path_beneath.values().collect::<Vec<_>>(),
+            [&access]
+        );
+
+        // Serialized configurations do not depend on the aliases.
+        let json = serde_json::to_string(
+            &Config::parse_json(
+                r#"{ "ruleset": [ { "handledAccessFs": [ "test-log-write" ] } ] }"#.as_bytes(),
+            )
+            .unwrap(),
+        )
+        .unwrap();
+        assert_eq!(
+            json,
+            r#"{"ruleset":[{"handledAccessFs":["write_file","make_reg","truncate"]}]}"#
+        );
+    }
+
+    #[test]
+    fn test_net_scope_alias() {
+        register_net_alias("test-tcp", AccessNet::BindTcp | AccessNet::ConnectTcp).unwrap();
+        register_scope_alias("test-ipc", Scope::AbstractUnixSocket | Scope::Signal).unwrap();
+        let toml = r#"
+            [[ruleset]]
+            handled_access_net = ["test-tcp"]
+            scoped = ["test-ipc"]
+        "#;
+        let config = Config::parse_toml(toml).unwrap().resolve().unwrap();
+        assert_eq!(
+            config.handled_net,
+            AccessNet::BindTcp | AccessNet::ConnectTcp
+        );
+        assert_eq!(config.scoped, Scope::AbstractUnixSocket | Scope::Signal);
+
+        // Aliases are only known for their kind.
+        assert!(parse_json(r#"{ "ruleset": [ { "handledAccessFs": [ "test-tcp" ] } ] }"#).is_err());
+    }
+
+    #[test]
+    fn test_alias_errors() {
+        assert!(matches!(
+            register_fs_alias("read_file", AccessFs::ReadFile.into()),
+            Err(AliasError::Collision(name)) if name == "read_file"
+        ));
+        assert!(matches!(
+            register_net_alias("abi.all", AccessNet::BindTcp.into()),
+            Err(AliasError::InvalidName(_))
+        ));
+        assert!(matches!(
+            register_fs_alias("", AccessFs::ReadFile.into()),
+            Err(AliasError::InvalidName(_))
+        ));
+        assert!(matches!(
+            register_fs_alias("test-nothing", BitFlags::EMPTY),
+            Err(AliasError::EmptyAccess(_))
+        ));
+
+        register_fs_alias("test-exec", AccessFs::Execute.into()).unwrap();
+        assert!(matches!(
+            register_fs_alias("test-exec", AccessFs::Execute | AccessFs::ReadFile),
+            Err(AliasError::Collision(_))
+        ));
+        // The same name can be used by another kind.
+        register_scope_alias("test-exec", Scope::Signal.into()).unwrap();
+
+        // Unknown names are still reported as such.
+        assert!(
+            parse_json(r#"{ "ruleset": [ { "handledAccessFs": [ "test-unregistered" ] } ] }"#)
+                .is_err()
+        );
+        // Standard names are not changed.
+        assert!(!fs_access_names().contains(&"test-exec"));
+    }
+}
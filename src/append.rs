@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{open_rule_path, AddRule, BuildRulesetError, RuleError};
+use crate::errno::{map_errno, Operation};
+use crate::{kernel, ResolvedConfig};
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope, ABI};
+use std::io;
+use std::os::unix::io::{AsFd, BorrowedFd};
+use thiserror::Error;
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum AddRulesError {
+    #[error(transparent)]
+    Build(#[from] BuildRulesetError),
+    #[error(
+        "access rights handled by the configuration but not by the ruleset: \
+        filesystem {fs:?}, network {net:?}"
+    )]
+    Unhandled {
+        fs: BitFlags<AccessFs>,
+        net: BitFlags<AccessNet>,
+    },
+    /// Scopes can only be set when creating a ruleset.
+    #[error("scopes cannot be added to an existing ruleset: {0:?}")]
+    Scoped(BitFlags<Scope>),
+    #[error("failed to add rule {rule}: {source}")]
+    AddRule { rule: usize, source: io::Error },
+}
+
+impl ResolvedConfig {
+    /// Adds the rules of this configuration to a ruleset created by the
+    /// caller (e.g. with the landlock_create_ruleset(2) syscall), instead of
+    /// creating a new one.  The ruleset is not enforced.
+    ///
+    /// The ruleset must handle at least the access rights handled by this
+    /// configuration and supported by the running kernel, which are given with
+    /// `handled_fs` and `handled_net` because they cannot be read from a
+    /// ruleset file descriptor.  Otherwise, the denials of this configuration
+    /// would not hold, and [`AddRulesError::Unhandled`] is returned before
+    /// adding any rule.  This configuration cannot have scopes.
+    ///
+    /// Like [`build_ruleset()`](ResolvedConfig::build_ruleset), access rights
+    /// not supported by the running kernel are ignored, and rules are indexed
+    /// in the same order.
+    pub fn add_rules_to(
+        &self,
+        ruleset: BorrowedFd<'_>,
+        handled_fs: BitFlags<AccessFs>,
+        handled_net: BitFlags<AccessNet>,
+    ) -> Result<Vec<RuleError>, AddRulesError> {
+        let kernel_abi = ABI::from(kernel::abi_version());
+        let supported_fs = AccessFs::from_all(kernel_abi);
+        let supported_net = AccessNet::from_all(kernel_abi);
+        if !self.scoped.is_empty() {
+            return Err(AddRulesError::Scoped(self.scoped));
+        }
+        let fs = self.handled_fs & supported_fs & !handled_fs;
+        let net = self.handled_net & supported_net & !handled_net;
+        if !fs.is_empty() || !net.is_empty() {
+            return Err(AddRulesError::Unhandled { fs, net });
+        }
+
+        let mut rule_errors = self.check_supported(kernel_abi)?;
+        rule_errors.extend(self.add_rules_with(open_rule_path, |rule, add| {
+            let added = match add {
+                AddRule::PathBeneath(fd, access) => {
+                    let access = access & supported_fs;
+                    if access.is_empty() {
+                        return Ok(());
+                    }
+                    kernel::add_path_beneath_rule(ruleset, fd.as_fd(), access.bits())
+                }
+                AddRule::NetPort(port, access) => {
+                    let access = access & supported_net;
+                    if access.is_empty() {
+                        return Ok(());
+                    }
+                    kernel::add_net_port_rule(ruleset, port, access.bits())
+                }
+            };
+            added.map_err(
+                |source| match map_errno(Operation::AddRule, &source, Some(rule)) {
+                    Some(error) => error.into(),
+                    None => AddRulesError::AddRule { rule, source },
+                },
+            )
+        })?);
+        Ok(rule_errors)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{dedicated_thread, parse_json};
+    use std::fs::File;
+    use std::os::unix::io::{FromRawFd, OwnedFd};
+
+    #[repr(C)]
+    struct RulesetAttr {
+        handled_access_fs: u64,
+        handled_access_net: u64,
+        scoped: u64,
+    }
+
+    fn resolved() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file", "read_dir" ],
+                        "parent": [ "/usr", "/dev", "/proc" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_add_rules_to() {
+        let handled_fs = AccessFs::ReadFile | AccessFs::ReadDir;
+        dedicated_thread(move || {
+            let attr = RulesetAttr {
+                handled_access_fs: handled_fs.bits(),
+                handled_access_net: 0,
+                scoped: 0,
+            };
+            let ret = unsafe {
+                libc::syscall(
+                    libc::SYS_landlock_create_ruleset,
+                    &attr as *const RulesetAttr,
+                    // Only handled_access_fs, supported by all ABI versions.
+                    size_of_val(&attr.handled_access_fs),
+                    0,
+                )
+            };
+            if ret < 0 {
+                eprintln!("Failed to create a ruleset: {}", io::Error::last_os_error());
+                return;
+            }
+            let ruleset = unsafe { OwnedFd::from_raw_fd(ret as i32) };
+
+            let rule_errors = resolved()
+                .add_rules_to(ruleset.as_fd(), handled_fs, BitFlags::EMPTY)
+                .unwrap();
+            assert!(rule_errors.is_empty());
+
+            kernel::restrict_self(ruleset.as_fd(), 0).unwrap();
+            assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+            assert!(!probe_denied("/usr", AccessFs::ReadDir).unwrap());
+        });
+    }
+
+    #[test]
+    fn test_add_rules_to_errors() {
+        // Checked before using the ruleset.
+        let file = File::open("/dev/null").unwrap();
+        if kernel::abi_version() > 0 {
+            assert!(matches!(
+                resolved().add_rules_to(file.as_fd(), AccessFs::ReadFile.into(), BitFlags::EMPTY),
+                Err(AddRulesError::Unhandled { fs, net })
+                    if fs == AccessFs::ReadDir.into() && net.is_empty()
+            ));
+        }
+
+        let scoped = ResolvedConfig {
+            scoped: Scope::Signal.into(),
+            ..Default::default()
+        };
+        assert!(matches!(
+            scoped.add_rules_to(file.as_fd(), BitFlags::EMPTY, BitFlags::EMPTY),
+            Err(AddRulesError::Scoped(scopes)) if scopes == Scope::Signal.into()
+        ));
+    }
+}
@@ -0,0 +1,415 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::grant::Explanation;
+use crate::names::access_name;
+use crate::parser::{
+    JsonFsAccessItem, JsonNetAccessItem, JsonScopeItem, TemplateString, UnknownAccessError,
+};
+use crate::{Config, ResolvedConfig};
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope};
+use serde::Serialize;
+use std::ffi::OsString;
+use std::os::unix::ffi::OsStringExt;
+use std::path::PathBuf;
+use std::str::FromStr;
+use thiserror::Error;
+
+/// Landlock denial parsed from a kernel audit record (`LANDLOCK_ACCESS` type),
+/// see [`ResolvedConfig::match_audit_record()`].
+///
+/// Only the fields needed to find the missing rule are kept:
+/// - `domain`: the Landlock domain which denied the access;
+/// - `blockers`: the denied access rights or scopes, e.g. `fs.read_file` or
+///   `net.connect_tcp`;
+/// - `path`: the file or the parent directory of a filesystem access;
+/// - `src` or `dest`: the TCP port of a bind or a connect.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct AuditRecord {
+    pub domain: Option<String>,
+    pub blockers: Vec<String>,
+    pub path: Option<PathBuf>,
+    pub port: Option<u16>,
+}
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum AuditRecordError {
+    #[error("missing blockers field")]
+    MissingBlockers,
+    #[error("invalid {0} field")]
+    InvalidField(String),
+    #[error("unterminated quoted value")]
+    UnterminatedQuote,
+}
+
+/// Splits an audit record into its fields, with their values unquoted.
+fn fields(record: &str) -> Result<Vec<(&str, &str, bool)>, AuditRecordError> {
+    let mut fields = Vec::new();
+    let mut rest = record.trim();
+    while !rest.is_empty() {
+        let (token, next) = match rest.split_once('=') {
+            Some((key, value)) if !key.contains(' ') => {
+                let (value, next, quoted) = match value.strip_prefix('"') {
+                    Some(quoted) => {
+                        let (value, next) = quoted
+                            .split_once('"')
+                            .ok_or(AuditRecordError::UnterminatedQuote)?;
+                        (value, next, true)
+                    }
+                    None => {
+                        let (value, next) = value.split_once(' ').unwrap_or((value, ""));
+                        (value, next, false)
+                    }
+                };
+                (Some((key, value, quoted)), next)
+            }
+            // Skips tokens without value.
+            _ => (None, rest.split_once(' ').map_or("", |(_, next)| next)),
+        };
+        fields.extend(token);
+        rest = next.trim_start();
+    }
+    Ok(fields)
+}
+
+/// Decodes an audit string, which is hex-encoded if not quoted (e.g. if it
+/// contains spaces).
+fn untrusted_string(value: &str, quoted: bool) -> Option<Vec<u8>> {
+    if quoted {
+        return Some(value.as_bytes().to_vec());
+    }
+    if value.len() % 2 != 0 {
+        return None;
+    }
+    (0..value.len())
+        .step_by(2)
+        .map(|i| u8::from_str_radix(value.get(i..i + 2)?, 16).ok())
+        .collect()
+}
+
+impl FromStr for AuditRecord {
+    type Err = AuditRecordError;
+
+    /// Parses a record as printed by the kernel (e.g. in dmesg) or by
+    /// ausearch(8), ignoring the unknown fields.
+    fn from_str(record: &str) -> Result<Self, Self::Err> {
+        let mut parsed = Self::default();
+        let mut blockers = None;
+        for (key, value, quoted) in fields(record)? {
+            let invalid = || AuditRecordError::InvalidField(key.into());
+            match key {
+                "domain" => parsed.domain = Some(value.into()),
+                "blockers" => blockers = Some(value),
+                "path" => {
+                    let path = untrusted_string(value, quoted).ok_or_else(invalid)?;
+                    parsed.path = Some(OsString::from_vec(path).into());
+                }
+                "src" | "dest" => parsed.port = Some(value.parse().map_err(|_| invalid())?),
+                _ => {}
+            }
+        }
+        parsed.blockers = blockers
+            .ok_or(AuditRecordError::MissingBlockers)?
+            .split(',')
+            .filter(|blocker| !blocker.is_empty())
+            .map(Into::into)
+            .collect();
+        if parsed.blockers.is_empty() {
+            return Err(AuditRecordError::MissingBlockers);
+        }
+        Ok(parsed)
+    }
+}
+
+/// Rules (not) matching a denial, see
+/// [`ResolvedConfig::match_audit_record()`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct AuditMatch {
+    /// Why the configuration denies the blocked filesystem access rights, if
+    /// any, like [`ResolvedConfig::why_denied()`].
+    pub fs: Option<Explanation>,
+    /// Blocked network access rights not allowed by the configuration for the
+    /// port.
+    pub net: BitFlags<AccessNet>,
+    /// Blocked scopes, which no rule can allow: they must not be scoped
+    /// instead.
+    pub scoped: BitFlags<Scope>,
+    /// Blockers which cannot be matched, because they are not known (e.g.
+    /// `fs.change_topology`) or the record does not have a path or a port.
+    pub unmatched: Vec<String>,
+    /// Configuration with the rules allowing the blocked accesses, to add to
+    /// this configuration, e.g. with [`Config::compose()`].  It is empty if
+    /// the denial does not come from this configuration (e.g. from another
+    /// layer).
+    pub suggestion: Config,
+}
+
+/// Returns the access right or the scope named `name` by the parser.
+fn access_from_name<A, I>(name: &str) -> Option<A>
+where
+    A: Access,
+    I: TryFrom<A, Error = UnknownAccessError> + Serialize,
+{
+    BitFlags::<A>::all()
+        .iter()
+        .find(|access| access_name::<A, I>(*access).as_deref() == Some(name))
+}
+
+impl ResolvedConfig {
+    /// Finds which rules are missing or too narrow to allow an access denied
+    /// by the kernel, from its audit record, e.g. to turn a denial seen in
+    /// dmesg into a rule to add.
+    ///
+    /// Like [`why_denied()`](ResolvedConfig::why_denied), this is only an
+    /// analysis of this configuration: paths are compared lexically, and the
+    /// suggested filesystem rule is for the logged path, which is the file or
+    /// the parent directory of the accessed one.
+    pub fn match_audit_record(&self, record: &AuditRecord) -> AuditMatch {
+        let mut blocked_fs = BitFlags::<AccessFs>::EMPTY;
+        let mut blocked_net = BitFlags::<AccessNet>::EMPTY;
+        let mut scoped = BitFlags::<Scope>::EMPTY;
+        let mut unmatched = Vec::new();
+        for blocker in &record.blockers {
+            let matched = match blocker.split_once('.') {
+                Some(("fs", name)) if record.path.is_some() => {
+                    access_from_name::<AccessFs, JsonFsAccessItem>(name).map(|a| blocked_fs |= a)
+                }
+                Some(("net", name)) if record.port.is_some() => {
+                    access_from_name::<AccessNet, JsonNetAccessItem>(name).map(|a| blocked_net |= a)
+                }
+                Some(("scope", name)) => {
+                    access_from_name::<Scope, JsonScopeItem>(name).map(|s| scoped |= s)
+                }
+                _ => None,
+            };
+            if matched.is_none() {
+                unmatched.push(blocker.clone());
+            }
+        }
+
+        let mut suggestion = Config::empty();
+        let fs = record
+            .path
+            .as_ref()
+            .filter(|_| !blocked_fs.is_empty())
+            .map(|path| {
+                let explanation = self.why_denied(path, blocked_fs);
+                let missing = match &explanation {
+                    Explanation::Allowed => BitFlags::EMPTY,
+                    Explanation::NoRule { missing }
+                    | Explanation::MissingAccess { missing, .. } => *missing,
+                };
+                // Paths that are not valid UTF-8 cannot be part of a
+                // configuration.
+                if let Some(path) = path.to_str().filter(|_| !missing.is_empty()) {
+                    suggestion.handled_fs = missing;
+                    suggestion
+                        .rules_path_beneath
+                        .insert(TemplateString::from_text(path), missing);
+                }
+                explanation
+            });
+
+        let net = match record.port {
+            Some(port) => {
+                let allowed = self
+                    .rules_net_port
+                    .get(&port.into())
+                    .copied()
+                    .unwrap_or_default();
+                blocked_net & self.handled_net & !allowed
+            }
+            None => BitFlags::EMPTY,
+        };
+        if let (Some(port), false) = (record.port, net.is_empty()) {
+            suggestion.handled_net = net;
+            suggestion.rules_net_port.insert(port.into(), net);
+        }
+
+        AuditMatch {
+            fs,
+            net,
+            scoped: scoped & self.scoped,
+            unmatched,
+            suggestion,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    fn resolved() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "execute", "read_file", "make_reg" ],
+                        "handledAccessNet": [ "bind_tcp", "connect_tcp" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    fn suggestion(matched: &AuditMatch) -> String {
+        serde_json::to_string(&matched.suggestion).unwrap()
+    }
+
+    #[test]
+    fn test_parse_audit_record() {
+        let record: AuditRecord = "type=LANDLOCK_ACCESS msg=audit(1729738800.268:30): \
+            domain=195ba459b blockers=fs.read_file,fs.execute path=\"/etc/passwd\" \
+            dev=\"vda2\" ino=9"
+            .parse()
+            .unwrap();
+        assert_eq!(
+            record,
+            AuditRecord {
+                domain: Some("195ba459b".into()),
+                blockers: vec!["fs.read_file".into(), "fs.execute".into()],
+                path: Some("/etc/passwd".into()),
+                port: None,
+            }
+        );
+
+        // Paths with spaces are hex-encoded.
+        let record: AuditRecord = "blockers=fs.make_reg path=2F746D702F6120622063"
+            .parse()
+            .unwrap();
+        assert_eq!(record.path, Some("/tmp/a b c".into()));
+
+        let record: AuditRecord = "domain=1 blockers=net.bind_tcp saddr=127.0.0.1 src=8080"
+            .parse()
+            .unwrap();
+        assert_eq!(record.port, Some(8080));
+
+        assert_eq!(
+            "domain=1 path=\"/etc\"".parse::<AuditRecord>(),
+            Err(AuditRecordError::MissingBlockers)
+        );
+        assert_eq!(
+            "blockers= path=\"/etc\"".parse::<AuditRecord>(),
+            Err(AuditRecordError::MissingBlockers)
+        );
+        assert_eq!(
+            "blockers=fs.read_file path=\"/etc".parse::<AuditRecord>(),
+            Err(AuditRecordError::UnterminatedQuote)
+        );
+        assert_eq!(
+            "blockers=fs.read_file path=2F6".parse::<AuditRecord>(),
+            Err(AuditRecordError::InvalidField("path".into()))
+        );
+        assert_eq!(
+            "blockers=net.connect_tcp dest=http".parse::<AuditRecord>(),
+            Err(AuditRecordError::InvalidField("dest".into()))
+        );
+    }
+
+    #[test]
+    fn test_match_fs_no_rule() {
+        let record = "blockers=fs.read_file path=\"/etc/passwd\""
+            .parse()
+            .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert_eq!(
+            matched.fs,
+            Some(Explanation::NoRule {
+                missing: AccessFs::ReadFile.into()
+            })
+        );
+        assert_eq!(
+            suggestion(&matched),
+            r#"{"ruleset":[{"handledAccessFs":["read_file"]}],"pathBeneath":[{"allowedAccess":["read_file"],"parent":["/etc/passwd"]}]}"#
+        );
+    }
+
+    #[test]
+    fn test_match_fs_missing_access() {
+        // Creating a file is logged with the parent directory.
+        let record = "blockers=fs.make_reg,fs.read_file path=\"/tmp\""
+            .parse()
+            .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert_eq!(
+            matched.fs,
+            Some(Explanation::MissingAccess {
+                rules: vec!["/tmp".into()],
+                missing: AccessFs::MakeReg.into()
+            })
+        );
+        assert_eq!(
+            suggestion(&matched),
+            r#"{"ruleset":[{"handledAccessFs":["make_reg"]}],"pathBeneath":[{"allowedAccess":["make_reg"],"parent":["/tmp"]}]}"#
+        );
+    }
+
+    #[test]
+    fn test_match_allowed() {
+        // Denied by another layer.
+        let record = "blockers=fs.execute path=\"/usr/bin/true\""
+            .parse()
+            .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert_eq!(matched.fs, Some(Explanation::Allowed));
+        assert_eq!(matched.suggestion, Config::empty());
+
+        let record = "blockers=net.connect_tcp daddr=1.1.1.1 dest=443"
+            .parse()
+            .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert!(matched.net.is_empty());
+        assert_eq!(matched.suggestion, Config::empty());
+    }
+
+    #[test]
+    fn test_match_net() {
+        let record = "blockers=net.bind_tcp saddr=127.0.0.1 src=8080"
+            .parse()
+            .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert_eq!(matched.fs, None);
+        assert_eq!(matched.net, AccessNet::BindTcp.into());
+        assert_eq!(
+            suggestion(&matched),
+            r#"{"ruleset":[{"handledAccessNet":["bind_tcp"]}],"netPort":[{"allowedAccess":["bind_tcp"],"port":[8080]}]}"#
+        );
+    }
+
+    #[test]
+    fn test_match_scope_unmatched() {
+        let record =
+            "blockers=scope.signal,fs.change_topology,net.connect_tcp opid=1 ocomm=\"init\""
+                .parse()
+                .unwrap();
+        let matched = resolved().match_audit_record(&record);
+        assert_eq!(matched.scoped, Scope::Signal.into());
+        // The port is unknown without the dest field.
+        assert_eq!(matched.unmatched, ["fs.change_topology", "net.connect_tcp"]);
+        assert_eq!(matched.suggestion, Config::empty());
+    }
+}
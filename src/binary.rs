@@ -0,0 +1,323 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+//! Binary format of resolved configurations, to pass them between processes.
+//!
+//! All integers are little-endian:
+//! * magic (4 bytes) and format version (u16);
+//! * handled filesystem and network access rights, and scopes (u64 each);
+//! * path beneath rules, then mount point rules: count (u64) and, for each
+//!   rule, the path length (u64), the path bytes, and the access rights (u64);
+//! * network port rules: count (u64) and, for each rule, the port and the
+//!   access rights (u64 each);
+//! * since version 2, required paths: count (u64) and, for each path, its
+//!   length (u64) and its bytes;
+//! * since version 2, required ports: count (u64) and each port (u64).
+
+use crate::ResolvedConfig;
+use landlock::{AccessFs, AccessNet, BitFlags, Scope};
+use std::collections::{BTreeMap, BTreeSet};
+use std::ffi::OsStr;
+use std::os::unix::ffi::OsStrExt;
+use std::path::{Path, PathBuf};
+use thiserror::Error;
+
+const MAGIC: &[u8; 4] = b"LLCB";
+
+/// Current version of the binary format.  Any incompatible change to the
+/// format must increment it.
+pub const BINARY_VERSION: u16 = 2;
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum BinaryError {
+    #[error("not a binary Landlock configuration")]
+    InvalidMagic,
+    #[error("unsupported binary format version: {0}")]
+    UnsupportedVersion(u16),
+    #[error("truncated binary configuration")]
+    Truncated,
+    #[error("trailing data after the binary configuration")]
+    TrailingData,
+    #[error("unknown access rights: {0:#x}")]
+    UnknownAccess(u64),
+}
+
+fn write_u64(data: &mut Vec<u8>, value: u64) {
+    data.extend_from_slice(&value.to_le_bytes());
+}
+
+fn write_path(data: &mut Vec<u8>, path: &Path) {
+    let path = path.as_os_str().as_bytes();
+    write_u64(data, path.len() as u64);
+    data.extend_from_slice(path);
+}
+
+fn write_paths(data: &mut Vec<u8>, rules: &BTreeMap<PathBuf, BitFlags<AccessFs>>) {
+    write_u64(data, rules.len() as u64);
+    for (path, access) in rules {
+        write_path(data, path);
+        write_u64(data, access.bits());
+    }
+}
+
+struct Reader<'a>(&'a [u8]);
+
+impl<'a> Reader<'a> {
+    fn bytes(&mut self, len: u64) -> Result<&'a [u8], BinaryError> {
+        let len = usize::try_from(len).map_err(|_| BinaryError::Truncated)?;
+        if self.0.len() < len {
+            return Err(BinaryError::Truncated);
+        }
+        let (bytes, rest) = self.0.split_at(len);
+        self.0 = rest;
+        Ok(bytes)
+    }
+
+    fn u16(&mut self) -> Result<u16, BinaryError> {
+        Ok(u16::from_le_bytes(self.bytes(2)?.try_into().unwrap()))
+    }
+
+    fn u64(&mut self) -> Result<u64, BinaryError> {
+        Ok(u64::from_le_bytes(self.bytes(8)?.try_into().unwrap()))
+    }
+
+    fn access_fs(&mut self) -> Result<BitFlags<AccessFs>, BinaryError> {
+        let bits = self.u64()?;
+        BitFlags::from_bits(bits).map_err(|_| BinaryError::UnknownAccess(bits))
+    }
+
+    fn access_net(&mut self) -> Result<BitFlags<AccessNet>, BinaryError> {
+        let bits = self.u64()?;
+        BitFlags::from_bits(bits).map_err(|_| BinaryError::UnknownAccess(bits))
+    }
+
+    fn scopes(&mut self) -> Result<BitFlags<Scope>, BinaryError> {
+        let bits = self.u64()?;
+        BitFlags::from_bits(bits).map_err(|_| BinaryError::UnknownAccess(bits))
+    }
+
+    fn path(&mut self) -> Result<PathBuf, BinaryError> {
+        let len = self.u64()?;
+        Ok(PathBuf::from(OsStr::from_bytes(self.bytes(len)?)))
+    }
+
+    fn paths(&mut self) -> Result<BTreeMap<PathBuf, BitFlags<AccessFs>>, BinaryError> {
+        let mut rules = BTreeMap::new();
+        for _ in 0..self.u64()? {
+            let path = self.path()?;
+            rules.insert(path, self.access_fs()?);
+        }
+        Ok(rules)
+    }
+}
+
+impl ResolvedConfig {
+    /// Serializes this configuration with a compact and versioned binary
+    /// format, e.g. to send it from a trusted process parsing configurations
+    /// to a sandboxed launcher, which then does not need to parse text.
+    pub fn to_binary(&self) -> Vec<u8> {
+        let mut data = Vec::new();
+        data.extend_from_slice(MAGIC);
+        data.extend_from_slice(&BINARY_VERSION.to_le_bytes());
+        write_u64(&mut data, self.handled_fs.bits());
+        write_u64(&mut data, self.handled_net.bits());
+        write_u64(&mut data, self.scoped.bits());
+        write_paths(&mut data, &self.rules_path_beneath);
+        write_paths(&mut data, &self.rules_mount_point);
+        write_u64(&mut data, self.rules_net_port.len() as u64);
+        for (port, access) in &self.rules_net_port {
+            write_u64(&mut data, *port);
+            write_u64(&mut data, access.bits());
+        }
+        write_u64(&mut data, self.required_paths.len() as u64);
+        for path in &self.required_paths {
+            write_path(&mut data, path);
+        }
+        write_u64(&mut data, self.required_ports.len() as u64);
+        for port in &self.required_ports {
+            write_u64(&mut data, *port);
+        }
+        data
+    }
+
+    /// Deserializes a configuration serialized with
+    /// [`to_binary()`](ResolvedConfig::to_binary).
+    ///
+    /// Versions up to the current [`BINARY_VERSION`] are supported, and
+    /// unknown access rights are rejected.  Version 1 does not have required
+    /// rules.
+    pub fn from_binary(data: &[u8]) -> Result<Self, BinaryError> {
+        let mut reader = Reader(data);
+        if reader.bytes(MAGIC.len() as u64) != Ok(&MAGIC[..]) {
+            return Err(BinaryError::InvalidMagic);
+        }
+        let version = reader.u16()?;
+        if version == 0 || version > BINARY_VERSION {
+            return Err(BinaryError::UnsupportedVersion(version));
+        }
+
+        let handled_fs = reader.access_fs()?;
+        let handled_net = reader.access_net()?;
+        let scoped = reader.scopes()?;
+        let rules_path_beneath = reader.paths()?;
+        let rules_mount_point = reader.paths()?;
+        let mut rules_net_port = BTreeMap::new();
+        for _ in 0..reader.u64()? {
+            let port = reader.u64()?;
+            rules_net_port.insert(port, reader.access_net()?);
+        }
+        let mut required_paths = BTreeSet::new();
+        let mut required_ports = BTreeSet::new();
+        if version >= 2 {
+            for _ in 0..reader.u64()? {
+                required_paths.insert(reader.path()?);
+            }
+            for _ in 0..reader.u64()? {
+                required_ports.insert(reader.u64()?);
+            }
+        }
+        if !reader.0.is_empty() {
+            return Err(BinaryError::TrailingData);
+        }
+
+        Ok(Self {
+            handled_fs,
+            handled_net,
+            scoped,
+            rules_path_beneath,
+            rules_mount_point,
+            rules_net_port,
+            required_paths,
+            required_ports,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    fn config() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/proc" ],
+                        "mountPoint": true
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    // Version 1 serialization of config(), which must stay readable.
+    const CONFIG_V1: &[u8] = b"LLCB\x01\x00\
+        \x05\x00\x00\x00\x00\x00\x00\x00\
+        \x02\x00\x00\x00\x00\x00\x00\x00\
+        \x02\x00\x00\x00\x00\x00\x00\x00\
+        \x01\x00\x00\x00\x00\x00\x00\x00\
+        \x04\x00\x00\x00\x00\x00\x00\x00/usr\x05\x00\x00\x00\x00\x00\x00\x00\
+        \x01\x00\x00\x00\x00\x00\x00\x00\
+        \x05\x00\x00\x00\x00\x00\x00\x00/proc\x04\x00\x00\x00\x00\x00\x00\x00\
+        \x01\x00\x00\x00\x00\x00\x00\x00\
+        \xbb\x01\x00\x00\x00\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00";
+
+    #[test]
+    fn test_round_trip() {
+        let config = config();
+        assert_eq!(ResolvedConfig::from_binary(&config.to_binary()), Ok(config));
+
+        let empty = ResolvedConfig::default();
+        assert_eq!(ResolvedConfig::from_binary(&empty.to_binary()), Ok(empty));
+    }
+
+    #[test]
+    fn test_version_1() {
+        assert_eq!(ResolvedConfig::from_binary(CONFIG_V1), Ok(config()));
+
+        // Version 2 only appends the (empty) required rules.
+        let mut data = CONFIG_V1.to_vec();
+        data[4] = 2;
+        data.extend_from_slice(&[0; 16]);
+        assert_eq!(config().to_binary(), data);
+    }
+
+    #[test]
+    fn test_required() {
+        let mut config = config();
+        config.required_paths.insert("/usr".into());
+        config.required_ports.insert(443);
+        let data = config.to_binary();
+        assert_eq!(ResolvedConfig::from_binary(&data), Ok(config));
+        for len in 4..data.len() {
+            assert_eq!(
+                ResolvedConfig::from_binary(&data[..len]),
+                Err(BinaryError::Truncated)
+            );
+        }
+    }
+
+    #[test]
+    fn test_unsupported_version() {
+        for version in [0, 3] {
+            let mut data = CONFIG_V1.to_vec();
+            data[4] = version;
+            assert_eq!(
+                ResolvedConfig::from_binary(&data),
+                Err(BinaryError::UnsupportedVersion(version.into()))
+            );
+        }
+    }
+
+    #[test]
+    fn test_invalid() {
+        assert_eq!(
+            ResolvedConfig::from_binary(b""),
+            Err(BinaryError::InvalidMagic)
+        );
+        assert_eq!(
+            ResolvedConfig::from_binary(b"{}"),
+            Err(BinaryError::InvalidMagic)
+        );
+        for len in 4..CONFIG_V1.len() {
+            assert_eq!(
+                ResolvedConfig::from_binary(&CONFIG_V1[..len]),
+                Err(BinaryError::Truncated)
+            );
+        }
+
+        let mut data = CONFIG_V1.to_vec();
+        data.push(0);
+        assert_eq!(
+            ResolvedConfig::from_binary(&data),
+            Err(BinaryError::TrailingData)
+        );
+
+        let mut data = CONFIG_V1.to_vec();
+        data[13] = 0x80;
+        assert_eq!(
+            ResolvedConfig::from_binary(&data),
+            Err(BinaryError::UnknownAccess(0x8000_0000_0000_0005))
+        );
+    }
+}
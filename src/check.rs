@@ -0,0 +1,360 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{open_rule_path, ConfigFormat, ParseFileError, ParseOptions};
+use crate::variable::ResolveError;
+use crate::{Config, ParsedConfig, PathResolver, ResolvedConfig};
+use std::collections::BTreeMap;
+use std::io::Read;
+use std::path::Path;
+use thiserror::Error;
+
+/// Analysis run by [`Config::check()`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq, PartialOrd, Ord)]
+#[non_exhaustive]
+pub enum Analysis {
+    /// Suspicious parts of the configuration, see [`Config::warnings()`].
+    Config,
+    /// Rules allowing to both write and execute files (i.e. no W^X), see
+    /// [`ResolvedConfig::write_execute_paths()`].
+    WriteExecute,
+    /// Rule paths which do not exist, and would be ignored when building the
+    /// ruleset.  This is the only analysis accessing the filesystem, which
+    /// opens the paths like the builder does.
+    MissingPath,
+    /// Rules which do not allow more than the rule of an ancestor path, and
+    /// could then be removed.
+    Overlap,
+}
+
+const ANALYSES: [Analysis; 4] = [
+    Analysis::Config,
+    Analysis::WriteExecute,
+    Analysis::MissingPath,
+    Analysis::Overlap,
+];
+
+#[derive(Clone, Copy, Debug, PartialEq, Eq, PartialOrd, Ord)]
+#[non_exhaustive]
+pub enum Severity {
+    Warning,
+    Error,
+}
+
+/// Issue reported by an analysis of [`Config::check()`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Finding {
+    pub analysis: Analysis,
+    pub severity: Severity,
+    pub message: String,
+}
+
+/// Result of [`Config::check()`].
+#[derive(Clone, Debug)]
+#[non_exhaustive]
+pub struct CheckResult {
+    /// Findings sorted by analysis (in the [`Analysis`] order), and then in
+    /// the rule order.
+    pub findings: Vec<Finding>,
+    /// Summary of what the configuration allows, as rendered by
+    /// [`AccessMatrix::to_text()`](crate::AccessMatrix::to_text).
+    pub explanation: String,
+    /// The checked configuration, e.g. to then enforce it.
+    pub config: ResolvedConfig,
+}
+
+impl CheckResult {
+    pub fn errors(&self) -> impl Iterator<Item = &Finding> {
+        self.findings
+            .iter()
+            .filter(|finding| finding.severity == Severity::Error)
+    }
+
+    pub fn warnings(&self) -> impl Iterator<Item = &Finding> {
+        self.findings
+            .iter()
+            .filter(|finding| finding.severity == Severity::Warning)
+    }
+
+    /// Returns whether no finding is an error, e.g. to pass a CI gate.
+    pub fn is_ok(&self) -> bool {
+        self.errors().next().is_none()
+    }
+}
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum CheckError {
+    #[error(transparent)]
+    Parse(#[from] ParseFileError),
+    #[error(transparent)]
+    Resolve(#[from] ResolveError),
+}
+
+/// Options of [`Config::check()`].
+#[derive(Clone, Debug)]
+#[non_exhaustive]
+pub struct CheckOptions {
+    format: ConfigFormat,
+    parse: ParseOptions,
+    resolver: PathResolver,
+    severities: BTreeMap<Analysis, Severity>,
+}
+
+impl Default for CheckOptions {
+    fn default() -> Self {
+        Self {
+            format: ConfigFormat::Json,
+            parse: Default::default(),
+            resolver: Default::default(),
+            severities: ANALYSES
+                .into_iter()
+                .map(|analysis| (analysis, Severity::Warning))
+                .collect(),
+        }
+    }
+}
+
+impl CheckOptions {
+    /// Runs all the analyses, with the [`Severity::Warning`] severity.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the format of the configuration, which is JSON by default.
+    pub fn format(mut self, format: ConfigFormat) -> Self {
+        self.format = format;
+        self
+    }
+
+    pub fn parse_options(mut self, options: ParseOptions) -> Self {
+        self.parse = options;
+        self
+    }
+
+    /// Sets the resolver of the rule paths, which keeps them as is by default.
+    pub fn resolver(mut self, resolver: PathResolver) -> Self {
+        self.resolver = resolver;
+        self
+    }
+
+    /// Sets the severity of the findings of `analysis`, or disables it with
+    /// `None`.
+    pub fn analysis(mut self, analysis: Analysis, severity: Option<Severity>) -> Self {
+        match severity {
+            Some(severity) => self.severities.insert(analysis, severity),
+            None => self.severities.remove(&analysis),
+        };
+        self
+    }
+}
+
+/// Returns the messages of an analysis of `config`.
+fn analyze(analysis: Analysis, config: &Config, resolved: &ResolvedConfig) -> Vec<String> {
+    let grants = resolved.granted_paths();
+    let access_of = |path: &Path| {
+        grants
+            .iter()
+            .find(|grant| grant.path == path)
+            .map(|grant| grant.access)
+            .unwrap_or_default()
+    };
+    match analysis {
+        Analysis::Config => config.warnings().iter().map(ToString::to_string).collect(),
+        Analysis::WriteExecute => resolved
+            .write_execute_paths()
+            .into_iter()
+            .map(|path| format!("{} allows both write_file and execute", path.display()))
+            .collect(),
+        Analysis::MissingPath => resolved
+            .planned_opens()
+            .into_iter()
+            .filter(|open| {
+                open_rule_path(&open.path).is_err_and(|e| {
+                    e.syscall_error(None)
+                        .is_some_and(|e| e.errno() == Some(libc::ENOENT))
+                })
+            })
+            .map(|open| format!("{} does not exist", open.path.display()))
+            .collect(),
+        Analysis::Overlap => grants
+            .iter()
+            .filter_map(|grant| {
+                let parent = grant.inherited_from.as_deref()?;
+                (access_of(parent) == grant.access).then(|| {
+                    format!(
+                        "{} does not allow more than {}",
+                        grant.path.display(),
+                        parent.display()
+                    )
+                })
+            })
+            .collect(),
+    }
+}
+
+impl Config {
+    /// Parses, resolves, and analyzes a configuration, without enforcing it,
+    /// e.g. for a CI gate or an editor plugin.
+    ///
+    /// Only parsing and resolution errors are returned as errors.  Each
+    /// enabled analysis (all by default, see [`CheckOptions::analysis()`])
+    /// then reports its findings with its severity, and the result explains
+    /// what the configuration allows.  Like
+    /// [`granted_paths()`](ResolvedConfig::granted_paths), paths are compared
+    /// lexically, and the running kernel is not queried.
+    pub fn check<R>(mut reader: R, options: &CheckOptions) -> Result<CheckResult, CheckError>
+    where
+        R: Read,
+    {
+        let mut data = Vec::new();
+        reader
+            .read_to_end(&mut data)
+            .map_err(ParseFileError::from)?;
+        let config = ParsedConfig::parse(data, options.format, &options.parse)?.into_config();
+        let resolved = config.clone().resolve_with(&options.resolver)?;
+
+        let mut findings = Vec::new();
+        for (analysis, severity) in &options.severities {
+            findings.extend(
+                analyze(*analysis, &config, &resolved)
+                    .into_iter()
+                    .map(|message| Finding {
+                        analysis: *analysis,
+                        severity: *severity,
+                        message,
+                    }),
+            );
+        }
+        Ok(CheckResult {
+            findings,
+            explanation: resolved.access_matrix().to_text(),
+            config: resolved,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const JSON: &str = r#"{
+        "ruleset": [
+            {
+                "handledAccessNet": [ "connect_tcp" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_dir" ],
+                "parent": [ "/" ]
+            },
+            {
+                "allowedAccess": [ "read_dir" ],
+                "parent": [ "/usr" ]
+            },
+            {
+                "allowedAccess": [ "execute", "write_file" ],
+                "parent": [ "/tmp", "/nonexistent/landlockconfig" ]
+            }
+        ]
+    }"#;
+
+    fn check(options: &CheckOptions) -> CheckResult {
+        Config::check(JSON.as_bytes(), options).unwrap()
+    }
+
+    fn messages(result: &CheckResult, analysis: Analysis) -> Vec<&str> {
+        result
+            .findings
+            .iter()
+            .filter(|finding| finding.analysis == analysis)
+            .map(|finding| finding.message.as_str())
+            .collect()
+    }
+
+    #[test]
+    fn test_check_default() {
+        let result = check(&CheckOptions::new());
+        assert_eq!(messages(&result, Analysis::Config).len(), 1);
+        assert_eq!(
+            messages(&result, Analysis::WriteExecute),
+            [
+                "/nonexistent/landlockconfig allows both write_file and execute",
+                "/tmp allows both write_file and execute",
+            ]
+        );
+        assert_eq!(
+            messages(&result, Analysis::MissingPath),
+            ["/nonexistent/landlockconfig does not exist"]
+        );
+        assert_eq!(
+            messages(&result, Analysis::Overlap),
+            ["/usr does not allow more than /"]
+        );
+
+        // Findings are sorted by analysis, and are warnings by default.
+        assert!(result
+            .findings
+            .windows(2)
+            .all(|pair| pair[0].analysis <= pair[1].analysis));
+        assert_eq!(result.warnings().count(), result.findings.len());
+        assert!(result.is_ok());
+        assert_eq!(result.explanation, result.config.access_matrix().to_text());
+    }
+
+    #[test]
+    fn test_check_write_execute_inherited() {
+        // Only the ancestor allowing both is reported.
+        let json = r#"{
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute", "write_file" ],
+                    "parent": [ "/tmp" ]
+                },
+                {
+                    "allowedAccess": [ "read_file" ],
+                    "parent": [ "/tmp/a" ]
+                }
+            ]
+        }"#;
+        let options = CheckOptions::new().analysis(Analysis::MissingPath, None);
+        let result = Config::check(json.as_bytes(), &options).unwrap();
+        assert_eq!(
+            messages(&result, Analysis::WriteExecute),
+            ["/tmp allows both write_file and execute"]
+        );
+        assert!(messages(&result, Analysis::Overlap).is_empty());
+    }
+
+    #[test]
+    fn test_check_severity() {
+        let options = CheckOptions::new()
+            .analysis(Analysis::WriteExecute, Some(Severity::Error))
+            .analysis(Analysis::MissingPath, None)
+            .analysis(Analysis::Overlap, None);
+        let result = check(&options);
+        assert!(!result.is_ok());
+        assert_eq!(result.errors().count(), 2);
+        assert!(result
+            .errors()
+            .all(|finding| finding.analysis == Analysis::WriteExecute));
+        assert_eq!(result.warnings().count(), 1);
+        assert!(messages(&result, Analysis::MissingPath).is_empty());
+        assert!(messages(&result, Analysis::Overlap).is_empty());
+    }
+
+    #[test]
+    fn test_check_errors() {
+        assert!(matches!(
+            Config::check(&b"{ \"unknown\": [] }"[..], &CheckOptions::new()),
+            Err(CheckError::Parse(ParseFileError::ParseJson(_)))
+        ));
+        let json =
+            r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "${foo}" ] } ] }"#;
+        assert!(matches!(
+            Config::check(json.as_bytes(), &CheckOptions::new()),
+            Err(CheckError::Resolve(ResolveError::VariableNotFound(_)))
+        ));
+    }
+}
@@ -1,16 +1,35 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
-use crate::nonempty::NonEmptyStruct;
-use crate::parser::{JsonConfig, TemplateString, TomlConfig};
-use crate::variable::{NameError, ResolveError, Variables, VecStringIterator};
+use crate::errno::{map_errno, Operation, SyscallError};
+use crate::flags::{FlagsError, RulesetOptions};
+use crate::fragment::{self, FragmentError, DEFAULT_FRAGMENT_DIR};
+use crate::group::{GroupError, Groups};
+use crate::kernel::{self, LazyAbi};
+use crate::mount::MountPoints;
+use crate::nonempty::{NonEmptySet, NonEmptyStruct};
+use crate::parser::{
+    to_access_items, JsonAbi, JsonConfig, JsonNetPort, JsonPathBeneath, JsonPort, JsonRuleLine,
+    JsonRuleset, JsonVariable, JsonWhen, TemplateString, TomlConfig, UnknownAccessError,
+};
+use crate::resolver::PathResolver;
+#[cfg(feature = "schema")]
+use crate::schema::{self, SchemaError};
+use crate::services::{LazyServices, ServiceError};
+use crate::trace::{Phase, Trace};
+use crate::variable::{NameError, ResolveError, ResolveWarning, Variables, VecStringIterator};
 use landlock::{
-    AccessFs, AccessNet, BitFlags, NetPort, PathBeneath, PathFd, PathFdError, Ruleset, RulesetAttr,
-    RulesetCreated, RulesetCreatedAttr, RulesetError, Scope, ABI,
+    Access, AccessFs, AccessNet, BitFlags, NetPort, PathBeneath, PathFd, PathFdError,
+    RestrictionStatus, Ruleset, RulesetAttr, RulesetCreated, RulesetCreatedAttr, RulesetError,
+    Scope, ABI,
 };
-use std::collections::BTreeMap;
+use serde::{Serialize, Serializer};
+use std::collections::{BTreeMap, BTreeSet};
+use std::ffi::{OsStr, OsString};
 use std::fs::{self, File};
 use std::num::TryFromIntError;
+use std::os::unix::io::{AsFd, BorrowedFd, OwnedFd};
 use std::path::{Path, PathBuf};
+use std::sync::Arc;
 use thiserror::Error;
 
 #[derive(Debug, Error)]
@@ -22,6 +41,73 @@ pub enum BuildRulesetError {
     Integer(#[from] TryFromIntError),
     #[error(transparent)]
     Ruleset(#[from] RulesetError),
+    /// The kernel refused the ruleset because it exceeds one of its limits
+    /// (`E2BIG`), e.g. enforcing it would nest more than 16 layers.
+    #[error("ruleset exceeds a kernel limit{}: {source}", rule_index(.rule))]
+    RulesetTooLarge {
+        /// Index of the rule being added, if any.
+        rule: Option<usize>,
+        source: std::io::Error,
+    },
+    /// The kernel refused some access rights (`EINVAL`), e.g. bits it does not
+    /// define, or a rule allowing access rights not handled by the ruleset.
+    #[error("unsupported access rights{}: {source}", rule_index(.rule))]
+    UnsupportedAccess {
+        /// Index of the rule being added, if any.
+        rule: Option<usize>,
+        source: std::io::Error,
+    },
+    /// The kernel refused an operation for another known reason (e.g.
+    /// `EPERM`), see [`SyscallError`].
+    #[error(transparent)]
+    Syscall(#[from] SyscallError),
+    /// The system call flags are unknown or not supported by the running
+    /// kernel, see [`RulesetOptions`].
+    #[error(transparent)]
+    Flags(#[from] FlagsError),
+    /// A required rule cannot be added (e.g. its path cannot be opened).
+    #[error("required rule: {0}")]
+    RequiredRule(#[source] RuleError),
+    /// A required rule allows access rights not supported by the running
+    /// kernel.
+    #[error("required rule for {} allows unsupported access rights: {access:?}", .path.display())]
+    RequiredFsAccess {
+        path: PathBuf,
+        access: BitFlags<AccessFs>,
+    },
+    /// A required rule allows access rights not supported by the running
+    /// kernel.
+    #[error("required rule for port {port} allows unsupported access rights: {access:?}")]
+    RequiredNetAccess {
+        port: u64,
+        access: BitFlags<AccessNet>,
+    },
+}
+
+pub(crate) fn rule_index(rule: &Option<usize>) -> String {
+    rule.map(|i| format!(" for rule {i}")).unwrap_or_default()
+}
+
+impl BuildRulesetError {
+    /// Maps the kernel errors of `op` to their own variants, see
+    /// [`map_errno()`].
+    ///
+    /// Rules are indexed in the order they are added: path beneath rules,
+    /// mount point rules, and then network port rules, each sorted by path or
+    /// port.
+    fn from_ruleset(op: Operation, error: RulesetError, rule: Option<usize>) -> Self {
+        let mut source: Option<&(dyn std::error::Error + 'static)> = Some(&error);
+        while let Some(e) = source {
+            if let Some(e) = e.downcast_ref::<std::io::Error>() {
+                match map_errno(op, e, rule) {
+                    Some(mapped) => return mapped,
+                    None => break,
+                }
+            }
+            source = e.source();
+        }
+        Self::Ruleset(error)
+    }
 }
 
 #[cfg_attr(test, derive(Default))]
@@ -35,7 +121,70 @@ pub struct Config {
     pub(crate) handled_net: BitFlags<AccessNet>,
     pub(crate) scoped: BitFlags<Scope>,
     pub(crate) rules_path_beneath: BTreeMap<TemplateString, BitFlags<AccessFs>>,
+    /// Rules applied to the mount point containing each path.
+    pub(crate) rules_mount_point: BTreeMap<TemplateString, BitFlags<AccessFs>>,
     pub(crate) rules_net_port: BTreeMap<u64, BitFlags<AccessNet>>,
+    /// Paths (of path beneath or mount point rules) and ports of the rules
+    /// that must be fully enforced.
+    pub(crate) required_paths: BTreeSet<TemplateString>,
+    pub(crate) required_ports: BTreeSet<u64>,
+    /// Handled network access rights may be denied for all ports.
+    pub(crate) allow_none: bool,
+    /// Rules of the `when` blocks, only added when resolving the
+    /// configuration for a matching kernel.
+    pub(crate) when: Vec<ConditionalRules>,
+}
+
+/// Rules of a `when` block, and the inclusive range of Landlock ABI versions
+/// for which they are added.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub(crate) struct ConditionalRules {
+    pub(crate) min_abi: Option<JsonAbi>,
+    pub(crate) max_abi: Option<JsonAbi>,
+    pub(crate) rules: Config,
+}
+
+impl ConditionalRules {
+    fn matches(&self, kernel_abi: i32) -> bool {
+        self.min_abi.is_none_or(|min| i32::from(min) <= kernel_abi)
+            && self.max_abi.is_none_or(|max| kernel_abi <= max.into())
+    }
+
+    /// Restricts the range to the versions up to `max_abi`, which are the only
+    /// ones a capped configuration can be evaluated against.  Returns false if
+    /// the rules can then never be added.
+    fn cap(&mut self, max_abi: i32) -> bool {
+        if self.min_abi.is_some_and(|min| max_abi < min.into()) {
+            return false;
+        }
+        // Any kernel newer than max_abi is then handled as max_abi.
+        if self.max_abi.is_none_or(|max| max_abi <= max.into()) {
+            self.max_abi = None;
+        }
+        true
+    }
+
+    /// Returns the rules added for the versions matching both `self` and
+    /// `other`, composed together.
+    fn intersect(&self, other: &Self) -> Option<Self> {
+        let min_abi = self.min_abi.max(other.min_abi);
+        let max_abi = match (self.max_abi, other.max_abi) {
+            (Some(a), Some(b)) => Some(a.min(b)),
+            (a, b) => a.or(b),
+        };
+        if let (Some(min), Some(max)) = (min_abi, max_abi) {
+            if max < min {
+                return None;
+            }
+        }
+        let mut rules = self.rules.clone();
+        rules.compose(&other.rules);
+        Some(Self {
+            min_abi,
+            max_abi,
+            rules,
+        })
+    }
 }
 
 #[cfg_attr(test, derive(Default))]
@@ -49,21 +198,290 @@ pub struct ResolvedConfig {
     // * the paths are sorted (the longest path is the last one), which makes configurations deterministic and idempotent.
     // Thanks to PathBuf, paths are normalized.
     pub(crate) rules_path_beneath: BTreeMap<PathBuf, BitFlags<AccessFs>>,
+    // Mount points can only be found when building the ruleset, with the
+    // current mount namespace.
+    pub(crate) rules_mount_point: BTreeMap<PathBuf, BitFlags<AccessFs>>,
     pub(crate) rules_net_port: BTreeMap<u64, BitFlags<AccessNet>>,
+    pub(crate) required_paths: BTreeSet<PathBuf>,
+    pub(crate) required_ports: BTreeSet<u64>,
 }
 
 #[derive(Debug, Error)]
 pub enum ConfigError {
+    #[error(transparent)]
+    Fragment(#[from] FragmentError),
+    #[error(transparent)]
+    Group(#[from] GroupError),
     #[error(transparent)]
     Name(#[from] NameError),
     #[error(transparent)]
     Resolve(#[from] ResolveError),
+    #[error(transparent)]
+    Service(#[from] ServiceError),
+    #[error("unknown profile: {0}")]
+    UnknownProfile(String),
+    #[error("no allowedAccess nor defaultAccess for the path beneath rule of: {0}")]
+    MissingAccess(String),
+    #[error("default access rights not handled by the ruleset: {0:?}")]
+    UnhandledDefaultAccess(BitFlags<AccessFs>),
+    #[error("invalid {MAX_ABI_ENV} value: {0}")]
+    InvalidMaxAbi(String),
 }
 
-impl TryFrom<NonEmptyStruct<JsonConfig>> for Config {
-    type Error = ConfigError;
+/// Environment variable capping the Landlock ABI version of parsed
+/// configurations, only read if [`ParseOptions::max_abi_from_env()`] is
+/// enabled.
+pub const MAX_ABI_ENV: &str = "LANDLOCKCONFIG_MAX_ABI";
+
+/// Suspicious but valid part of a configuration, see [`Config::warnings()`].
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum ConfigWarning {
+    /// These handled network access rights are denied for all ports because
+    /// no network port rule allows them, which might come from a forgotten
+    /// rule.  Setting `allowNone` in a ruleset acknowledges it.
+    #[error("network access rights denied for all ports (no rule allows them): {0:?}")]
+    NoNetPortRule(BitFlags<AccessNet>),
+    /// `bind_tcp` is allowed on a port usually only connected to (see
+    /// [`Config::net_port_warnings()`]), which might come from a rule meant
+    /// for `connect_tcp`.
+    #[error("bind_tcp allowed on the client port {0}")]
+    BindClientPort(u64),
+    /// Both `bind_tcp` and `connect_tcp` are allowed on this port, which
+    /// might come from rules with different intents for the same port.
+    #[error("both bind_tcp and connect_tcp allowed on port {0}")]
+    BindAndConnect(u64),
+}
+
+/// Ports of common protocols for which a sandboxed program is usually a
+/// client, see [`Config::net_port_warnings()`].
+pub const DEFAULT_CLIENT_PORTS: &[u16] = &[
+    20, 21, 22, 23, 25, 53, 80, 110, 143, 443, 465, 587, 853, 993, 995,
+];
+
+/// Line separating TOML documents parsed by [`Config::parse_toml_multi()`].
+#[cfg(feature = "toml")]
+const TOML_SEPARATOR: &str = "---";
+
+/// Kind of restrictions of a configuration, see
+/// [`ResolvedConfig::retain()`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum Restriction {
+    /// Handled filesystem access rights, and path beneath and mount point
+    /// rules.
+    Fs,
+    /// Handled network access rights, and network port rules.
+    Net,
+    /// Scopes.
+    Scope,
+}
+
+/// Options to tune the parsing of configurations.
+#[derive(Clone, Debug, Default)]
+#[non_exhaustive]
+pub struct ParseOptions {
+    kernel_abi: Option<i32>,
+    fragment_dirs: Option<Vec<PathBuf>>,
+    #[cfg(feature = "schema")]
+    validate_schema: bool,
+    profile: Option<String>,
+    trace: Option<Arc<Trace>>,
+    services_file: Option<PathBuf>,
+    json_last_key_wins: bool,
+    include_tags: Option<BTreeSet<String>>,
+    exclude_tags: BTreeSet<String>,
+    max_abi_from_env: bool,
+    // Replaces the process environment in tests, which must not call
+    // std::env::set_var() while other tests read the environment.
+    env: Option<BTreeMap<OsString, OsString>>,
+    pub(crate) retain_source: bool,
+    // Fragments being included, to detect cycles.
+    fragments: Vec<String>,
+}
+
+impl ParseOptions {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the Landlock ABI version against which the `*` access right is
+    /// resolved, instead of the one supported by the running kernel.  `when`
+    /// blocks are evaluated when resolving, see [`PathResolver::kernel_abi()`].
+    pub fn kernel_abi(mut self, abi: ABI) -> Self {
+        self.kernel_abi = Some(abi as i32);
+        self
+    }
+
+    /// Sets the directories where included fragments are looked for, in
+    /// order, instead of [`DEFAULT_FRAGMENT_DIR`].
+    pub fn fragment_dirs<I, P>(mut self, dirs: I) -> Self
+    where
+        I: IntoIterator<Item = P>,
+        P: Into<PathBuf>,
+    {
+        self.fragment_dirs = Some(dirs.into_iter().map(Into::into).collect());
+        self
+    }
+
+    /// Selects the profile whose rules are added to the other ones.  Parsing
+    /// fails if the configuration does not define this profile.
+    pub fn profile<S>(mut self, name: S) -> Self
+    where
+        S: Into<String>,
+    {
+        self.profile = Some(name.into());
+        self
+    }
+
+    /// Only applies the rules with at least one of these tags, instead of all
+    /// the rules.  Untagged rules are then not applied.
+    ///
+    /// Tags are filtered while parsing, in fragments too.  Excluded tags take
+    /// precedence: a rule with both an included and an excluded tag is not
+    /// applied.  Filtered rules still handle their access rights, so
+    /// filtering rules never allows more.
+    pub fn include_tags<I, S>(mut self, tags: I) -> Self
+    where
+        I: IntoIterator<Item = S>,
+        S: Into<String>,
+    {
+        self.include_tags = Some(tags.into_iter().map(Into::into).collect());
+        self
+    }
+
+    /// Does not apply the rules with any of these tags, e.g. to skip the rules
+    /// tagged `debug` in production.  See
+    /// [`include_tags()`](ParseOptions::include_tags).
+    pub fn exclude_tags<I, S>(mut self, tags: I) -> Self
+    where
+        I: IntoIterator<Item = S>,
+        S: Into<String>,
+    {
+        self.exclude_tags = tags.into_iter().map(Into::into).collect();
+        self
+    }
+
+    /// Returns whether a rule with these tags is applied.
+    fn applies(&self, tags: Option<&NonEmptySet<String>>) -> bool {
+        let mut tags = tags.into_iter().flat_map(|tags| tags.iter());
+        if tags.clone().any(|tag| self.exclude_tags.contains(tag)) {
+            return false;
+        }
+        match &self.include_tags {
+            Some(include) => tags.any(|tag| include.contains(tag)),
+            None => true,
+        }
+    }
+
+    /// Caps the Landlock ABI version to the one set in the [`MAX_ABI_ENV`]
+    /// environment variable (e.g. `LANDLOCKCONFIG_MAX_ABI=2`), if any, to
+    /// simulate an older kernel in tests: `when` blocks are only kept for the
+    /// versions up to this one, and the parsed configuration is then
+    /// [downgraded](Config::downgrade) to it.  An
+    /// invalid value fails the parsing.
+    ///
+    /// This is disabled by default, and must only be enabled by test builds or
+    /// test tools: the environment of a process is often controlled by less
+    /// trusted parties, and this variable can only weaken the sandbox (e.g.
+    /// `0` drops all the restrictions).
+    pub fn max_abi_from_env(mut self, enable: bool) -> Self {
+        self.max_abi_from_env = enable;
+        self
+    }
+
+    /// Returns the ABI version of [`MAX_ABI_ENV`], if enabled and set.
+    fn max_abi(&self) -> Result<Option<i32>, ConfigError> {
+        if !self.max_abi_from_env {
+            return Ok(None);
+        }
+        let value = match &self.env {
+            Some(env) => env.get(OsStr::new(MAX_ABI_ENV)).cloned(),
+            None => std::env::var_os(MAX_ABI_ENV),
+        };
+        let Some(value) = value else {
+            return Ok(None);
+        };
+        let value = value.to_string_lossy();
+        match value.parse::<u8>() {
+            Ok(abi) => Ok(Some(abi.into())),
+            Err(_) => Err(ConfigError::InvalidMaxAbi(value.into_owned())),
+        }
+    }
+
+    #[cfg(test)]
+    pub(crate) fn env<I, K, V>(mut self, vars: I) -> Self
+    where
+        I: IntoIterator<Item = (K, V)>,
+        K: Into<OsString>,
+        V: Into<OsString>,
+    {
+        self.env = Some(
+            vars.into_iter()
+                .map(|(k, v)| (k.into(), v.into()))
+                .collect(),
+        );
+        self
+    }
+
+    /// Sets the services database used to resolve service names of network
+    /// port rules (see services(5)), instead of `/etc/services`, e.g. for
+    /// hermetic tests.
+    pub fn services_file<P>(mut self, path: P) -> Self
+    where
+        P: Into<PathBuf>,
+    {
+        self.services_file = Some(path.into());
+        self
+    }
+
+    /// Accepts duplicate keys in JSON objects, the last one overriding the
+    /// previous ones, e.g. for generated configurations.
+    ///
+    /// By default, duplicate keys are rejected, with their location, because
+    /// they are likely mistakes (e.g. two `handledAccessFs` in the same
+    /// ruleset).  TOML forbids them whatever this option.  When enabled, errors
+    /// about the configuration content lose their location.
+    pub fn json_last_key_wins(mut self, enable: bool) -> Self {
+        self.json_last_key_wins = enable;
+        self
+    }
+
+    /// Keeps the original data of configurations parsed with
+    /// [`ParsedConfig`](crate::ParsedConfig), to get it with
+    /// [`ParsedConfig::raw_source()`](crate::ParsedConfig::raw_source).  This
+    /// is disabled by default because it keeps a copy of each configuration in
+    /// memory.
+    pub fn retain_source(mut self, enable: bool) -> Self {
+        self.retain_source = enable;
+        self
+    }
+
+    /// Records the time spent reading and parsing configuration files in
+    /// `trace`.  Files are then read at once before being parsed.
+    pub fn trace(mut self, trace: Arc<Trace>) -> Self {
+        self.trace = Some(trace);
+        self
+    }
+
+    /// Validates JSON configurations against the embedded [`JSON_SCHEMA`]
+    /// before parsing them.  The first violation is then returned as a
+    /// [`SchemaError`] pointing to the invalid value.
+    ///
+    /// [`JSON_SCHEMA`]: crate::JSON_SCHEMA
+    #[cfg(feature = "schema")]
+    pub fn validate_schema(mut self, validate: bool) -> Self {
+        self.validate_schema = validate;
+        self
+    }
+}
 
-    fn try_from(json: NonEmptyStruct<JsonConfig>) -> Result<Self, Self::Error> {
+impl Config {
+    fn try_from_json(
+        json: NonEmptyStruct<JsonConfig>,
+        options: &ParseOptions,
+        format: ConfigFormat,
+    ) -> Result<Self, ConfigError> {
         let mut config = Self::empty();
         let json = json.into_inner();
 
@@ -76,37 +494,248 @@ impl TryFrom<NonEmptyStruct<JsonConfig>> for Config {
             config.variables.extend(name, literal);
         }
 
-        for ruleset in json.ruleset.unwrap_or_default() {
+        // Groups are expanded while parsing, where they are used, and are then
+        // only visible to this configuration.
+        let groups = Groups::new(json.group.unwrap_or_default())?;
+
+        // Only read the services database if a service name is used.
+        let mut services = LazyServices::new(options.services_file.as_deref());
+        let max_abi = options.max_abi()?;
+        let mut kernel_abi = LazyAbi::new(options.kernel_abi).max(max_abi);
+
+        // The default access rights of the top-level rulesets apply to all the
+        // rules of this configuration (but not to its fragments).
+        let default_access = config.add_rules(
+            json.ruleset.unwrap_or_default(),
+            json.pathBeneath
+                .unwrap_or_default()
+                .into_iter()
+                .chain(groups.expand(json.r#use.unwrap_or_default())?)
+                .collect(),
+            json.netPort.unwrap_or_default(),
+            None,
+            &mut services,
+            &mut kernel_abi,
+            options,
+        )?;
+
+        // Conditions are only evaluated when resolving the configuration, but
+        // their rules are checked now, with the same default access rights.
+        for when in json.when.unwrap_or_default() {
+            let when = when.into_inner();
+            let mut rules = Self::empty();
+            rules.abi = config.abi;
+            rules.add_rules(
+                when.ruleset.unwrap_or_default(),
+                when.pathBeneath
+                    .unwrap_or_default()
+                    .into_iter()
+                    .chain(groups.expand(when.r#use.unwrap_or_default())?)
+                    .collect(),
+                when.netPort.unwrap_or_default(),
+                default_access,
+                &mut services,
+                &mut kernel_abi,
+                options,
+            )?;
+            config.when.push(ConditionalRules {
+                min_abi: when.minAbi,
+                max_abi: when.maxAbi,
+                rules,
+            });
+        }
+
+        // Like groups, all the profiles must only use known groups, but only the
+        // selected one is then handled like the other rules.
+        let mut profile_found = false;
+        for profile in json.profile.unwrap_or_default() {
+            let profile = profile.into_inner();
+            let path_beneath = profile
+                .pathBeneath
+                .unwrap_or_default()
+                .into_iter()
+                .chain(groups.expand(profile.r#use.unwrap_or_default())?)
+                .collect();
+            if options.profile.as_ref() == Some(&profile.name) {
+                profile_found = true;
+                config.add_rules(
+                    profile.ruleset.unwrap_or_default(),
+                    path_beneath,
+                    profile.netPort.unwrap_or_default(),
+                    default_access,
+                    &mut services,
+                    &mut kernel_abi,
+                    options,
+                )?;
+            }
+        }
+        if let (Some(name), false) = (&options.profile, profile_found) {
+            return Err(ConfigError::UnknownProfile(name.clone()));
+        }
+
+        // Fragments are parsed on their own, and their rules are then merged
+        // with the others.
+        for name in json.includeFragment.unwrap_or_default() {
+            config.merge(Self::parse_fragment(&name, options, format)?);
+        }
+
+        if let Some(max_abi) = max_abi {
+            config.when.retain_mut(|when| when.cap(max_abi));
+            config.downgrade(max_abi.into());
+        }
+        Ok(config)
+    }
+
+    fn parse_fragment(
+        name: &str,
+        options: &ParseOptions,
+        format: ConfigFormat,
+    ) -> Result<Self, FragmentError> {
+        if let Some(start) = options.fragments.iter().position(|n| n == name) {
+            let mut cycle = options.fragments[start..].to_vec();
+            cycle.push(name.into());
+            return Err(FragmentError::Cycle(cycle));
+        }
+
+        let path = match &options.fragment_dirs {
+            Some(dirs) => fragment::find(name, dirs, format)?,
+            None => fragment::find(name, &[DEFAULT_FRAGMENT_DIR.into()], format)?,
+        };
+        let mut options = options.clone();
+        options.fragments.push(name.into());
+        // Profiles are only selected in the including configuration.
+        options.profile = None;
+        // Fragments are accounted in the parsing of the including file.
+        options.trace = None;
+        Self::parse_file_with(path, format, &options).map_err(|e| FragmentError::Parse {
+            name: name.into(),
+            source: Box::new(e),
+        })
+    }
+
+    /// Adds the handled access rights, the rules, and the variables of `other`
+    /// as if they were defined in this configuration.
+    fn merge(&mut self, other: Self) {
+        self.handled_fs |= other.handled_fs;
+        self.handled_net |= other.handled_net;
+        self.scoped |= other.scoped;
+        for (parent, access) in other.rules_path_beneath {
+            self.rules_path_beneath
+                .entry(parent)
+                .and_modify(|a| *a |= access)
+                .or_insert(access);
+        }
+        for (parent, access) in other.rules_mount_point {
+            self.rules_mount_point
+                .entry(parent)
+                .and_modify(|a| *a |= access)
+                .or_insert(access);
+        }
+        for (port, access) in other.rules_net_port {
+            self.rules_net_port
+                .entry(port)
+                .and_modify(|a| *a |= access)
+                .or_insert(access);
+        }
+        self.required_paths.extend(other.required_paths);
+        self.required_ports.extend(other.required_ports);
+        for (name, value) in other.variables.iter() {
+            self.variables.extend(name.clone(), value.clone());
+        }
+        self.when.extend(other.when);
+    }
+
+    /// Adds the rulesets and the rules of a block, with `default_access`
+    /// extended by the `defaultAccess` of its rulesets for the path beneath
+    /// rules without `allowedAccess`.  Returns the extended default access
+    /// rights.
+    #[allow(clippy::too_many_arguments)]
+    fn add_rules(
+        &mut self,
+        rulesets: NonEmptySet<NonEmptyStruct<JsonRuleset>>,
+        path_beneaths: NonEmptySet<JsonPathBeneath>,
+        net_ports: NonEmptySet<JsonNetPort>,
+        mut default_access: Option<BitFlags<AccessFs>>,
+        services: &mut LazyServices,
+        kernel_abi: &mut LazyAbi,
+        options: &ParseOptions,
+    ) -> Result<Option<BitFlags<AccessFs>>, ConfigError> {
+        let mut explicit_fs = None;
+        let mut block_default = None;
+        for ruleset in rulesets {
             let ruleset = ruleset.into_inner();
-            config.handled_fs |= ruleset
+            let handled_fs = ruleset
                 .handledAccessFs
-                .map(|access| access.resolve_bitflags(config.abi))
-                .transpose()?
-                .unwrap_or_default();
-            config.handled_net |= ruleset
+                .map(|access| access.resolve_bitflags(self.abi, kernel_abi))
+                .transpose()?;
+            if let Some(handled_fs) = handled_fs {
+                *explicit_fs.get_or_insert(BitFlags::EMPTY) |= handled_fs;
+            }
+            self.handled_fs |= handled_fs.unwrap_or_default();
+            if let Some(access) = ruleset.defaultAccess {
+                *block_default.get_or_insert(BitFlags::EMPTY) |=
+                    access.resolve_bitflags(self.abi, kernel_abi)?;
+            }
+            self.handled_net |= ruleset
                 .handledAccessNet
-                .map(|access| access.resolve_bitflags(config.abi))
+                .map(|access| access.resolve_bitflags(self.abi))
                 .transpose()?
                 .unwrap_or_default();
-            config.scoped |= ruleset
+            self.scoped |= ruleset
                 .scoped
-                .map(|scoped| scoped.resolve_bitflags(config.abi))
+                .map(|scoped| scoped.resolve_bitflags(self.abi))
                 .transpose()?
                 .unwrap_or_default();
+            self.allow_none |= ruleset.allowNone.unwrap_or_default();
+        }
+        // Default access rights must be handled if the handled ones are
+        // listed, otherwise they are handled like the rules' ones.
+        if let (Some(handled_fs), Some(block_default)) = (explicit_fs, block_default) {
+            let unhandled = block_default & !handled_fs;
+            if !unhandled.is_empty() {
+                return Err(ConfigError::UnhandledDefaultAccess(unhandled));
+            }
+        }
+        if let Some(block_default) = block_default {
+            *default_access.get_or_insert(BitFlags::EMPTY) |= block_default;
         }
 
-        for path_beneath in json.pathBeneath.unwrap_or_default() {
-            let access = path_beneath.allowedAccess.resolve_bitflags(config.abi)?;
+        for path_beneath in path_beneaths {
+            let access = match (path_beneath.allowedAccess, default_access) {
+                (Some(access), _) => access.resolve_bitflags(self.abi, kernel_abi)?,
+                (None, Some(access)) => access,
+                (None, None) => {
+                    return Err(ConfigError::MissingAccess(
+                        path_beneath
+                            .parent
+                            .iter()
+                            .map(ToString::to_string)
+                            .collect::<Vec<_>>()
+                            .join(", "),
+                    ))
+                }
+            };
 
             // It is possible to have rules with empty access because of empty
             // access group resolution.
             if !access.is_empty() {
                 // Automatically augment and keep the ruleset consistent.
-                config.handled_fs |= access;
+                self.handled_fs |= access;
+                if !options.applies(path_beneath.tag.as_ref()) {
+                    continue;
+                }
 
+                let rules = if path_beneath.mountPoint.unwrap_or_default() {
+                    &mut self.rules_mount_point
+                } else {
+                    &mut self.rules_path_beneath
+                };
+                let required = path_beneath.required.unwrap_or_default();
                 for parent in path_beneath.parent {
-                    config
-                        .rules_path_beneath
+                    if required {
+                        self.required_paths.insert(parent.clone());
+                    }
+                    rules
                         .entry(parent)
                         .and_modify(|a| *a |= access)
                         .or_insert(access);
@@ -114,18 +743,33 @@ impl TryFrom<NonEmptyStruct<JsonConfig>> for Config {
             }
         }
 
-        for net_port in json.netPort.unwrap_or_default() {
-            let access = net_port.allowedAccess.resolve_bitflags(config.abi)?;
+        for net_port in net_ports {
+            let access = net_port.allowedAccess.resolve_bitflags(self.abi)?;
+
+            // Always resolve service names to catch unknown ones.
+            let mut ports = Vec::with_capacity(net_port.port.len());
+            for port in net_port.port {
+                ports.push(match port {
+                    JsonPort::Number(port) => port,
+                    JsonPort::Name(name) => services.tcp_port(&name)?.into(),
+                });
+            }
 
             // It is possible to have rules with empty access because of empty
             // access group resolution.
             if !access.is_empty() {
                 // Automatically augment and keep the ruleset consistent.
-                config.handled_net |= access;
+                self.handled_net |= access;
+                if !options.applies(net_port.tag.as_ref()) {
+                    continue;
+                }
 
-                for port in net_port.port {
-                    config
-                        .rules_net_port
+                let required = net_port.required.unwrap_or_default();
+                for port in ports {
+                    if required {
+                        self.required_ports.insert(port);
+                    }
+                    self.rules_net_port
                         .entry(port)
                         .and_modify(|a| *a |= access)
                         .or_insert(access);
@@ -133,7 +777,232 @@ impl TryFrom<NonEmptyStruct<JsonConfig>> for Config {
             }
         }
 
-        Ok(config)
+        Ok(default_access)
+    }
+}
+
+#[derive(Debug, Error)]
+pub(crate) enum SerializeError {
+    #[error(transparent)]
+    UnknownAccess(#[from] UnknownAccessError),
+    #[error("path is not valid UTF-8: {}", .0.display())]
+    NonUtf8Path(PathBuf),
+}
+
+#[allow(clippy::too_many_arguments)]
+fn to_json_config<P>(
+    abi: Option<ABI>,
+    variables: &Variables,
+    handled_fs: BitFlags<AccessFs>,
+    handled_net: BitFlags<AccessNet>,
+    scoped: BitFlags<Scope>,
+    rules_path_beneath: P,
+    rules_mount_point: P,
+    rules_net_port: &BTreeMap<u64, BitFlags<AccessNet>>,
+    required_paths: &BTreeSet<TemplateString>,
+    required_ports: &BTreeSet<u64>,
+    allow_none: bool,
+) -> Result<JsonConfig, SerializeError>
+where
+    P: IntoIterator<Item = (TemplateString, BitFlags<AccessFs>)>,
+{
+    let variable = variables
+        .iter()
+        .map(|(name, literal)| JsonVariable {
+            name: name.to_string(),
+            literal: NonEmptySet::new(literal.clone()),
+        })
+        .collect();
+
+    let ruleset = NonEmptyStruct::new(JsonRuleset {
+        handledAccessFs: to_access_items(handled_fs)?,
+        handledAccessNet: to_access_items(handled_net)?,
+        scoped: to_access_items(scoped)?,
+        allowNone: allow_none.then_some(true),
+        defaultAccess: None,
+    })
+    .map(|ruleset| [ruleset].into_iter().collect());
+
+    // Groups rules with the same access rights, and required or not, for
+    // conciseness.
+    let mut path_beneath = BTreeSet::new();
+    for (rules, mount_point) in [(rules_path_beneath, None), (rules_mount_point, Some(true))] {
+        let mut parents: BTreeMap<(u64, bool), (BitFlags<AccessFs>, BTreeSet<TemplateString>)> =
+            Default::default();
+        for (parent, access) in rules {
+            parents
+                .entry((access.bits(), required_paths.contains(&parent)))
+                .or_insert_with(|| (access, Default::default()))
+                .1
+                .insert(parent);
+        }
+        for ((_, required), (access, parent)) in parents {
+            if let (Some(allowed_access), Some(parent)) =
+                (to_access_items(access)?, NonEmptySet::new(parent))
+            {
+                path_beneath.insert(JsonPathBeneath {
+                    allowedAccess: Some(allowed_access),
+                    parent,
+                    mountPoint: mount_point,
+                    required: required.then_some(true),
+                    tag: None,
+                });
+            }
+        }
+    }
+
+    let mut ports: BTreeMap<(u64, bool), (BitFlags<AccessNet>, BTreeSet<JsonPort>)> =
+        Default::default();
+    for (port, access) in rules_net_port {
+        ports
+            .entry((access.bits(), required_ports.contains(port)))
+            .or_insert_with(|| (*access, Default::default()))
+            .1
+            .insert(JsonPort::Number(*port));
+    }
+    let mut net_port = BTreeSet::new();
+    for ((_, required), (access, port)) in ports {
+        if let (Some(allowed_access), Some(port)) =
+            (to_access_items(access)?, NonEmptySet::new(port))
+        {
+            net_port.insert(JsonNetPort {
+                allowedAccess: allowed_access,
+                port,
+                required: required.then_some(true),
+                tag: None,
+            });
+        }
+    }
+
+    Ok(JsonConfig {
+        abi: abi.map(Into::into),
+        variable: NonEmptySet::new(variable),
+        group: None,
+        ruleset,
+        pathBeneath: NonEmptySet::new(path_beneath),
+        netPort: NonEmptySet::new(net_port),
+        when: None,
+        profile: None,
+        r#use: None,
+        includeFragment: None,
+    })
+}
+
+impl TryFrom<&Config> for JsonConfig {
+    type Error = SerializeError;
+
+    fn try_from(config: &Config) -> Result<Self, Self::Error> {
+        let rules = |rules: &BTreeMap<TemplateString, BitFlags<AccessFs>>| {
+            rules
+                .iter()
+                .map(|(parent, access)| (parent.clone(), *access))
+                .collect::<Vec<_>>()
+        };
+        to_json_config(
+            config.abi,
+            &config.variables,
+            config.handled_fs,
+            config.handled_net,
+            config.scoped,
+            rules(&config.rules_path_beneath),
+            rules(&config.rules_mount_point),
+            &config.rules_net_port,
+            &config.required_paths,
+            &config.required_ports,
+            config.allow_none,
+        )
+        .and_then(|json| {
+            let mut when = BTreeSet::new();
+            for conditional in &config.when {
+                let rules = JsonConfig::try_from(&conditional.rules)?;
+                // Blocks without any rule left (e.g. after a composition) are
+                // dropped.
+                when.extend(NonEmptyStruct::new(JsonWhen {
+                    minAbi: conditional.min_abi,
+                    maxAbi: conditional.max_abi,
+                    ruleset: rules.ruleset,
+                    pathBeneath: rules.pathBeneath,
+                    netPort: rules.netPort,
+                    r#use: None,
+                }));
+            }
+            Ok(JsonConfig {
+                when: NonEmptySet::new(when),
+                ..json
+            })
+        })
+    }
+}
+
+impl TryFrom<&ResolvedConfig> for JsonConfig {
+    type Error = SerializeError;
+
+    fn try_from(config: &ResolvedConfig) -> Result<Self, Self::Error> {
+        let rules = |rules: &BTreeMap<PathBuf, BitFlags<AccessFs>>| {
+            rules
+                .iter()
+                .map(|(parent, access)| match parent.to_str() {
+                    Some(parent) => Ok((TemplateString::from_text(parent), *access)),
+                    None => Err(SerializeError::NonUtf8Path(parent.clone())),
+                })
+                .collect::<Result<Vec<_>, _>>()
+        };
+        // Paths that are not valid UTF-8 are reported with their rules.
+        let required_paths = config
+            .required_paths
+            .iter()
+            .filter_map(|path| path.to_str().map(TemplateString::from_text))
+            .collect();
+        to_json_config(
+            None,
+            &Default::default(),
+            config.handled_fs,
+            config.handled_net,
+            config.scoped,
+            rules(&config.rules_path_beneath)?,
+            rules(&config.rules_mount_point)?,
+            &config.rules_net_port,
+            &required_paths,
+            &config.required_ports,
+            false,
+        )
+    }
+}
+
+/// Serializes the configuration with the same format as the one parsed by
+/// [`Config::parse_json()`].
+///
+/// Access rights are always listed individually (i.e. without `abi.*` groups),
+/// and rules with the same access rights are grouped together.  If the
+/// configuration is empty (e.g. after composing exclusive configurations), the
+/// serialized output cannot be parsed again.
+///
+/// Serializing to a writer (e.g. with `serde_json::to_writer()`) streams the
+/// output: only the rules are first copied and grouped by access rights, not
+/// the serialized text.
+impl Serialize for Config {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        JsonConfig::try_from(self)
+            .map_err(serde::ser::Error::custom)?
+            .serialize(serializer)
+    }
+}
+
+/// Serializes the resolved configuration with the same format as the one parsed
+/// by [`Config::parse_json()`], but without variables.
+///
+/// Paths that are not valid UTF-8 cannot be serialized.
+impl Serialize for ResolvedConfig {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        JsonConfig::try_from(self)
+            .map_err(serde::ser::Error::custom)?
+            .serialize(serializer)
     }
 }
 
@@ -142,6 +1011,116 @@ impl TryFrom<NonEmptyStruct<JsonConfig>> for Config {
 pub enum RuleError {
     #[error(transparent)]
     PathFd(#[from] PathFdError),
+    /// Error returned by the opener of
+    /// [`build_ruleset_with()`](ResolvedConfig::build_ruleset_with).
+    #[error("failed to open {}: {source}", .path.display())]
+    Open {
+        path: PathBuf,
+        source: std::io::Error,
+    },
+    #[error("failed to find the mount point of {}: {source}", .path.display())]
+    MountPoint {
+        path: PathBuf,
+        source: std::io::Error,
+    },
+    /// The rule is still applied to the mount point containing the path.
+    #[error("{} is not a mount point, using {} instead", .path.display(), .mount_point.display())]
+    NotMountPoint { path: PathBuf, mount_point: PathBuf },
+    /// The rule is still applied, but without these access rights, which only
+    /// apply to directories (e.g. `read_dir` or `make_reg`).
+    #[error("{} is not a directory, ignoring access rights: {access:?}", .path.display())]
+    NotDirectory {
+        path: PathBuf,
+        access: BitFlags<AccessFs>,
+    },
+    /// The rule is still applied, but without these access rights, which are
+    /// not supported by the running kernel.
+    #[error("{} allows unsupported access rights, ignoring them: {access:?}", .path.display())]
+    UnsupportedFsAccess {
+        path: PathBuf,
+        access: BitFlags<AccessFs>,
+    },
+    /// The rule is still applied, but without these access rights, which are
+    /// not supported by the running kernel.
+    #[error("port {port} allows unsupported access rights, ignoring them: {access:?}")]
+    UnsupportedNetAccess {
+        port: u64,
+        access: BitFlags<AccessNet>,
+    },
+}
+
+impl RuleError {
+    /// Returns whether the rule is still applied despite this error (maybe
+    /// without some access rights), which is then only a warning.
+    pub fn is_warning(&self) -> bool {
+        matches!(
+            self,
+            Self::NotMountPoint { .. }
+                | Self::NotDirectory { .. }
+                | Self::UnsupportedFsAccess { .. }
+                | Self::UnsupportedNetAccess { .. }
+        )
+    }
+}
+
+/// Rule added by [`ResolvedConfig::add_rules_with()`].
+pub(crate) enum AddRule<F> {
+    PathBeneath(F, BitFlags<AccessFs>),
+    NetPort(u16, BitFlags<AccessNet>),
+}
+
+/// Rule of a ruleset being built, see
+/// [`ResolvedConfig::build_ruleset_observed()`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum BuiltRule<'a> {
+    PathBeneath {
+        path: &'a Path,
+        access: BitFlags<AccessFs>,
+    },
+    /// Rule applied to the mount point containing `path`.
+    MountPoint {
+        path: &'a Path,
+        access: BitFlags<AccessFs>,
+    },
+    NetPort {
+        port: u64,
+        access: BitFlags<AccessNet>,
+    },
+}
+
+/// Records a rule error as a warning, or fails if the rule is required.
+fn push_rule_error(
+    rule_errors: &mut Vec<RuleError>,
+    error: RuleError,
+    required: bool,
+) -> Result<(), BuildRulesetError> {
+    if required {
+        return Err(BuildRulesetError::RequiredRule(error));
+    }
+    rule_errors.push(error);
+    Ok(())
+}
+
+/// Opens the path of a rule like the default builder, also used to check
+/// configurations without building them.
+pub(crate) fn open_rule_path(path: &Path) -> Result<PathFd, RuleError> {
+    PathFd::new(path).map_err(RuleError::PathFd)
+}
+
+/// Returns a rule error if `access` contains access rights that only apply to
+/// directories but `path` is not a directory.  All the other access rights
+/// apply to both files and directories (i.e. beneath them).
+fn check_directory(path: &Path, access: BitFlags<AccessFs>) -> Option<RuleError> {
+    // Access rights of the latest ABI supported by the landlock crate.
+    let access = access & !AccessFs::from_file(ABI::V6);
+    if access.is_empty() || fs::metadata(path).ok()?.is_dir() {
+        return None;
+    }
+    Some(RuleError::NotDirectory {
+        path: path.into(),
+        access,
+    })
 }
 
 #[derive(Debug, Error)]
@@ -150,6 +1129,18 @@ pub enum ParseJsonError {
     Config(#[from] ConfigError),
     #[error(transparent)]
     SerdeJson(#[from] serde_json::Error),
+    #[cfg(feature = "schema")]
+    #[error(transparent)]
+    Schema(#[from] SchemaError),
+}
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum ParseRulesError {
+    #[error(transparent)]
+    Io(#[from] std::io::Error),
+    #[error("line {line}: {source}")]
+    Line { line: usize, source: ParseJsonError },
 }
 
 #[cfg(feature = "toml")]
@@ -172,6 +1163,29 @@ pub enum ParseFileError {
     ParseToml(#[from] ParseTomlError),
 }
 
+/// Deserializes JSON data, with the last duplicate key winning if
+/// [`ParseOptions::json_last_key_wins()`] is enabled.
+fn from_json_reader<R, T>(reader: R, options: &ParseOptions) -> serde_json::Result<T>
+where
+    R: std::io::Read,
+    T: serde::de::DeserializeOwned,
+{
+    if options.json_last_key_wins {
+        // Unlike derived structs, a Value keeps the last duplicate key.
+        serde_json::from_value(serde_json::from_reader::<_, serde_json::Value>(reader)?)
+    } else {
+        serde_json::from_reader(reader)
+    }
+}
+
+#[cfg(feature = "schema")]
+fn from_json_slice<T>(data: &[u8], options: &ParseOptions) -> serde_json::Result<T>
+where
+    T: serde::de::DeserializeOwned,
+{
+    from_json_reader(data, options)
+}
+
 fn format_parse_files_error(errors: &BTreeMap<PathBuf, ParseFileError>) -> String {
     errors
         .iter()
@@ -205,6 +1219,7 @@ impl From<ParseDirectoryError> for std::io::Error {
     }
 }
 
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
 pub enum ConfigFormat {
     Json,
     #[cfg(feature = "toml")]
@@ -212,7 +1227,7 @@ pub enum ConfigFormat {
 }
 
 impl ConfigFormat {
-    fn extension(&self) -> &'static str {
+    pub(crate) fn extension(&self) -> &'static str {
         match self {
             ConfigFormat::Json => "json",
             #[cfg(feature = "toml")]
@@ -225,7 +1240,7 @@ impl Config {
     // Do not implement Default for Config because it would not be useful but
     // misleading.  Indeed, the default configuration would allow everything and
     // could not be updated with public methods (e.g. compose).
-    fn empty() -> Self {
+    pub(crate) fn empty() -> Self {
         Self {
             abi: Default::default(),
             variables: Default::default(),
@@ -233,8 +1248,78 @@ impl Config {
             handled_net: Default::default(),
             scoped: Default::default(),
             rules_path_beneath: Default::default(),
+            rules_mount_point: Default::default(),
             rules_net_port: Default::default(),
+            required_paths: Default::default(),
+            required_ports: Default::default(),
+            allow_none: false,
+            when: Default::default(),
+        }
+    }
+
+    /// Creates a configuration handling all the filesystem access rights of
+    /// `abi`, allowing to read and execute everything, but only allowing to
+    /// write beneath the `writable` paths.
+    ///
+    /// Access rights allowed beneath a path are the union of the ones allowed
+    /// by the rules on this path and its parents, so the `writable` paths are
+    /// still readable.  Paths are literal strings, without variables.
+    pub fn read_only_root<I, P>(abi: ABI, writable: I) -> Self
+    where
+        I: IntoIterator<Item = P>,
+        P: AsRef<str>,
+    {
+        let mut config = Self::empty();
+        config.abi = Some(abi);
+        config.handled_fs = AccessFs::from_all(abi);
+        config
+            .rules_path_beneath
+            .insert(TemplateString::from_text("/"), AccessFs::from_read(abi));
+        for path in writable {
+            *config
+                .rules_path_beneath
+                .entry(TemplateString::from_text(path.as_ref()))
+                .or_default() |= AccessFs::from_write(abi);
         }
+        config
+    }
+
+    /// Creates a configuration handling all the access rights and scopes of
+    /// `abi`, without any rule, which denies all these accesses (e.g. for a
+    /// process that only computes on inherited file descriptors).
+    ///
+    /// A process denied everything cannot even load a shared library or
+    /// execute a program afterwards: such configuration should typically be
+    /// composed with or extended by rules explicitly allowing what its runtime
+    /// needs.
+    pub fn deny_all(abi: ABI) -> Self {
+        let mut config = Self::empty();
+        config.abi = Some(abi);
+        config.handled_fs = AccessFs::from_all(abi);
+        config.handled_net = AccessNet::from_all(abi);
+        config.scoped = Scope::from_all(abi);
+        // Denying all ports is the point.
+        config.allow_none = true;
+        config
+    }
+
+    /// Creates a configuration only denying the `denied` filesystem access
+    /// rights, everywhere, by handling them without any rule.  All other
+    /// accesses are not restricted.
+    ///
+    /// This narrow deny cannot make exceptions (i.e. allow them beneath some
+    /// paths) without rules, and access rights unsupported by the running
+    /// kernel are silently not denied (see
+    /// [`ResolvedConfig::restrict_self()`]).  Some operations also require
+    /// several access rights (e.g. renaming a file requires `remove_file` and
+    /// a `make_*` one), and are already denied if one of them is.
+    pub fn deny_only<T>(denied: T) -> Self
+    where
+        T: Into<BitFlags<AccessFs>>,
+    {
+        let mut config = Self::empty();
+        config.handled_fs = denied.into();
+        config
     }
 
     /// Composes two configurations by merging `other` with `self` in a safe
@@ -252,14 +1337,48 @@ impl Config {
     /// - Rules are merged with access rights limited to commonly handled ones.
     /// - Paths with empty access rights after intersection are removed.
     /// - Variables from both configurations are merged.
+    /// - Acknowledgments of denied network access rights (i.e. `allowNone`)
+    ///   from either configuration are kept.
+    /// - Rules of `when` blocks are composed with the other configuration's
+    ///   rules, and with its `when` blocks matching the same ABI versions.
     ///
     /// # Commutativity
     ///
     /// This operation is commutative: `a.compose(&b)` produces the same result
-    /// as `b.compose(&a)`. The order of composition does not affect the final
-    /// configuration, ensuring predictable behavior regardless of the sequence
-    /// in which configurations are combined.
+    /// as `b.compose(&a)`, except for the order of the `when` blocks. The order
+    /// of composition does not affect the final configuration, ensuring
+    /// predictable behavior regardless of the sequence in which configurations
+    /// are combined.
     pub fn compose(&mut self, other: &Self) {
+        // Composition distributes over the conditional rules, which are
+        // composed with the unconditional rules of both configurations.
+        let when = if self.when.is_empty() && other.when.is_empty() {
+            Vec::new()
+        } else {
+            let self_rules = self.unconditional_rules();
+            let other_rules = other.unconditional_rules();
+            let mut when = Vec::new();
+            for conditional in &self.when {
+                let mut rules = conditional.rules.clone();
+                rules.compose(&other_rules);
+                when.push(ConditionalRules {
+                    rules,
+                    ..*conditional
+                });
+                when.extend(other.when.iter().filter_map(|o| conditional.intersect(o)));
+            }
+            for conditional in &other.when {
+                let mut rules = conditional.rules.clone();
+                rules.compose(&self_rules);
+                when.push(ConditionalRules {
+                    rules,
+                    ..*conditional
+                });
+            }
+            when
+        };
+        self.when = when;
+
         let common_handled_fs = self.handled_fs & other.handled_fs;
         let common_handled_net = self.handled_net & other.handled_net;
 
@@ -269,6 +1388,10 @@ impl Config {
             *access &= common_handled_fs;
             !access.is_empty()
         });
+        self.rules_mount_point.retain(|_, access| {
+            *access &= common_handled_fs;
+            !access.is_empty()
+        });
         self.rules_net_port.retain(|_, access| {
             *access &= common_handled_net;
             !access.is_empty()
@@ -285,6 +1408,15 @@ impl Config {
                     .or_insert(downgraded_access);
             }
         }
+        for (path, access) in &other.rules_mount_point {
+            let downgraded_access = *access & common_handled_fs;
+            if !downgraded_access.is_empty() {
+                self.rules_mount_point
+                    .entry(path.clone())
+                    .and_modify(|a| *a |= downgraded_access)
+                    .or_insert(downgraded_access);
+            }
+        }
         for (port, access) in &other.rules_net_port {
             let downgraded_access = *access & common_handled_net;
             if !downgraded_access.is_empty() {
@@ -295,6 +1427,11 @@ impl Config {
             }
         }
 
+        // A rule required by either configuration stays required.
+        self.required_paths
+            .extend(other.required_paths.iter().cloned());
+        self.required_ports.extend(&other.required_ports);
+
         // Third step: merge variables.
         for (name, value) in other.variables.iter() {
             self.variables.extend(name.clone(), value.clone());
@@ -304,6 +1441,7 @@ impl Config {
         self.handled_fs &= other.handled_fs;
         self.handled_net &= other.handled_net;
         self.scoped &= other.scoped;
+        self.allow_none |= other.allow_none;
 
         // Fifth step: downgrade the ABI version.
         self.abi = match (self.abi, other.abi) {
@@ -314,21 +1452,328 @@ impl Config {
         };
     }
 
-    pub fn parse_json<R>(reader: R) -> Result<Self, ParseJsonError>
-    where
-        R: std::io::Read,
-    {
-        let json = serde_json::from_reader::<_, NonEmptyStruct<JsonConfig>>(reader)?;
-        Ok(json.try_into()?)
+    /// Merges the rules of the `when` blocks matching `kernel_abi`, and drops
+    /// the others.
+    pub(crate) fn add_conditional_rules(&mut self, kernel_abi: i32) {
+        for when in std::mem::take(&mut self.when) {
+            if when.matches(kernel_abi) {
+                self.merge(when.rules);
+            }
+        }
     }
 
-    #[cfg(feature = "toml")]
-    pub fn parse_toml(data: &str) -> Result<Self, ParseTomlError> {
-        // The TOML parser does not handle Read implementations,
-        // see https://github.com/toml-rs/toml/issues/326
-        let json: NonEmptyStruct<JsonConfig> =
-            toml::from_str::<NonEmptyStruct<TomlConfig>>(data)?.convert();
-        Ok(json.try_into()?)
+    /// Returns the handled access rights and the rules of this configuration,
+    /// without its variables nor its `when` blocks.
+    fn unconditional_rules(&self) -> Self {
+        Self {
+            abi: None,
+            variables: Default::default(),
+            when: Vec::new(),
+            ..self.clone()
+        }
+    }
+
+    /// Downgrades the configuration to only use the features supported by the
+    /// `abi` version, e.g. to generate a policy for older kernels.
+    ///
+    /// This is the same as composing with a configuration handling all the
+    /// access rights supported by `abi`.  The configured ABI version is then
+    /// at most `abi`, and a configuration that does not use newer features is
+    /// left unchanged.
+    pub fn downgrade(&mut self, abi: ABI) {
+        let mut target = Self::empty();
+        target.abi = Some(abi);
+        target.handled_fs = AccessFs::from_all(abi);
+        target.handled_net = AccessNet::from_all(abi);
+        target.scoped = Scope::from_all(abi);
+        self.compose(&target);
+    }
+
+    /// Denies all network accesses by handling all the network access rights,
+    /// without any network port rule (e.g. to only allow some filesystem
+    /// accesses).  Existing network port rules are removed.
+    ///
+    /// Network access control requires Landlock ABI 4.  With older kernels,
+    /// the best-effort approach silently ignores these access rights, and
+    /// [`ResolvedConfig::restrict_self()`] then reports the ruleset as not
+    /// fully enforced.
+    pub fn deny_network(&mut self) {
+        // Access rights of the latest ABI supported by the landlock crate.
+        self.handled_net = AccessNet::from_all(ABI::V6);
+        self.rules_net_port.clear();
+        self.allow_none = true;
+        for when in &mut self.when {
+            when.rules.rules_net_port.clear();
+        }
+    }
+
+    /// Returns the suspicious parts of this configuration, which might come
+    /// from mistakes but are still enforced as is.
+    pub fn warnings(&self) -> Vec<ConfigWarning> {
+        let mut warnings = Vec::new();
+        let allowed_net = self
+            .rules_net_port
+            .values()
+            .chain(
+                self.when
+                    .iter()
+                    .flat_map(|when| when.rules.rules_net_port.values()),
+            )
+            .fold(BitFlags::EMPTY, |allowed, access| allowed | *access);
+        let denied_net = self.handled_net & !allowed_net;
+        let allow_none = self.allow_none || self.when.iter().any(|when| when.rules.allow_none);
+        if !allow_none && !denied_net.is_empty() {
+            warnings.push(ConfigWarning::NoNetPortRule(denied_net));
+        }
+        warnings.extend(self.net_port_warnings(DEFAULT_CLIENT_PORTS));
+        warnings
+    }
+
+    /// Returns the network port rules that might not match the author's
+    /// intent, with `client_ports` as the ports on which `bind_tcp` is
+    /// suspicious.  [`warnings()`](Config::warnings) includes these warnings
+    /// with [`DEFAULT_CLIENT_PORTS`].
+    ///
+    /// This is only advisory: rules on the same port are merged when parsing,
+    /// so conflicting rules are only flagged if they allow both `bind_tcp`
+    /// and `connect_tcp`, and a server can legitimately listen on a port in
+    /// `client_ports`.
+    pub fn net_port_warnings(&self, client_ports: &[u16]) -> Vec<ConfigWarning> {
+        let mut warnings = Vec::new();
+        for (port, access) in &self.rules_net_port {
+            if !access.contains(AccessNet::BindTcp) {
+                continue;
+            }
+            if client_ports.iter().any(|p| u64::from(*p) == *port) {
+                warnings.push(ConfigWarning::BindClientPort(*port));
+            }
+            if access.contains(AccessNet::ConnectTcp) {
+                warnings.push(ConfigWarning::BindAndConnect(*port));
+            }
+        }
+        warnings
+    }
+
+    pub fn parse_json<R>(reader: R) -> Result<Self, ParseJsonError>
+    where
+        R: std::io::Read,
+    {
+        Self::parse_json_with(reader, &Default::default())
+    }
+
+    pub fn parse_json_with<R>(reader: R, options: &ParseOptions) -> Result<Self, ParseJsonError>
+    where
+        R: std::io::Read,
+    {
+        #[cfg(feature = "schema")]
+        if options.validate_schema {
+            let mut reader = reader;
+            let mut data = Vec::new();
+            reader
+                .read_to_end(&mut data)
+                .map_err(serde_json::Error::io)?;
+            // The configuration is parsed again, instead of being converted
+            // from a Value, to keep the same errors (e.g. duplicate fields).
+            schema::validate(&serde_json::from_slice(&data)?)?;
+            let json = from_json_slice::<NonEmptyStruct<JsonConfig>>(&data, options)?;
+            return Ok(Self::try_from_json(json, options, ConfigFormat::Json)?);
+        }
+
+        let json = from_json_reader::<_, NonEmptyStruct<JsonConfig>>(reader, options)?;
+        Ok(Self::try_from_json(json, options, ConfigFormat::Json)?)
+    }
+
+    /// Parses several configurations from a JSON array, e.g.
+    /// `[ { "pathBeneath": [...] }, { "netPort": [...] } ]`.
+    ///
+    /// Each configuration is parsed on its own, and they are returned in
+    /// order, e.g. to then compose them or to enforce them as layers.
+    pub fn parse_json_multi<R>(reader: R) -> Result<Vec<Self>, ParseJsonError>
+    where
+        R: std::io::Read,
+    {
+        Self::parse_json_multi_with(reader, &Default::default())
+    }
+
+    pub fn parse_json_multi_with<R>(
+        reader: R,
+        options: &ParseOptions,
+    ) -> Result<Vec<Self>, ParseJsonError>
+    where
+        R: std::io::Read,
+    {
+        let documents = {
+            #[cfg(feature = "schema")]
+            if options.validate_schema {
+                let mut reader = reader;
+                let mut data = Vec::new();
+                reader
+                    .read_to_end(&mut data)
+                    .map_err(serde_json::Error::io)?;
+                schema::validate_array(&serde_json::from_slice(&data)?)?;
+                from_json_slice::<Vec<NonEmptyStruct<JsonConfig>>>(&data, options)?
+            } else {
+                from_json_reader::<_, Vec<NonEmptyStruct<JsonConfig>>>(reader, options)?
+            }
+            #[cfg(not(feature = "schema"))]
+            from_json_reader::<_, Vec<NonEmptyStruct<JsonConfig>>>(reader, options)?
+        };
+        documents
+            .into_iter()
+            .map(|json| Ok(Self::try_from_json(json, options, ConfigFormat::Json)?))
+            .collect()
+    }
+
+    /// Parses filesystem rules from line-delimited JSON (NDJSON), e.g. generated
+    /// on the fly by a tracer.
+    ///
+    /// Each line is an object with a `path` (like a `pathBeneath` parent) and
+    /// its allowed `access` rights (like `allowedAccess`), e.g.
+    /// `{"path": "/usr", "access": ["execute", "read_file"]}`.  Blank lines are
+    /// ignored.  Rules are merged into a single configuration, with the same
+    /// path only appearing once, and the handled access rights are inferred
+    /// from them.  The first invalid line is returned with its number
+    /// (starting from 1).
+    pub fn parse_json_rules<R>(reader: R) -> Result<Self, ParseRulesError>
+    where
+        R: std::io::BufRead,
+    {
+        let mut config = Self::empty();
+        let mut services = LazyServices::new(None);
+        let mut kernel_abi = LazyAbi::new(None);
+        for (index, line) in reader.lines().enumerate() {
+            let line = line?;
+            if line.trim().is_empty() {
+                continue;
+            }
+            let error = |source| ParseRulesError::Line {
+                line: index + 1,
+                source,
+            };
+            let rule = serde_json::from_str::<JsonRuleLine>(&line)
+                .map_err(|e| error(ParseJsonError::SerdeJson(e)))?;
+            let path_beneath = JsonPathBeneath {
+                allowedAccess: Some(rule.access),
+                parent: [rule.path].into_iter().collect(),
+                mountPoint: None,
+                required: None,
+                tag: None,
+            };
+            config
+                .add_rules(
+                    Default::default(),
+                    [path_beneath].into_iter().collect(),
+                    Default::default(),
+                    None,
+                    &mut services,
+                    &mut kernel_abi,
+                    &ParseOptions::default(),
+                )
+                .map_err(|e| error(ParseJsonError::Config(e)))?;
+        }
+        Ok(config)
+    }
+
+    #[cfg(feature = "toml")]
+    pub fn parse_toml(data: &str) -> Result<Self, ParseTomlError> {
+        Self::parse_toml_with(data, &Default::default())
+    }
+
+    #[cfg(feature = "toml")]
+    pub fn parse_toml_with(data: &str, options: &ParseOptions) -> Result<Self, ParseTomlError> {
+        // The TOML parser does not handle Read implementations,
+        // see https://github.com/toml-rs/toml/issues/326
+        let json: NonEmptyStruct<JsonConfig> =
+            toml::from_str::<NonEmptyStruct<TomlConfig>>(data)?.convert();
+        Ok(Self::try_from_json(json, options, ConfigFormat::Toml)?)
+    }
+
+    /// Parses several TOML configurations separated by `---` lines.
+    ///
+    /// Each configuration is parsed on its own, and they are returned in
+    /// order, e.g. to then compose them or to enforce them as layers.
+    /// Documents only containing comments or blank lines (e.g. after a
+    /// trailing separator) are ignored.
+    #[cfg(feature = "toml")]
+    pub fn parse_toml_multi(data: &str) -> Result<Vec<Self>, ParseTomlError> {
+        Self::parse_toml_multi_with(data, &Default::default())
+    }
+
+    #[cfg(feature = "toml")]
+    pub fn parse_toml_multi_with(
+        data: &str,
+        options: &ParseOptions,
+    ) -> Result<Vec<Self>, ParseTomlError> {
+        let mut configs = Vec::new();
+        let mut document = String::new();
+        // Number of lines before the current document.
+        let mut offset = 0;
+        let mut is_empty = true;
+        let mut lines = data.lines().enumerate().peekable();
+        while let Some((index, line)) = lines.next() {
+            let is_separator = line.trim_end() == TOML_SEPARATOR;
+            if !is_separator {
+                document.push_str(line);
+                document.push('\n');
+                let trimmed = line.trim_start();
+                is_empty &= trimmed.is_empty() || trimmed.starts_with('#');
+            }
+            if (is_separator || lines.peek().is_none()) && !is_empty {
+                let config = Self::parse_toml_with(&document, options).map_err(|e| match e {
+                    // The span of a TOML error cannot be shifted, so only the
+                    // failing document is parsed again after the preceding
+                    // lines, for the error to point to the whole data.
+                    ParseTomlError::SerdeToml(_) => {
+                        let padded = "\n".repeat(offset) + &document;
+                        Self::parse_toml_with(&padded, options).err().unwrap_or(e)
+                    }
+                    e => e,
+                })?;
+                configs.push(config);
+            }
+            if is_separator {
+                document.clear();
+                offset = index + 1;
+                is_empty = true;
+            }
+        }
+        Ok(configs)
+    }
+
+    /// Parse a configuration file with the specified format.
+    pub fn parse_file<T>(path: T, format: ConfigFormat) -> Result<Self, ParseFileError>
+    where
+        T: AsRef<Path>,
+    {
+        Self::parse_file_with(path, format, &Default::default())
+    }
+
+    pub fn parse_file_with<T>(
+        path: T,
+        format: ConfigFormat,
+        options: &ParseOptions,
+    ) -> Result<Self, ParseFileError>
+    where
+        T: AsRef<Path>,
+    {
+        if let Some(trace) = &options.trace {
+            let data = trace.time(Phase::Read, || fs::read(path))?;
+            return trace.time(Phase::Parse, || match format {
+                ConfigFormat::Json => Ok(Self::parse_json_with(data.as_slice(), options)?),
+                #[cfg(feature = "toml")]
+                ConfigFormat::Toml => Ok(Self::parse_toml_with(
+                    &String::from_utf8(data)
+                        .map_err(|e| std::io::Error::new(std::io::ErrorKind::InvalidData, e))?,
+                    options,
+                )?),
+            });
+        }
+
+        match format {
+            ConfigFormat::Json => Ok(Self::parse_json_with(File::open(path)?, options)?),
+            #[cfg(feature = "toml")]
+            ConfigFormat::Toml => Ok(Self::parse_toml_with(&fs::read_to_string(path)?, options)?),
+        }
     }
 
     /// Parse all configuration files in a directory with the specified format.
@@ -367,38 +1812,60 @@ impl Config {
                 continue;
             }
 
-            match format {
-                ConfigFormat::Json => match File::open(&path) {
-                    Ok(file) => match Self::parse_json(file) {
-                        Ok(config) => full_config.compose(&config),
-                        Err(e) => {
-                            // Duplicated file names should be very rare when
-                            // listing the content of a directory, and ignoring
-                            // errors for now-removed files is OK.
-                            errors.insert(path.clone(), e.into());
-                        }
-                    },
-                    Err(e) => {
-                        // Ignore race conditions when files are removed.
-                        if e.kind() != std::io::ErrorKind::NotFound {
-                            errors.insert(path.clone(), e.into());
-                        }
-                    }
-                },
-                #[cfg(feature = "toml")]
-                ConfigFormat::Toml => match std::fs::read_to_string(&path) {
-                    Ok(data) => match Self::parse_toml(data.as_str()) {
-                        Ok(config) => full_config.compose(&config),
-                        Err(e) => {
-                            errors.insert(path.clone(), e.into());
-                        }
-                    },
-                    Err(e) => {
-                        if e.kind() != std::io::ErrorKind::NotFound {
-                            errors.insert(path.clone(), e.into());
+            match Self::parse_file(&path, format) {
+                Ok(config) => full_config.compose(&config),
+                // Ignore race conditions when files are removed.
+                Err(ParseFileError::Io(e)) if e.kind() == std::io::ErrorKind::NotFound => {}
+                Err(e) => {
+                    // Duplicated file names should be very rare when listing
+                    // the content of a directory, and ignoring errors for
+                    // now-removed files is OK.
+                    errors.insert(path.clone(), e);
+                }
+            }
+        }
+
+        if !errors.is_empty() {
+            return Err(ParseDirectoryError::ParseFiles(errors));
+        }
+        full_config.ok_or(ParseDirectoryError::NoConfigFile)
+    }
+
+    /// Loads layered configuration files, e.g. a system policy, a user
+    /// policy, and an override, in increasing precedence (see
+    /// [`xdg_layers()`](Config::xdg_layers)).
+    ///
+    /// Missing files are skipped, but other errors are not, and at least one
+    /// file must exist.  Each layer is added to the previous ones as if it was
+    /// included: handled access rights (i.e. restrictions) and rules (i.e.
+    /// allowances) are merged, so a layer can neither drop a restriction nor
+    /// a rule of a previous one.  The variables defined by a layer replace the
+    /// ones of the previous layers with the same name, e.g. for a user policy
+    /// to move a directory allowed by the system policy.
+    pub fn load_layered<I, P>(paths: I, format: ConfigFormat) -> Result<Self, ParseDirectoryError>
+    where
+        I: IntoIterator<Item = P>,
+        P: AsRef<Path>,
+    {
+        let mut full_config: Option<Self> = None;
+        let mut errors = BTreeMap::new();
+
+        for path in paths {
+            let path = path.as_ref();
+            match Self::parse_file(path, format) {
+                Ok(layer) => match &mut full_config {
+                    Some(config) => {
+                        for (name, _) in layer.variables.iter() {
+                            config.variables.remove(name);
                         }
+                        config.merge(layer);
                     }
+                    None => full_config = Some(layer),
                 },
+                Err(ParseFileError::Io(e)) if e.kind() == std::io::ErrorKind::NotFound => {}
+                Err(e) => {
+                    errors.insert(path.to_path_buf(), e);
+                }
             }
         }
 
@@ -408,9 +1875,128 @@ impl Config {
         full_config.ok_or(ParseDirectoryError::NoConfigFile)
     }
 
+    /// Returns the XDG-style layers of the `app` policy, to load with
+    /// [`load_layered()`](Config::load_layered): the system policy
+    /// (`/etc/<app>/landlock.<ext>`), and then the user policy
+    /// (`$XDG_CONFIG_HOME/<app>/landlock.<ext>`, or
+    /// `$HOME/.config/<app>/landlock.<ext>`), if the user configuration
+    /// directory is known.
+    ///
+    /// Callers can then append an override, e.g. a path from an environment
+    /// variable of the app.
+    pub fn xdg_layers(app: &str, format: ConfigFormat) -> Vec<PathBuf> {
+        let file_name = format!("landlock.{}", format.extension());
+        // Relative paths are invalid according to the XDG specification.
+        let absolute =
+            |dir: std::ffi::OsString| Some(PathBuf::from(dir)).filter(|d| d.is_absolute());
+        let user_dir = std::env::var_os("XDG_CONFIG_HOME")
+            .and_then(absolute)
+            .or_else(|| {
+                std::env::var_os("HOME")
+                    .and_then(absolute)
+                    .map(|home| home.join(".config"))
+            });
+        [Some(Path::new("/etc").to_path_buf()), user_dir]
+            .into_iter()
+            .flatten()
+            .map(|dir| dir.join(app).join(&file_name))
+            .collect()
+    }
+
     pub fn resolve(self) -> Result<ResolvedConfig, ResolveError> {
         self.try_into()
     }
+
+    /// Resolves variables, and then converts paths with `resolver`.
+    pub fn resolve_with(self, resolver: &PathResolver) -> Result<ResolvedConfig, ResolveError> {
+        match resolver.tracer() {
+            Some(trace) => trace.time(Phase::Resolve, || self.resolve_paths(resolver, None)),
+            None => self.resolve_paths(resolver, None),
+        }
+    }
+
+    /// Resolves this configuration like [`resolve_with()`](Config::resolve_with),
+    /// but drops the rules of the paths referencing an undefined variable
+    /// (e.g. an unset environment variable, see
+    /// [`PathResolver::expand_env()`]) without default value, and returns them
+    /// as warnings.
+    ///
+    /// Dropping a rule denies more, but the rules of required paths are never
+    /// dropped: they still fail.
+    pub fn resolve_lenient(
+        self,
+        resolver: &PathResolver,
+    ) -> Result<(ResolvedConfig, Vec<ResolveWarning>), ResolveError> {
+        let mut warnings = Vec::new();
+        let resolved = match resolver.tracer() {
+            Some(trace) => trace.time(Phase::Resolve, || {
+                self.resolve_paths(resolver, Some(&mut warnings))
+            }),
+            None => self.resolve_paths(resolver, Some(&mut warnings)),
+        }?;
+        Ok((resolved, warnings))
+    }
+
+    /// Resolves this configuration, and drops the rules with undefined
+    /// variables into `warnings`, if any.
+    fn resolve_paths(
+        mut self,
+        resolver: &PathResolver,
+        mut warnings: Option<&mut Vec<ResolveWarning>>,
+    ) -> Result<ResolvedConfig, ResolveError> {
+        // Conditions are evaluated once, for the kernel the configuration is
+        // resolved for, and the matching rules are then handled like the others.
+        if !self.when.is_empty() {
+            self.add_conditional_rules(resolver.kernel_abi_version());
+        }
+        resolver.set_variables(&mut self.variables)?;
+        let mut required_paths = BTreeSet::new();
+        let mut resolve = |rules: BTreeMap<TemplateString, BitFlags<AccessFs>>| {
+            let mut resolved: BTreeMap<PathBuf, BitFlags<AccessFs>> = Default::default();
+            for (path_beneath, access) in rules {
+                let required = self.required_paths.contains(&path_beneath);
+                let set = match (self.variables.resolve(&path_beneath), warnings.as_mut()) {
+                    (Err(ResolveError::VariableNotFound(name)), Some(warnings)) if !required => {
+                        warnings.push(ResolveWarning::UndefinedVariable {
+                            path: path_beneath.to_string(),
+                            name,
+                        });
+                        continue;
+                    }
+                    (set, _) => set?,
+                };
+                for path in VecStringIterator::new(&set) {
+                    for path in resolver.resolve(&path)? {
+                        if required {
+                            required_paths.insert(path.clone());
+                        }
+                        resolved
+                            .entry(path)
+                            .and_modify(|a| *a |= access)
+                            .or_insert(access);
+                    }
+                }
+            }
+            Ok::<_, ResolveError>(resolver.merge_case(resolved))
+        };
+        let rules_path_beneath = resolve(self.rules_path_beneath)?;
+        let rules_mount_point = resolve(self.rules_mount_point)?;
+        let required_paths = resolver.merge_case_paths(
+            required_paths,
+            rules_path_beneath.keys().chain(rules_mount_point.keys()),
+        );
+
+        Ok(ResolvedConfig {
+            handled_fs: self.handled_fs,
+            handled_net: self.handled_net,
+            scoped: self.scoped,
+            rules_path_beneath,
+            rules_mount_point,
+            rules_net_port: self.rules_net_port,
+            required_paths,
+            required_ports: self.required_ports,
+        })
+    }
 }
 
 #[test]
@@ -438,43 +2024,426 @@ impl OptionalConfig for Option<Config> {
 
 impl ResolvedConfig {
     pub fn build_ruleset(&self) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError> {
-        let mut ruleset = Ruleset::default();
-        let ruleset_ref = &mut ruleset;
-        if !self.handled_fs.is_empty() {
-            ruleset_ref.handle_access(self.handled_fs)?;
+        self.build_ruleset_observed(|_, _, _| {})
+    }
+
+    /// Builds the ruleset like [`build_ruleset()`](ResolvedConfig::build_ruleset),
+    /// and calls `on_rule` after each rule is added or ignored, e.g. for
+    /// per-rule telemetry or to identify the rules ignored in best-effort
+    /// mode.
+    ///
+    /// `on_rule` gets the index of the rule (see
+    /// [`build_ruleset_with()`](ResolvedConfig::build_ruleset_with)), the rule,
+    /// and `Ok(())` if the rule was added, or the error that ignored it or
+    /// that stopped the build.  It is called once for each rule, in index
+    /// order, from the calling thread: path beneath rules, mount point rules,
+    /// and then network port rules.  Rules after a fatal error are not tried,
+    /// and `on_rule` is not called for them.  Like the ruleset, rules with
+    /// access rights unsupported by the running kernel are added in a
+    /// best-effort way, and then reported as added.
+    pub fn build_ruleset_observed<C>(
+        &self,
+        on_rule: C,
+    ) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError>
+    where
+        C: FnMut(usize, BuiltRule<'_>, Result<(), &dyn std::error::Error>),
+    {
+        self.build_ruleset_opener(open_rule_path, on_rule)
+    }
+
+    /// Builds the ruleset like [`build_ruleset()`](ResolvedConfig::build_ruleset),
+    /// but without opening the rule paths itself: `opener` is called for each
+    /// path and returns a file descriptor referring to it (e.g. opened with
+    /// `O_PATH | O_CLOEXEC` by a broker), which is then owned and closed by the
+    /// ruleset builder.  An opener error is reported as a rule error, and the
+    /// related rule is ignored.
+    ///
+    /// Mount point rules are still resolved with the mount points of the
+    /// current mount namespace, and then opened with `opener`.
+    pub fn build_ruleset_with<O>(
+        &self,
+        mut opener: O,
+    ) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError>
+    where
+        O: FnMut(&Path) -> std::io::Result<OwnedFd>,
+    {
+        self.build_ruleset_opener(
+            |path| {
+                opener(path).map_err(|source| RuleError::Open {
+                    path: path.into(),
+                    source,
+                })
+            },
+            |_, _, _| {},
+        )
+    }
+
+    /// Checks the access rights allowed by the rules against the ones
+    /// supported by `kernel_abi`: required rules fail, and the other ones get
+    /// a rule error, unless Landlock is not supported at all, which the
+    /// restriction status already tells.
+    pub(crate) fn check_supported(
+        &self,
+        kernel_abi: ABI,
+    ) -> Result<Vec<RuleError>, BuildRulesetError> {
+        let warn = kernel_abi != ABI::Unsupported;
+        let mut rule_errors = Vec::new();
+        for (path, access) in self
+            .rules_path_beneath
+            .iter()
+            .chain(&self.rules_mount_point)
+        {
+            let access = *access & !AccessFs::from_all(kernel_abi);
+            if access.is_empty() {
+                continue;
+            }
+            let path = path.clone();
+            if self.required_paths.contains(&path) {
+                return Err(BuildRulesetError::RequiredFsAccess { path, access });
+            }
+            if warn {
+                rule_errors.push(RuleError::UnsupportedFsAccess { path, access });
+            }
         }
-        if !self.handled_net.is_empty() {
-            ruleset_ref.handle_access(self.handled_net)?;
+        for (port, access) in &self.rules_net_port {
+            let access = *access & !AccessNet::from_all(kernel_abi);
+            if access.is_empty() {
+                continue;
+            }
+            let port = *port;
+            if self.required_ports.contains(&port) {
+                return Err(BuildRulesetError::RequiredNetAccess { port, access });
+            }
+            if warn {
+                rule_errors.push(RuleError::UnsupportedNetAccess { port, access });
+            }
         }
-        if !self.scoped.is_empty() {
-            ruleset_ref.scope(self.scoped)?;
+        Ok(rule_errors)
+    }
+
+    /// Opens the rule paths with `opener`, and then calls `add` with the index
+    /// of each rule and the rule to add.
+    ///
+    /// Rules are indexed in the order they are added: path beneath rules,
+    /// mount point rules, and then network port rules.
+    pub(crate) fn add_rules_with<F, O, A, E>(&self, opener: O, add: A) -> Result<Vec<RuleError>, E>
+    where
+        F: AsFd,
+        O: FnMut(&Path) -> Result<F, RuleError>,
+        A: FnMut(usize, AddRule<F>) -> Result<(), E>,
+        E: From<BuildRulesetError> + std::error::Error + 'static,
+    {
+        self.add_rules_observed(opener, add, |_, _, _| {})
+    }
+
+    /// Adds rules like [`add_rules_with()`](Self::add_rules_with), and then
+    /// calls `observe` with the index, the description, and the outcome of
+    /// each rule.
+    fn add_rules_observed<F, O, A, E, C>(
+        &self,
+        mut opener: O,
+        mut add: A,
+        mut observe: C,
+    ) -> Result<Vec<RuleError>, E>
+    where
+        F: AsFd,
+        O: FnMut(&Path) -> Result<F, RuleError>,
+        A: FnMut(usize, AddRule<F>) -> Result<(), E>,
+        E: From<BuildRulesetError> + std::error::Error + 'static,
+        C: FnMut(usize, BuiltRule<'_>, Result<(), &dyn std::error::Error>),
+    {
+        // Calls `observe` with the outcome of `add`.
+        fn observed<E, C>(
+            observe: &mut C,
+            rule: usize,
+            built: BuiltRule<'_>,
+            added: Result<(), E>,
+        ) -> Result<(), E>
+        where
+            E: std::error::Error + 'static,
+            C: FnMut(usize, BuiltRule<'_>, Result<(), &dyn std::error::Error>),
+        {
+            observe(
+                rule,
+                built,
+                added
+                    .as_ref()
+                    .map(|_| ())
+                    .map_err(|e| e as &dyn std::error::Error),
+            );
+            added
         }
-        let mut ruleset_created = ruleset.create()?;
-        let ruleset_created_ref = &mut ruleset_created;
-        let mut rule_errors = Vec::new();
 
-        for (parent, allowed_access) in &self.rules_path_beneath {
+        let mut rule_errors = Vec::new();
+        for (rule, (parent, allowed_access)) in self.rules_path_beneath.iter().enumerate() {
+            let required = self.required_paths.contains(parent);
+            let built = BuiltRule::PathBeneath {
+                path: parent,
+                access: *allowed_access,
+            };
             // TODO: Walk through all path and only open them once, including their
             // common parent directory to get a consistent hierarchy.
-            let fd = match PathFd::new(parent) {
+            let fd = match opener(parent) {
                 Ok(fd) => fd,
                 Err(e) => {
-                    rule_errors.push(RuleError::PathFd(e));
+                    observe(rule, built, Err(&e));
+                    push_rule_error(&mut rule_errors, e, required)?;
                     continue;
                 }
             };
-            ruleset_created_ref.add_rule(PathBeneath::new(fd, *allowed_access))?;
+            rule_errors.extend(check_directory(parent, *allowed_access));
+            let added = add(rule, AddRule::PathBeneath(fd, *allowed_access));
+            observed(&mut observe, rule, built, added)?;
         }
 
-        for (port, allowed_access) in &self.rules_net_port {
-            ruleset_created_ref.add_rule(
-                // TODO: Check integer conversion in parse_json(), which would require changing the type of config and specifying where the error is.
-                NetPort::new((*port).try_into()?, *allowed_access),
-            )?;
+        // Only read the mount points if a rule needs them.
+        let mut mount_points: Option<MountPoints> = None;
+        let offset = self.rules_path_beneath.len();
+        for (rule, (path, allowed_access)) in self.rules_mount_point.iter().enumerate() {
+            let required = self.required_paths.contains(path);
+            let built = BuiltRule::MountPoint {
+                path,
+                access: *allowed_access,
+            };
+            let mount_root = match mount_points {
+                Some(ref mount_points) => mount_points.mount_root(path),
+                None => MountPoints::load().and_then(|m| mount_points.insert(m).mount_root(path)),
+            };
+            let mount_point = match mount_root {
+                Ok((mount_point, true)) => mount_point,
+                Ok((mount_point, false)) => {
+                    rule_errors.push(RuleError::NotMountPoint {
+                        path: path.clone(),
+                        mount_point: mount_point.clone(),
+                    });
+                    mount_point
+                }
+                Err(source) => {
+                    let error = RuleError::MountPoint {
+                        path: path.clone(),
+                        source,
+                    };
+                    observe(offset + rule, built, Err(&error));
+                    push_rule_error(&mut rule_errors, error, required)?;
+                    continue;
+                }
+            };
+            let fd = match opener(&mount_point) {
+                Ok(fd) => fd,
+                Err(e) => {
+                    observe(offset + rule, built, Err(&e));
+                    push_rule_error(&mut rule_errors, e, required)?;
+                    continue;
+                }
+            };
+            rule_errors.extend(check_directory(&mount_point, *allowed_access));
+            let added = add(offset + rule, AddRule::PathBeneath(fd, *allowed_access));
+            observed(&mut observe, offset + rule, built, added)?;
         }
 
+        let offset = offset + self.rules_mount_point.len();
+        for (rule, (port, allowed_access)) in self.rules_net_port.iter().enumerate() {
+            let built = BuiltRule::NetPort {
+                port: *port,
+                access: *allowed_access,
+            };
+            // The parser checks port ranges, but not the configurations built
+            // or modified otherwise.
+            let added = u16::try_from(*port)
+                .map_err(|e| BuildRulesetError::from(e).into())
+                .and_then(|port| add(offset + rule, AddRule::NetPort(port, *allowed_access)));
+            observed(&mut observe, offset + rule, built, added)?;
+        }
+
+        Ok(rule_errors)
+    }
+
+    fn build_ruleset_opener<F, O, C>(
+        &self,
+        opener: O,
+        on_rule: C,
+    ) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError>
+    where
+        F: AsFd,
+        O: FnMut(&Path) -> Result<F, RuleError>,
+        C: FnMut(usize, BuiltRule<'_>, Result<(), &dyn std::error::Error>),
+    {
+        let mut rule_errors = self.check_supported(kernel::abi_version().into())?;
+        let ruleset_error = |e| BuildRulesetError::from_ruleset(Operation::CreateRuleset, e, None);
+        let mut ruleset = Ruleset::default();
+        let ruleset_ref = &mut ruleset;
+        if !self.handled_fs.is_empty() {
+            ruleset_ref
+                .handle_access(self.handled_fs)
+                .map_err(ruleset_error)?;
+        }
+        if !self.handled_net.is_empty() {
+            ruleset_ref
+                .handle_access(self.handled_net)
+                .map_err(ruleset_error)?;
+        }
+        if !self.scoped.is_empty() {
+            ruleset_ref.scope(self.scoped).map_err(ruleset_error)?;
+        }
+        let mut ruleset_created = ruleset.create().map_err(ruleset_error)?;
+        // Rules are indexed to identify the one refused by the kernel, if any.
+        rule_errors.extend(self.add_rules_observed(
+            opener,
+            |rule, add| {
+                let ruleset_created_ref = &mut ruleset_created;
+                let added = match add {
+                    AddRule::PathBeneath(fd, access) => {
+                        ruleset_created_ref.add_rule(PathBeneath::new(fd, access))
+                    }
+                    AddRule::NetPort(port, access) => {
+                        ruleset_created_ref.add_rule(NetPort::new(port, access))
+                    }
+                };
+                added
+                    .map(|_| ())
+                    .map_err(|e| BuildRulesetError::from_ruleset(Operation::AddRule, e, Some(rule)))
+            },
+            on_rule,
+        )?);
         Ok((ruleset_created, rule_errors))
     }
+
+    /// Builds the ruleset like [`build_ruleset()`](ResolvedConfig::build_ruleset),
+    /// and records the time spent in `trace`.
+    pub fn build_ruleset_traced(
+        &self,
+        trace: &Trace,
+    ) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError> {
+        trace.time(Phase::Build, || self.build_ruleset())
+    }
+
+    /// Builds the ruleset and enforces it on the calling thread.
+    ///
+    /// Each call adds a new layer of restrictions on top of the current ones,
+    /// which can then only be further restricted.  Reloading a configuration
+    /// can then only tighten the sandbox, and there is no way to roll back to a
+    /// previous layer.  See [`check_layer()`](ResolvedConfig::check_layer) to
+    /// detect what a new layer could not grant, and
+    /// [`can_tighten()`](ResolvedConfig::can_tighten) to skip a no-op layer.
+    pub fn restrict_self(&self) -> Result<(RestrictionStatus, Vec<RuleError>), BuildRulesetError> {
+        let (ruleset, rule_errors) = self.build_ruleset()?;
+        let status = ruleset
+            .restrict_self()
+            .map_err(|e| BuildRulesetError::from_ruleset(Operation::RestrictSelf, e, None))?;
+        Ok((status, rule_errors))
+    }
+
+    /// Builds the ruleset like [`build_ruleset()`](ResolvedConfig::build_ruleset),
+    /// after checking the flags of `options` against the running kernel.
+    pub fn build_ruleset_with_options(
+        &self,
+        options: &RulesetOptions,
+    ) -> Result<(RulesetCreated, Vec<RuleError>), BuildRulesetError> {
+        options.check(kernel::abi_version())?;
+        // There is no flag to create a ruleset yet, which would otherwise
+        // require to create it without the landlock crate.
+        self.build_ruleset()
+    }
+
+    /// Builds the ruleset like
+    /// [`build_ruleset_with_options()`](ResolvedConfig::build_ruleset_with_options),
+    /// and enforces it on the calling thread with the landlock_restrict_self(2)
+    /// flags of `options`.
+    ///
+    /// Like [`SealedConfig::restrict_self()`](crate::SealedConfig::restrict_self),
+    /// this also sets no_new_privs, and returns `false` if Landlock is not
+    /// supported by the running kernel, in which case nothing is enforced.
+    pub fn restrict_self_with_options(
+        &self,
+        options: &RulesetOptions,
+    ) -> Result<(bool, Vec<RuleError>), BuildRulesetError> {
+        self.restrict_self_options_with(options, kernel::abi_version(), kernel::restrict_self)
+    }
+
+    /// Enforces the ruleset like
+    /// [`restrict_self_with_options()`](ResolvedConfig::restrict_self_with_options),
+    /// with the flags checked against `abi`, and enforced with `restrict`.
+    pub(crate) fn restrict_self_options_with<F>(
+        &self,
+        options: &RulesetOptions,
+        abi: i32,
+        restrict: F,
+    ) -> Result<(bool, Vec<RuleError>), BuildRulesetError>
+    where
+        F: FnOnce(BorrowedFd<'_>, u32) -> std::io::Result<()>,
+    {
+        options.check(abi)?;
+        let (ruleset, rule_errors) = self.build_ruleset()?;
+        // The ruleset is not created if Landlock is not supported.
+        let Some(fd) = Option::<OwnedFd>::from(ruleset) else {
+            return Ok((false, rule_errors));
+        };
+        restrict(fd.as_fd(), options.restrict_flags)
+            .map_err(|e| SyscallError::new(Operation::RestrictSelf, None, e))?;
+        Ok((true, rule_errors))
+    }
+
+    /// Returns the handled access rights and scopes that are denied somewhere,
+    /// i.e. that are not allowed everywhere.
+    ///
+    /// A filesystem access right is allowed everywhere if it is allowed beneath
+    /// the root directory.  A network access right cannot be allowed for all
+    /// ports and a scope cannot be allowed at all, so they are always denied if
+    /// they are handled (e.g. `connect_tcp` is denied except for the allowed
+    /// ports).
+    pub fn denied(&self) -> (BitFlags<AccessFs>, BitFlags<AccessNet>, BitFlags<Scope>) {
+        let root = Path::new("/");
+        let allowed_fs = self
+            .rules_path_beneath
+            .get(root)
+            .copied()
+            .unwrap_or_default()
+            | self
+                .rules_mount_point
+                .get(root)
+                .copied()
+                .unwrap_or_default();
+        (self.handled_fs & !allowed_fs, self.handled_net, self.scoped)
+    }
+
+    /// Returns the `handled_access_fs`, `handled_access_net`, and `scoped`
+    /// fields of the `struct landlock_ruleset_attr` that would be used to
+    /// build the ruleset for `abi`, e.g. to create it with custom code.
+    ///
+    /// Like [`build_ruleset()`](ResolvedConfig::build_ruleset), access rights
+    /// and scopes not supported by `abi` are removed.  Callers doing the
+    /// landlock_create_ruleset(2) call themselves must also pass a struct size
+    /// supported by the running kernel, e.g. without the `scoped` field before
+    /// ABI 6, and the rules are still theirs to add.
+    pub fn ruleset_attr(&self, abi: ABI) -> (u64, u64, u64) {
+        (
+            (self.handled_fs & AccessFs::from_all(abi)).bits(),
+            (self.handled_net & AccessNet::from_all(abi)).bits(),
+            (self.scoped & Scope::from_all(abi)).bits(),
+        )
+    }
+
+    /// Only keeps the `kinds` of restrictions, e.g. to only enforce the
+    /// filesystem restrictions of a configuration while the network is
+    /// restricted by another mechanism (e.g. nftables).
+    ///
+    /// The other kinds are not handled anymore: once enforced, the related
+    /// accesses are not restricted by this Landlock layer at all, even if the
+    /// configuration denied them.
+    pub fn retain(&mut self, kinds: &[Restriction]) {
+        if !kinds.contains(&Restriction::Fs) {
+            self.handled_fs = BitFlags::EMPTY;
+            self.rules_path_beneath.clear();
+            self.rules_mount_point.clear();
+        }
+        if !kinds.contains(&Restriction::Net) {
+            self.handled_net = BitFlags::EMPTY;
+            self.rules_net_port.clear();
+        }
+        if !kinds.contains(&Restriction::Scope) {
+            self.scoped = BitFlags::EMPTY;
+        }
+    }
 }
 
 impl TryFrom<Config> for ResolvedConfig {
@@ -482,24 +2451,7 @@ impl TryFrom<Config> for ResolvedConfig {
 
     /// Resolve all (composed) variables but not local (synthetic) variables such as `abi.*`.
     fn try_from(config: Config) -> Result<Self, Self::Error> {
-        let mut rules_path_beneath: BTreeMap<PathBuf, BitFlags<AccessFs>> = Default::default();
-        for (path_beneath, access) in config.rules_path_beneath {
-            let set = config.variables.resolve(&path_beneath)?;
-            for path in VecStringIterator::new(&set) {
-                rules_path_beneath
-                    .entry(PathBuf::from(path))
-                    .and_modify(|a| *a |= access)
-                    .or_insert(access);
-            }
-        }
-
-        Ok(Self {
-            handled_fs: config.handled_fs,
-            handled_net: config.handled_net,
-            scoped: config.scoped,
-            rules_path_beneath,
-            rules_net_port: config.rules_net_port,
-        })
+        config.resolve_with(&Default::default())
     }
 }
 
@@ -637,3 +2589,965 @@ mod tests_compose {
         assert_eq!(c1_mut, c2_mut);
     }
 }
+
+#[cfg(test)]
+mod tests_denied {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use landlock::{Access, ABI};
+
+    fn denied(json: &str) -> (BitFlags<AccessFs>, BitFlags<AccessNet>, BitFlags<Scope>) {
+        parse_json(json).unwrap().resolve().unwrap().denied()
+    }
+
+    #[test]
+    fn test_read_everywhere() {
+        let json = r#"{
+            "abi": 1,
+            "ruleset": [
+                {
+                    "handledAccessFs": [ "abi.all" ]
+                }
+            ],
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "abi.read_execute" ],
+                    "parent": [ "/" ]
+                },
+                {
+                    "allowedAccess": [ "write_file" ],
+                    "parent": [ "/tmp" ]
+                }
+            ]
+        }"#;
+        let (fs, net, scope) = denied(json);
+        assert_eq!(
+            fs,
+            AccessFs::from_all(ABI::V1) & !AccessFs::from_read(ABI::V1)
+        );
+        assert!(fs.contains(AccessFs::WriteFile));
+        assert!(net.is_empty());
+        assert!(scope.is_empty());
+    }
+
+    #[test]
+    fn test_net_scope() {
+        let json = r#"{
+            "ruleset": [
+                {
+                    "scoped": [ "signal" ]
+                }
+            ],
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        }"#;
+        assert_eq!(
+            denied(json),
+            (
+                BitFlags::EMPTY,
+                AccessNet::ConnectTcp.into(),
+                Scope::Signal.into()
+            )
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests_ruleset_attr {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    #[test]
+    fn test_ruleset_attr() {
+        let json = r#"{
+            "ruleset": [
+                {
+                    "handledAccessFs": [ "execute", "refer", "truncate" ],
+                    "scoped": [ "signal" ]
+                }
+            ],
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        }"#;
+        let resolved = parse_json(json).unwrap().resolve().unwrap();
+        // LANDLOCK_ACCESS_FS_EXECUTE, LANDLOCK_ACCESS_FS_REFER,
+        // LANDLOCK_ACCESS_FS_TRUNCATE, LANDLOCK_ACCESS_NET_CONNECT_TCP, and
+        // LANDLOCK_SCOPE_SIGNAL.
+        assert_eq!(
+            resolved.ruleset_attr(ABI::V6),
+            (1 | 1 << 13 | 1 << 14, 1 << 1, 1 << 1)
+        );
+        assert_eq!(
+            resolved.ruleset_attr(ABI::V3),
+            (1 | 1 << 13 | 1 << 14, 0, 0)
+        );
+        assert_eq!(resolved.ruleset_attr(ABI::V1), (1, 0, 0));
+        assert_eq!(resolved.ruleset_attr(ABI::Unsupported), (0, 0, 0));
+    }
+}
+
+#[cfg(test)]
+mod tests_read_only_root {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{restricted_thread, TempDir};
+
+    #[test]
+    fn test_read_only_root() {
+        let config = Config::read_only_root(ABI::V6, ["/tmp", "/var/tmp"]);
+        let resolved = config.resolve().unwrap();
+        assert_eq!(resolved.handled_fs, AccessFs::from_all(ABI::V6));
+        assert_eq!(
+            resolved.denied().0,
+            AccessFs::from_write(ABI::V6),
+            "only writes are denied somewhere"
+        );
+        assert_eq!(
+            resolved.rules_path_beneath,
+            [
+                (PathBuf::from("/"), AccessFs::from_read(ABI::V6)),
+                (PathBuf::from("/tmp"), AccessFs::from_write(ABI::V6)),
+                (PathBuf::from("/var/tmp"), AccessFs::from_write(ABI::V6)),
+            ]
+            .into()
+        );
+    }
+
+    #[test]
+    fn test_read_only_root_enforced() {
+        let dir = TempDir::new("config-read-only");
+        let file = dir.path().join("file");
+        fs::write(&file, "").unwrap();
+
+        let writable = dir.path().to_str().unwrap().to_string();
+        let resolved = Config::read_only_root(ABI::V6, [writable])
+            .resolve()
+            .unwrap();
+        let thread_file = file.clone();
+        restricted_thread(resolved, move || {
+            assert!(!probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+            assert!(!probe_denied("/", AccessFs::ReadDir).unwrap());
+            assert!(probe_denied("/etc/passwd", AccessFs::WriteFile).unwrap());
+            assert!(!probe_denied(&thread_file, AccessFs::ReadFile).unwrap());
+            assert!(!probe_denied(&thread_file, AccessFs::WriteFile).unwrap());
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests_build_ruleset_observed {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    #[test]
+    fn test_build_ruleset_observed() {
+        let resolved = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr", "/etc", "/landlockconfig-missing" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+
+        let mut observed = Vec::new();
+        let (_, rule_errors) = resolved
+            .build_ruleset_observed(|rule, built, outcome| {
+                let built = match built {
+                    BuiltRule::PathBeneath { path, .. } => path.display().to_string(),
+                    BuiltRule::MountPoint { .. } => unreachable!(),
+                    BuiltRule::NetPort { port, .. } => port.to_string(),
+                };
+                observed.push((rule, built, outcome.map_err(|e| e.to_string())));
+            })
+            .unwrap();
+
+        // Paths are sorted.
+        assert_eq!(rule_errors.len(), 1);
+        assert_eq!(
+            observed,
+            [
+                (0, "/etc".into(), Ok(())),
+                (
+                    1,
+                    "/landlockconfig-missing".into(),
+                    Err(rule_errors[0].to_string())
+                ),
+                (2, "/usr".into(), Ok(())),
+                (3, "443".into(), Ok(())),
+            ]
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests_deny_all {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::restricted_thread;
+
+    #[test]
+    fn test_deny_all() {
+        let config = Config::deny_all(ABI::V6);
+        assert!(config.warnings().is_empty());
+        let resolved = config.resolve().unwrap();
+        assert_eq!(
+            resolved.denied(),
+            (
+                AccessFs::from_all(ABI::V6),
+                AccessNet::from_all(ABI::V6),
+                Scope::from_all(ABI::V6)
+            )
+        );
+        assert!(resolved.rules_path_beneath.is_empty());
+        assert!(resolved.rules_net_port.is_empty());
+
+        // A ruleset without rules is still valid.
+        let (_, rule_errors) = resolved.build_ruleset().unwrap();
+        assert!(rule_errors.is_empty());
+
+        restricted_thread(resolved, || {
+            assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+            assert!(probe_denied("/", AccessFs::ReadDir).unwrap());
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests_deny_only {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{restricted_thread, TempDir};
+
+    #[test]
+    fn test_deny_only() {
+        let denied = AccessFs::WriteFile | AccessFs::Truncate;
+        let config = Config::deny_only(denied);
+        assert!(config.warnings().is_empty());
+        let resolved = config.resolve().unwrap();
+        assert_eq!(
+            resolved.denied(),
+            (denied, BitFlags::EMPTY, BitFlags::EMPTY)
+        );
+        assert!(resolved.rules_path_beneath.is_empty());
+
+        let dir = TempDir::new("config-deny-only");
+        let file = dir.path().join("file");
+        fs::write(&file, "").unwrap();
+        restricted_thread(resolved, move || {
+            assert!(probe_denied(&file, AccessFs::WriteFile).unwrap());
+            // Unhandled accesses still work.
+            assert!(!probe_denied(&file, AccessFs::ReadFile).unwrap());
+            assert!(!probe_denied("/", AccessFs::ReadDir).unwrap());
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests_deny_network {
+    use super::*;
+    use crate::kernel;
+    use crate::tests_helpers::{parse_json, restricted_thread};
+    use std::io::ErrorKind;
+    use std::net::{TcpListener, TcpStream};
+
+    fn config() -> Config {
+        let mut config = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        config.deny_network();
+        config
+    }
+
+    #[test]
+    fn test_deny_network() {
+        let resolved = config().resolve().unwrap();
+        assert_eq!(
+            resolved.handled_net,
+            AccessNet::BindTcp | AccessNet::ConnectTcp
+        );
+        assert!(resolved.rules_net_port.is_empty());
+        assert_eq!(
+            resolved.rules_path_beneath,
+            [(PathBuf::from("/usr"), AccessFs::ReadFile.into())].into()
+        );
+
+        // Network access rights are ignored by older kernels.
+        assert_eq!(
+            resolved.ruleset_attr(ABI::V3),
+            (BitFlags::from(AccessFs::ReadFile).bits(), 0, 0)
+        );
+    }
+
+    #[test]
+    fn test_deny_network_enforced() {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let addr = listener.local_addr().unwrap();
+        let resolved = config().resolve().unwrap();
+
+        restricted_thread(resolved, move || {
+            if kernel::abi_version() < 4 {
+                eprintln!("Landlock network access control is not supported");
+                return;
+            }
+            assert_eq!(
+                TcpStream::connect(addr).unwrap_err().kind(),
+                ErrorKind::PermissionDenied
+            );
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests_parse_file {
+    use super::*;
+
+    fn composition(name: &str) -> PathBuf {
+        PathBuf::from(env!("CARGO_MANIFEST_DIR"))
+            .join("tests/composition")
+            .join(name)
+    }
+
+    #[cfg(feature = "toml")]
+    #[test]
+    fn test_parse_file() {
+        assert_eq!(
+            Config::parse_file(composition("s.json"), ConfigFormat::Json).unwrap(),
+            Config::parse_file(composition("s.toml"), ConfigFormat::Toml).unwrap()
+        );
+    }
+
+    #[test]
+    fn test_parse_file_not_found() {
+        let err = Config::parse_file(composition("nonexistent.json"), ConfigFormat::Json);
+        assert!(matches!(
+            err,
+            Err(ParseFileError::Io(e)) if e.kind() == std::io::ErrorKind::NotFound
+        ));
+    }
+
+    #[test]
+    fn test_parse_file_wrong_format() {
+        let err = Config::parse_file(composition("s.toml"), ConfigFormat::Json);
+        assert!(matches!(err, Err(ParseFileError::ParseJson(_))));
+    }
+}
+
+#[cfg(test)]
+mod tests_directory {
+    use super::*;
+
+    fn rule_errors(rules: &[(&str, BitFlags<AccessFs>)]) -> Vec<RuleError> {
+        let manifest_dir = Path::new(env!("CARGO_MANIFEST_DIR"));
+        let resolved = ResolvedConfig {
+            handled_fs: AccessFs::from_all(ABI::V6),
+            rules_path_beneath: rules
+                .iter()
+                .map(|(path, access)| (manifest_dir.join(path), *access))
+                .collect(),
+            ..Default::default()
+        };
+        resolved.build_ruleset().unwrap().1
+    }
+
+    #[test]
+    fn test_directory_access_on_file() {
+        let errors = rule_errors(&[(
+            "tests/composition/s.json",
+            AccessFs::ReadFile | AccessFs::ReadDir | AccessFs::MakeReg,
+        )]);
+        let [RuleError::NotDirectory { path, access }] = errors.as_slice() else {
+            panic!("unexpected rule errors: {errors:?}");
+        };
+        assert!(path.ends_with("tests/composition/s.json"));
+        assert_eq!(*access, AccessFs::ReadDir | AccessFs::MakeReg);
+    }
+
+    #[test]
+    fn test_matching_access() {
+        let errors = rule_errors(&[
+            (
+                "tests/composition/s.json",
+                AccessFs::ReadFile | AccessFs::WriteFile | AccessFs::Truncate,
+            ),
+            (
+                "tests/composition",
+                AccessFs::ReadFile | AccessFs::ReadDir | AccessFs::MakeReg,
+            ),
+        ]);
+        assert!(errors.is_empty(), "unexpected rule errors: {errors:?}");
+    }
+
+    #[test]
+    fn test_write_execute() {
+        // W^X is only a lint, see write_execute_paths().
+        let errors = rule_errors(&[("tests", AccessFs::WriteFile | AccessFs::Execute)]);
+        assert!(errors.is_empty(), "unexpected rule errors: {errors:?}");
+    }
+}
+
+#[cfg(test)]
+mod tests_opener {
+    use super::*;
+    use std::io;
+
+    #[test]
+    fn test_build_ruleset_with() {
+        let resolved = ResolvedConfig {
+            handled_fs: AccessFs::ReadFile.into(),
+            rules_path_beneath: [
+                (PathBuf::from("/usr"), AccessFs::ReadFile.into()),
+                (PathBuf::from("/broker/denied"), AccessFs::ReadFile.into()),
+            ]
+            .into(),
+            ..Default::default()
+        };
+
+        // The broker maps configured paths to other files.
+        let mut opened = Vec::new();
+        let (_, rule_errors) = resolved
+            .build_ruleset_with(|path| {
+                opened.push(path.to_path_buf());
+                if path == Path::new("/usr") {
+                    Ok(File::open(env!("CARGO_MANIFEST_DIR"))?.into())
+                } else {
+                    Err(io::Error::from(io::ErrorKind::PermissionDenied))
+                }
+            })
+            .unwrap();
+        assert_eq!(opened, ["/broker/denied", "/usr"].map(PathBuf::from));
+        let [RuleError::Open { path, source }] = rule_errors.as_slice() else {
+            panic!("unexpected rule errors: {rule_errors:?}");
+        };
+        assert_eq!(path, Path::new("/broker/denied"));
+        assert_eq!(source.kind(), io::ErrorKind::PermissionDenied);
+    }
+}
+
+#[cfg(test)]
+mod tests_retain {
+    use super::*;
+    use crate::kernel;
+    use crate::probe_denied;
+    use crate::tests_helpers::{parse_json, restricted_thread};
+    use std::io::ErrorKind;
+    use std::net::{TcpListener, TcpStream};
+
+    fn mixed() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_retain() {
+        let full = mixed();
+        let mut all = full.clone();
+        all.retain(&[Restriction::Fs, Restriction::Net, Restriction::Scope]);
+        assert_eq!(all, full);
+
+        let mut fs_only = full.clone();
+        fs_only.retain(&[Restriction::Fs]);
+        assert_eq!(
+            fs_only,
+            ResolvedConfig {
+                handled_fs: full.handled_fs,
+                rules_path_beneath: full.rules_path_beneath.clone(),
+                ..Default::default()
+            }
+        );
+
+        let mut net_only = full.clone();
+        net_only.retain(&[Restriction::Net]);
+        assert_eq!(
+            net_only,
+            ResolvedConfig {
+                handled_net: full.handled_net,
+                rules_net_port: full.rules_net_port.clone(),
+                ..Default::default()
+            }
+        );
+
+        let mut scope_only = full.clone();
+        scope_only.retain(&[Restriction::Scope]);
+        assert_eq!(
+            scope_only,
+            ResolvedConfig {
+                scoped: full.scoped,
+                ..Default::default()
+            }
+        );
+
+        let mut none = full;
+        none.retain(&[]);
+        assert_eq!(none, ResolvedConfig::default());
+    }
+
+    // Enforces `kinds` of the mixed configuration in a dedicated thread, and
+    // returns whether /etc/passwd and a local TCP connection are denied.
+    fn enforce(kinds: &'static [Restriction]) -> Option<(bool, bool)> {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let addr = listener.local_addr().unwrap();
+        let mut resolved = mixed();
+        resolved.retain(kinds);
+
+        restricted_thread(resolved, move || {
+            if kernel::abi_version() < 4 {
+                eprintln!("Landlock network access control is not supported");
+                return None;
+            }
+            let fs_denied = probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap();
+            let net_denied = match TcpStream::connect(addr) {
+                Ok(_) => false,
+                Err(e) => {
+                    assert_eq!(e.kind(), ErrorKind::PermissionDenied);
+                    true
+                }
+            };
+            Some((fs_denied, net_denied))
+        })
+        .flatten()
+    }
+
+    #[test]
+    fn test_retain_enforced() {
+        if let Some(denied) = enforce(&[Restriction::Fs]) {
+            assert_eq!(denied, (true, false));
+        }
+        if let Some(denied) = enforce(&[Restriction::Net]) {
+            assert_eq!(denied, (false, true));
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests_warnings {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    #[test]
+    fn test_no_net_port_rule() {
+        let config = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessNet": [ "bind_tcp", "connect_tcp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 8080 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(
+            config.warnings(),
+            [ConfigWarning::NoNetPortRule(AccessNet::ConnectTcp.into())]
+        );
+    }
+
+    #[test]
+    fn test_no_net_port_rule_allow_none() {
+        let config = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "allowNone": true
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(config.warnings(), []);
+
+        // The acknowledgment is kept when serializing.
+        assert!(serde_json::to_string(&config)
+            .unwrap()
+            .contains(r#""allowNone":true"#));
+
+        // Composing with a configuration allowing some ports.
+        let mut composed = parse_json(
+            r#"{
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(composed.warnings(), []);
+        composed.compose(&config);
+        assert_eq!(composed.warnings(), []);
+    }
+
+    #[test]
+    fn test_no_warning() {
+        let mut config = Config::empty();
+        assert_eq!(config.warnings(), []);
+        config.deny_network();
+        assert_eq!(config.warnings(), []);
+    }
+
+    #[test]
+    fn test_net_port_warnings() {
+        let config = parse_json(
+            r#"{
+                "netPort": [
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 443, 8080 ]
+                    },
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 80, 443, 5432 ]
+                    },
+                    {
+                        "allowedAccess": [ "bind_tcp", "connect_tcp" ],
+                        "port": [ 9000 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(
+            config.warnings(),
+            [
+                ConfigWarning::BindClientPort(443),
+                ConfigWarning::BindAndConnect(443),
+                ConfigWarning::BindAndConnect(9000),
+            ]
+        );
+        assert_eq!(
+            config.net_port_warnings(&[8080]),
+            [
+                ConfigWarning::BindAndConnect(443),
+                ConfigWarning::BindClientPort(8080),
+                ConfigWarning::BindAndConnect(9000),
+            ]
+        );
+
+        // Sensible rules.
+        let config = parse_json(
+            r#"{
+                "netPort": [
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 8080 ]
+                    },
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 80, 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(config.warnings(), []);
+    }
+
+    #[cfg(feature = "toml")]
+    #[test]
+    fn test_no_net_port_rule_toml() {
+        let toml = r#"
+            [[ruleset]]
+            handled_access_net = [ "connect_tcp" ]
+        "#;
+        assert_eq!(
+            Config::parse_toml(toml).unwrap().warnings(),
+            [ConfigWarning::NoNetPortRule(AccessNet::ConnectTcp.into())]
+        );
+        let toml = r#"
+            [[ruleset]]
+            handled_access_net = [ "connect_tcp" ]
+            allow_none = true
+        "#;
+        assert_eq!(Config::parse_toml(toml).unwrap().warnings(), []);
+    }
+}
+
+#[cfg(test)]
+mod tests_limits {
+    use super::*;
+    use std::io;
+
+    #[test]
+    fn test_from_io_too_large() {
+        let error = io::Error::from_raw_os_error(libc::E2BIG);
+        let err = map_errno(Operation::AddRule, &error, None).unwrap();
+        assert!(matches!(
+            &err,
+            BuildRulesetError::RulesetTooLarge { rule: None, source }
+                if source.raw_os_error() == Some(libc::E2BIG)
+        ));
+        assert!(err
+            .to_string()
+            .starts_with("ruleset exceeds a kernel limit: "));
+    }
+
+    #[test]
+    fn test_from_io_unsupported_access() {
+        let error = io::Error::from_raw_os_error(libc::EINVAL);
+        let err = map_errno(Operation::AddRule, &error, Some(3)).unwrap();
+        assert!(matches!(
+            &err,
+            BuildRulesetError::UnsupportedAccess { rule: Some(3), source }
+                if source.raw_os_error() == Some(libc::EINVAL)
+        ));
+        assert!(err
+            .to_string()
+            .starts_with("unsupported access rights for rule 3: "));
+    }
+
+    #[test]
+    fn test_from_io_other() {
+        for error in [
+            io::Error::from_raw_os_error(libc::ENOMEM),
+            io::Error::other("not an errno"),
+        ] {
+            assert!(map_errno(Operation::AddRule, &error, Some(0)).is_none());
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests_required {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    fn resolved(parent: &str, required: bool) -> ResolvedConfig {
+        parse_json(&format!(
+            r#"{{
+                "pathBeneath": [
+                    {{
+                        "allowedAccess": [ "read_file", "refer" ],
+                        "parent": [ "{parent}" ],
+                        "required": {required}
+                    }},
+                    {{
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/etc" ]
+                    }}
+                ],
+                "netPort": [
+                    {{
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ],
+                        "required": {required}
+                    }}
+                ]
+            }}"#
+        ))
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_required_parse() {
+        let config = resolved("/usr", true);
+        assert_eq!(config.required_paths, [PathBuf::from("/usr")].into());
+        assert_eq!(config.required_ports, [443].into());
+        assert!(serde_json::to_string(&config)
+            .unwrap()
+            .contains(r#""parent":["/usr"],"required":true}"#));
+
+        let config = resolved("/usr", false);
+        assert!(config.required_paths.is_empty());
+        assert!(config.required_ports.is_empty());
+    }
+
+    #[test]
+    fn test_required_unsupported() {
+        let required = resolved("/usr", true);
+        assert!(matches!(
+            required.check_supported(ABI::V1),
+            Err(BuildRulesetError::RequiredFsAccess { path, access })
+                if path == Path::new("/usr") && access == AccessFs::Refer.into()
+        ));
+        assert!(matches!(
+            required.check_supported(ABI::V3),
+            Err(BuildRulesetError::RequiredNetAccess { port: 443, access })
+                if access == AccessNet::ConnectTcp.into()
+        ));
+        assert!(required.check_supported(ABI::V4).unwrap().is_empty());
+
+        // Best-effort rules are only dropped with a warning.
+        let rule_errors = resolved("/usr", false).check_supported(ABI::V1).unwrap();
+        assert!(matches!(
+            rule_errors.as_slice(),
+            [
+                RuleError::UnsupportedFsAccess { path, access },
+                RuleError::UnsupportedNetAccess { port: 443, .. },
+            ] if path == Path::new("/usr") && *access == AccessFs::Refer.into()
+        ));
+        assert!(resolved("/usr", false)
+            .check_supported(ABI::Unsupported)
+            .unwrap()
+            .is_empty());
+    }
+
+    #[test]
+    fn test_required_missing() {
+        let missing = "/does/not/exist";
+        assert!(matches!(
+            resolved(missing, true).build_ruleset(),
+            Err(BuildRulesetError::RequiredRule(RuleError::PathFd(_)))
+        ));
+
+        let (_, rule_errors) = resolved(missing, false).build_ruleset().unwrap();
+        assert!(rule_errors
+            .iter()
+            .any(|e| matches!(e, RuleError::PathFd(_))));
+    }
+}
+
+#[cfg(test)]
+mod tests_max_abi {
+    use super::*;
+
+    const JSON: &str = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "execute", "refer", "truncate", "ioctl_dev" ],
+                "handledAccessNet": [ "connect_tcp" ],
+                "scoped": [ "signal" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute", "refer", "truncate" ],
+                "parent": [ "/usr" ]
+            }
+        ],
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ]
+            }
+        ],
+        "when": [
+            {
+                "minAbi": 3,
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/opt" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    fn parse(enable: bool, value: Option<&str>) -> Result<Config, ParseJsonError> {
+        let options = ParseOptions::new()
+            .kernel_abi(ABI::V6)
+            .max_abi_from_env(enable)
+            .env(value.map(|value| (MAX_ABI_ENV, value)));
+        Config::parse_json_with(JSON.as_bytes(), &options)
+    }
+
+    #[test]
+    fn test_max_abi_from_env() {
+        let ignored = parse(false, Some("2"));
+        let capped = parse(true, Some("2"));
+        let invalid = parse(true, Some("v2"));
+        let unset = parse(true, None);
+
+        // The environment is only read if enabled.
+        let full = ignored.unwrap();
+        assert_eq!(full.handled_fs.iter().count(), 4);
+        assert_eq!(full.rules_path_beneath.len(), 1);
+        assert_eq!(full.when.len(), 1);
+        assert_eq!(unset.unwrap(), full);
+        assert!(matches!(
+            invalid,
+            Err(ParseJsonError::Config(ConfigError::InvalidMaxAbi(value))) if value == "v2"
+        ));
+
+        let capped = capped.unwrap();
+        assert_eq!(capped.abi, Some(ABI::V2));
+        assert_eq!(capped.handled_fs, AccessFs::Execute | AccessFs::Refer);
+        assert!(capped.handled_net.is_empty());
+        assert!(capped.scoped.is_empty());
+        // The when block requires ABI 3.
+        assert!(capped.when.is_empty());
+        assert_eq!(
+            capped.rules_path_beneath,
+            [(
+                TemplateString::from_text("/usr"),
+                AccessFs::Execute | AccessFs::Refer
+            )]
+            .into()
+        );
+        assert!(capped.rules_net_port.is_empty());
+
+        // The ruleset is then built with the capped access rights.
+        let resolved = capped.resolve().unwrap();
+        assert_eq!(
+            resolved.ruleset_attr(ABI::V6),
+            ((AccessFs::Execute | AccessFs::Refer).bits(), 0, 0)
+        );
+        let (_, rule_errors) = resolved.build_ruleset().unwrap();
+        assert!(rule_errors.is_empty());
+    }
+}
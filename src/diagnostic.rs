@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::ConfigWarning;
+use crate::Config;
+use serde::Serialize;
+use serde_json::Value;
+
+/// Version of the JSON document returned by [`Config::diagnostics_json()`],
+/// incremented with each incompatible change.
+pub const DIAGNOSTICS_VERSION: u32 = 1;
+
+#[derive(Serialize)]
+struct JsonDiagnostics {
+    version: u32,
+    diagnostics: Vec<JsonDiagnostic>,
+}
+
+#[derive(Serialize)]
+struct JsonDiagnostic {
+    severity: &'static str,
+    code: &'static str,
+    message: String,
+    /// JSON pointer (RFC 6901) in the serialized configuration.
+    location: String,
+    /// Index of the rule in its array, if the diagnostic is about a rule.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    rule: Option<usize>,
+}
+
+/// Returns whether a serialized `allowedAccess` allows both `write_file` and
+/// `execute`.
+fn is_write_execute(rule: &Value) -> bool {
+    let Some(access) = rule.get("allowedAccess").and_then(Value::as_array) else {
+        return false;
+    };
+    ["write_file", "execute"]
+        .iter()
+        .all(|name| access.iter().any(|a| a == name))
+}
+
+impl Config {
+    /// Serializes the findings about this configuration as a JSON document,
+    /// e.g. to convert them to CI annotations.
+    ///
+    /// The document is an object with a `version` (see
+    /// [`DIAGNOSTICS_VERSION`]) and a `diagnostics` array.  Each diagnostic has
+    /// a `severity` (currently always `warning`), a stable `code`, a
+    /// `message`, a `location` which is a JSON pointer in the serialized
+    /// configuration (which is normalized, not the parsed one), and a `rule`
+    /// index for rule diagnostics.  Codes are:
+    /// - `no-net-port-rule`: see [`ConfigWarning::NoNetPortRule`];
+    /// - `bind-client-port`: see [`ConfigWarning::BindClientPort`];
+    /// - `bind-and-connect`: see [`ConfigWarning::BindAndConnect`];
+    /// - `write-execute`: a `pathBeneath` rule allows both `write_file` and
+    ///   `execute` (i.e. no W^X).
+    ///
+    /// Unlike rule errors, these diagnostics do not depend on the filesystem.
+    pub fn diagnostics_json(&self) -> serde_json::Result<Vec<u8>> {
+        let json = serde_json::to_value(self)?;
+        let net_rules = json
+            .get("netPort")
+            .and_then(Value::as_array)
+            .map(Vec::as_slice)
+            .unwrap_or_default();
+        let net_rule = |port: u64| {
+            net_rules.iter().position(|rule| {
+                rule.get("port")
+                    .and_then(Value::as_array)
+                    .is_some_and(|ports| ports.iter().any(|p| p.as_u64() == Some(port)))
+            })
+        };
+
+        let mut diagnostics: Vec<_> = self
+            .warnings()
+            .into_iter()
+            .map(|warning| {
+                let (code, rule) = match warning {
+                    ConfigWarning::NoNetPortRule(_) => ("no-net-port-rule", None),
+                    ConfigWarning::BindClientPort(port) => ("bind-client-port", net_rule(port)),
+                    ConfigWarning::BindAndConnect(port) => ("bind-and-connect", net_rule(port)),
+                };
+                JsonDiagnostic {
+                    severity: "warning",
+                    code,
+                    message: warning.to_string(),
+                    location: match rule {
+                        Some(index) => format!("/netPort/{index}"),
+                        None => "/ruleset/0".into(),
+                    },
+                    rule,
+                }
+            })
+            .collect();
+
+        let rules = json
+            .get("pathBeneath")
+            .and_then(Value::as_array)
+            .map(Vec::as_slice)
+            .unwrap_or_default();
+        for (index, rule) in rules.iter().enumerate() {
+            if is_write_execute(rule) {
+                let parents = rule
+                    .get("parent")
+                    .and_then(Value::as_array)
+                    .map(Vec::as_slice)
+                    .unwrap_or_default()
+                    .iter()
+                    .filter_map(Value::as_str)
+                    .collect::<Vec<_>>()
+                    .join(", ");
+                diagnostics.push(JsonDiagnostic {
+                    severity: "warning",
+                    code: "write-execute",
+                    message: format!("{parents} allows both write_file and execute"),
+                    location: format!("/pathBeneath/{index}"),
+                    rule: Some(index),
+                });
+            }
+        }
+
+        let mut data = serde_json::to_vec_pretty(&JsonDiagnostics {
+            version: DIAGNOSTICS_VERSION,
+            diagnostics,
+        })?;
+        data.push(b'\n');
+        Ok(data)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use crate::tests_helpers::parse_json;
+
+    const GOLDEN: &str = include_str!("../tests/diagnostics/golden.json");
+
+    #[test]
+    fn test_diagnostics_json() {
+        let config = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessNet": [ "bind_tcp", "connect_tcp" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "execute", "write_file" ],
+                        "parent": [ "/tmp", "/var/tmp" ]
+                    },
+                    {
+                        "allowedAccess": [ "execute", "read_dir", "write_file" ],
+                        "parent": [ "/home" ],
+                        "mountPoint": true
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 80, 8080 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        let json = config.diagnostics_json().unwrap();
+        assert_eq!(String::from_utf8(json).unwrap(), GOLDEN);
+    }
+
+    #[test]
+    fn test_diagnostics_json_empty() {
+        let config =
+            parse_json(r#"{ "ruleset": [ { "handledAccessFs": [ "execute" ] } ] }"#).unwrap();
+        assert_eq!(
+            String::from_utf8(config.diagnostics_json().unwrap()).unwrap(),
+            "{\n  \"version\": 1,\n  \"diagnostics\": []\n}\n"
+        );
+    }
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+#[cfg(feature = "toml")]
+use crate::config::ParseTomlError;
+use crate::config::{ConfigFormat, ParseJsonError, ParseOptions};
+use crate::{Config, OptionalConfig};
+use std::collections::BTreeMap;
+use std::path::Path;
+use thiserror::Error;
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum ParseEmbeddedError {
+    #[error("unknown configuration format: {0}")]
+    UnknownFormat(String),
+    #[error(transparent)]
+    ParseJson(#[from] ParseJsonError),
+    #[cfg(feature = "toml")]
+    #[error("invalid UTF-8: {0}")]
+    Utf8(#[from] std::str::Utf8Error),
+    #[cfg(feature = "toml")]
+    #[error(transparent)]
+    ParseToml(#[from] ParseTomlError),
+    // Use BTreeMap for deterministic errors.
+    #[error("failed to parse configuration file(s):\n\n{}", format_parse_files_error(.0))]
+    ParseFiles(BTreeMap<String, ParseEmbeddedError>),
+    #[error("no configuration file found")]
+    NoConfigFile,
+}
+
+fn format_parse_files_error(errors: &BTreeMap<String, ParseEmbeddedError>) -> String {
+    errors
+        .iter()
+        .map(|(name, error)| format!("{name}: {error}"))
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+impl ConfigFormat {
+    /// Returns the format of a file name according to its extension.
+    pub(crate) fn from_name(name: &str) -> Option<Self> {
+        match Path::new(name).extension()?.to_str()? {
+            "json" => Some(ConfigFormat::Json),
+            #[cfg(feature = "toml")]
+            "toml" => Some(ConfigFormat::Toml),
+            _ => None,
+        }
+    }
+}
+
+impl Config {
+    /// Parses a configuration embedded in the program, e.g. with
+    /// `include_bytes!("policy.toml")`, with the format matching the extension
+    /// of `name`.
+    ///
+    /// This works like [`parse_file()`](Config::parse_file), without writing
+    /// the data to a file first.
+    pub fn parse_embedded(name: &str, data: &[u8]) -> Result<Self, ParseEmbeddedError> {
+        Self::parse_embedded_with(name, data, &Default::default())
+    }
+
+    pub fn parse_embedded_with(
+        name: &str,
+        data: &[u8],
+        options: &ParseOptions,
+    ) -> Result<Self, ParseEmbeddedError> {
+        match ConfigFormat::from_name(name) {
+            Some(ConfigFormat::Json) => Ok(Self::parse_json_with(data, options)?),
+            #[cfg(feature = "toml")]
+            Some(ConfigFormat::Toml) => {
+                Ok(Self::parse_toml_with(std::str::from_utf8(data)?, options)?)
+            }
+            None => Err(ParseEmbeddedError::UnknownFormat(name.into())),
+        }
+    }
+
+    /// Parses and composes embedded configuration files, given as file names
+    /// and contents, like [`parse_directory()`](Config::parse_directory).
+    ///
+    /// Each file is parsed according to its extension, which allows mixing
+    /// JSON and TOML files.  Files with another extension or with a name
+    /// starting with '.' are ignored.
+    pub fn parse_embedded_directory(files: &[(&str, &[u8])]) -> Result<Self, ParseEmbeddedError> {
+        let mut full_config = None;
+        let mut errors = BTreeMap::new();
+
+        for (name, data) in files {
+            let hidden = Path::new(name)
+                .file_name()
+                .and_then(|n| n.to_str())
+                .is_some_and(|n| n.starts_with('.'));
+            if hidden || ConfigFormat::from_name(name).is_none() {
+                continue;
+            }
+
+            match Self::parse_embedded(name, data) {
+                Ok(config) => full_config.compose(&config),
+                Err(e) => {
+                    errors.insert(name.to_string(), e);
+                }
+            }
+        }
+
+        if !errors.is_empty() {
+            return Err(ParseEmbeddedError::ParseFiles(errors));
+        }
+        full_config.ok_or(ParseEmbeddedError::NoConfigFile)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::TempDir;
+    use landlock::AccessFs;
+
+    const JSON: &[u8] = br#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute", "read_file" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+
+    #[cfg(feature = "toml")]
+    const TOML: &[u8] = br#"
+        [[path_beneath]]
+        allowed_access = [ "execute", "read_file" ]
+        parent = [ "/etc" ]
+    "#;
+
+    #[test]
+    fn test_parse_embedded() {
+        let config = Config::parse_embedded("policy.json", JSON).unwrap();
+        assert_eq!(
+            config.rules_path_beneath.values().collect::<Vec<_>>(),
+            [&(AccessFs::Execute | AccessFs::ReadFile)]
+        );
+
+        // Same as the on-disk variant.
+        let dir = TempDir::new("embed-parse");
+        let path = dir.path().join("policy.json");
+        std::fs::write(&path, JSON).unwrap();
+        assert_eq!(
+            Config::parse_file(&path, ConfigFormat::Json).unwrap(),
+            config
+        );
+
+        assert!(matches!(
+            Config::parse_embedded("policy.yaml", JSON),
+            Err(ParseEmbeddedError::UnknownFormat(name)) if name == "policy.yaml"
+        ));
+        assert!(matches!(
+            Config::parse_embedded("policy.json", b"{"),
+            Err(ParseEmbeddedError::ParseJson(_))
+        ));
+    }
+
+    #[cfg(feature = "toml")]
+    #[test]
+    fn test_parse_embedded_directory() {
+        let config = Config::parse_embedded_directory(&[
+            ("policy.d/10-fs.json", JSON),
+            ("policy.d/20-net.toml", TOML),
+            ("policy.d/.hidden.json", b"{"),
+            ("policy.d/README", b"not a configuration"),
+        ])
+        .unwrap();
+        let mut expected = Config::parse_embedded("fs.json", JSON).unwrap();
+        expected.compose(&Config::parse_embedded("net.toml", TOML).unwrap());
+        assert_eq!(config, expected);
+        assert_eq!(config.rules_path_beneath.len(), 2);
+
+        match Config::parse_embedded_directory(&[("a.json", JSON), ("b.toml", b"[")]) {
+            Err(ParseEmbeddedError::ParseFiles(errors)) => {
+                assert_eq!(errors.keys().collect::<Vec<_>>(), ["b.toml"]);
+                assert!(matches!(errors["b.toml"], ParseEmbeddedError::ParseToml(_)));
+            }
+            ret => panic!("{ret:?}"),
+        }
+
+        assert!(matches!(
+            Config::parse_embedded_directory(&[("README", b"")]),
+            Err(ParseEmbeddedError::NoConfigFile)
+        ));
+    }
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{rule_index, BuildRulesetError, RuleError};
+use std::fmt;
+use std::io;
+use thiserror::Error;
+
+/// Syscall-backed operation which failed, see [`SyscallError`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum Operation {
+    /// Creating a ruleset, e.g. with handled access rights not supported by
+    /// the running kernel.
+    CreateRuleset,
+    /// Adding a rule to a ruleset.
+    AddRule,
+    /// Enforcing a ruleset on the calling thread.
+    RestrictSelf,
+    /// Opening the path of a rule.
+    OpenPath,
+}
+
+impl fmt::Display for Operation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            Self::CreateRuleset => "creating the ruleset",
+            Self::AddRule => "adding a rule",
+            Self::RestrictSelf => "restricting the thread",
+            Self::OpenPath => "opening a rule path",
+        })
+    }
+}
+
+/// Kernel error of a syscall-backed operation, with a human explanation of its
+/// errno.
+///
+/// The errno is kept as is in the [`io::Error`] source, e.g. to compare it
+/// with [`raw_os_error()`](io::Error::raw_os_error) or to return it from a C
+/// API.  Known errnos are explained according to the operation:
+///
+/// | errno        | operation          | explanation                                  |
+/// |--------------|--------------------|----------------------------------------------|
+/// | `ENOSYS`     | any                | Landlock is not supported by the kernel      |
+/// | `EOPNOTSUPP` | any                | Landlock is disabled by the kernel           |
+/// | `E2BIG`      | any                | a kernel limit is exceeded (e.g. 16 layers)  |
+/// | `EINVAL`     | create, add rule   | unsupported or unhandled access rights       |
+/// | `EINVAL`     | restrict self      | unsupported flags                            |
+/// | `EPERM`      | restrict self      | no `no_new_privs` nor `CAP_SYS_ADMIN`        |
+/// | `EPERM`      | other              | operation not permitted                      |
+/// | `EACCES`     | any                | denied, e.g. by an enforced Landlock domain  |
+/// | `ENOENT`     | open path          | the path does not exist                      |
+#[derive(Debug, Error)]
+#[error("{op} failed{}: {source}{}", rule_index(.rule), explanation_suffix(*.op, .source))]
+#[non_exhaustive]
+pub struct SyscallError {
+    pub op: Operation,
+    /// Index of the rule being added or opened, if any.
+    pub rule: Option<usize>,
+    #[source]
+    pub source: io::Error,
+}
+
+fn explanation_suffix(op: Operation, source: &io::Error) -> String {
+    source
+        .raw_os_error()
+        .and_then(|errno| explain(op, errno))
+        .map(|explanation| format!(" ({explanation})"))
+        .unwrap_or_default()
+}
+
+/// Explains the errnos returned by the Landlock syscalls and open(2), see
+/// [`SyscallError`].
+fn explain(op: Operation, errno: i32) -> Option<&'static str> {
+    Some(match (errno, op) {
+        (libc::ENOSYS, _) => "Landlock is not supported by the running kernel",
+        (libc::EOPNOTSUPP, _) => "Landlock is supported but disabled by the running kernel",
+        (libc::E2BIG, _) => "a kernel limit is exceeded, e.g. more than 16 nested layers",
+        (libc::EINVAL, Operation::CreateRuleset) => "unsupported access rights",
+        (libc::EINVAL, Operation::AddRule) => {
+            "unsupported access rights, or access rights not handled by the ruleset"
+        }
+        (libc::EINVAL, Operation::RestrictSelf) => "unsupported flags",
+        (libc::EPERM, Operation::RestrictSelf) => {
+            "the thread is not no_new_privs and lacks the CAP_SYS_ADMIN capability"
+        }
+        (libc::EPERM, _) => "operation not permitted",
+        (libc::EACCES, _) => "access denied, e.g. by an enforced Landlock domain",
+        (libc::ENOENT, Operation::OpenPath) => "the path does not exist",
+        _ => return None,
+    })
+}
+
+impl SyscallError {
+    pub fn new(op: Operation, rule: Option<usize>, source: io::Error) -> Self {
+        Self { op, rule, source }
+    }
+
+    pub fn errno(&self) -> Option<i32> {
+        self.source.raw_os_error()
+    }
+
+    /// Returns the explanation of the errno for this operation, if it is a
+    /// known one.
+    pub fn explanation(&self) -> Option<&'static str> {
+        explain(self.op, self.errno()?)
+    }
+}
+
+/// Maps a kernel error to a [`BuildRulesetError`], which is the only place
+/// where the errnos of the Landlock syscalls are interpreted:
+/// - `E2BIG` is a [`BuildRulesetError::RulesetTooLarge`];
+/// - `EINVAL` is a [`BuildRulesetError::UnsupportedAccess`];
+/// - `ENOSYS`, `EOPNOTSUPP`, `EPERM`, and `EACCES` are a
+///   [`BuildRulesetError::Syscall`];
+/// - other errors (or non-OS errors) are not mapped.
+pub(crate) fn map_errno(
+    op: Operation,
+    error: &io::Error,
+    rule: Option<usize>,
+) -> Option<BuildRulesetError> {
+    let errno = error.raw_os_error()?;
+    let source = io::Error::from_raw_os_error(errno);
+    match errno {
+        libc::E2BIG => Some(BuildRulesetError::RulesetTooLarge { rule, source }),
+        libc::EINVAL => Some(BuildRulesetError::UnsupportedAccess { rule, source }),
+        libc::ENOSYS | libc::EOPNOTSUPP | libc::EPERM | libc::EACCES => {
+            Some(SyscallError::new(op, rule, source).into())
+        }
+        _ => None,
+    }
+}
+
+impl RuleError {
+    /// Returns the kernel error which prevented opening the path of this rule,
+    /// if any, with its explanation.
+    pub fn syscall_error(&self, rule: Option<usize>) -> Option<SyscallError> {
+        let source: &io::Error = match self {
+            Self::Open { source, .. } | Self::MountPoint { source, .. } => source,
+            Self::PathFd(error) => std::error::Error::source(error)?.downcast_ref()?,
+            _ => return None,
+        };
+        let errno = source.raw_os_error()?;
+        Some(SyscallError::new(
+            Operation::OpenPath,
+            rule,
+            io::Error::from_raw_os_error(errno),
+        ))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use landlock::PathFd;
+    use std::path::PathBuf;
+
+    fn mapped(op: Operation, errno: i32) -> Option<BuildRulesetError> {
+        map_errno(op, &io::Error::from_raw_os_error(errno), Some(2))
+    }
+
+    #[test]
+    fn test_map_errno() {
+        assert!(matches!(
+            mapped(Operation::AddRule, libc::E2BIG),
+            Some(BuildRulesetError::RulesetTooLarge { rule: Some(2), source })
+                if source.raw_os_error() == Some(libc::E2BIG)
+        ));
+        assert!(matches!(
+            mapped(Operation::AddRule, libc::EINVAL),
+            Some(BuildRulesetError::UnsupportedAccess { rule: Some(2), source })
+                if source.raw_os_error() == Some(libc::EINVAL)
+        ));
+        for (op, errno, explanation) in [
+            (
+                Operation::CreateRuleset,
+                libc::ENOSYS,
+                "Landlock is not supported by the running kernel",
+            ),
+            (
+                Operation::CreateRuleset,
+                libc::EOPNOTSUPP,
+                "Landlock is supported but disabled by the running kernel",
+            ),
+            (
+                Operation::RestrictSelf,
+                libc::EPERM,
+                "the thread is not no_new_privs and lacks the CAP_SYS_ADMIN capability",
+            ),
+            (Operation::AddRule, libc::EPERM, "operation not permitted"),
+            (
+                Operation::AddRule,
+                libc::EACCES,
+                "access denied, e.g. by an enforced Landlock domain",
+            ),
+        ] {
+            let Some(BuildRulesetError::Syscall(error)) = mapped(op, errno) else {
+                panic!("errno {errno} is not mapped to a syscall error");
+            };
+            assert_eq!(error.op, op);
+            assert_eq!(error.rule, Some(2));
+            assert_eq!(error.errno(), Some(errno));
+            assert_eq!(error.explanation(), Some(explanation));
+            assert!(error.to_string().ends_with(&format!(" ({explanation})")));
+        }
+        assert!(mapped(Operation::AddRule, libc::ENOMEM).is_none());
+        assert!(map_errno(Operation::AddRule, &io::Error::other("not an errno"), None).is_none());
+    }
+
+    #[test]
+    fn test_syscall_error_display() {
+        let error = SyscallError::new(
+            Operation::RestrictSelf,
+            None,
+            io::Error::from_raw_os_error(libc::EINVAL),
+        );
+        assert!(error
+            .to_string()
+            .starts_with("restricting the thread failed: "));
+        assert!(error.to_string().ends_with(" (unsupported flags)"));
+
+        // Unknown errnos are not explained.
+        let error = SyscallError::new(
+            Operation::AddRule,
+            Some(1),
+            io::Error::from_raw_os_error(libc::ENOMEM),
+        );
+        assert_eq!(error.explanation(), None);
+        assert_eq!(
+            error.to_string(),
+            format!(
+                "adding a rule failed for rule 1: {}",
+                io::Error::from_raw_os_error(libc::ENOMEM)
+            )
+        );
+    }
+
+    #[test]
+    fn test_rule_syscall_error() {
+        let path = PathBuf::from("/nonexistent/landlockconfig");
+        let rule_error = RuleError::PathFd(PathFd::new(&path).unwrap_err());
+        let error = rule_error.syscall_error(Some(0)).unwrap();
+        assert_eq!(error.op, Operation::OpenPath);
+        assert_eq!(error.errno(), Some(libc::ENOENT));
+        assert_eq!(error.explanation(), Some("the path does not exist"));
+
+        let rule_error = RuleError::Open {
+            path: path.clone(),
+            source: io::Error::from_raw_os_error(libc::EACCES),
+        };
+        assert_eq!(
+            rule_error.syscall_error(None).unwrap().errno(),
+            Some(libc::EACCES)
+        );
+        assert!(RuleError::NotMountPoint {
+            mount_point: path.clone(),
+            path,
+        }
+        .syscall_error(None)
+        .is_none());
+    }
+}
@@ -0,0 +1,580 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigFormat, ParseFileError, ParseOptions};
+use crate::{Config, ParsedConfig};
+use std::fs::File;
+use std::io::{self, Read};
+use std::path::Path;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{mpsc, Arc};
+use std::thread;
+use std::time::{Duration, Instant};
+use thiserror::Error;
+
+/// Default maximum size of a fetched configuration, in bytes.
+pub const DEFAULT_FETCH_MAX_SIZE: u64 = 1024 * 1024;
+
+/// Default maximum duration of a fetch.
+pub const DEFAULT_FETCH_TIMEOUT: Duration = Duration::from_secs(30);
+
+// Maximum delay to notice a cancellation while waiting for the fetcher.
+const CANCEL_POLL_INTERVAL: Duration = Duration::from_millis(50);
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum FetchError {
+    #[error("unsupported URL: {0}")]
+    UnsupportedUrl(String),
+    #[error("failed to fetch {url}: {source}")]
+    Fetch {
+        url: String,
+        #[source]
+        source: io::Error,
+    },
+    #[error("fetched configuration larger than {max_size} bytes: {url}")]
+    TooLarge { url: String, max_size: u64 },
+    #[error("fetch not completed after {timeout:?}: {url}")]
+    TimedOut { url: String, timeout: Duration },
+    #[error("fetch cancelled: {0}")]
+    Cancelled(String),
+    #[error("unknown configuration format: {0}")]
+    UnknownFormat(String),
+    #[error(transparent)]
+    Parse(#[from] ParseFileError),
+}
+
+/// Request given to a [`Fetcher`].
+#[derive(Debug)]
+#[non_exhaustive]
+pub struct FetchRequest<'a> {
+    pub url: &'a str,
+    /// The fetcher should stop reading data beyond this size, which is
+    /// checked anyway.
+    pub max_size: u64,
+    /// The fetcher should give up after this duration, which is enforced
+    /// anyway.
+    pub timeout: Duration,
+    /// Set once the fetch is cancelled or timed out, and its result ignored:
+    /// the fetcher should then stop as soon as possible.
+    pub cancelled: &'a AtomicBool,
+}
+
+/// Data returned by a [`Fetcher`].
+#[derive(Debug, Default)]
+pub struct FetchResponse {
+    pub data: Vec<u8>,
+    /// MIME type of the data, if the transport has one (e.g.
+    /// `application/json`), which takes precedence over the URL's extension.
+    pub content_type: Option<String>,
+}
+
+/// Transport used by [`Config::parse_url()`].
+///
+/// Without the `http` feature, this crate does not depend on an HTTP client:
+/// HTTP(S) distribution then requires a fetcher wrapping the client of the
+/// application, which is then responsible for TLS verification.  Closures
+/// with the same signature as [`fetch()`](Fetcher::fetch) are fetchers.
+///
+/// Fetchers are called from a dedicated thread, which is left running if the
+/// fetch times out or is cancelled.
+pub trait Fetcher {
+    fn fetch(&self, request: &FetchRequest) -> io::Result<FetchResponse>;
+}
+
+impl<F> Fetcher for F
+where
+    F: Fn(&FetchRequest) -> io::Result<FetchResponse>,
+{
+    fn fetch(&self, request: &FetchRequest) -> io::Result<FetchResponse> {
+        self(request)
+    }
+}
+
+/// Fetcher only supporting `file://` URLs with an absolute path (e.g.
+/// `file:///etc/landlockconfig.json`), without percent-decoding.
+#[derive(Clone, Copy, Debug, Default)]
+pub struct FileFetcher;
+
+impl Fetcher for FileFetcher {
+    fn fetch(&self, request: &FetchRequest) -> io::Result<FetchResponse> {
+        let path = request
+            .url
+            .strip_prefix("file://")
+            .filter(|path| path.starts_with('/'))
+            .ok_or(io::ErrorKind::Unsupported)?;
+        let mut data = Vec::new();
+        // Reads one more byte to detect too large files.
+        File::open(path)?
+            .take(request.max_size.saturating_add(1))
+            .read_to_end(&mut data)?;
+        Ok(FetchResponse {
+            data,
+            content_type: None,
+        })
+    }
+}
+
+/// Fetcher only supporting `https://` URLs, available with the `http`
+/// feature.
+///
+/// Server certificates are always verified against the Mozilla root
+/// certificates, and redirections to plain HTTP are refused.  The request
+/// timeout covers the whole fetch, including the body, which is read up to
+/// the size limit, and the cancellation is checked between each read.
+#[cfg(feature = "http")]
+#[derive(Clone, Copy, Debug, Default)]
+pub struct HttpFetcher;
+
+#[cfg(feature = "http")]
+impl Fetcher for HttpFetcher {
+    fn fetch(&self, request: &FetchRequest) -> io::Result<FetchResponse> {
+        fn http_error(error: reqwest::Error) -> io::Error {
+            if error.is_timeout() {
+                io::ErrorKind::TimedOut.into()
+            } else {
+                io::Error::other(error)
+            }
+        }
+
+        if !request.url.starts_with("https://") {
+            return Err(io::ErrorKind::Unsupported.into());
+        }
+        let client = reqwest::blocking::Client::builder()
+            .https_only(true)
+            .timeout(request.timeout)
+            .build()
+            .map_err(http_error)?;
+        if request.cancelled.load(Ordering::Relaxed) {
+            return Err(io::ErrorKind::Interrupted.into());
+        }
+        let mut response = client
+            .get(request.url)
+            .send()
+            .and_then(|response| response.error_for_status())
+            .map_err(http_error)?;
+        let content_type = response
+            .headers()
+            .get(reqwest::header::CONTENT_TYPE)
+            .and_then(|value| value.to_str().ok())
+            .map(Into::into);
+        let mut data = Vec::new();
+        let mut buffer = [0; 8192];
+        // Reads one more byte to detect too large responses.
+        while data.len() as u64 <= request.max_size {
+            if request.cancelled.load(Ordering::Relaxed) {
+                return Err(io::ErrorKind::Interrupted.into());
+            }
+            match response.read(&mut buffer)? {
+                0 => break,
+                len => data.extend_from_slice(&buffer[..len]),
+            }
+        }
+        Ok(FetchResponse { data, content_type })
+    }
+}
+
+/// Fetcher of [`FetchOptions::default()`], dispatching `file://` URLs to
+/// [`FileFetcher`], and the others to [`HttpFetcher`] if enabled.
+struct DefaultFetcher;
+
+impl Fetcher for DefaultFetcher {
+    fn fetch(&self, request: &FetchRequest) -> io::Result<FetchResponse> {
+        #[cfg(feature = "http")]
+        if !request.url.starts_with("file://") {
+            return HttpFetcher.fetch(request);
+        }
+        FileFetcher.fetch(request)
+    }
+}
+
+/// Options of [`Config::parse_url()`].
+#[non_exhaustive]
+pub struct FetchOptions {
+    fetcher: Arc<dyn Fetcher + Send + Sync>,
+    max_size: u64,
+    timeout: Duration,
+    cancelled: Option<Arc<AtomicBool>>,
+    parse: ParseOptions,
+}
+
+impl Default for FetchOptions {
+    fn default() -> Self {
+        Self {
+            fetcher: Arc::new(DefaultFetcher),
+            max_size: DEFAULT_FETCH_MAX_SIZE,
+            timeout: DEFAULT_FETCH_TIMEOUT,
+            cancelled: None,
+            parse: Default::default(),
+        }
+    }
+}
+
+impl FetchOptions {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the transport, which by default only supports `file://` URLs, and
+    /// also `https://` ones with the `http` feature (see [`HttpFetcher`]).
+    pub fn fetcher<F>(mut self, fetcher: F) -> Self
+    where
+        F: Fetcher + Send + Sync + 'static,
+    {
+        self.fetcher = Arc::new(fetcher);
+        self
+    }
+
+    /// Sets the maximum size of the fetched data, which is
+    /// [`DEFAULT_FETCH_MAX_SIZE`] by default.
+    pub fn max_size(mut self, max_size: u64) -> Self {
+        self.max_size = max_size;
+        self
+    }
+
+    /// Sets the maximum duration of the fetch, which is
+    /// [`DEFAULT_FETCH_TIMEOUT`] by default.
+    pub fn timeout(mut self, timeout: Duration) -> Self {
+        self.timeout = timeout;
+        self
+    }
+
+    /// Cancels the fetch once `cancelled` is set, e.g. from another thread
+    /// when the application shuts down.
+    pub fn cancel_flag(mut self, cancelled: Arc<AtomicBool>) -> Self {
+        self.cancelled = Some(cancelled);
+        self
+    }
+
+    pub fn parse_options(mut self, options: ParseOptions) -> Self {
+        self.parse = options;
+        self
+    }
+
+    /// Calls the fetcher from a dedicated thread, and waits for it until the
+    /// timeout or the cancellation.
+    fn fetch(&self, url: &str) -> Result<FetchResponse, FetchError> {
+        let cancelled = self.cancelled.clone().unwrap_or_default();
+        let (sender, receiver) = mpsc::channel();
+        let fetcher = self.fetcher.clone();
+        let request_url = String::from(url);
+        let (max_size, timeout) = (self.max_size, self.timeout);
+        let thread_cancelled = cancelled.clone();
+        thread::spawn(move || {
+            let request = FetchRequest {
+                url: &request_url,
+                max_size,
+                timeout,
+                cancelled: &thread_cancelled,
+            };
+            // The receiver is gone if the fetch was abandoned.
+            let _ = sender.send(fetcher.fetch(&request));
+        });
+
+        let deadline = Instant::now() + timeout;
+        let result = loop {
+            let remaining = deadline.saturating_duration_since(Instant::now());
+            if cancelled.load(Ordering::Relaxed) {
+                return Err(FetchError::Cancelled(url.into()));
+            }
+            if remaining.is_zero() {
+                cancelled.store(true, Ordering::Relaxed);
+                return Err(FetchError::TimedOut {
+                    url: url.into(),
+                    timeout,
+                });
+            }
+            match receiver.recv_timeout(remaining.min(CANCEL_POLL_INTERVAL)) {
+                // The fetcher may stop because of the cancellation.
+                Ok(_) if cancelled.load(Ordering::Relaxed) => {
+                    return Err(FetchError::Cancelled(url.into()))
+                }
+                Ok(result) => break result,
+                Err(mpsc::RecvTimeoutError::Timeout) => continue,
+                Err(mpsc::RecvTimeoutError::Disconnected) => {
+                    return Err(FetchError::Fetch {
+                        url: url.into(),
+                        source: io::Error::other("fetcher panicked"),
+                    })
+                }
+            }
+        };
+        result.map_err(|source| match source.kind() {
+            io::ErrorKind::Unsupported => FetchError::UnsupportedUrl(url.into()),
+            _ => FetchError::Fetch {
+                url: url.into(),
+                source,
+            },
+        })
+    }
+}
+
+/// Returns the format of a MIME type, ignoring its parameters.
+fn format_from_content_type(content_type: &str) -> Option<ConfigFormat> {
+    match content_type.split(';').next()?.trim() {
+        "application/json" => Some(ConfigFormat::Json),
+        #[cfg(feature = "toml")]
+        "application/toml" => Some(ConfigFormat::Toml),
+        _ => None,
+    }
+}
+
+/// Returns the format of the extension of the URL's path.
+fn format_from_url(url: &str) -> Option<ConfigFormat> {
+    let path = url.split(['?', '#']).next()?;
+    // Ignores the extension of host names (e.g. "https://example.json").
+    let (_, path) = path.split_once("://").unwrap_or(("", path));
+    let (_, path) = path.split_once('/')?;
+    let name = Path::new(path).file_name()?.to_str()?;
+    ConfigFormat::from_name(name)
+}
+
+impl Config {
+    /// Fetches and parses a configuration, e.g. distributed by a central
+    /// server, with the transport, size limit, timeout, and cancellation of
+    /// `options`.
+    ///
+    /// The format is identified by the response's content type, if it is a
+    /// configuration one, and otherwise by the extension of the URL's path.
+    /// Only `file://` URLs are supported by default, see [`Fetcher`].
+    pub fn parse_url(url: &str, options: &FetchOptions) -> Result<Self, FetchError> {
+        let response = options.fetch(url)?;
+        if response.data.len() as u64 > options.max_size {
+            return Err(FetchError::TooLarge {
+                url: url.into(),
+                max_size: options.max_size,
+            });
+        }
+        // Servers commonly send generic content types (e.g. text/plain) for
+        // configuration files.
+        let format = response
+            .content_type
+            .as_deref()
+            .and_then(format_from_content_type)
+            .or_else(|| format_from_url(url))
+            .ok_or_else(|| FetchError::UnknownFormat(url.into()))?;
+        Ok(ParsedConfig::parse(response.data, format, &options.parse)?.into_config())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::TempDir;
+    use std::collections::BTreeMap;
+
+    const JSON: &str = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+
+    #[cfg(feature = "toml")]
+    const TOML: &str = r#"
+        [[path_beneath]]
+        allowed_access = [ "read_file" ]
+        parent = [ "/usr" ]
+    "#;
+
+    /// Serves (content type, data) for each URL, like a web server.
+    fn server(files: BTreeMap<&'static str, (Option<&'static str>, &'static str)>) -> FetchOptions {
+        FetchOptions::new().fetcher(move |request: &FetchRequest| {
+            let (content_type, data) = files
+                .get(request.url)
+                .ok_or(io::Error::from(io::ErrorKind::NotFound))?;
+            Ok(FetchResponse {
+                data: data.as_bytes().to_vec(),
+                content_type: content_type.map(Into::into),
+            })
+        })
+    }
+
+    #[test]
+    fn test_parse_url() {
+        let expected = Config::parse_json(JSON.as_bytes()).unwrap();
+        let mut files = BTreeMap::new();
+        files.insert(
+            "https://example.com/policy",
+            (Some("application/json"), JSON),
+        );
+        files.insert("https://example.com/policy.json?v=2", (None, JSON));
+        files.insert("https://example.json/policy", (None, JSON));
+        files.insert(
+            "https://example.com/policy.json",
+            (Some("application/octet-stream"), JSON),
+        );
+        files.insert("https://example.com/text", (Some("text/plain"), JSON));
+        #[cfg(feature = "toml")]
+        files.insert(
+            "https://example.com/policy.toml",
+            (Some("text/plain; charset=utf-8"), TOML),
+        );
+        #[cfg(feature = "toml")]
+        files.insert(
+            "https://example.com/toml",
+            (Some("application/toml; charset=utf-8"), TOML),
+        );
+        let options = server(files);
+
+        let parse = |url| Config::parse_url(url, &options);
+        assert_eq!(parse("https://example.com/policy").unwrap(), expected);
+        assert_eq!(
+            parse("https://example.com/policy.json?v=2").unwrap(),
+            expected
+        );
+        #[cfg(feature = "toml")]
+        assert_eq!(parse("https://example.com/toml").unwrap(), expected);
+
+        assert!(matches!(
+            parse("https://example.json/policy"),
+            Err(FetchError::UnknownFormat(url)) if url == "https://example.json/policy"
+        ));
+        // Generic content types fall back to the extension.
+        assert_eq!(parse("https://example.com/policy.json").unwrap(), expected);
+        #[cfg(feature = "toml")]
+        assert_eq!(parse("https://example.com/policy.toml").unwrap(), expected);
+        assert!(matches!(
+            parse("https://example.com/text"),
+            Err(FetchError::UnknownFormat(url)) if url == "https://example.com/text"
+        ));
+        assert!(matches!(
+            parse("https://example.com/missing.json"),
+            Err(FetchError::Fetch { source, .. }) if source.kind() == io::ErrorKind::NotFound
+        ));
+    }
+
+    #[test]
+    fn test_parse_url_max_size() {
+        let mut files = BTreeMap::new();
+        files.insert("https://example.com/policy.json", (None, JSON));
+        let options = server(files).max_size(JSON.len() as u64);
+        assert!(Config::parse_url("https://example.com/policy.json", &options).is_ok());
+
+        let mut files = BTreeMap::new();
+        files.insert("https://example.com/policy.json", (None, JSON));
+        let options = server(files).max_size(JSON.len() as u64 - 1);
+        assert!(matches!(
+            Config::parse_url("https://example.com/policy.json", &options),
+            Err(FetchError::TooLarge { max_size, .. }) if max_size == JSON.len() as u64 - 1
+        ));
+    }
+
+    #[test]
+    fn test_parse_url_timeout() {
+        let timeout = Duration::from_millis(10);
+        let options =
+            FetchOptions::new()
+                .timeout(timeout)
+                .fetcher(move |request: &FetchRequest| {
+                    assert_eq!(request.timeout, timeout);
+                    Err(io::Error::from(io::ErrorKind::TimedOut))
+                });
+        assert!(matches!(
+            Config::parse_url("https://example.com/policy.json", &options),
+            Err(FetchError::Fetch { source, .. }) if source.kind() == io::ErrorKind::TimedOut
+        ));
+    }
+
+    #[test]
+    fn test_parse_url_timeout_enforced() {
+        let stopped = Arc::new(AtomicBool::new(false));
+        let fetcher_stopped = stopped.clone();
+        let options = FetchOptions::new()
+            .timeout(Duration::from_millis(10))
+            .fetcher(move |request: &FetchRequest| {
+                // Ignores the timeout, but not the cancellation.
+                while !request.cancelled.load(Ordering::Relaxed) {
+                    thread::sleep(Duration::from_millis(1));
+                }
+                fetcher_stopped.store(true, Ordering::Relaxed);
+                Err(io::Error::from(io::ErrorKind::Interrupted))
+            });
+        assert!(matches!(
+            Config::parse_url("https://example.com/policy.json", &options),
+            Err(FetchError::TimedOut { timeout, .. }) if timeout == Duration::from_millis(10)
+        ));
+        while !stopped.load(Ordering::Relaxed) {
+            thread::sleep(Duration::from_millis(1));
+        }
+    }
+
+    #[test]
+    fn test_parse_url_cancelled() {
+        let cancelled = Arc::new(AtomicBool::new(false));
+        let options =
+            FetchOptions::new()
+                .cancel_flag(cancelled.clone())
+                .fetcher(|request: &FetchRequest| {
+                    while !request.cancelled.load(Ordering::Relaxed) {
+                        thread::sleep(Duration::from_millis(1));
+                    }
+                    Err(io::Error::from(io::ErrorKind::Interrupted))
+                });
+        let canceller = thread::spawn(move || {
+            thread::sleep(Duration::from_millis(10));
+            cancelled.store(true, Ordering::Relaxed);
+        });
+        assert!(matches!(
+            Config::parse_url("https://example.com/policy.json", &options),
+            Err(FetchError::Cancelled(url)) if url == "https://example.com/policy.json"
+        ));
+        canceller.join().unwrap();
+    }
+
+    #[cfg(feature = "http")]
+    #[test]
+    fn test_http_fetcher() {
+        let cancelled = AtomicBool::new(false);
+        let request = |url| FetchRequest {
+            url,
+            max_size: DEFAULT_FETCH_MAX_SIZE,
+            timeout: DEFAULT_FETCH_TIMEOUT,
+            cancelled: &cancelled,
+        };
+        // Plain HTTP is refused.
+        assert_eq!(
+            HttpFetcher
+                .fetch(&request("http://example.com/policy.json"))
+                .unwrap_err()
+                .kind(),
+            io::ErrorKind::Unsupported
+        );
+
+        // Nothing is sent once cancelled.
+        cancelled.store(true, Ordering::Relaxed);
+        assert_eq!(
+            HttpFetcher
+                .fetch(&request("https://example.com/policy.json"))
+                .unwrap_err()
+                .kind(),
+            io::ErrorKind::Interrupted
+        );
+    }
+
+    #[test]
+    fn test_file_fetcher() {
+        let dir = TempDir::new("fetch-file");
+        let path = dir.path().join("policy.json");
+        std::fs::write(&path, JSON).unwrap();
+        let url = format!("file://{}", path.display());
+        assert_eq!(
+            Config::parse_url(&url, &FetchOptions::new()).unwrap(),
+            Config::parse_json(JSON.as_bytes()).unwrap()
+        );
+        assert!(matches!(
+            Config::parse_url(&url, &FetchOptions::new().max_size(JSON.len() as u64 - 1)),
+            Err(FetchError::TooLarge { .. })
+        ));
+        let unsupported = |url| {
+            matches!(
+                Config::parse_url(url, &FetchOptions::new()),
+                Err(FetchError::UnsupportedUrl(u)) if u == url
+            )
+        };
+        assert!(unsupported("file://policy.json"));
+        #[cfg(not(feature = "http"))]
+        assert!(unsupported("https://example.com/policy.json"));
+    }
+}
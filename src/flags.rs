@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use thiserror::Error;
+
+/// Disables logging of denied accesses for the processes which are in the
+/// same executable as the one enforcing the ruleset, until they call
+/// execve(2).  Requires Landlock ABI 7.
+pub const LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF: u32 = 1 << 0;
+
+/// Enables logging of denied accesses after an execve(2) call, which are not
+/// logged by default.  Requires Landlock ABI 7.
+pub const LANDLOCK_RESTRICT_SELF_LOG_NEW_EXEC_ON: u32 = 1 << 1;
+
+/// Disables logging of denied accesses for all the nested domains created
+/// afterwards, e.g. to silence a sandboxed program sandboxing itself.
+/// Requires Landlock ABI 7.
+pub const LANDLOCK_RESTRICT_SELF_LOG_SUBDOMAINS_OFF: u32 = 1 << 2;
+
+/// landlock_create_ruleset(2) flags supported to create a ruleset, with the
+/// minimal Landlock ABI version supporting them.  The kernel only defines
+/// query flags (i.e. `LANDLOCK_CREATE_RULESET_VERSION` and
+/// `LANDLOCK_CREATE_RULESET_ERRATA`), which cannot create a ruleset.
+const CREATE_RULESET_FLAGS: [(u32, i32); 0] = [];
+
+/// landlock_restrict_self(2) flags, with the minimal Landlock ABI version
+/// supporting them.
+const RESTRICT_SELF_FLAGS: [(u32, i32); 3] = [
+    (LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF, 7),
+    (LANDLOCK_RESTRICT_SELF_LOG_NEW_EXEC_ON, 7),
+    (LANDLOCK_RESTRICT_SELF_LOG_SUBDOMAINS_OFF, 7),
+];
+
+#[derive(Debug, Error, PartialEq, Eq)]
+pub enum FlagsError {
+    /// Some flags are not known by this library.
+    #[error("unknown flags: {0:#x}")]
+    Unknown(u32),
+    /// Some flags are not supported by the running kernel.
+    #[error("flags {flags:#x} require Landlock ABI {min_abi}, but the kernel only supports {abi}")]
+    Unsupported { flags: u32, min_abi: i32, abi: i32 },
+}
+
+/// System call flags used to build and enforce a ruleset, see
+/// [`ResolvedConfig::build_ruleset_with_options()`] and
+/// [`ResolvedConfig::restrict_self_with_options()`].
+///
+/// All flags are 0 by default.  They are checked against the Landlock ABI
+/// version of the running kernel before building the ruleset, and unknown or
+/// unsupported flags are an error instead of being ignored.
+///
+/// [`ResolvedConfig::build_ruleset_with_options()`]: crate::ResolvedConfig::build_ruleset_with_options
+/// [`ResolvedConfig::restrict_self_with_options()`]: crate::ResolvedConfig::restrict_self_with_options
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct RulesetOptions {
+    pub(crate) create_flags: u32,
+    pub(crate) restrict_flags: u32,
+}
+
+impl RulesetOptions {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the landlock_create_ruleset(2) flags.  No flag can create a
+    /// ruleset yet, so they must be 0: this is only reserved for the flags
+    /// newer kernels may add.
+    pub fn create_flags(mut self, flags: u32) -> Self {
+        self.create_flags = flags;
+        self
+    }
+
+    /// Sets the landlock_restrict_self(2) flags, a combination of
+    /// [`LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF`],
+    /// [`LANDLOCK_RESTRICT_SELF_LOG_NEW_EXEC_ON`], and
+    /// [`LANDLOCK_RESTRICT_SELF_LOG_SUBDOMAINS_OFF`].
+    pub fn restrict_flags(mut self, flags: u32) -> Self {
+        self.restrict_flags = flags;
+        self
+    }
+
+    /// Checks that all the flags are known and supported by the `abi`
+    /// version.
+    pub(crate) fn check(&self, abi: i32) -> Result<(), FlagsError> {
+        check_flags(self.create_flags, &CREATE_RULESET_FLAGS, abi)?;
+        check_flags(self.restrict_flags, &RESTRICT_SELF_FLAGS, abi)
+    }
+}
+
+fn check_flags(flags: u32, supported: &[(u32, i32)], abi: i32) -> Result<(), FlagsError> {
+    let mut unknown = flags;
+    for &(flag, min_abi) in supported {
+        if flags & flag == 0 {
+            continue;
+        }
+        if abi < min_abi {
+            return Err(FlagsError::Unsupported {
+                flags: flag,
+                min_abi,
+                abi,
+            });
+        }
+        unknown &= !flag;
+    }
+    if unknown != 0 {
+        return Err(FlagsError::Unknown(unknown));
+    }
+    Ok(())
+}
+
+#[test]
+fn test_check_flags() {
+    assert_eq!(RulesetOptions::new().check(0), Ok(()));
+    let options = RulesetOptions::new().restrict_flags(LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF);
+    assert_eq!(options.check(7), Ok(()));
+    assert_eq!(
+        options.check(6),
+        Err(FlagsError::Unsupported {
+            flags: LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF,
+            min_abi: 7,
+            abi: 6,
+        })
+    );
+    let options = RulesetOptions::new().restrict_flags(
+        LANDLOCK_RESTRICT_SELF_LOG_NEW_EXEC_ON | LANDLOCK_RESTRICT_SELF_LOG_SUBDOMAINS_OFF,
+    );
+    assert_eq!(options.check(8), Ok(()));
+    assert_eq!(
+        RulesetOptions::new().restrict_flags(1 << 31).check(7),
+        Err(FlagsError::Unknown(1 << 31))
+    );
+    // The query flags cannot create a ruleset.
+    assert_eq!(
+        RulesetOptions::new().create_flags(1 << 0).check(7),
+        Err(FlagsError::Unknown(1 << 0))
+    );
+}
+
+#[test]
+fn test_restrict_self_forward_flags() {
+    let json = r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/" ] } ] }"#;
+    let resolved = crate::tests_helpers::parse_json(json)
+        .unwrap()
+        .resolve()
+        .unwrap();
+    let flags = LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF;
+    let options = RulesetOptions::new().restrict_flags(flags);
+
+    // The ruleset is only given to the restrict closure, which does not
+    // restrict the test thread.
+    let mut forwarded = None;
+    let (enforced, _) = resolved
+        .restrict_self_options_with(&options, 7, |_, flags| {
+            forwarded = Some(flags);
+            Ok(())
+        })
+        .unwrap();
+    if enforced {
+        assert_eq!(forwarded, Some(flags));
+    } else {
+        // The ruleset cannot be created without Landlock support.
+        assert_eq!(forwarded, None);
+    }
+
+    assert!(matches!(
+        resolved.restrict_self_options_with(&options, 6, |_, _| unreachable!()),
+        Err(crate::BuildRulesetError::Flags(
+            FlagsError::Unsupported { .. }
+        ))
+    ));
+}
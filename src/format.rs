@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::nonempty::NonEmptyStruct;
+use crate::parser::TomlConfig;
+use std::cmp::Ordering;
+use std::collections::BTreeSet;
+use thiserror::Error;
+use toml_edit::{Array, DocumentMut, Item, Key, RawString, Table, Value};
+
+/// Canonical order of the keys in a table, following the configuration
+/// structures.  Unknown keys come last, in their original order.
+const KEY_ORDER: &[&str] = &[
+    "abi",
+    "name",
+    "min_abi",
+    "max_abi",
+    "literal",
+    "handled_access_fs",
+    "handled_access_net",
+    "scoped",
+    "allow_none",
+    "default_access",
+    "allowed_access",
+    "parent",
+    "port",
+    "mount_point",
+    "required",
+    "tag",
+    "use",
+    "include_fragment",
+];
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum FormatTomlError {
+    #[error(transparent)]
+    Config(#[from] toml::de::Error),
+    #[error(transparent)]
+    Document(#[from] toml_edit::TomlError),
+}
+
+fn key_rank(key: &Key) -> usize {
+    KEY_ORDER
+        .iter()
+        .position(|k| *k == key.get())
+        .unwrap_or(KEY_ORDER.len())
+}
+
+fn compare_keys(a: &Key, b: &Key) -> Ordering {
+    key_rank(a).cmp(&key_rank(b))
+}
+
+fn has_comment(raw: Option<&RawString>) -> bool {
+    raw.and_then(RawString::as_str)
+        .is_some_and(|raw| raw.contains('#'))
+}
+
+/// Removes the indentation and the trailing whitespace of the comment and
+/// blank lines preceding an item.
+fn normalize_prefix(raw: Option<&RawString>) -> String {
+    raw.and_then(RawString::as_str)
+        .unwrap_or_default()
+        .split('\n')
+        .map(str::trim)
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Keeps a trailing comment, separated with one space.
+fn normalize_suffix(raw: Option<&RawString>) -> String {
+    match raw.and_then(RawString::as_str).map(str::trim) {
+        Some(comment) if !comment.is_empty() => format!(" {comment}"),
+        _ => String::new(),
+    }
+}
+
+/// Sorts and deduplicates an array of strings or of integers, which are all
+/// sets in a configuration.
+fn sort_array(array: &mut Array) {
+    let compare = |a: &Value, b: &Value| match (a, b) {
+        (Value::String(a), Value::String(b)) => a.value().cmp(b.value()),
+        (Value::Integer(a), Value::Integer(b)) => a.value().cmp(b.value()),
+        _ => Ordering::Equal,
+    };
+    let sortable = array.iter().all(Value::is_str) || array.iter().all(Value::is_integer);
+    if !sortable {
+        return;
+    }
+    array.sort_by(compare);
+    let mut seen = BTreeSet::new();
+    array.retain(|value| seen.insert(value.to_string().trim().to_owned()));
+}
+
+fn normalize_value(value: &mut Value) {
+    match value {
+        // Comments between elements are kept as is, with the array layout.
+        Value::Array(array)
+            if !array
+                .iter()
+                .any(|v| has_comment(v.decor().prefix()) || has_comment(v.decor().suffix()))
+                && !has_comment(Some(array.trailing())) =>
+        {
+            sort_array(array);
+            array.iter_mut().for_each(normalize_value);
+            array.fmt();
+        }
+        Value::InlineTable(table) => {
+            table.sort_values_by(|a, _, b, _| compare_keys(a, b));
+            table
+                .iter_mut()
+                .for_each(|(_, value)| normalize_value(value));
+            table.fmt();
+        }
+        _ => {}
+    }
+}
+
+fn normalize_table(table: &mut Table) {
+    let prefix = normalize_prefix(table.decor().prefix());
+    table.decor_mut().set_prefix(prefix);
+    table.sort_values_by(|a, _, b, _| compare_keys(a, b));
+    for (mut key, item) in table.iter_mut() {
+        match item {
+            Item::Value(value) => {
+                let decor = key.leaf_decor_mut();
+                let prefix = normalize_prefix(decor.prefix());
+                decor.set_prefix(prefix);
+                decor.set_suffix(" ");
+                let suffix = normalize_suffix(value.decor().suffix());
+                normalize_value(value);
+                value.decor_mut().set_prefix(" ");
+                value.decor_mut().set_suffix(suffix);
+            }
+            Item::Table(table) => normalize_table(table),
+            Item::ArrayOfTables(tables) => tables.iter_mut().for_each(normalize_table),
+            Item::None => {}
+        }
+    }
+}
+
+/// Formats a TOML configuration in place, like `gofmt`: unlike serializing
+/// a parsed [`Config`](crate::Config), the comments and the layout of the
+/// author are kept.
+///
+/// The configuration must be valid, but its fragments are not loaded.  The
+/// formatting normalizes:
+/// - the order of the keys in each table, following the configuration
+///   structures (e.g. `allowed_access` before `parent`), with unknown keys
+///   last;
+/// - the spacing around `=` and the indentation of the keys;
+/// - arrays of strings or of integers, which are sorted, deduplicated, and
+///   written on one line, unless they contain comments;
+/// - the trailing whitespace of comment lines.
+///
+/// The formatting preserves the comments (each one stays attached to the value
+/// or the table it precedes or follows), the blank lines, the order of the
+/// tables, the quoting of the strings, and the semantic of the configuration.
+/// Formatting is idempotent.
+pub fn format_toml(data: &str) -> Result<String, FormatTomlError> {
+    toml::from_str::<NonEmptyStruct<TomlConfig>>(data)?;
+    let mut document: DocumentMut = data.parse()?;
+    normalize_table(document.as_table_mut());
+    Ok(document.to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::Config;
+
+    const MESSY: &str = r#"# System policy.
+abi   =   4
+
+[[variable]]
+  literal = [ "/var/tmp", "/tmp", "/tmp" ]   # Both temporary directories.
+name="tmp"
+
+# Main system file hierarchies can be read and executed.
+[[path_beneath]]
+parent = [
+    "/usr",
+    # Needed by the dynamic linker.
+    "/lib",
+]
+allowed_access = ["read_file", "execute"]
+
+[[path_beneath]]
+required = true
+parent = [ "${tmp}" ]
+allowed_access = [ "write_file" ]
+
+[[net_port]]
+port = [ 443, 80 ]
+allowed_access = [ "connect_tcp" ]
+"#;
+
+    const FORMATTED: &str = r#"# System policy.
+abi = 4
+
+[[variable]]
+name = "tmp"
+literal = ["/tmp", "/var/tmp"] # Both temporary directories.
+
+# Main system file hierarchies can be read and executed.
+[[path_beneath]]
+allowed_access = ["execute", "read_file"]
+parent = [
+    "/usr",
+    # Needed by the dynamic linker.
+    "/lib",
+]
+
+[[path_beneath]]
+allowed_access = ["write_file"]
+parent = ["${tmp}"]
+required = true
+
+[[net_port]]
+allowed_access = ["connect_tcp"]
+port = [80, 443]
+"#;
+
+    #[test]
+    fn test_format_toml() {
+        let formatted = format_toml(MESSY).unwrap();
+        assert_eq!(formatted, FORMATTED);
+        // Idempotent and semantic-preserving.
+        assert_eq!(format_toml(&formatted).unwrap(), formatted);
+        assert_eq!(
+            Config::parse_toml(&formatted).unwrap(),
+            Config::parse_toml(MESSY).unwrap()
+        );
+    }
+
+    #[test]
+    fn test_format_toml_inline() {
+        let toml =
+            "path_beneath = [ { parent = [ \"/usr\" ], allowed_access = [ \"execute\" ] } ]\n";
+        assert_eq!(
+            format_toml(toml).unwrap(),
+            "path_beneath = [{ allowed_access = [\"execute\"], parent = [\"/usr\"] }]\n"
+        );
+    }
+
+    #[test]
+    fn test_format_toml_invalid() {
+        assert!(matches!(
+            format_toml("[[path_beneath]]\nparent = [ \"/usr\" ]\nunknown = 1\n"),
+            Err(FormatTomlError::Config(_))
+        ));
+        assert!(matches!(
+            format_toml("abi = "),
+            Err(FormatTomlError::Config(_))
+        ));
+    }
+}
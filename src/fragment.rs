@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigFormat, ParseFileError};
+use std::path::PathBuf;
+use thiserror::Error;
+
+/// Default directory where system-provided fragments are installed.
+pub const DEFAULT_FRAGMENT_DIR: &str = "/usr/share/landlockconfig/fragments";
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum FragmentError {
+    #[error("invalid fragment name: {0:?}")]
+    InvalidName(String),
+    #[error("fragment not found: {0}")]
+    NotFound(String),
+    #[error("cycle in fragment includes: {}", .0.join(" -> "))]
+    Cycle(Vec<String>),
+    #[error("failed to parse fragment {name}: {source}")]
+    Parse {
+        name: String,
+        source: Box<ParseFileError>,
+    },
+}
+
+/// Returns the path of the first fragment file named `name` found in `dirs`.
+///
+/// Fragment names cannot contain slashes nor start with a dot, which prevents
+/// accessing files outside these directories.
+pub(crate) fn find(
+    name: &str,
+    dirs: &[PathBuf],
+    format: ConfigFormat,
+) -> Result<PathBuf, FragmentError> {
+    if name.is_empty() || name.starts_with('.') || name.contains('/') {
+        return Err(FragmentError::InvalidName(name.into()));
+    }
+    let file_name = format!("{name}.{}", format.extension());
+    dirs.iter()
+        .map(|dir| dir.join(&file_name))
+        .find(|path| path.is_file())
+        .ok_or_else(|| FragmentError::NotFound(name.into()))
+}
@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::ResolvedConfig;
+use landlock::{AccessFs, BitFlags};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+/// Filesystem access rights granted beneath a path.
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct PathGrant {
+    pub path: PathBuf,
+    /// Access rights allowed beneath `path`, including the ones inherited from
+    /// its ancestors.
+    pub access: BitFlags<AccessFs>,
+    /// Nearest ancestor with a rule, if any.
+    pub inherited_from: Option<PathBuf>,
+}
+
+/// Advisory explanation of why filesystem access rights are denied by a
+/// configuration.
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum Explanation {
+    /// The access rights are allowed, or they are not handled at all.
+    Allowed,
+    /// No rule applies to the path nor to its parents.  The minimal rule to
+    /// add allows `missing` beneath the path.
+    NoRule { missing: BitFlags<AccessFs> },
+    /// Rules apply to the path (sorted from the furthest to the nearest
+    /// parent), but none of them allows `missing`.  The minimal rule to add
+    /// allows `missing` beneath the path, or the nearest rule could be
+    /// extended instead.
+    MissingAccess {
+        rules: Vec<PathBuf>,
+        missing: BitFlags<AccessFs>,
+    },
+}
+
+impl ResolvedConfig {
+    /// Lists all the paths with a rule, sorted and deduplicated, with their
+    /// effective access rights, e.g. to audit what a configuration grants.
+    ///
+    /// Paths are the resolved ones, which depend on the environment when the
+    /// configuration was resolved.  They are compared lexically, without
+    /// following symbolic links, and mount point rules are listed with their
+    /// configured paths.
+    pub fn granted_paths(&self) -> Vec<PathGrant> {
+        let rules = self.path_rules();
+        rules
+            .iter()
+            .map(|(path, access)| {
+                // Rules are sorted, so the nearest ancestor is the last one.
+                let ancestors = rules
+                    .range(..path.clone())
+                    .filter(|(parent, _)| path.starts_with(parent));
+                let (access, inherited_from) =
+                    ancestors.fold((*access, None), |(access, _), (parent, parent_access)| {
+                        (access | *parent_access, Some(parent.clone()))
+                    });
+                PathGrant {
+                    path: path.clone(),
+                    access,
+                    inherited_from,
+                }
+            })
+            .collect()
+    }
+
+    /// Explains why `access` would be denied for `path`, e.g. to investigate
+    /// an unexpected `EACCES` error.
+    ///
+    /// This is only an analysis of the configuration, without the kernel: like
+    /// [`granted_paths()`](ResolvedConfig::granted_paths), paths are compared
+    /// lexically, and the actual denial might come from another layer or from
+    /// other access controls.
+    pub fn why_denied<P>(&self, path: P, access: BitFlags<AccessFs>) -> Explanation
+    where
+        P: AsRef<Path>,
+    {
+        let path = path.as_ref();
+        let (rules, allowed) = self
+            .path_rules()
+            .into_iter()
+            .filter(|(parent, _)| path.starts_with(parent))
+            .fold(
+                (Vec::new(), BitFlags::EMPTY),
+                |(mut rules, allowed), (parent, access)| {
+                    rules.push(parent);
+                    (rules, allowed | access)
+                },
+            );
+        let missing = access & self.handled_fs & !allowed;
+        if missing.is_empty() {
+            Explanation::Allowed
+        } else if rules.is_empty() {
+            Explanation::NoRule { missing }
+        } else {
+            Explanation::MissingAccess { rules, missing }
+        }
+    }
+
+    /// Lists the paths beneath which both `write_file` and `execute` are
+    /// allowed, e.g. to lint a configuration.
+    ///
+    /// Allowing to both write and execute the same files lets sandboxed
+    /// processes run arbitrary code, which defeats the purpose of restricting
+    /// `execute` (i.e. no W^X).  This is only a security warning: such rules
+    /// are still valid and applied.  Like
+    /// [`granted_paths()`](ResolvedConfig::granted_paths), access rights are
+    /// inherited, and only the furthest path allowing both is listed.
+    pub fn write_execute_paths(&self) -> Vec<PathBuf> {
+        let write_execute = AccessFs::WriteFile | AccessFs::Execute;
+        let grants = self.granted_paths();
+        grants
+            .iter()
+            .filter(|grant| {
+                grant.access.contains(write_execute)
+                    && !grant.inherited_from.as_deref().is_some_and(|parent| {
+                        grants
+                            .iter()
+                            .any(|g| g.path == parent && g.access.contains(write_execute))
+                    })
+            })
+            .map(|grant| grant.path.clone())
+            .collect()
+    }
+
+    /// Returns all the filesystem rules, with mount point rules merged by
+    /// their configured paths.
+    fn path_rules(&self) -> BTreeMap<PathBuf, BitFlags<AccessFs>> {
+        let mut rules = self.rules_path_beneath.clone();
+        for (path, access) in &self.rules_mount_point {
+            *rules.entry(path.clone()).or_default() |= *access;
+        }
+        rules
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    fn usr_tmp() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "make_dir" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp", "/usr/local" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_why_denied_allowed() {
+        let resolved = usr_tmp();
+        assert_eq!(
+            resolved.why_denied("/usr/local/bin", AccessFs::ReadFile | AccessFs::WriteFile),
+            Explanation::Allowed
+        );
+        // Not handled.
+        assert_eq!(
+            resolved.why_denied("/etc", AccessFs::ReadDir.into()),
+            Explanation::Allowed
+        );
+    }
+
+    #[test]
+    fn test_why_denied_no_rule() {
+        assert_eq!(
+            usr_tmp().why_denied("/etc/passwd", AccessFs::ReadFile | AccessFs::ReadDir),
+            Explanation::NoRule {
+                missing: AccessFs::ReadFile.into()
+            }
+        );
+    }
+
+    #[test]
+    fn test_why_denied_missing_access() {
+        assert_eq!(
+            usr_tmp().why_denied("/usr/local/lib", AccessFs::WriteFile | AccessFs::MakeDir),
+            Explanation::MissingAccess {
+                rules: vec!["/usr".into(), "/usr/local".into()],
+                missing: AccessFs::MakeDir.into()
+            }
+        );
+    }
+
+    #[test]
+    fn test_granted_paths() {
+        let resolved = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr", "/usr/" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/usr/lib/cache", "/usrlib", "/tmp" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/usr/lib", "/tmp" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/proc" ],
+                        "mountPoint": true
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+
+        let read_exec = AccessFs::Execute | AccessFs::ReadFile;
+        let grant = |path: &str, access, inherited_from: Option<&str>| PathGrant {
+            path: path.into(),
+            access,
+            inherited_from: inherited_from.map(Into::into),
+        };
+        assert_eq!(
+            resolved.granted_paths(),
+            [
+                grant("/proc", AccessFs::ReadDir.into(), None),
+                grant("/tmp", AccessFs::WriteFile | AccessFs::ReadDir, None),
+                grant("/usr", read_exec, None),
+                grant("/usr/lib", read_exec | AccessFs::ReadDir, Some("/usr")),
+                grant(
+                    "/usr/lib/cache",
+                    read_exec | AccessFs::ReadDir | AccessFs::WriteFile,
+                    Some("/usr/lib")
+                ),
+                grant("/usrlib", AccessFs::WriteFile.into(), None),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_write_execute_paths() {
+        let resolved = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "write_file" ],
+                        "parent": [ "/tmp", "/var/tmp" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/tmp/a" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/usr/local" ]
+                    },
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        // Only the furthest paths are listed, including inherited access rights.
+        assert_eq!(
+            resolved.write_execute_paths(),
+            [
+                PathBuf::from("/tmp"),
+                PathBuf::from("/usr/local"),
+                PathBuf::from("/var/tmp")
+            ]
+        );
+    }
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::nonempty::{NonEmptySet, NonEmptyStruct};
+use crate::parser::{JsonGroup, JsonPathBeneath};
+use std::collections::{BTreeMap, BTreeSet};
+use thiserror::Error;
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum GroupError {
+    #[error("unknown group: {0}")]
+    Unknown(String),
+    #[error("cycle in group references: {}", .0.join(" -> "))]
+    Cycle(Vec<String>),
+}
+
+#[derive(Debug, Default)]
+struct Group {
+    path_beneath: BTreeSet<JsonPathBeneath>,
+    uses: BTreeSet<String>,
+}
+
+/// Groups defined in a configuration file.  Groups with the same name are
+/// merged.
+#[derive(Debug, Default)]
+pub(crate) struct Groups(BTreeMap<String, Group>);
+
+impl Groups {
+    /// Merges the group definitions and checks that all their references are
+    /// known and acyclic, even for unused groups.
+    pub(crate) fn new(groups: NonEmptySet<NonEmptyStruct<JsonGroup>>) -> Result<Self, GroupError> {
+        let mut map = BTreeMap::<_, Group>::new();
+        for group in groups {
+            let group = group.into_inner();
+            let entry = map.entry(group.name).or_default();
+            entry
+                .path_beneath
+                .extend(group.pathBeneath.unwrap_or_default());
+            entry.uses.extend(group.r#use.unwrap_or_default());
+        }
+
+        let groups = Self(map);
+        for name in groups.0.keys() {
+            groups.collect(name, &mut Vec::new(), &mut BTreeSet::new())?;
+        }
+        Ok(groups)
+    }
+
+    /// Returns the rules of the used groups, including the ones of the groups
+    /// they use.
+    pub(crate) fn expand(
+        &self,
+        uses: NonEmptySet<String>,
+    ) -> Result<BTreeSet<JsonPathBeneath>, GroupError> {
+        let mut rules = BTreeSet::new();
+        for name in &*uses {
+            self.collect(name, &mut Vec::new(), &mut rules)?;
+        }
+        Ok(rules)
+    }
+
+    fn collect<'a>(
+        &'a self,
+        name: &'a str,
+        stack: &mut Vec<&'a str>,
+        rules: &mut BTreeSet<JsonPathBeneath>,
+    ) -> Result<(), GroupError> {
+        if let Some(start) = stack.iter().position(|n| *n == name) {
+            let mut cycle: Vec<String> = stack[start..].iter().map(|n| n.to_string()).collect();
+            cycle.push(name.into());
+            return Err(GroupError::Cycle(cycle));
+        }
+        let group = self
+            .0
+            .get(name)
+            .ok_or_else(|| GroupError::Unknown(name.into()))?;
+
+        stack.push(name);
+        rules.extend(group.path_beneath.iter().cloned());
+        for used in &group.uses {
+            self.collect(used, stack, rules)?;
+        }
+        stack.pop();
+        Ok(())
+    }
+}
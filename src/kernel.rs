@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use std::io;
+use std::os::unix::io::{AsRawFd, BorrowedFd};
+
+const LANDLOCK_CREATE_RULESET_VERSION: libc::c_uint = 1 << 0;
+
+/// Returns the Landlock ABI version supported by the running kernel, or 0 if
+/// Landlock is not supported.
+pub(crate) fn abi_version() -> i32 {
+    let ret = unsafe {
+        libc::syscall(
+            libc::SYS_landlock_create_ruleset,
+            std::ptr::null::<libc::c_void>(),
+            0 as libc::size_t,
+            LANDLOCK_CREATE_RULESET_VERSION,
+        )
+    };
+    i32::try_from(ret).unwrap_or_default().max(0)
+}
+
+/// Landlock ABI version of the running kernel, only probed when needed.
+pub(crate) struct LazyAbi {
+    version: Option<i32>,
+    max: Option<i32>,
+}
+
+impl LazyAbi {
+    /// Uses `abi` instead of probing the kernel, if any.
+    pub(crate) fn new(abi: Option<i32>) -> Self {
+        Self {
+            version: abi,
+            max: None,
+        }
+    }
+
+    /// Caps the version to `max`, if any, e.g. to simulate an older kernel.
+    pub(crate) fn max(mut self, max: Option<i32>) -> Self {
+        self.max = max;
+        self
+    }
+
+    pub(crate) fn version(&mut self) -> i32 {
+        let version = *self.version.get_or_insert_with(abi_version);
+        self.max.map_or(version, |max| version.min(max))
+    }
+}
+
+/// Sets no_new_privs and enforces `ruleset` on the calling thread, with the
+/// landlock_restrict_self(2) `flags`.  This does not allocate memory, which
+/// makes it usable after fork(2).
+pub(crate) fn restrict_self(ruleset: BorrowedFd<'_>, flags: u32) -> io::Result<()> {
+    // The returned errors do not allocate either.
+    if unsafe { libc::prctl(libc::PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) } != 0 {
+        return Err(io::Error::last_os_error());
+    }
+    if unsafe { libc::syscall(libc::SYS_landlock_restrict_self, ruleset.as_raw_fd(), flags) } != 0 {
+        return Err(io::Error::last_os_error());
+    }
+    Ok(())
+}
+
+const LANDLOCK_RULE_PATH_BENEATH: libc::c_int = 1;
+const LANDLOCK_RULE_NET_PORT: libc::c_int = 2;
+
+#[repr(C, packed)]
+struct PathBeneathAttr {
+    allowed_access: u64,
+    parent_fd: i32,
+}
+
+#[repr(C, packed)]
+struct NetPortAttr {
+    allowed_access: u64,
+    port: u64,
+}
+
+fn add_rule<T>(ruleset: BorrowedFd<'_>, rule_type: libc::c_int, attr: &T) -> io::Result<()> {
+    let ret = unsafe {
+        libc::syscall(
+            libc::SYS_landlock_add_rule,
+            ruleset.as_raw_fd(),
+            rule_type,
+            attr as *const T,
+            0,
+        )
+    };
+    if ret != 0 {
+        return Err(io::Error::last_os_error());
+    }
+    Ok(())
+}
+
+/// Adds a path beneath rule to a ruleset created by the caller.
+pub(crate) fn add_path_beneath_rule(
+    ruleset: BorrowedFd<'_>,
+    parent: BorrowedFd<'_>,
+    allowed_access: u64,
+) -> io::Result<()> {
+    let attr = PathBeneathAttr {
+        allowed_access,
+        parent_fd: parent.as_raw_fd(),
+    };
+    add_rule(ruleset, LANDLOCK_RULE_PATH_BENEATH, &attr)
+}
+
+/// Adds a network port rule to a ruleset created by the caller.
+pub(crate) fn add_net_port_rule(
+    ruleset: BorrowedFd<'_>,
+    port: u16,
+    allowed_access: u64,
+) -> io::Result<()> {
+    let attr = NetPortAttr {
+        allowed_access,
+        port: port.into(),
+    };
+    add_rule(ruleset, LANDLOCK_RULE_NET_PORT, &attr)
+}
@@ -0,0 +1,488 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, RuleError};
+use crate::ResolvedConfig;
+use landlock::{AccessFs, AccessNet, BitFlags, RestrictionStatus, Scope};
+use std::collections::BTreeSet;
+use std::path::PathBuf;
+use std::sync::{Mutex, PoisonError};
+use thiserror::Error;
+
+/// Configurations enforced in this process by
+/// [`ResolvedConfig::ensure_applied()`], identified by their binary format.
+static APPLIED: Mutex<BTreeSet<Vec<u8>>> = Mutex::new(BTreeSet::new());
+
+/// Part of a new layer that cannot take effect because of the current layer.
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum LayerWarning {
+    #[error("filesystem access rights still restricted by the current layer: {0:?}")]
+    UnhandledFs(BitFlags<AccessFs>),
+    #[error("network access rights still restricted by the current layer: {0:?}")]
+    UnhandledNet(BitFlags<AccessNet>),
+    #[error("scopes still restricted by the current layer: {0:?}")]
+    UnhandledScope(BitFlags<Scope>),
+    #[error("access rights denied by the current layer beneath {}: {access:?}", .path.display())]
+    DeniedPath {
+        path: PathBuf,
+        access: BitFlags<AccessFs>,
+    },
+    #[error("access rights denied by the current layer for port {port}: {access:?}")]
+    DeniedPort {
+        port: u64,
+        access: BitFlags<AccessNet>,
+    },
+}
+
+impl ResolvedConfig {
+    /// Lists what `next` would allow but would still be denied by `self`, if
+    /// `next` were enforced as a new layer on top of `self`.
+    ///
+    /// Landlock layers can only add restrictions: an access is allowed if all
+    /// the layers allow it.  No warning means that enforcing `next` on top of
+    /// `self` is the same as only enforcing `next`.  Paths are compared
+    /// lexically, without following symbolic links, and mount point rules are
+    /// compared with their configured paths.
+    pub fn check_layer(&self, next: &ResolvedConfig) -> Vec<LayerWarning> {
+        let mut warnings = Vec::new();
+
+        let unhandled_fs = self.handled_fs & !next.handled_fs;
+        if !unhandled_fs.is_empty() {
+            warnings.push(LayerWarning::UnhandledFs(unhandled_fs));
+        }
+        let unhandled_net = self.handled_net & !next.handled_net;
+        if !unhandled_net.is_empty() {
+            warnings.push(LayerWarning::UnhandledNet(unhandled_net));
+        }
+        let unhandled_scope = self.scoped & !next.scoped;
+        if !unhandled_scope.is_empty() {
+            warnings.push(LayerWarning::UnhandledScope(unhandled_scope));
+        }
+
+        for (path, access) in next
+            .rules_path_beneath
+            .iter()
+            .chain(&next.rules_mount_point)
+        {
+            let allowed = self
+                .rules_path_beneath
+                .iter()
+                .chain(&self.rules_mount_point)
+                .filter(|(parent, _)| path.starts_with(parent))
+                .fold(BitFlags::EMPTY, |allowed, (_, access)| allowed | *access);
+            let denied = *access & self.handled_fs & !allowed;
+            if !denied.is_empty() {
+                warnings.push(LayerWarning::DeniedPath {
+                    path: path.clone(),
+                    access: denied,
+                });
+            }
+        }
+
+        for (port, access) in &next.rules_net_port {
+            let allowed = self.rules_net_port.get(port).copied().unwrap_or_default();
+            let denied = *access & self.handled_net & !allowed;
+            if !denied.is_empty() {
+                warnings.push(LayerWarning::DeniedPort {
+                    port: *port,
+                    access: denied,
+                });
+            }
+        }
+
+        warnings
+    }
+
+    /// Returns whether enforcing `next` as a new layer on top of `self` would
+    /// change the effective policy, i.e. whether `next` denies some access that
+    /// `self` still allows.  If not, the new layer would be a no-op and a
+    /// reload can skip it.
+    ///
+    /// This is the converse of [`check_layer()`](ResolvedConfig::check_layer):
+    /// `next` tightens `self` if `next.check_layer(self)` returns any warning.
+    /// The result is conservative: with the same lexical comparison of paths,
+    /// an access right handled by `next` but allowed everywhere (e.g. beneath
+    /// the root directory) is still considered as tightening.
+    pub fn can_tighten(&self, next: &ResolvedConfig) -> bool {
+        !next.check_layer(self).is_empty()
+    }
+
+    /// Returns whether `candidate` grants nothing beyond `self`, e.g. for a
+    /// multi-tenant launcher to only accept tenant policies within the bounds
+    /// of an operator ceiling.
+    ///
+    /// `candidate` is within bounds if it handles at least the filesystem
+    /// access rights, the network access rights, and the scopes handled by
+    /// `self`, and if each of its path and port rules only allows access
+    /// rights allowed by `self` for this path (or one of its parents) or this
+    /// port, or not handled by `self`.  This is the case if and only if
+    /// [`check_layer()`](ResolvedConfig::check_layer) returns no warning:
+    /// enforcing `candidate` alone is then at least as strict as enforcing
+    /// `self`.  Paths are compared the same lexical way.
+    pub fn permits(&self, candidate: &ResolvedConfig) -> bool {
+        self.check_layer(candidate).is_empty()
+    }
+
+    /// Enforces this configuration on the calling thread like
+    /// [`restrict_self()`](ResolvedConfig::restrict_self), unless this exact
+    /// configuration was already enforced with `ensure_applied()`, e.g. by
+    /// library code called from several initialization paths.  Enforcing the
+    /// same configuration twice would only add a redundant layer.
+    ///
+    /// Returns `None` if the configuration was already enforced.  Only
+    /// identical configurations enforced in the same process are
+    /// deduplicated, whatever the calling thread.  Landlock layers are per
+    /// thread, and only inherited by the threads spawned afterwards: this
+    /// should then be called before spawning threads, otherwise a thread
+    /// calling it after another one would stay unrestricted.  Concurrent calls
+    /// are serialized, and a failed enforcement is not recorded.
+    pub fn ensure_applied(
+        &self,
+    ) -> Result<Option<(RestrictionStatus, Vec<RuleError>)>, BuildRulesetError> {
+        self.ensure_applied_with(ResolvedConfig::restrict_self)
+    }
+
+    fn ensure_applied_with<T, E, F>(&self, restrict: F) -> Result<Option<T>, E>
+    where
+        F: FnOnce(&Self) -> Result<T, E>,
+    {
+        let key = self.to_binary();
+        // Held while enforcing, for a concurrent call to wait for the outcome.
+        let mut applied = APPLIED.lock().unwrap_or_else(PoisonError::into_inner);
+        if applied.contains(&key) {
+            return Ok(None);
+        }
+        let ret = restrict(self)?;
+        applied.insert(key);
+        Ok(Some(ret))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::{dedicated_thread, parse_json};
+
+    fn current() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_same_layer() {
+        let current = current();
+        assert_eq!(current.check_layer(&current), []);
+    }
+
+    #[test]
+    fn test_tighten() {
+        let next = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "write_file", "make_dir" ],
+                        "handledAccessNet": [ "bind_tcp" ],
+                        "scoped": [ "signal", "abstract_unix_socket" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr/bin" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr/lib" ]
+                    },
+                    {
+                        "allowedAccess": [ "make_dir" ],
+                        "parent": [ "/home" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        assert_eq!(current().check_layer(&next), []);
+    }
+
+    #[test]
+    fn test_loosen() {
+        let next = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file", "write_file" ],
+                        "parent": [ "/usr/bin" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usrlib" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 80 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        assert_eq!(
+            current().check_layer(&next),
+            [
+                LayerWarning::UnhandledScope(Scope::Signal.into()),
+                LayerWarning::DeniedPath {
+                    path: "/usr/bin".into(),
+                    access: AccessFs::WriteFile.into(),
+                },
+                LayerWarning::DeniedPath {
+                    path: "/usrlib".into(),
+                    access: AccessFs::ReadFile.into(),
+                },
+                LayerWarning::DeniedPort {
+                    port: 80,
+                    access: AccessNet::ConnectTcp.into(),
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_unhandled() {
+        let next = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        assert_eq!(
+            current().check_layer(&next),
+            [
+                LayerWarning::UnhandledFs(AccessFs::ReadFile | AccessFs::WriteFile),
+                LayerWarning::UnhandledNet(AccessNet::ConnectTcp.into()),
+                LayerWarning::UnhandledScope(Scope::Signal.into()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_can_tighten() {
+        let current = current();
+        assert!(!current.can_tighten(&current));
+
+        // Narrower rules with the same handled access rights.
+        let next = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr/bin" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        assert!(current.can_tighten(&next));
+        assert!(!next.can_tighten(&current));
+
+        // Newly handled access rights.
+        let mut next = current.clone();
+        next.handled_fs |= AccessFs::MakeDir;
+        assert!(current.can_tighten(&next));
+    }
+
+    #[test]
+    fn test_can_tighten_looser() {
+        let next = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp", "/home" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 80 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        assert!(!current().can_tighten(&next));
+    }
+
+    #[test]
+    fn test_permits() {
+        let ceiling = current();
+        assert!(ceiling.permits(&ceiling));
+
+        let candidate = |json| parse_json(json).unwrap().resolve().unwrap();
+        let within = candidate(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "make_dir" ],
+                        "scoped": [ "signal", "abstract_unix_socket" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr/bin" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        );
+        assert!(ceiling.permits(&within));
+        // The subset relation is not symmetric.
+        assert!(!within.permits(&ceiling));
+
+        let mut extra_path = within.clone();
+        extra_path
+            .rules_path_beneath
+            .insert("/home".into(), AccessFs::WriteFile.into());
+        assert!(!ceiling.permits(&extra_path));
+
+        let mut extra_port = within.clone();
+        extra_port
+            .rules_net_port
+            .insert(80, AccessNet::ConnectTcp.into());
+        assert!(!ceiling.permits(&extra_port));
+
+        let mut unhandled_scope = within.clone();
+        unhandled_scope.scoped = Scope::AbstractUnixSocket.into();
+        assert!(!ceiling.permits(&unhandled_scope));
+    }
+
+    // The record is shared by all the tests, which must then enforce distinct
+    // configurations.
+    fn unique(port: u64) -> ResolvedConfig {
+        let mut config = current();
+        config
+            .rules_net_port
+            .insert(port, AccessNet::ConnectTcp.into());
+        config
+    }
+
+    #[test]
+    fn test_ensure_applied_once() {
+        let mut calls = 0;
+        let mut restrict = |_: &ResolvedConfig| {
+            calls += 1;
+            Ok::<_, ()>(calls)
+        };
+        let config = unique(1001);
+        assert_eq!(config.ensure_applied_with(&mut restrict), Ok(Some(1)));
+        assert_eq!(config.ensure_applied_with(&mut restrict), Ok(None));
+        assert_eq!(unique(1001).ensure_applied_with(&mut restrict), Ok(None));
+
+        // Another configuration is another layer.
+        let other = unique(1002);
+        assert_eq!(other.ensure_applied_with(&mut restrict), Ok(Some(2)));
+        assert_eq!(calls, 2);
+
+        // The record is shared by all the threads.
+        assert_eq!(
+            dedicated_thread(move || config.ensure_applied_with(|_| Ok::<_, ()>(()))),
+            Ok(None)
+        );
+    }
+
+    #[test]
+    fn test_ensure_applied_error() {
+        let config = unique(1003);
+        assert_eq!(config.ensure_applied_with(|_| Err::<(), _>(())), Err(()));
+        assert_eq!(
+            config.ensure_applied_with(|_| Ok::<_, ()>(())),
+            Ok(Some(()))
+        );
+    }
+
+    #[test]
+    fn test_ensure_applied() {
+        let config = unique(1004);
+        dedicated_thread(move || {
+            assert!(config.ensure_applied().unwrap().is_some());
+            assert!(config.ensure_applied().unwrap().is_none());
+        });
+    }
+}
@@ -1,15 +1,101 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
+pub use alias::{register_fs_alias, register_net_alias, register_scope_alias, AliasError};
+pub use append::AddRulesError;
+pub use audit::{AuditMatch, AuditRecord, AuditRecordError};
+pub use binary::{BinaryError, BINARY_VERSION};
+pub use check::{Analysis, CheckError, CheckOptions, CheckResult, Finding, Severity};
+pub use codegen::{CodegenError, RUST_LANDLOCK_VERSION};
 pub use config::{
-    BuildRulesetError, Config, ConfigFormat, OptionalConfig, ParseDirectoryError, ResolvedConfig,
-    RuleError,
+    BuildRulesetError, BuiltRule, Config, ConfigFormat, ConfigWarning, OptionalConfig,
+    ParseDirectoryError, ParseFileError, ParseOptions, ParseRulesError, ResolvedConfig,
+    Restriction, RuleError, DEFAULT_CLIENT_PORTS, MAX_ABI_ENV,
 };
-pub use variable::ResolveError;
+pub use diagnostic::DIAGNOSTICS_VERSION;
+pub use embed::ParseEmbeddedError;
+pub use errno::{Operation, SyscallError};
+pub use fetch::{
+    FetchError, FetchOptions, FetchRequest, FetchResponse, Fetcher, FileFetcher,
+    DEFAULT_FETCH_MAX_SIZE, DEFAULT_FETCH_TIMEOUT,
+};
+pub use flags::{
+    FlagsError, RulesetOptions, LANDLOCK_RESTRICT_SELF_LOG_NEW_EXEC_ON,
+    LANDLOCK_RESTRICT_SELF_LOG_SAME_EXEC_OFF, LANDLOCK_RESTRICT_SELF_LOG_SUBDOMAINS_OFF,
+};
+#[cfg(feature = "toml")]
+pub use format::{format_toml, FormatTomlError};
+pub use fragment::{FragmentError, DEFAULT_FRAGMENT_DIR};
+pub use grant::{Explanation, PathGrant};
+pub use group::GroupError;
+pub use layer::LayerWarning;
+pub use matrix::{AccessMatrix, MatrixCell, MatrixRow};
+pub use merge::{MergeError, MergePolicy};
+pub use names::{abi_table, fs_access_names, net_access_names, scope_names, AbiTable};
+pub use plan::{PlannedOpen, ResourceEstimate};
+pub use preflight::TestApplyError;
+pub use privilege::{launch, DropPrivilegesError, LaunchError, RestrictThreadError};
+pub use probe::probe_denied;
+pub use recorder::Recorder;
+pub use remap::RemapError;
+pub use resolver::{
+    PathResolveError, PathResolver, Resolution, DEFAULT_MAX_PATH_COMPONENTS, DEFAULT_MAX_PATH_LEN,
+};
+#[cfg(feature = "schema")]
+pub use schema::{SchemaError, StrictSchemaError};
+pub use schema::{JSON_SCHEMA, JSON_SCHEMA_VERSION};
+pub use seal::{Inode, InodeChange, SealedConfig};
+pub use services::ServiceError;
+pub use source::ParsedConfig;
+pub use support::{FullSupportError, UnsupportedFeature};
+pub use surface::Surface;
+pub use trace::{Timings, Trace};
+pub use variable::{ResolveError, ResolveWarning};
+pub use verify::VerifyError;
+pub use version::{kernel_version_abi, Dropped, KernelVersionError};
 
+mod alias;
+mod append;
+mod audit;
+mod binary;
+mod check;
+mod codegen;
 mod config;
+mod diagnostic;
+mod embed;
+mod errno;
+mod fetch;
+mod flags;
+#[cfg(feature = "toml")]
+mod format;
+mod fragment;
+mod grant;
+mod group;
+mod kernel;
+mod layer;
+mod matrix;
+mod merge;
+mod mount;
+mod names;
 mod nonempty;
 mod parser;
+mod plan;
+mod preflight;
+mod privilege;
+mod probe;
+mod recorder;
+mod remap;
+mod resolver;
+mod schema;
+mod scratch;
+mod seal;
+mod services;
+mod source;
+mod support;
+mod surface;
+mod trace;
 mod variable;
+mod verify;
+mod version;
 
 #[cfg(test)]
 #[macro_use]
@@ -29,3 +115,33 @@ mod tests_compose;
 
 #[cfg(test)]
 mod tests_abi;
+
+#[cfg(test)]
+mod tests_serialize;
+
+#[cfg(test)]
+mod tests_when;
+
+#[cfg(test)]
+mod tests_group;
+
+#[cfg(test)]
+mod tests_fragment;
+
+#[cfg(test)]
+mod tests_mount;
+
+#[cfg(test)]
+mod tests_multi;
+
+#[cfg(test)]
+mod tests_profile;
+
+#[cfg(test)]
+mod tests_tag;
+
+#[cfg(test)]
+mod tests_layered;
+
+#[cfg(all(test, feature = "schema"))]
+mod tests_schema;
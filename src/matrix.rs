@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::names::access_name;
+use crate::parser::{JsonFsAccessItem, JsonNetAccessItem, JsonScopeItem};
+use crate::ResolvedConfig;
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope};
+use std::fmt::Write;
+
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum MatrixCell {
+    Allow,
+    Deny,
+    /// The column does not apply to the row (e.g. a network access right for
+    /// a path).
+    NotApplicable,
+}
+
+impl MatrixCell {
+    fn as_str(&self) -> &'static str {
+        match self {
+            Self::Allow => "allow",
+            Self::Deny => "deny",
+            Self::NotApplicable => "",
+        }
+    }
+}
+
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct MatrixRow {
+    /// Path, port (e.g. `port 443`), or `process` for the scopes.
+    pub label: String,
+    /// One cell per column.
+    pub cells: Vec<MatrixCell>,
+}
+
+/// Tabular summary of a configuration, see
+/// [`ResolvedConfig::access_matrix()`].
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct AccessMatrix {
+    /// Names of the handled filesystem access rights, network access rights,
+    /// and scopes, in this order.
+    pub columns: Vec<String>,
+    pub rows: Vec<MatrixRow>,
+}
+
+/// Returns the cells of `access` for the `handled` columns, and
+/// `NotApplicable` for the `before` and `after` other columns.
+fn cells<A>(
+    before: usize,
+    handled: BitFlags<A>,
+    access: BitFlags<A>,
+    after: usize,
+) -> Vec<MatrixCell>
+where
+    A: Access,
+{
+    let mut cells = vec![MatrixCell::NotApplicable; before];
+    cells.extend(handled.iter().map(|a| {
+        if access.contains(a) {
+            MatrixCell::Allow
+        } else {
+            MatrixCell::Deny
+        }
+    }));
+    cells.extend(vec![MatrixCell::NotApplicable; after]);
+    cells
+}
+
+impl ResolvedConfig {
+    /// Summarizes this configuration as a table, e.g. to document a policy
+    /// in a pull request or a runbook.
+    ///
+    /// Columns are the handled access rights and scopes.  There is one row
+    /// per path with a rule, with the access rights allowed beneath it
+    /// (including the inherited ones, see
+    /// [`granted_paths()`](ResolvedConfig::granted_paths)), then one row per
+    /// port, and a final `process` row denying the scopes, if any.  Rows and
+    /// columns are sorted.  Access rights handled but not listed in a row are
+    /// denied, and unlisted paths and ports are denied everything.
+    pub fn access_matrix(&self) -> AccessMatrix {
+        let fs = self.handled_fs.iter().count();
+        let net = self.handled_net.iter().count();
+        let scopes = self.scoped.iter().count();
+
+        let columns = self
+            .handled_fs
+            .iter()
+            .filter_map(access_name::<AccessFs, JsonFsAccessItem>)
+            .chain(
+                self.handled_net
+                    .iter()
+                    .filter_map(access_name::<AccessNet, JsonNetAccessItem>),
+            )
+            .chain(
+                self.scoped
+                    .iter()
+                    .filter_map(access_name::<Scope, JsonScopeItem>),
+            )
+            .collect();
+
+        let mut rows: Vec<_> = self
+            .granted_paths()
+            .into_iter()
+            .map(|grant| MatrixRow {
+                label: grant.path.display().to_string(),
+                cells: cells(0, self.handled_fs, grant.access, net + scopes),
+            })
+            .collect();
+        rows.extend(self.rules_net_port.iter().map(|(port, access)| MatrixRow {
+            label: format!("port {port}"),
+            cells: cells(fs, self.handled_net, *access, scopes),
+        }));
+        if scopes != 0 {
+            rows.push(MatrixRow {
+                label: "process".into(),
+                cells: cells(fs + net, self.scoped, BitFlags::EMPTY, 0),
+            });
+        }
+        AccessMatrix { columns, rows }
+    }
+}
+
+impl AccessMatrix {
+    /// Renders the matrix as a Markdown table, with paths as code.
+    pub fn to_markdown(&self) -> String {
+        let mut table = String::from("|");
+        // Writing to a String cannot fail.
+        for column in std::iter::once("").chain(self.columns.iter().map(String::as_str)) {
+            let _ = write!(table, " {column} |");
+        }
+        table.push_str("\n|");
+        for _ in 0..=self.columns.len() {
+            table.push_str("---|");
+        }
+        table.push('\n');
+        for row in &self.rows {
+            let label = if row.label.starts_with('/') {
+                format!("`{}`", row.label)
+            } else {
+                row.label.clone()
+            };
+            let _ = write!(table, "| {label} |");
+            for cell in &row.cells {
+                let _ = write!(table, " {} |", cell.as_str());
+            }
+            table.push('\n');
+        }
+        table
+    }
+
+    /// Renders the matrix as a plain text table with aligned columns, and `-`
+    /// for the cells that do not apply.
+    pub fn to_text(&self) -> String {
+        let label_width = self
+            .rows
+            .iter()
+            .map(|row| row.label.chars().count())
+            .max()
+            .unwrap_or_default();
+        let widths: Vec<_> = self
+            .columns
+            .iter()
+            .map(|column| column.len().max(MatrixCell::Allow.as_str().len()))
+            .collect();
+
+        let mut lines = vec![std::iter::once(format!("{:label_width$}", ""))
+            .chain(
+                self.columns
+                    .iter()
+                    .zip(&widths)
+                    .map(|(column, width)| format!("{column:width$}")),
+            )
+            .collect::<Vec<_>>()];
+        for row in &self.rows {
+            lines.push(
+                std::iter::once(format!("{:label_width$}", row.label))
+                    .chain(row.cells.iter().zip(&widths).map(|(cell, width)| {
+                        let cell = match cell {
+                            MatrixCell::NotApplicable => "-",
+                            cell => cell.as_str(),
+                        };
+                        format!("{cell:width$}")
+                    }))
+                    .collect(),
+            );
+        }
+        lines
+            .into_iter()
+            .map(|line| line.join("  ").trim_end().to_string() + "\n")
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    const GOLDEN_MARKDOWN: &str = include_str!("../tests/matrix/golden.md");
+    const GOLDEN_TEXT: &str = include_str!("../tests/matrix/golden.txt");
+
+    fn matrix() -> AccessMatrix {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "write_file" ],
+                        "scoped": [ "signal", "abstract_unix_socket" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file", "read_dir" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/usr/local/var", "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 80 ]
+                    },
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 8080 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+        .access_matrix()
+    }
+
+    #[test]
+    fn test_access_matrix() {
+        let matrix = matrix();
+        assert_eq!(
+            matrix.columns,
+            [
+                "execute",
+                "write_file",
+                "read_file",
+                "read_dir",
+                "bind_tcp",
+                "connect_tcp",
+                "abstract_unix_socket",
+                "signal",
+            ]
+        );
+        assert_eq!(
+            matrix
+                .rows
+                .iter()
+                .map(|row| row.label.as_str())
+                .collect::<Vec<_>>(),
+            [
+                "/tmp",
+                "/usr",
+                "/usr/local/var",
+                "port 80",
+                "port 443",
+                "port 8080",
+                "process"
+            ]
+        );
+        assert!(matrix
+            .rows
+            .iter()
+            .all(|row| row.cells.len() == matrix.columns.len()));
+    }
+
+    #[test]
+    fn test_access_matrix_golden() {
+        let matrix = matrix();
+        assert_eq!(matrix.to_markdown(), GOLDEN_MARKDOWN);
+        assert_eq!(matrix.to_text(), GOLDEN_TEXT);
+    }
+
+    #[test]
+    fn test_access_matrix_empty() {
+        let matrix = ResolvedConfig::default().access_matrix();
+        assert_eq!(matrix, AccessMatrix::default());
+        assert_eq!(matrix.to_markdown(), "|  |\n|---|\n");
+        assert_eq!(matrix.to_text(), "\n");
+    }
+}
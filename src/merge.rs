@@ -0,0 +1,428 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::ResolvedConfig;
+use landlock::{Access, AccessFs, BitFlags};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use thiserror::Error;
+
+/// How [`ResolvedConfig::merge_with()`] handles configurations that disagree.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum MergePolicy {
+    /// Most permissive: allows what is allowed by any configuration.
+    ///
+    /// * Filesystem and network access rights are only handled if they are
+    ///   handled by all the configurations, and the rules of all the
+    ///   configurations are merged, limited to these common access rights.
+    /// * Scopes are only kept if they are set by all the configurations.
+    ///
+    /// This is the same as [`Config::compose()`](crate::Config::compose).
+    Union,
+    /// Most restrictive: only allows what is allowed by all the
+    /// configurations.
+    ///
+    /// * Filesystem and network access rights handled by any configuration
+    ///   are handled.
+    /// * A filesystem access right handled by several configurations is only
+    ///   allowed beneath a path if all of them allow it for this path or one
+    ///   of its parents (compared lexically, without following symbolic
+    ///   links).
+    /// * A network access right handled by several configurations is only
+    ///   allowed for a port if all of them allow it for this port.
+    /// * Scopes set by any configuration are kept.
+    Intersection,
+    /// Fails with a [`MergeError`] if the configurations disagree, e.g. to
+    /// make sure fragments maintained by different teams are consistent.
+    ///
+    /// * All the configurations must handle the same filesystem and network
+    ///   access rights, and set the same scopes.
+    /// * A path or a port with rules in several configurations must be
+    ///   allowed the same access rights in all of them.
+    ///
+    /// The rules of all the configurations are then merged.
+    Strict,
+}
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum MergeError {
+    #[error("different handled access rights or scopes")]
+    Handled,
+    #[error("different access rights allowed for path {}", .0.display())]
+    Path(PathBuf),
+    #[error("different access rights allowed for port {0}")]
+    Port(u64),
+}
+
+/// Allowed filesystem access rights for `path`, including the ones inherited
+/// from its parents.
+fn allowed_fs(rules: &[&BTreeMap<PathBuf, BitFlags<AccessFs>>], path: &Path) -> BitFlags<AccessFs> {
+    rules
+        .iter()
+        .flat_map(|rules| rules.iter())
+        .filter(|(parent, _)| path.starts_with(parent))
+        .fold(BitFlags::EMPTY, |allowed, (_, access)| allowed | *access)
+}
+
+fn union_rules<K, A>(rules: &mut BTreeMap<K, BitFlags<A>>, other: &BTreeMap<K, BitFlags<A>>)
+where
+    K: Clone + Ord,
+    A: Access,
+{
+    for (key, access) in other {
+        *rules.entry(key.clone()).or_default() |= *access;
+    }
+}
+
+fn check_rules<K, A, E>(
+    rules: &BTreeMap<K, BitFlags<A>>,
+    other: &BTreeMap<K, BitFlags<A>>,
+    error: E,
+) -> Result<(), MergeError>
+where
+    K: Clone + Ord,
+    A: Access,
+    E: Fn(K) -> MergeError,
+{
+    for (key, access) in other {
+        match rules.get(key) {
+            Some(a) if a != access => return Err(error(key.clone())),
+            _ => {}
+        }
+    }
+    Ok(())
+}
+
+impl ResolvedConfig {
+    /// Merges `others` into `self` according to `policy`, e.g. to combine
+    /// configuration fragments maintained by different teams.
+    ///
+    /// Unlike [`Config::compose()`](crate::Config::compose), merging is done
+    /// with resolved paths, which is required to compare path hierarchies.
+    /// See [`MergePolicy`] for the semantics of each policy.  With
+    /// [`MergePolicy::Strict`], `self` is left unchanged if an error is
+    /// returned.
+    pub fn merge_with(&mut self, policy: MergePolicy, others: &[&Self]) -> Result<(), MergeError> {
+        if policy == MergePolicy::Strict {
+            for other in others {
+                self.check_merge(other)?;
+            }
+        }
+        for other in others {
+            // A rule required by any configuration stays required.
+            self.required_paths
+                .extend(other.required_paths.iter().cloned());
+            self.required_ports.extend(&other.required_ports);
+            match policy {
+                MergePolicy::Union => self.merge_union(other),
+                MergePolicy::Intersection => self.merge_intersection(other),
+                // Handled access rights are the same, so the union only merges
+                // the rules.
+                MergePolicy::Strict => self.merge_union(other),
+            }
+        }
+        Ok(())
+    }
+
+    fn check_merge(&self, other: &Self) -> Result<(), MergeError> {
+        if self.handled_fs != other.handled_fs
+            || self.handled_net != other.handled_net
+            || self.scoped != other.scoped
+        {
+            return Err(MergeError::Handled);
+        }
+        check_rules(
+            &self.rules_path_beneath,
+            &other.rules_path_beneath,
+            MergeError::Path,
+        )?;
+        check_rules(
+            &self.rules_mount_point,
+            &other.rules_mount_point,
+            MergeError::Path,
+        )?;
+        check_rules(
+            &self.rules_net_port,
+            &other.rules_net_port,
+            MergeError::Port,
+        )
+    }
+
+    fn merge_union(&mut self, other: &Self) {
+        let common_handled_fs = self.handled_fs & other.handled_fs;
+        let common_handled_net = self.handled_net & other.handled_net;
+
+        union_rules(&mut self.rules_path_beneath, &other.rules_path_beneath);
+        union_rules(&mut self.rules_mount_point, &other.rules_mount_point);
+        union_rules(&mut self.rules_net_port, &other.rules_net_port);
+        for rules in [&mut self.rules_path_beneath, &mut self.rules_mount_point] {
+            rules.retain(|_, access| {
+                *access &= common_handled_fs;
+                !access.is_empty()
+            });
+        }
+        self.rules_net_port.retain(|_, access| {
+            *access &= common_handled_net;
+            !access.is_empty()
+        });
+
+        self.handled_fs = common_handled_fs;
+        self.handled_net = common_handled_net;
+        self.scoped &= other.scoped;
+    }
+
+    fn merge_intersection(&mut self, other: &Self) {
+        let common_handled_fs = self.handled_fs & other.handled_fs;
+        let common_handled_net = self.handled_net & other.handled_net;
+
+        // Access rights only handled by one configuration are not restricted
+        // by the other one.
+        let self_fs = [&self.rules_path_beneath, &self.rules_mount_point];
+        let other_fs = [&other.rules_path_beneath, &other.rules_mount_point];
+        let intersect = |rules: &BTreeMap<PathBuf, BitFlags<AccessFs>>,
+                         opposite: &[&BTreeMap<PathBuf, BitFlags<AccessFs>>],
+                         opposite_handled: BitFlags<AccessFs>| {
+            rules
+                .iter()
+                .map(|(path, access)| {
+                    let restricted = *access & common_handled_fs;
+                    let access =
+                        (*access & !opposite_handled) | (restricted & allowed_fs(opposite, path));
+                    (path.clone(), access)
+                })
+                .filter(|(_, access)| !access.is_empty())
+                .collect::<BTreeMap<_, _>>()
+        };
+        let mut path_beneath = intersect(&self.rules_path_beneath, &other_fs, other.handled_fs);
+        let mut mount_point = intersect(&self.rules_mount_point, &other_fs, other.handled_fs);
+        union_rules(
+            &mut path_beneath,
+            &intersect(&other.rules_path_beneath, &self_fs, self.handled_fs),
+        );
+        union_rules(
+            &mut mount_point,
+            &intersect(&other.rules_mount_point, &self_fs, self.handled_fs),
+        );
+
+        let mut net_port = BTreeMap::new();
+        for (rules, opposite, opposite_handled) in [
+            (
+                &self.rules_net_port,
+                &other.rules_net_port,
+                other.handled_net,
+            ),
+            (
+                &other.rules_net_port,
+                &self.rules_net_port,
+                self.handled_net,
+            ),
+        ] {
+            for (port, access) in rules {
+                let allowed = opposite.get(port).copied().unwrap_or_default();
+                let access =
+                    (*access & !opposite_handled) | (*access & common_handled_net & allowed);
+                if !access.is_empty() {
+                    *net_port.entry(*port).or_default() |= access;
+                }
+            }
+        }
+
+        self.rules_path_beneath = path_beneath;
+        self.rules_mount_point = mount_point;
+        self.rules_net_port = net_port;
+        self.handled_fs |= other.handled_fs;
+        self.handled_net |= other.handled_net;
+        self.scoped |= other.scoped;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use landlock::{AccessNet, Scope};
+
+    // Overlapping configurations: both handle execute and read_file, /usr is
+    // allowed by the first one and /usr/bin by the second one.
+    fn first() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "make_dir" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "make_dir" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 80 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    fn second() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "scoped": [ "abstract_unix_socket", "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr/bin", "/etc" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 8080 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    fn merge(policy: MergePolicy) -> Result<ResolvedConfig, MergeError> {
+        let mut merged = first();
+        merged.merge_with(policy, &[&second()]).map(|_| merged)
+    }
+
+    #[test]
+    fn test_merge_union() {
+        assert_eq!(
+            merge(MergePolicy::Union).unwrap(),
+            ResolvedConfig {
+                handled_fs: AccessFs::ReadFile.into(),
+                handled_net: AccessNet::ConnectTcp.into(),
+                scoped: Scope::Signal.into(),
+                rules_path_beneath: [
+                    ("/etc".into(), AccessFs::ReadFile.into()),
+                    ("/usr".into(), AccessFs::ReadFile.into()),
+                    ("/usr/bin".into(), AccessFs::ReadFile.into()),
+                ]
+                .into(),
+                rules_net_port: [
+                    (80, AccessNet::ConnectTcp.into()),
+                    (443, AccessNet::ConnectTcp.into()),
+                    (8080, AccessNet::ConnectTcp.into()),
+                ]
+                .into(),
+                ..Default::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_merge_union_compose() {
+        let mut composed = first();
+        composed
+            .merge_with(MergePolicy::Union, &[&second()])
+            .unwrap();
+        let mut reversed = second();
+        reversed
+            .merge_with(MergePolicy::Union, &[&first()])
+            .unwrap();
+        assert_eq!(composed, reversed);
+    }
+
+    #[test]
+    fn test_merge_intersection() {
+        assert_eq!(
+            merge(MergePolicy::Intersection).unwrap(),
+            ResolvedConfig {
+                handled_fs: AccessFs::Execute | AccessFs::ReadFile | AccessFs::MakeDir,
+                handled_net: AccessNet::ConnectTcp.into(),
+                scoped: Scope::AbstractUnixSocket | Scope::Signal,
+                rules_path_beneath: [
+                    // Execute is only handled by the first configuration.
+                    ("/usr".into(), AccessFs::Execute.into()),
+                    ("/usr/bin".into(), AccessFs::ReadFile.into()),
+                    // MakeDir is only handled by the first configuration.
+                    ("/tmp".into(), AccessFs::MakeDir.into()),
+                ]
+                .into(),
+                rules_net_port: [(443, AccessNet::ConnectTcp.into())].into(),
+                ..Default::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_merge_strict() {
+        assert_eq!(merge(MergePolicy::Strict), Err(MergeError::Handled));
+
+        let mut other = first();
+        other.rules_path_beneath = [
+            ("/usr".into(), AccessFs::Execute | AccessFs::ReadFile),
+            ("/usr/bin".into(), AccessFs::ReadFile.into()),
+        ]
+        .into();
+        other.rules_net_port = [(8080, AccessNet::ConnectTcp.into())].into();
+        let mut merged = first();
+        merged.merge_with(MergePolicy::Strict, &[&other]).unwrap();
+        assert_eq!(
+            merged.rules_path_beneath,
+            [
+                ("/tmp".into(), AccessFs::MakeDir.into()),
+                ("/usr".into(), AccessFs::Execute | AccessFs::ReadFile),
+                ("/usr/bin".into(), AccessFs::ReadFile.into()),
+            ]
+            .into()
+        );
+        assert_eq!(merged.rules_net_port.len(), 3);
+        assert_eq!(merged.handled_fs, first().handled_fs);
+
+        other.rules_path_beneath = [("/usr".into(), AccessFs::ReadFile.into())].into();
+        let mut merged = first();
+        assert_eq!(
+            merged.merge_with(MergePolicy::Strict, &[&other]),
+            Err(MergeError::Path("/usr".into()))
+        );
+        assert_eq!(merged, first());
+
+        other.rules_path_beneath.clear();
+        other.rules_net_port = [(443, AccessNet::BindTcp.into())].into();
+        assert_eq!(
+            first().merge_with(MergePolicy::Strict, &[&other]),
+            Err(MergeError::Port(443))
+        );
+    }
+
+    #[test]
+    fn test_merge_empty() {
+        for policy in [
+            MergePolicy::Union,
+            MergePolicy::Intersection,
+            MergePolicy::Strict,
+        ] {
+            let mut merged = first();
+            merged.merge_with(policy, &[]).unwrap();
+            assert_eq!(merged, first());
+            // Merging with itself is idempotent.
+            merged.merge_with(policy, &[&first()]).unwrap();
+            assert_eq!(merged, first());
+        }
+    }
+}
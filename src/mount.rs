@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use std::collections::BTreeSet;
+use std::fs;
+use std::io;
+use std::path::{Path, PathBuf};
+
+const MOUNTINFO_PATH: &str = "/proc/self/mountinfo";
+
+/// Mount points of the current mount namespace.
+#[derive(Debug, Default)]
+pub(crate) struct MountPoints(BTreeSet<PathBuf>);
+
+impl MountPoints {
+    pub(crate) fn load() -> io::Result<Self> {
+        Ok(Self::parse(&fs::read_to_string(MOUNTINFO_PATH)?))
+    }
+
+    /// Parses the mount points (i.e. the fifth field) of a mountinfo file, see
+    /// proc_pid_mountinfo(5).
+    fn parse(mountinfo: &str) -> Self {
+        Self(
+            mountinfo
+                .lines()
+                .filter_map(|line| line.split(' ').nth(4))
+                .map(|mount_point| PathBuf::from(unescape(mount_point)))
+                .collect(),
+        )
+    }
+
+    /// Returns the mount point containing `path`, after following its symbolic
+    /// links, and whether `path` is itself this mount point.
+    pub(crate) fn mount_root<P>(&self, path: P) -> io::Result<(PathBuf, bool)>
+    where
+        P: AsRef<Path>,
+    {
+        let path = fs::canonicalize(path)?;
+        let mount_point = path
+            .ancestors()
+            .find(|ancestor| self.0.contains(*ancestor))
+            .ok_or_else(|| {
+                io::Error::new(
+                    io::ErrorKind::NotFound,
+                    format!("no mount point found in {MOUNTINFO_PATH}"),
+                )
+            })?;
+        Ok((mount_point.into(), mount_point == path))
+    }
+}
+
+/// Decodes the octal escape sequences used for spaces, tabulations, newlines,
+/// and backslashes.
+fn unescape(field: &str) -> String {
+    let mut unescaped = String::with_capacity(field.len());
+    let mut rest = field;
+    while let Some(index) = rest.find('\\') {
+        unescaped.push_str(&rest[..index]);
+        let escaped = rest.get(index + 1..index + 4);
+        match escaped.and_then(|code| u8::from_str_radix(code, 8).ok()) {
+            Some(byte) => {
+                unescaped.push(byte.into());
+                rest = &rest[index + 4..];
+            }
+            None => {
+                unescaped.push('\\');
+                rest = &rest[index + 1..];
+            }
+        }
+    }
+    unescaped.push_str(rest);
+    unescaped
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const MOUNTINFO: &str = "\
+22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+24 22 0:22 / /tmp rw,nosuid,nodev shared:13 - tmpfs tmpfs rw
+25 22 0:23 / /mnt/with\\040space rw,relatime shared:14 - tmpfs tmpfs rw
+";
+
+    #[test]
+    fn test_parse() {
+        let mount_points = MountPoints::parse(MOUNTINFO);
+        assert_eq!(
+            mount_points.0,
+            ["/", "/proc", "/tmp", "/mnt/with space"]
+                .into_iter()
+                .map(PathBuf::from)
+                .collect()
+        );
+    }
+
+    #[test]
+    fn test_unescape() {
+        assert_eq!(unescape("/a\\040b\\011c\\012d\\134e"), "/a b\tc\nd\\e");
+        assert_eq!(unescape("/a\\b"), "/a\\b");
+        assert_eq!(unescape("/a\\"), "/a\\");
+    }
+
+    #[test]
+    fn test_mount_root() {
+        let mount_points = MountPoints::load().unwrap();
+        assert_eq!(
+            mount_points.mount_root("/proc").unwrap(),
+            ("/proc".into(), true)
+        );
+        // /proc/self is a symbolic link to a directory in /proc.
+        assert_eq!(
+            mount_points.mount_root("/proc/self").unwrap(),
+            ("/proc".into(), false)
+        );
+        assert_eq!(mount_points.mount_root("/").unwrap(), ("/".into(), true));
+    }
+
+    #[test]
+    fn test_mount_root_not_found() {
+        let mount_points = MountPoints::parse(MOUNTINFO);
+        let err = mount_points
+            .mount_root("/landlockconfig-nonexistent")
+            .unwrap_err();
+        assert_eq!(err.kind(), io::ErrorKind::NotFound);
+
+        assert_eq!(
+            MountPoints::default().mount_root("/").unwrap_err().kind(),
+            io::ErrorKind::NotFound
+        );
+    }
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::alias::AccessItem;
+use crate::parser::{JsonFsAccessItem, JsonNetAccessItem, JsonScopeItem, UnknownAccessError};
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope, ABI};
+use serde::de::value::Error;
+use serde::de::{Error as _, Visitor};
+use serde::{forward_to_deserialize_any, Deserialize, Deserializer, Serialize};
+use std::collections::BTreeMap;
+
+/// Deserializer only used to get the variant names of an enum, as seen by the
+/// parser (i.e. with the serde renames).
+struct VariantNames<'a>(&'a mut &'static [&'static str]);
+
+impl<'de> Deserializer<'de> for VariantNames<'_> {
+    type Error = Error;
+
+    fn deserialize_any<V>(self, _visitor: V) -> Result<V::Value, Self::Error>
+    where
+        V: Visitor<'de>,
+    {
+        Err(Error::custom("not an enum"))
+    }
+
+    fn deserialize_enum<V>(
+        self,
+        _name: &'static str,
+        variants: &'static [&'static str],
+        _visitor: V,
+    ) -> Result<V::Value, Self::Error>
+    where
+        V: Visitor<'de>,
+    {
+        *self.0 = variants;
+        Err(Error::custom("variant names collected"))
+    }
+
+    forward_to_deserialize_any! {
+        bool i8 i16 i32 i64 i128 u8 u16 u32 u64 u128 f32 f64 char str string
+        bytes byte_buf option unit unit_struct newtype_struct seq tuple
+        tuple_struct map struct identifier ignored_any
+    }
+}
+
+fn variant_names<T>() -> &'static [&'static str]
+where
+    T: Deserialize<'static>,
+{
+    let mut names: &'static [&'static str] = &[];
+    let _ = T::deserialize(VariantNames(&mut names));
+    names
+}
+
+/// Returns the standard names of an access right item, i.e. without the
+/// registered aliases.
+pub(crate) fn standard_names<I>() -> &'static [&'static str]
+where
+    I: AccessItem,
+{
+    let mut names: &'static [&'static str] = &[];
+    let _ = I::deserialize_standard(VariantNames(&mut names));
+    names
+}
+
+/// Returns all the filesystem access right names accepted by the parser,
+/// including the `abi.*` groups.
+pub fn fs_access_names() -> &'static [&'static str] {
+    variant_names::<JsonFsAccessItem>()
+}
+
+/// Returns all the network access right names accepted by the parser,
+/// including the `abi.*` groups.
+pub fn net_access_names() -> &'static [&'static str] {
+    variant_names::<JsonNetAccessItem>()
+}
+
+/// Returns all the scope names accepted by the parser, including the `abi.*`
+/// groups.
+pub fn scope_names() -> &'static [&'static str] {
+    variant_names::<JsonScopeItem>()
+}
+
+/// Access rights and scopes supported by an ABI version, mapping their names
+/// to their kernel bits.
+///
+/// The bits are the ones of the Landlock UAPI, which never change for a
+/// name, and the names are the ones accepted by the parser (without the
+/// `abi.*` groups), which are stable for a [`JSON_SCHEMA_VERSION`](crate::JSON_SCHEMA_VERSION).
+/// A newer ABI version only adds entries.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct AbiTable {
+    pub fs: BTreeMap<String, u64>,
+    pub net: BTreeMap<String, u64>,
+    pub scope: BTreeMap<String, u64>,
+}
+
+/// Returns the name of an access right or a scope accepted by the parser, if
+/// any.
+pub(crate) fn access_name<A, I>(access: A) -> Option<String>
+where
+    I: TryFrom<A, Error = UnknownAccessError> + Serialize,
+{
+    let item = I::try_from(access).ok()?;
+    Some(serde_json::to_value(item).ok()?.as_str()?.to_owned())
+}
+
+fn access_table<A, I>(abi: ABI, bits: fn(BitFlags<A>) -> u64) -> BTreeMap<String, u64>
+where
+    A: Access,
+    I: TryFrom<A, Error = UnknownAccessError> + Serialize,
+{
+    A::from_all(abi)
+        .iter()
+        // Access rights unknown to the parser cannot be configured.
+        .filter_map(|access| Some((access_name::<A, I>(access)?, bits(access.into()))))
+        .collect()
+}
+
+/// Returns the access rights and scopes supported by `abi`, e.g. to generate
+/// documentation or to validate configurations without hardcoding them.
+pub fn abi_table(abi: ABI) -> AbiTable {
+    AbiTable {
+        fs: access_table::<AccessFs, JsonFsAccessItem>(abi, |a| a.bits()),
+        net: access_table::<AccessNet, JsonNetAccessItem>(abi, |a| a.bits()),
+        scope: access_table::<Scope, JsonScopeItem>(abi, |a| a.bits()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::LATEST_ABI;
+    use serde::de::DeserializeOwned;
+    use serde_json::Value;
+    use std::fs;
+    use std::path::PathBuf;
+
+    fn schema_names(definition: &str) -> Vec<String> {
+        let schema_path =
+            PathBuf::from(env!("CARGO_MANIFEST_DIR")).join("schema/landlockconfig.json");
+        let schema: Value =
+            serde_json::from_str(&fs::read_to_string(schema_path).unwrap()).unwrap();
+        serde_json::from_value(schema["$defs"][definition]["enum"].clone()).unwrap()
+    }
+
+    fn check_names<A, I>(names: &[&str], definition: &str)
+    where
+        A: Access,
+        I: TryFrom<A, Error = UnknownAccessError> + DeserializeOwned + Serialize,
+    {
+        assert!(!names.is_empty());
+        assert_eq!(names, schema_names(definition));
+
+        // Round trip through the parser.
+        for name in names {
+            let item: I = serde_json::from_value(Value::from(*name)).unwrap();
+            assert_eq!(serde_json::to_value(&item).unwrap(), Value::from(*name));
+        }
+
+        // Every known access right has a name.
+        for access in BitFlags::<A>::all() {
+            let item = I::try_from(access).unwrap();
+            let name = serde_json::to_value(&item).unwrap();
+            assert!(names.contains(&name.as_str().unwrap()));
+        }
+    }
+
+    #[test]
+    fn test_fs_access_names() {
+        check_names::<AccessFs, JsonFsAccessItem>(fs_access_names(), "accessFs");
+    }
+
+    #[test]
+    fn test_net_access_names() {
+        check_names::<AccessNet, JsonNetAccessItem>(net_access_names(), "accessNet");
+    }
+
+    #[test]
+    fn test_scope_names() {
+        check_names::<Scope, JsonScopeItem>(scope_names(), "scope");
+    }
+
+    fn table(entries: &[(&str, u64)]) -> BTreeMap<String, u64> {
+        entries
+            .iter()
+            .map(|(name, bits)| (name.to_string(), *bits))
+            .collect()
+    }
+
+    #[test]
+    fn test_abi_table() {
+        let v1 = [
+            ("execute", 1 << 0),
+            ("write_file", 1 << 1),
+            ("read_file", 1 << 2),
+            ("read_dir", 1 << 3),
+            ("remove_dir", 1 << 4),
+            ("remove_file", 1 << 5),
+            ("make_char", 1 << 6),
+            ("make_dir", 1 << 7),
+            ("make_reg", 1 << 8),
+            ("make_sock", 1 << 9),
+            ("make_fifo", 1 << 10),
+            ("make_block", 1 << 11),
+            ("make_sym", 1 << 12),
+        ];
+        let v2 = [&v1[..], &[("refer", 1 << 13)]].concat();
+        let v3 = [&v2[..], &[("truncate", 1 << 14)]].concat();
+        let v5 = [&v3[..], &[("ioctl_dev", 1 << 15)]].concat();
+        let net = table(&[("bind_tcp", 1 << 0), ("connect_tcp", 1 << 1)]);
+        let scope = table(&[("abstract_unix_socket", 1 << 0), ("signal", 1 << 1)]);
+
+        assert_eq!(abi_table(ABI::Unsupported), AbiTable::default());
+        let expected = [
+            (ABI::V1, table(&v1), BTreeMap::new(), BTreeMap::new()),
+            (ABI::V2, table(&v2), BTreeMap::new(), BTreeMap::new()),
+            (ABI::V3, table(&v3), BTreeMap::new(), BTreeMap::new()),
+            (ABI::V4, table(&v3), net.clone(), BTreeMap::new()),
+            (ABI::V5, table(&v5), net.clone(), BTreeMap::new()),
+            (ABI::V6, table(&v5), net.clone(), scope.clone()),
+        ];
+        for (abi, fs, net, scope) in expected {
+            assert_eq!(abi_table(abi), AbiTable { fs, net, scope }, "{abi:?}");
+        }
+        assert_eq!(abi_table(LATEST_ABI), abi_table(ABI::V6));
+    }
+}
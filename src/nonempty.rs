@@ -1,6 +1,6 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
-use serde::Deserialize;
+use serde::{Deserialize, Serialize};
 use std::collections::BTreeSet;
 use std::iter::FromIterator;
 use std::ops::Deref;
@@ -15,6 +15,16 @@ impl<T> Default for NonEmptySet<T> {
     }
 }
 
+impl<T> NonEmptySet<T> {
+    pub(crate) fn new(set: BTreeSet<T>) -> Option<Self> {
+        if set.is_empty() {
+            None
+        } else {
+            Some(Self(set))
+        }
+    }
+}
+
 impl<'de, T> Deserialize<'de> for NonEmptySet<T>
 where
     T: Deserialize<'de> + Ord,
@@ -32,6 +42,18 @@ where
     }
 }
 
+impl<T> Serialize for NonEmptySet<T>
+where
+    T: Serialize,
+{
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: serde::Serializer,
+    {
+        self.0.serialize(serializer)
+    }
+}
+
 impl<T> Deref for NonEmptySet<T> {
     type Target = BTreeSet<T>;
 
@@ -73,6 +95,14 @@ impl<T> NonEmptyStruct<T>
 where
     T: NonEmptyStructInner,
 {
+    pub(crate) fn new(inner: T) -> Option<Self> {
+        if inner.is_empty() {
+            None
+        } else {
+            Some(Self(inner))
+        }
+    }
+
     pub(crate) fn into_inner(self) -> T {
         self.0
     }
@@ -101,3 +131,15 @@ where
         }
     }
 }
+
+impl<T> Serialize for NonEmptyStruct<T>
+where
+    T: Serialize + NonEmptyStructInner,
+{
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: serde::Serializer,
+    {
+        self.0.serialize(serializer)
+    }
+}
@@ -1,6 +1,8 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
 use crate::{
+    alias::{deserialize_item, AccessItem, Alias},
+    kernel::LazyAbi,
     nonempty::{NonEmptySet, NonEmptyStruct, NonEmptyStructInner},
     variable::{Name, ResolveError},
 };
@@ -8,18 +10,21 @@ use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope, ABI};
 use serde::de::{Unexpected, Visitor};
 use serde::{de, Deserialize, Deserializer, Serialize, Serializer};
 use std::str::FromStr;
+use thiserror::Error;
 
 #[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Hash)]
 pub enum TemplateToken {
     Text(String),
     Var(Name),
+    /// Variable with a default value, used if the variable is not defined,
+    /// written `${name:-default}`.
+    VarDefault(Name, String),
 }
 
 #[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Hash)]
 pub struct TemplateString(pub Vec<TemplateToken>);
 
 impl TemplateString {
-    #[cfg(test)]
     pub(crate) fn from_text<T>(text: T) -> Self
     where
         T: Into<String>,
@@ -32,8 +37,10 @@ impl std::fmt::Display for TemplateString {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
         for token in &self.0 {
             match token {
-                TemplateToken::Text(text) => f.write_str(text)?,
+                // Escapes dollar signs to keep the string parsable.
+                TemplateToken::Text(text) => f.write_str(&text.replace('$', "$$"))?,
                 TemplateToken::Var(var) => write!(f, "${{{}}}", var)?,
+                TemplateToken::VarDefault(var, default) => write!(f, "${{{}:-{}}}", var, default)?,
             }
         }
         Ok(())
@@ -62,7 +69,8 @@ impl<'de> de::Visitor<'de> for TemplateStringVisitor {
     type Value = TemplateString;
 
     fn expecting(&self, formatter: &mut std::fmt::Formatter) -> std::fmt::Result {
-        formatter.write_str("a string with optional variable references like ${var}")
+        formatter
+            .write_str("a string with optional variable references like ${var} or ${var:-default}")
     }
 
     fn visit_str<E>(self, value: &str) -> Result<Self::Value, E>
@@ -106,15 +114,23 @@ impl<'de> de::Visitor<'de> for TemplateStringVisitor {
                 },
                 TemplateState::Variable(name_start) => match c {
                     '}' => {
-                        // Get the variable name
-                        let name = Name::from_str(&value[name_start..i]).map_err(|e| {
+                        // Get the variable name, and its default value if any
+                        let reference = &value[name_start..i];
+                        let (name, default) = match reference.split_once(":-") {
+                            Some((name, default)) => (name, Some(default)),
+                            None => (reference, None),
+                        };
+                        let name = Name::from_str(name).map_err(|e| {
                             E::custom(format!(
                                 "invalid variable name at position {}: {}",
                                 name_start - 2,
                                 e
                             ))
                         })?;
-                        tokens.push(TemplateToken::Var(name));
+                        tokens.push(match default {
+                            Some(default) => TemplateToken::VarDefault(name, default.into()),
+                            None => TemplateToken::Var(name),
+                        });
                         TemplateState::Text(i + 1)
                     }
                     _ => TemplateState::Variable(name_start),
@@ -244,6 +260,49 @@ mod tests_template_string {
         );
     }
 
+    #[test]
+    fn test_visit_str_variable_default() {
+        assert_eq!(
+            TemplateStringVisitor
+                .visit_str::<TestError>("${foo:-/run/user/1000}/bar ${baz:-}")
+                .unwrap(),
+            TemplateString(vec![
+                TemplateToken::VarDefault(Name::from_str("foo").unwrap(), "/run/user/1000".into()),
+                TemplateToken::Text("/bar ".to_string()),
+                TemplateToken::VarDefault(Name::from_str("baz").unwrap(), "".into()),
+            ])
+        );
+        assert_eq!(
+            TemplateStringVisitor
+                .visit_str::<TestError>("${foo-bar:-baz}")
+                .unwrap_err()
+                .0,
+            "invalid variable name at position 0: invalid character(s) in name (must be ASCII alphanumeric or '_'): foo-bar"
+        );
+    }
+
+    #[test]
+    fn test_display_escaped() {
+        for text in [
+            "foo",
+            "$foo",
+            "${foo}",
+            "${foo:-/tmp}",
+            "$${foo}",
+            "foo$",
+            "${foo} $bar ${baz}",
+        ] {
+            let template = TemplateStringVisitor.visit_str::<TestError>(text).unwrap();
+            assert_eq!(
+                TemplateStringVisitor
+                    .visit_str::<TestError>(&template.to_string())
+                    .unwrap(),
+                template
+            );
+        }
+        assert_eq!(TemplateString::from_text("$foo").to_string(), "$$foo");
+    }
+
     #[test]
     fn test_visit_str_unclosed_variable() {
         assert_eq!(
@@ -301,15 +360,21 @@ impl<'de> Deserialize<'de> for TemplateString {
     }
 }
 
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
-#[serde(deny_unknown_fields, rename_all = "snake_case")]
+#[derive(Debug, Clone, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+// The aliases are deserialized and serialized by the manual implementations.
+#[serde(remote = "Self", deny_unknown_fields, rename_all = "snake_case")]
 pub(crate) enum JsonFsAccessItem {
+    /// All the access rights supported by the running kernel.
+    #[serde(rename = "*")]
+    Kernel,
     #[serde(rename = "abi.all")]
     AbiAll,
     #[serde(rename = "abi.read_execute")]
     AbiReadExecute,
     #[serde(rename = "abi.read_write")]
     AbiReadWrite,
+    ExecOnly,
+    ExecRead,
     Execute,
     WriteFile,
     ReadFile,
@@ -326,6 +391,47 @@ pub(crate) enum JsonFsAccessItem {
     Refer,
     Truncate,
     IoctlDev,
+    /// Registered alias, see [`register_fs_alias()`](crate::register_fs_alias).
+    #[serde(skip)]
+    Alias(Alias<AccessFs>),
+}
+
+impl<'de> Deserialize<'de> for JsonFsAccessItem {
+    fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        deserialize_item(deserializer)
+    }
+}
+
+impl Serialize for JsonFsAccessItem {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        match self {
+            Self::Alias(alias) => serializer.serialize_str(&alias.name),
+            _ => Self::serialize(self, serializer),
+        }
+    }
+}
+
+impl AccessItem for JsonFsAccessItem {
+    type Access = AccessFs;
+
+    const NAME: &'static str = "JsonFsAccessItem";
+
+    fn deserialize_standard<'de, D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        Self::deserialize(deserializer)
+    }
+
+    fn from_alias(alias: Alias<Self::Access>) -> Self {
+        Self::Alias(alias)
+    }
 }
 
 trait AbiGroup<A>
@@ -361,7 +467,7 @@ where
     A: Access,
     G: AbiGroup<A>,
 {
-    Value(A),
+    Value(BitFlags<A>),
     Group(G),
 }
 
@@ -375,7 +481,7 @@ where
         V: Into<Self>,
     {
         match access.into() {
-            Self::Value(a) => Ok(a.into()),
+            Self::Value(a) => Ok(a),
             Self::Group(g) => {
                 // Simulate a missing variable
                 Ok(g.resolve_bitflags(
@@ -392,16 +498,20 @@ where
     G: AbiGroup<A>,
 {
     fn from(access: A) -> Self {
-        Self::Value(access)
+        Self::Value(access.into())
     }
 }
 
 impl From<&JsonFsAccessItem> for ValueAccessFs {
     fn from(js: &JsonFsAccessItem) -> Self {
         match js {
-            JsonFsAccessItem::AbiAll => Self::Group(AbiGroupFs::All),
+            JsonFsAccessItem::Kernel | JsonFsAccessItem::AbiAll => Self::Group(AbiGroupFs::All),
             JsonFsAccessItem::AbiReadExecute => Self::Group(AbiGroupFs::ReadExecute),
             JsonFsAccessItem::AbiReadWrite => Self::Group(AbiGroupFs::ReadWrite),
+            // Executing a file only requires to read it with the execute right.
+            JsonFsAccessItem::ExecOnly => AccessFs::Execute.into(),
+            // Interpreted files (e.g. scripts) also need to be read as data.
+            JsonFsAccessItem::ExecRead => Self::Value(AccessFs::Execute | AccessFs::ReadFile),
             JsonFsAccessItem::Execute => AccessFs::Execute.into(),
             JsonFsAccessItem::WriteFile => AccessFs::WriteFile.into(),
             JsonFsAccessItem::ReadFile => AccessFs::ReadFile.into(),
@@ -418,10 +528,60 @@ impl From<&JsonFsAccessItem> for ValueAccessFs {
             JsonFsAccessItem::Refer => AccessFs::Refer.into(),
             JsonFsAccessItem::Truncate => AccessFs::Truncate.into(),
             JsonFsAccessItem::IoctlDev => AccessFs::IoctlDev.into(),
+            JsonFsAccessItem::Alias(alias) => Self::Value(alias.access),
         }
     }
 }
 
+#[derive(Debug, Error)]
+#[error("unknown access right: {0}")]
+pub(crate) struct UnknownAccessError(String);
+
+impl TryFrom<AccessFs> for JsonFsAccessItem {
+    type Error = UnknownAccessError;
+
+    fn try_from(access: AccessFs) -> Result<Self, Self::Error> {
+        Ok(match access {
+            AccessFs::Execute => Self::Execute,
+            AccessFs::WriteFile => Self::WriteFile,
+            AccessFs::ReadFile => Self::ReadFile,
+            AccessFs::ReadDir => Self::ReadDir,
+            AccessFs::RemoveDir => Self::RemoveDir,
+            AccessFs::RemoveFile => Self::RemoveFile,
+            AccessFs::MakeChar => Self::MakeChar,
+            AccessFs::MakeDir => Self::MakeDir,
+            AccessFs::MakeReg => Self::MakeReg,
+            AccessFs::MakeSock => Self::MakeSock,
+            AccessFs::MakeFifo => Self::MakeFifo,
+            AccessFs::MakeBlock => Self::MakeBlock,
+            AccessFs::MakeSym => Self::MakeSym,
+            AccessFs::Refer => Self::Refer,
+            AccessFs::Truncate => Self::Truncate,
+            AccessFs::IoctlDev => Self::IoctlDev,
+            _ => return Err(UnknownAccessError(format!("{access:?}"))),
+        })
+    }
+}
+
+/// Converts a set of access rights to their non-group names, which makes the
+/// result independent of any ABI version.
+pub(crate) fn to_access_items<A, I>(
+    access: BitFlags<A>,
+) -> Result<Option<NonEmptySet<I>>, UnknownAccessError>
+where
+    A: Access,
+    I: TryFrom<A, Error = UnknownAccessError> + Ord,
+{
+    if access.is_empty() {
+        return Ok(None);
+    }
+    access
+        .iter()
+        .map(I::try_from)
+        .collect::<Result<_, _>>()
+        .map(Some)
+}
+
 #[test]
 fn test_v1_read_execute() {
     let rx =
@@ -479,22 +639,87 @@ fn test_v2_read_write() {
     assert!(rw.contains(AccessFs::Refer));
 }
 
+#[test]
+fn test_exec_composites() {
+    // Composites do not depend on the ABI.
+    assert_eq!(
+        ValueAccessFs::resolve_bitflags(&JsonFsAccessItem::ExecOnly, None).unwrap(),
+        AccessFs::Execute.into()
+    );
+    assert_eq!(
+        ValueAccessFs::resolve_bitflags(&JsonFsAccessItem::ExecRead, None).unwrap(),
+        AccessFs::Execute | AccessFs::ReadFile
+    );
+}
+
 impl NonEmptySet<JsonFsAccessItem> {
-    pub fn resolve_bitflags(&self, abi: Option<ABI>) -> Result<BitFlags<AccessFs>, ResolveError> {
+    pub fn resolve_bitflags(
+        &self,
+        abi: Option<ABI>,
+        kernel_abi: &mut LazyAbi,
+    ) -> Result<BitFlags<AccessFs>, ResolveError> {
         self.iter().try_fold(BitFlags::EMPTY, |flags, item| {
-            let access = ValueAccessFs::resolve_bitflags(item, abi)?;
+            let access = match item {
+                // Uses the running kernel's ABI instead of the configured one.
+                JsonFsAccessItem::Kernel => {
+                    ValueAccessFs::resolve_bitflags(item, Some(kernel_abi.version().into()))?
+                }
+                _ => ValueAccessFs::resolve_bitflags(item, abi)?,
+            };
             Ok(flags | access)
         })
     }
 }
 
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
-#[serde(deny_unknown_fields, rename_all = "snake_case")]
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+// The aliases are deserialized and serialized by the manual implementations.
+#[serde(remote = "Self", deny_unknown_fields, rename_all = "snake_case")]
 pub(crate) enum JsonNetAccessItem {
     #[serde(rename = "abi.all")]
     AbiAll,
     BindTcp,
     ConnectTcp,
+    /// Registered alias, see [`register_net_alias()`](crate::register_net_alias).
+    #[serde(skip)]
+    Alias(Alias<AccessNet>),
+}
+
+impl<'de> Deserialize<'de> for JsonNetAccessItem {
+    fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        deserialize_item(deserializer)
+    }
+}
+
+impl Serialize for JsonNetAccessItem {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        match self {
+            Self::Alias(alias) => serializer.serialize_str(&alias.name),
+            _ => Self::serialize(self, serializer),
+        }
+    }
+}
+
+impl AccessItem for JsonNetAccessItem {
+    type Access = AccessNet;
+
+    const NAME: &'static str = "JsonNetAccessItem";
+
+    fn deserialize_standard<'de, D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        Self::deserialize(deserializer)
+    }
+
+    fn from_alias(alias: Alias<Self::Access>) -> Self {
+        Self::Alias(alias)
+    }
 }
 
 enum AbiGroupNet {
@@ -511,12 +736,25 @@ impl AbiGroup<AccessNet> for AbiGroupNet {
 
 type ValueAccessNet = ValueAccess<AccessNet, AbiGroupNet>;
 
+impl TryFrom<AccessNet> for JsonNetAccessItem {
+    type Error = UnknownAccessError;
+
+    fn try_from(access: AccessNet) -> Result<Self, Self::Error> {
+        Ok(match access {
+            AccessNet::BindTcp => Self::BindTcp,
+            AccessNet::ConnectTcp => Self::ConnectTcp,
+            _ => return Err(UnknownAccessError(format!("{access:?}"))),
+        })
+    }
+}
+
 impl From<&JsonNetAccessItem> for ValueAccessNet {
     fn from(js: &JsonNetAccessItem) -> Self {
         match js {
             JsonNetAccessItem::AbiAll => Self::Group(AbiGroupNet::All),
             JsonNetAccessItem::BindTcp => AccessNet::BindTcp.into(),
             JsonNetAccessItem::ConnectTcp => AccessNet::ConnectTcp.into(),
+            JsonNetAccessItem::Alias(alias) => Self::Value(alias.access),
         }
     }
 }
@@ -530,13 +768,55 @@ impl NonEmptySet<JsonNetAccessItem> {
     }
 }
 
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
-#[serde(deny_unknown_fields, rename_all = "snake_case")]
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+// The aliases are deserialized and serialized by the manual implementations.
+#[serde(remote = "Self", deny_unknown_fields, rename_all = "snake_case")]
 pub(crate) enum JsonScopeItem {
     #[serde(rename = "abi.all")]
     AbiAll,
     AbstractUnixSocket,
     Signal,
+    /// Registered alias, see [`register_scope_alias()`](crate::register_scope_alias).
+    #[serde(skip)]
+    Alias(Alias<Scope>),
+}
+
+impl<'de> Deserialize<'de> for JsonScopeItem {
+    fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        deserialize_item(deserializer)
+    }
+}
+
+impl Serialize for JsonScopeItem {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        match self {
+            Self::Alias(alias) => serializer.serialize_str(&alias.name),
+            _ => Self::serialize(self, serializer),
+        }
+    }
+}
+
+impl AccessItem for JsonScopeItem {
+    type Access = Scope;
+
+    const NAME: &'static str = "JsonScopeItem";
+
+    fn deserialize_standard<'de, D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        Self::deserialize(deserializer)
+    }
+
+    fn from_alias(alias: Alias<Self::Access>) -> Self {
+        Self::Alias(alias)
+    }
 }
 
 enum AbiGroupScope {
@@ -553,12 +833,25 @@ impl AbiGroup<Scope> for AbiGroupScope {
 
 type ValueScope = ValueAccess<Scope, AbiGroupScope>;
 
+impl TryFrom<Scope> for JsonScopeItem {
+    type Error = UnknownAccessError;
+
+    fn try_from(scope: Scope) -> Result<Self, Self::Error> {
+        Ok(match scope {
+            Scope::AbstractUnixSocket => Self::AbstractUnixSocket,
+            Scope::Signal => Self::Signal,
+            _ => return Err(UnknownAccessError(format!("{scope:?}"))),
+        })
+    }
+}
+
 impl From<&JsonScopeItem> for ValueScope {
     fn from(js: &JsonScopeItem) -> Self {
         match js {
             JsonScopeItem::AbiAll => Self::Group(AbiGroupScope::All),
             JsonScopeItem::AbstractUnixSocket => Scope::AbstractUnixSocket.into(),
             JsonScopeItem::Signal => Scope::Signal.into(),
+            JsonScopeItem::Alias(alias) => Self::Value(alias.access),
         }
     }
 }
@@ -573,13 +866,23 @@ impl NonEmptySet<JsonScopeItem> {
 }
 
 // At least one of the fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 #[allow(non_snake_case)]
 pub(crate) struct JsonRuleset {
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) handledAccessFs: Option<NonEmptySet<JsonFsAccessItem>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) handledAccessNet: Option<NonEmptySet<JsonNetAccessItem>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) scoped: Option<NonEmptySet<JsonScopeItem>>,
+    /// Acknowledges that handled network access rights might be denied for
+    /// all ports, see [`Config::warnings()`](crate::Config::warnings).
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) allowNone: Option<bool>,
+    /// Access rights of the path beneath rules without `allowedAccess`.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) defaultAccess: Option<NonEmptySet<JsonFsAccessItem>>,
 }
 
 impl NonEmptyStructInner for JsonRuleset {
@@ -594,6 +897,8 @@ impl NonEmptyStructInner for JsonRuleset {
                 .as_ref()
                 .is_none_or(|set| set.is_empty())
             && self.scoped.as_ref().is_none_or(|set| set.is_empty())
+            && self.allowNone.is_none()
+            && self.defaultAccess.as_ref().is_none_or(|set| set.is_empty())
     }
 }
 
@@ -604,6 +909,8 @@ struct TomlRuleset {
     handled_access_fs: Option<NonEmptySet<JsonFsAccessItem>>,
     handled_access_net: Option<NonEmptySet<JsonNetAccessItem>>,
     scoped: Option<NonEmptySet<JsonScopeItem>>,
+    allow_none: Option<bool>,
+    default_access: Option<NonEmptySet<JsonFsAccessItem>>,
 }
 
 impl NonEmptyStructInner for TomlRuleset {
@@ -618,6 +925,11 @@ impl NonEmptyStructInner for TomlRuleset {
                 .as_ref()
                 .is_none_or(|set| set.is_empty())
             && self.scoped.as_ref().is_none_or(|set| set.is_empty())
+            && self.allow_none.is_none()
+            && self
+                .default_access
+                .as_ref()
+                .is_none_or(|set| set.is_empty())
     }
 }
 
@@ -627,25 +939,57 @@ impl From<TomlRuleset> for JsonRuleset {
             handledAccessFs: toml.handled_access_fs,
             handledAccessNet: toml.handled_access_net,
             scoped: toml.scoped,
+            allowNone: toml.allow_none,
+            defaultAccess: toml.default_access,
         }
     }
 }
 
 // TODO: Make paths canonical (e.g. remove extra slashes and dots) and only open the same paths
 // once.
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[derive(Debug, Clone, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 #[allow(non_snake_case)]
 pub(crate) struct JsonPathBeneath {
-    pub(crate) allowedAccess: NonEmptySet<JsonFsAccessItem>,
+    /// Defaults to the `defaultAccess` of the rulesets, which is required if
+    /// this is not set.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) allowedAccess: Option<NonEmptySet<JsonFsAccessItem>>,
     pub(crate) parent: NonEmptySet<TemplateString>,
+    /// Applies the rule to the mount point containing each parent, when the
+    /// ruleset is built.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) mountPoint: Option<bool>,
+    /// Fails to build the ruleset if the rule cannot be fully enforced,
+    /// instead of a best-effort rule error.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) required: Option<bool>,
+    /// Labels filtered with [`ParseOptions::include_tags()`] and
+    /// [`ParseOptions::exclude_tags()`].
+    ///
+    /// [`ParseOptions::include_tags()`]: crate::ParseOptions::include_tags
+    /// [`ParseOptions::exclude_tags()`]: crate::ParseOptions::exclude_tags
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) tag: Option<NonEmptySet<String>>,
+}
+
+/// Rule of a line-delimited JSON stream, see
+/// [`Config::parse_json_rules()`](crate::Config::parse_json_rules).
+#[derive(Debug, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub(crate) struct JsonRuleLine {
+    pub(crate) path: TemplateString,
+    pub(crate) access: NonEmptySet<JsonFsAccessItem>,
 }
 
 #[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 struct TomlPathBeneath {
-    allowed_access: NonEmptySet<JsonFsAccessItem>,
+    allowed_access: Option<NonEmptySet<JsonFsAccessItem>>,
     parent: NonEmptySet<TemplateString>,
+    mount_point: Option<bool>,
+    required: Option<bool>,
+    tag: Option<NonEmptySet<String>>,
 }
 
 impl From<TomlPathBeneath> for JsonPathBeneath {
@@ -653,23 +997,127 @@ impl From<TomlPathBeneath> for JsonPathBeneath {
         Self {
             allowedAccess: toml.allowed_access,
             parent: toml.parent,
+            mountPoint: toml.mount_point,
+            required: toml.required,
+            tag: toml.tag,
         }
     }
 }
 
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+/// A TCP port number, or a service name resolved at parse time with the host's
+/// services database (i.e. /etc/services).
+///
+/// Port numbers can also be given as strings (e.g. `"443"`), for generators
+/// stringifying all values.  Numbers are always checked to fit in 16 bits.
+#[derive(Debug, Clone, Ord, Eq, PartialOrd, PartialEq)]
+pub(crate) enum JsonPort {
+    Number(u64),
+    Name(String),
+}
+
+struct JsonPortVisitor;
+
+impl JsonPortVisitor {
+    fn number<E>(self, value: u64, unexpected: Unexpected) -> Result<JsonPort, E>
+    where
+        E: de::Error,
+    {
+        if value > u16::MAX.into() {
+            return Err(E::invalid_value(
+                unexpected,
+                &"a port number between 0 and 65535",
+            ));
+        }
+        Ok(JsonPort::Number(value))
+    }
+}
+
+impl Visitor<'_> for JsonPortVisitor {
+    type Value = JsonPort;
+
+    fn expecting(&self, formatter: &mut std::fmt::Formatter) -> std::fmt::Result {
+        formatter.write_str("a port number or a TCP service name")
+    }
+
+    // u64 deserialization is needed for JSON.
+    fn visit_u64<E>(self, value: u64) -> Result<JsonPort, E>
+    where
+        E: de::Error,
+    {
+        self.number(value, Unexpected::Unsigned(value))
+    }
+
+    // i64 deserialization is needed for TOML.
+    fn visit_i64<E>(self, value: i64) -> Result<JsonPort, E>
+    where
+        E: de::Error,
+    {
+        let unexpected = Unexpected::Signed(value);
+        match value.try_into() {
+            Ok(value) => self.number(value, unexpected),
+            Err(_) => Err(E::invalid_value(unexpected, &self)),
+        }
+    }
+
+    fn visit_str<E>(self, value: &str) -> Result<JsonPort, E>
+    where
+        E: de::Error,
+    {
+        if value.is_empty() {
+            return Err(E::invalid_value(Unexpected::Str(value), &self));
+        }
+        // Any other string is a service name, which may contain digits.
+        if value.bytes().all(|b| b.is_ascii_digit()) {
+            // Too many digits to fit in a u64 is also out of range.
+            let number = value.parse().unwrap_or(u64::MAX);
+            return self.number(number, Unexpected::Str(value));
+        }
+        Ok(JsonPort::Name(value.to_string()))
+    }
+}
+
+impl Serialize for JsonPort {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        match self {
+            Self::Number(port) => serializer.serialize_u64(*port),
+            Self::Name(name) => serializer.serialize_str(name),
+        }
+    }
+}
+
+impl<'de> Deserialize<'de> for JsonPort {
+    fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
+    where
+        D: Deserializer<'de>,
+    {
+        deserializer.deserialize_any(JsonPortVisitor)
+    }
+}
+
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 #[allow(non_snake_case)]
 pub(crate) struct JsonNetPort {
     pub(crate) allowedAccess: NonEmptySet<JsonNetAccessItem>,
-    pub(crate) port: NonEmptySet<u64>,
+    pub(crate) port: NonEmptySet<JsonPort>,
+    /// Fails to build the ruleset if the rule cannot be fully enforced.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) required: Option<bool>,
+    /// Labels filtered like the path beneath ones.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) tag: Option<NonEmptySet<String>>,
 }
 
 #[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 struct TomlNetPort {
     allowed_access: NonEmptySet<JsonNetAccessItem>,
-    port: NonEmptySet<u64>,
+    port: NonEmptySet<JsonPort>,
+    required: Option<bool>,
+    tag: Option<NonEmptySet<String>>,
 }
 
 impl From<TomlNetPort> for JsonNetPort {
@@ -677,6 +1125,82 @@ impl From<TomlNetPort> for JsonNetPort {
         Self {
             allowedAccess: toml.allowed_access,
             port: toml.port,
+            required: toml.required,
+            tag: toml.tag,
+        }
+    }
+}
+
+/// Rules only taken into account if the running kernel supports a Landlock ABI
+/// version in the inclusive range from minAbi to maxAbi.
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+#[allow(non_snake_case)]
+pub(crate) struct JsonWhen {
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) minAbi: Option<JsonAbi>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) maxAbi: Option<JsonAbi>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) ruleset: Option<NonEmptySet<NonEmptyStruct<JsonRuleset>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) pathBeneath: Option<NonEmptySet<JsonPathBeneath>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) netPort: Option<NonEmptySet<JsonNetPort>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for JsonWhen {
+    const ERROR_MESSAGE: &'static str = "empty when block";
+
+    fn is_empty(&self) -> bool {
+        self.ruleset.as_ref().is_none_or(|set| set.is_empty())
+            && self.pathBeneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.netPort.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+struct TomlWhen {
+    min_abi: Option<JsonAbi>,
+    max_abi: Option<JsonAbi>,
+    ruleset: Option<NonEmptySet<NonEmptyStruct<TomlRuleset>>>,
+    path_beneath: Option<NonEmptySet<TomlPathBeneath>>,
+    net_port: Option<NonEmptySet<TomlNetPort>>,
+    r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for TomlWhen {
+    const ERROR_MESSAGE: &'static str = "empty when block";
+
+    fn is_empty(&self) -> bool {
+        self.ruleset.as_ref().is_none_or(|set| set.is_empty())
+            && self.path_beneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.net_port.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+impl From<TomlWhen> for JsonWhen {
+    fn from(toml: TomlWhen) -> Self {
+        Self {
+            minAbi: toml.min_abi,
+            maxAbi: toml.max_abi,
+            ruleset: toml
+                .ruleset
+                .map(|set| set.into_iter().map(|r| r.convert()).collect()),
+            pathBeneath: toml
+                .path_beneath
+                .map(|set| set.into_iter().map(Into::into).collect()),
+            netPort: toml
+                .net_port
+                .map(|set| set.into_iter().map(Into::into).collect()),
+            r#use: toml.r#use,
         }
     }
 }
@@ -723,7 +1247,7 @@ impl<'de> Visitor<'de> for JsonAbiVisitor {
     }
 }
 
-#[derive(Debug)]
+#[derive(Debug, Clone, Copy, Ord, Eq, PartialOrd, PartialEq)]
 pub(crate) struct JsonAbi(i32);
 
 impl From<JsonAbi> for ABI {
@@ -732,6 +1256,27 @@ impl From<JsonAbi> for ABI {
     }
 }
 
+impl From<JsonAbi> for i32 {
+    fn from(abi: JsonAbi) -> Self {
+        abi.0
+    }
+}
+
+impl From<ABI> for JsonAbi {
+    fn from(abi: ABI) -> Self {
+        Self(abi as i32)
+    }
+}
+
+impl Serialize for JsonAbi {
+    fn serialize<S>(&self, serializer: S) -> Result<S::Ok, S::Error>
+    where
+        S: Serializer,
+    {
+        serializer.serialize_i32(self.0)
+    }
+}
+
 impl<'de> serde::Deserialize<'de> for JsonAbi {
     fn deserialize<D>(deserializer: D) -> Result<Self, D::Error>
     where
@@ -741,26 +1286,162 @@ impl<'de> serde::Deserialize<'de> for JsonAbi {
     }
 }
 
-#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
 #[serde(deny_unknown_fields)]
 #[allow(non_snake_case)]
 pub(crate) struct JsonVariable {
     pub(crate) name: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) literal: Option<NonEmptySet<String>>,
 }
 
 type TomlVariable = JsonVariable;
 
+/// Named set of rules that can be referenced with "use".
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+#[allow(non_snake_case)]
+pub(crate) struct JsonGroup {
+    pub(crate) name: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) pathBeneath: Option<NonEmptySet<JsonPathBeneath>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for JsonGroup {
+    const ERROR_MESSAGE: &'static str = "empty group";
+
+    fn is_empty(&self) -> bool {
+        self.pathBeneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+struct TomlGroup {
+    name: String,
+    path_beneath: Option<NonEmptySet<TomlPathBeneath>>,
+    r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for TomlGroup {
+    const ERROR_MESSAGE: &'static str = "empty group";
+
+    fn is_empty(&self) -> bool {
+        self.path_beneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+impl From<TomlGroup> for JsonGroup {
+    fn from(toml: TomlGroup) -> Self {
+        Self {
+            name: toml.name,
+            pathBeneath: toml
+                .path_beneath
+                .map(|set| set.into_iter().map(Into::into).collect()),
+            r#use: toml.r#use,
+        }
+    }
+}
+
+/// Named set of rules only taken into account if selected when parsing.
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Serialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+#[allow(non_snake_case)]
+pub(crate) struct JsonProfile {
+    pub(crate) name: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) ruleset: Option<NonEmptySet<NonEmptyStruct<JsonRuleset>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) pathBeneath: Option<NonEmptySet<JsonPathBeneath>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) netPort: Option<NonEmptySet<JsonNetPort>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for JsonProfile {
+    const ERROR_MESSAGE: &'static str = "empty profile";
+
+    fn is_empty(&self) -> bool {
+        self.ruleset.as_ref().is_none_or(|set| set.is_empty())
+            && self.pathBeneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.netPort.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+// At least one of the rule fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
+#[derive(Debug, Deserialize, Ord, Eq, PartialOrd, PartialEq)]
+#[serde(deny_unknown_fields)]
+struct TomlProfile {
+    name: String,
+    ruleset: Option<NonEmptySet<NonEmptyStruct<TomlRuleset>>>,
+    path_beneath: Option<NonEmptySet<TomlPathBeneath>>,
+    net_port: Option<NonEmptySet<TomlNetPort>>,
+    r#use: Option<NonEmptySet<String>>,
+}
+
+impl NonEmptyStructInner for TomlProfile {
+    const ERROR_MESSAGE: &'static str = "empty profile";
+
+    fn is_empty(&self) -> bool {
+        self.ruleset.as_ref().is_none_or(|set| set.is_empty())
+            && self.path_beneath.as_ref().is_none_or(|set| set.is_empty())
+            && self.net_port.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+    }
+}
+
+impl From<TomlProfile> for JsonProfile {
+    fn from(toml: TomlProfile) -> Self {
+        Self {
+            name: toml.name,
+            ruleset: toml
+                .ruleset
+                .map(|set| set.into_iter().map(|r| r.convert()).collect()),
+            pathBeneath: toml
+                .path_beneath
+                .map(|set| set.into_iter().map(Into::into).collect()),
+            netPort: toml
+                .net_port
+                .map(|set| set.into_iter().map(Into::into).collect()),
+            r#use: toml.r#use,
+        }
+    }
+}
+
 // At least one of the fields must be set, which is guaranteed when wrapped with NonEmptyStruct.
-#[derive(Debug, Deserialize)]
+#[derive(Debug, Deserialize, Serialize)]
 #[serde(deny_unknown_fields)]
 #[allow(non_snake_case)]
 pub(crate) struct JsonConfig {
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) abi: Option<JsonAbi>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) variable: Option<NonEmptySet<JsonVariable>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) group: Option<NonEmptySet<NonEmptyStruct<JsonGroup>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) ruleset: Option<NonEmptySet<NonEmptyStruct<JsonRuleset>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) pathBeneath: Option<NonEmptySet<JsonPathBeneath>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
     pub(crate) netPort: Option<NonEmptySet<JsonNetPort>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) when: Option<NonEmptySet<NonEmptyStruct<JsonWhen>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) profile: Option<NonEmptySet<NonEmptyStruct<JsonProfile>>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) r#use: Option<NonEmptySet<String>>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub(crate) includeFragment: Option<NonEmptySet<String>>,
 }
 
 impl NonEmptyStructInner for JsonConfig {
@@ -768,9 +1449,17 @@ impl NonEmptyStructInner for JsonConfig {
 
     fn is_empty(&self) -> bool {
         self.variable.as_ref().is_none_or(|set| set.is_empty())
+            && self.group.as_ref().is_none_or(|set| set.is_empty())
             && self.ruleset.as_ref().is_none_or(|set| set.is_empty())
             && self.pathBeneath.as_ref().is_none_or(|set| set.is_empty())
             && self.netPort.as_ref().is_none_or(|set| set.is_empty())
+            && self.when.as_ref().is_none_or(|set| set.is_empty())
+            && self.profile.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+            && self
+                .includeFragment
+                .as_ref()
+                .is_none_or(|set| set.is_empty())
     }
 }
 
@@ -780,9 +1469,14 @@ impl NonEmptyStructInner for JsonConfig {
 pub(crate) struct TomlConfig {
     abi: Option<JsonAbi>,
     variable: Option<NonEmptySet<TomlVariable>>,
+    group: Option<NonEmptySet<NonEmptyStruct<TomlGroup>>>,
     ruleset: Option<NonEmptySet<NonEmptyStruct<TomlRuleset>>>,
     path_beneath: Option<NonEmptySet<TomlPathBeneath>>,
     net_port: Option<NonEmptySet<TomlNetPort>>,
+    when: Option<NonEmptySet<NonEmptyStruct<TomlWhen>>>,
+    profile: Option<NonEmptySet<NonEmptyStruct<TomlProfile>>>,
+    r#use: Option<NonEmptySet<String>>,
+    include_fragment: Option<NonEmptySet<String>>,
 }
 
 impl NonEmptyStructInner for TomlConfig {
@@ -790,9 +1484,17 @@ impl NonEmptyStructInner for TomlConfig {
 
     fn is_empty(&self) -> bool {
         self.variable.as_ref().is_none_or(|set| set.is_empty())
+            && self.group.as_ref().is_none_or(|set| set.is_empty())
             && self.ruleset.as_ref().is_none_or(|set| set.is_empty())
             && self.path_beneath.as_ref().is_none_or(|set| set.is_empty())
             && self.net_port.as_ref().is_none_or(|set| set.is_empty())
+            && self.when.as_ref().is_none_or(|set| set.is_empty())
+            && self.profile.as_ref().is_none_or(|set| set.is_empty())
+            && self.r#use.as_ref().is_none_or(|set| set.is_empty())
+            && self
+                .include_fragment
+                .as_ref()
+                .is_none_or(|set| set.is_empty())
     }
 }
 
@@ -801,6 +1503,9 @@ impl From<TomlConfig> for JsonConfig {
         Self {
             abi: toml.abi,
             variable: toml.variable,
+            group: toml
+                .group
+                .map(|set| set.into_iter().map(|g| g.convert()).collect()),
             ruleset: toml
                 .ruleset
                 .map(|set| set.into_iter().map(|r| r.convert()).collect()),
@@ -810,6 +1515,14 @@ impl From<TomlConfig> for JsonConfig {
             netPort: toml
                 .net_port
                 .map(|set| set.into_iter().map(Into::into).collect()),
+            when: toml
+                .when
+                .map(|set| set.into_iter().map(|w| w.convert()).collect()),
+            profile: toml
+                .profile
+                .map(|set| set.into_iter().map(|p| p.convert()).collect()),
+            r#use: toml.r#use,
+            includeFragment: toml.include_fragment,
         }
     }
 }
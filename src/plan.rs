@@ -0,0 +1,423 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::{BuiltRule, ResolvedConfig};
+use std::fs;
+use std::io;
+use std::path::PathBuf;
+
+/// Flags used by [`landlock::PathFd::new()`] to open rule paths.
+const OPEN_FLAGS: libc::c_int = libc::O_PATH | libc::O_CLOEXEC;
+
+/// Path opened when building a ruleset, see
+/// [`ResolvedConfig::planned_opens()`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct PlannedOpen {
+    pub path: PathBuf,
+    /// Flags passed to open(2).
+    pub flags: libc::c_int,
+    /// The mount point containing `path` is opened instead, which is only
+    /// known when building the ruleset.
+    pub mount_point: bool,
+}
+
+/// Resources used by building a ruleset, see
+/// [`ResolvedConfig::resource_estimate()`].
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct ResourceEstimate {
+    /// Maximum number of file descriptors open at the same time: the ruleset
+    /// and one rule path, which is closed once its rule is added.
+    pub max_open_fds: usize,
+    /// Number of rule paths opened, one per path.
+    pub opened_fds: usize,
+    /// Number of landlock_add_rule(2) calls, one per path and per port.
+    pub add_rule_calls: usize,
+}
+
+impl ResourceEstimate {
+    /// Checks that the calling process can open
+    /// [`max_open_fds`](ResourceEstimate::max_open_fds) more file
+    /// descriptors without exceeding its `RLIMIT_NOFILE` soft limit, or
+    /// returns an `EMFILE` error, e.g. to raise the limit or to fail before
+    /// building the ruleset.
+    ///
+    /// File descriptors opened or closed concurrently by other threads are
+    /// not accounted for.
+    pub fn check_fd_limit(&self) -> io::Result<()> {
+        let mut limit = libc::rlimit {
+            rlim_cur: 0,
+            rlim_max: 0,
+        };
+        if unsafe { libc::getrlimit(libc::RLIMIT_NOFILE, &mut limit) } != 0 {
+            return Err(io::Error::last_os_error());
+        }
+        // Does not count the file descriptor of the listed directory.
+        let open = fs::read_dir("/proc/self/fd")?.count().saturating_sub(1);
+        let needed = open.saturating_add(self.max_open_fds);
+        if limit.rlim_cur != libc::RLIM_INFINITY && needed as u64 > limit.rlim_cur {
+            return Err(io::Error::from_raw_os_error(libc::EMFILE));
+        }
+        Ok(())
+    }
+}
+
+impl ResolvedConfig {
+    /// Estimates the resources [`build_ruleset()`](ResolvedConfig::build_ruleset)
+    /// uses, e.g. to check them against `RLIMIT_NOFILE` with
+    /// [`ResourceEstimate::check_fd_limit()`] on constrained systems.
+    ///
+    /// Rules for the same path or port are already merged (see
+    /// [`planned_rules()`](ResolvedConfig::planned_rules)), so each of them
+    /// opens at most one path and makes one landlock_add_rule(2) call.  This
+    /// is an upper bound: paths that cannot be opened are not added, and no
+    /// rule is added if Landlock is not supported by the running kernel.
+    /// Reading the mount points (only for mount point rules) temporarily
+    /// opens one file before any rule path.
+    pub fn resource_estimate(&self) -> ResourceEstimate {
+        let opened_fds = self.rules_path_beneath.len() + self.rules_mount_point.len();
+        ResourceEstimate {
+            max_open_fds: 1 + usize::from(opened_fds > 0),
+            opened_fds,
+            add_rule_calls: opened_fds + self.rules_net_port.len(),
+        }
+    }
+
+    /// Lists the paths [`build_ruleset()`](ResolvedConfig::build_ruleset)
+    /// opens, in the same order (see
+    /// [`planned_rules()`](ResolvedConfig::planned_rules)), e.g. for a broker
+    /// to pre-authorize them.
+    ///
+    /// This does not access the filesystem: paths are the ones resolved with
+    /// the [`PathResolver`](crate::PathResolver) in effect when the
+    /// configuration was resolved, and paths that cannot be opened are still
+    /// listed.
+    pub fn planned_opens(&self) -> Vec<PlannedOpen> {
+        let planned = |mount_point| {
+            move |path: &PathBuf| PlannedOpen {
+                path: path.clone(),
+                flags: OPEN_FLAGS,
+                mount_point,
+            }
+        };
+        self.rules_path_beneath
+            .keys()
+            .map(planned(false))
+            .chain(self.rules_mount_point.keys().map(planned(true)))
+            .collect()
+    }
+
+    /// Lists the rules [`build_ruleset()`](ResolvedConfig::build_ruleset)
+    /// adds, in the same order: the list index is the rule index of rule
+    /// errors and of
+    /// [`build_ruleset_observed()`](ResolvedConfig::build_ruleset_observed).
+    ///
+    /// This order is stable and does not depend on the order of the
+    /// configuration files nor of their rules: path beneath rules sorted by
+    /// path, then mount point rules sorted by path, and then network port
+    /// rules sorted by port.  Paths are compared component by component, so a
+    /// directory comes before its children.  Rules for the same path or port
+    /// are merged.
+    pub fn planned_rules(&self) -> Vec<BuiltRule<'_>> {
+        let path_beneath =
+            self.rules_path_beneath
+                .iter()
+                .map(|(path, access)| BuiltRule::PathBeneath {
+                    path,
+                    access: *access,
+                });
+        let mount_point =
+            self.rules_mount_point
+                .iter()
+                .map(|(path, access)| BuiltRule::MountPoint {
+                    path,
+                    access: *access,
+                });
+        let net_port = self
+            .rules_net_port
+            .iter()
+            .map(|(port, access)| BuiltRule::NetPort {
+                port: *port,
+                access: *access,
+            });
+        path_beneath.chain(mount_point).chain(net_port).collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use landlock::{AccessFs, AccessNet};
+    use std::fs::File;
+    use std::os::unix::fs::{MetadataExt, OpenOptionsExt};
+    use std::os::unix::io::{AsRawFd, OwnedFd, RawFd};
+    use std::path::Path;
+
+    #[test]
+    fn test_planned_opens() {
+        let resolved = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr", "/etc" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/proc" ],
+                        "mountPoint": true
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+
+        let planned = resolved.planned_opens();
+        assert_eq!(
+            planned
+                .iter()
+                .map(|open| (open.path.as_path(), open.mount_point))
+                .collect::<Vec<_>>(),
+            [
+                (Path::new("/etc"), false),
+                (Path::new("/usr"), false),
+                (Path::new("/proc"), true),
+            ]
+        );
+
+        // Same paths, with the same flags, as the ones opened by the builder.
+        let mut opened = Vec::new();
+        let (_, rule_errors) = resolved
+            .build_ruleset_with(|path| {
+                opened.push(path.to_path_buf());
+                let file = File::options()
+                    .read(true)
+                    .custom_flags(planned[0].flags)
+                    .open(path)?;
+                Ok(OwnedFd::from(file))
+            })
+            .unwrap();
+        assert!(rule_errors.is_empty());
+        assert_eq!(
+            opened,
+            planned
+                .iter()
+                .map(|open| open.path.clone())
+                .collect::<Vec<_>>()
+        );
+    }
+
+    #[test]
+    fn test_planned_rules_order() {
+        let resolved = |json| parse_json(json).unwrap().resolve().unwrap();
+        let first = resolved(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr/lib", "/etc", "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/proc" ],
+                        "mountPoint": true
+                    },
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443, 80 ]
+                    }
+                ]
+            }"#,
+        );
+        let second = resolved(
+            r#"{
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 80, 443 ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/proc" ],
+                        "mountPoint": true
+                    },
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/etc", "/usr/lib" ]
+                    }
+                ]
+            }"#,
+        );
+        assert_eq!(first, second);
+
+        let planned = first.planned_rules();
+        assert_eq!(planned, second.planned_rules());
+        assert_eq!(
+            planned,
+            [
+                BuiltRule::PathBeneath {
+                    path: Path::new("/etc"),
+                    access: AccessFs::ReadFile.into(),
+                },
+                BuiltRule::PathBeneath {
+                    path: Path::new("/usr"),
+                    access: AccessFs::Execute | AccessFs::ReadFile,
+                },
+                BuiltRule::PathBeneath {
+                    path: Path::new("/usr/lib"),
+                    access: AccessFs::ReadFile.into(),
+                },
+                BuiltRule::MountPoint {
+                    path: Path::new("/proc"),
+                    access: AccessFs::ReadDir.into(),
+                },
+                BuiltRule::NetPort {
+                    port: 80,
+                    access: AccessNet::ConnectTcp.into(),
+                },
+                BuiltRule::NetPort {
+                    port: 443,
+                    access: AccessNet::ConnectTcp.into(),
+                },
+            ]
+        );
+
+        // Rules are added in the planned order.
+        let planned = planned
+            .iter()
+            .enumerate()
+            .map(|(rule, built)| format!("{rule}: {built:?}"))
+            .collect::<Vec<_>>();
+        for resolved in [&first, &second] {
+            let mut observed = Vec::new();
+            resolved
+                .build_ruleset_observed(|rule, built, _| {
+                    observed.push(format!("{rule}: {built:?}"))
+                })
+                .unwrap();
+            assert_eq!(observed, planned);
+        }
+    }
+
+    #[test]
+    fn test_resource_estimate() {
+        let resolved = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr", "/etc" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/usr", "/proc" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    },
+                    {
+                        "allowedAccess": [ "bind_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+        let estimate = resolved.resource_estimate();
+        // Rules for /usr and for port 443 are merged.
+        assert_eq!(
+            estimate,
+            ResourceEstimate {
+                max_open_fds: 2,
+                opened_fds: 3,
+                add_rule_calls: 4,
+            }
+        );
+
+        // Checks the actual usage: each rule path must be closed before the
+        // next one is opened, which is detected with its inode because file
+        // descriptor numbers are reused.
+        let is_open = |fd: RawFd, inode: (u64, u64)| {
+            let mut stat = std::mem::MaybeUninit::<libc::stat>::uninit();
+            unsafe {
+                libc::fstat(fd, stat.as_mut_ptr()) == 0 && {
+                    let stat = stat.assume_init();
+                    (stat.st_dev, stat.st_ino) == inode
+                }
+            }
+        };
+        let mut previous: Option<(RawFd, (u64, u64))> = None;
+        let mut opened = 0;
+        let mut added = 0;
+        let (_, rule_errors) = resolved
+            .build_ruleset_with(|path| {
+                if let Some((fd, inode)) = previous {
+                    assert!(!is_open(fd, inode), "{} is still open", path.display());
+                }
+                let file = File::options()
+                    .read(true)
+                    .custom_flags(libc::O_PATH | libc::O_CLOEXEC)
+                    .open(path)?;
+                let metadata = file.metadata()?;
+                previous = Some((file.as_raw_fd(), (metadata.dev(), metadata.ino())));
+                opened += 1;
+                Ok(OwnedFd::from(file))
+            })
+            .unwrap();
+        assert!(rule_errors.is_empty());
+        assert_eq!(opened, estimate.opened_fds);
+        resolved
+            .build_ruleset_observed(|_, _, result| {
+                assert!(result.is_ok());
+                added += 1;
+            })
+            .unwrap();
+        assert_eq!(added, estimate.add_rule_calls);
+
+        assert_eq!(
+            ResolvedConfig::default().resource_estimate(),
+            ResourceEstimate {
+                max_open_fds: 1,
+                opened_fds: 0,
+                add_rule_calls: 0,
+            }
+        );
+    }
+
+    #[test]
+    fn test_check_fd_limit() {
+        let estimate = ResourceEstimate {
+            max_open_fds: 2,
+            ..Default::default()
+        };
+        estimate.check_fd_limit().unwrap();
+        let estimate = ResourceEstimate {
+            max_open_fds: usize::MAX,
+            ..Default::default()
+        };
+        assert_eq!(
+            estimate.check_fd_limit().unwrap_err().raw_os_error(),
+            Some(libc::EMFILE)
+        );
+    }
+}
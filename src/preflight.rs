@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, RuleError};
+use crate::{ResolvedConfig, SealedConfig};
+use std::io;
+use std::os::unix::process::ExitStatusExt;
+use std::process::ExitStatus;
+use thiserror::Error;
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum TestApplyError {
+    #[error(transparent)]
+    Build(#[from] BuildRulesetError),
+    #[error("failed to add {} rule(s), first: {}", .0.len(), .0[0])]
+    Rules(Vec<RuleError>),
+    #[error("failed to create a pipe: {0}")]
+    Pipe(#[source] io::Error),
+    #[error("failed to fork: {0}")]
+    Fork(#[source] io::Error),
+    #[error("failed to enforce the ruleset in the child process: {0}")]
+    Restrict(#[source] io::Error),
+    #[error("failed to wait for the child process: {0}")]
+    Wait(#[source] io::Error),
+    #[error("child process crashed before reporting: {0}")]
+    Crashed(ExitStatus),
+}
+
+/// Retries a syscall interrupted by a signal.
+fn retry<F>(mut f: F) -> io::Result<libc::c_long>
+where
+    F: FnMut() -> libc::c_long,
+{
+    loop {
+        match f() {
+            -1 => {
+                let error = io::Error::last_os_error();
+                if error.kind() != io::ErrorKind::Interrupted {
+                    return Err(error);
+                }
+            }
+            ret => return Ok(ret),
+        }
+    }
+}
+
+impl ResolvedConfig {
+    /// Checks that this configuration can be enforced, without restricting the
+    /// calling process, e.g. to validate a new configuration before reloading
+    /// a service with it.
+    ///
+    /// The ruleset is built by the calling process, where a rule which cannot
+    /// be added (e.g. a missing path) is an error, and then enforced by a
+    /// forked child process which reports the result through a pipe and exits.
+    /// Returns `false` if Landlock is not supported by the running kernel, in
+    /// which case nothing is enforced, and the rule errors which are only
+    /// warnings (see [`RuleError::is_warning()`]).
+    ///
+    /// This relies on fork(2), which is Linux-specific here: the child only
+    /// makes async-signal-safe syscalls, which makes this safe to call from a
+    /// multithreaded process.
+    pub fn test_apply(&self) -> Result<(bool, Vec<RuleError>), TestApplyError> {
+        self.test_apply_with(SealedConfig::restrict_self)
+    }
+
+    fn test_apply_with(
+        &self,
+        restrict: fn(&SealedConfig) -> io::Result<bool>,
+    ) -> Result<(bool, Vec<RuleError>), TestApplyError> {
+        let (sealed, rule_errors) = self.seal()?;
+        let (warnings, rule_errors): (Vec<_>, Vec<_>) =
+            rule_errors.into_iter().partition(RuleError::is_warning);
+        if !rule_errors.is_empty() {
+            return Err(TestApplyError::Rules(rule_errors));
+        }
+
+        let mut fds = [-1; 2];
+        if unsafe { libc::pipe2(fds.as_mut_ptr(), libc::O_CLOEXEC) } != 0 {
+            return Err(TestApplyError::Pipe(io::Error::last_os_error()));
+        }
+        let [read_fd, write_fd] = fds;
+
+        let pid = unsafe { libc::fork() };
+        if pid == 0 {
+            // Child process: no memory allocation from here.
+            let report: i32 = match restrict(&sealed) {
+                Ok(enforced) => enforced.into(),
+                Err(error) => -error.raw_os_error().unwrap_or(libc::EINVAL),
+            };
+            unsafe {
+                libc::write(write_fd, (&raw const report).cast(), size_of_val(&report));
+                libc::_exit(0);
+            }
+        }
+        unsafe { libc::close(write_fd) };
+        if pid < 0 {
+            let error = io::Error::last_os_error();
+            unsafe { libc::close(read_fd) };
+            return Err(TestApplyError::Fork(error));
+        }
+
+        let mut report: i32 = 0;
+        let read = retry(|| unsafe {
+            libc::read(read_fd, (&raw mut report).cast(), size_of_val(&report)) as libc::c_long
+        });
+        unsafe { libc::close(read_fd) };
+        let mut status = 0;
+        // Always reaps the child, even if reading failed.
+        let waited = retry(|| unsafe { libc::waitpid(pid, &mut status, 0) }.into());
+
+        match read {
+            Ok(len) if len == size_of_val(&report) as libc::c_long => match report {
+                0 => Ok((false, warnings)),
+                1 => Ok((true, warnings)),
+                errno => Err(TestApplyError::Restrict(io::Error::from_raw_os_error(
+                    -errno,
+                ))),
+            },
+            // The child exited without writing its report.
+            Ok(_) => {
+                waited.map_err(TestApplyError::Wait)?;
+                Err(TestApplyError::Crashed(ExitStatus::from_raw(status)))
+            }
+            Err(error) => Err(TestApplyError::Pipe(error)),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{parse_json, TempDir};
+    use landlock::AccessFs;
+    use std::fs;
+
+    fn resolved_with(parent: &str, access: &str) -> ResolvedConfig {
+        parse_json(&format!(
+            r#"{{
+                "pathBeneath": [
+                    {{
+                        "allowedAccess": [ {access} ],
+                        "parent": [ "{parent}" ]
+                    }}
+                ]
+            }}"#
+        ))
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    fn resolved(parent: &str) -> ResolvedConfig {
+        resolved_with(parent, r#""read_file""#)
+    }
+
+    fn check_applied(result: Result<(bool, Vec<RuleError>), TestApplyError>) -> Vec<RuleError> {
+        match result {
+            Ok((true, warnings)) => warnings,
+            Ok((false, warnings)) => {
+                eprintln!("Landlock is not supported by the running kernel");
+                warnings
+            }
+            Err(error) => panic!("{error}"),
+        }
+    }
+
+    #[test]
+    fn test_test_apply() {
+        let warnings = check_applied(resolved("/usr").test_apply());
+        assert!(warnings.is_empty(), "{warnings:?}");
+        // The parent is not restricted.
+        assert!(!probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+
+        let error = resolved("/does/not/exist").test_apply().unwrap_err();
+        assert!(
+            matches!(error, TestApplyError::Rules(ref errors) if errors.len() == 1),
+            "{error:?}"
+        );
+        assert!(!probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+    }
+
+    #[test]
+    fn test_test_apply_warning() {
+        // A directory access right on a file is ignored, but the rule is added.
+        let dir = TempDir::new("preflight-warning");
+        let file = dir.path().join("file");
+        fs::write(&file, "").unwrap();
+        let config = resolved_with(file.to_str().unwrap(), r#""read_file", "read_dir""#);
+        let warnings = check_applied(config.test_apply());
+        let [RuleError::NotDirectory { path, access }] = warnings.as_slice() else {
+            panic!("unexpected rule errors: {warnings:?}");
+        };
+        assert_eq!(path, &file);
+        assert_eq!(*access, AccessFs::ReadDir.into());
+        assert!(!probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+    }
+
+    #[test]
+    fn test_test_apply_errors() {
+        let config = resolved("/usr");
+        assert!(matches!(
+            config.test_apply_with(|_| Err(io::Error::from_raw_os_error(libc::E2BIG))),
+            Err(TestApplyError::Restrict(error)) if error.raw_os_error() == Some(libc::E2BIG),
+        ));
+
+        match config.test_apply_with(|_| unsafe { libc::abort() }) {
+            Err(TestApplyError::Crashed(status)) => {
+                assert_eq!(status.signal(), Some(libc::SIGABRT))
+            }
+            ret => panic!("{ret:?}"),
+        }
+    }
+}
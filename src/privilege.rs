@@ -0,0 +1,353 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, ParseFileError, RuleError};
+use crate::variable::ResolveError;
+use crate::{Config, ConfigFormat, ResolvedConfig};
+use landlock::RestrictionStatus;
+use std::ffi::{OsStr, OsString};
+use std::io;
+use std::os::unix::process::CommandExt;
+use std::path::Path;
+use std::process::Command;
+use thiserror::Error;
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum DropPrivilegesError {
+    #[error(transparent)]
+    Restrict(#[from] BuildRulesetError),
+    #[error("failed to clear supplementary groups: {0}")]
+    SetGroups(#[source] io::Error),
+    #[error("failed to set group ID {gid}: {source}")]
+    SetGid { gid: libc::gid_t, source: io::Error },
+    #[error("failed to set user ID {uid}: {source}")]
+    SetUid { uid: libc::uid_t, source: io::Error },
+}
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum RestrictThreadError {
+    /// Landlock can only restrict the calling thread, which is then inherited
+    /// by its future children.
+    #[error(
+        "cannot restrict thread {tid}: Landlock only restricts the calling thread, \
+        which should then be restricted before executing the program to sandbox \
+        (see launch()) or from the program itself"
+    )]
+    OtherThread { tid: libc::pid_t },
+    #[error(transparent)]
+    Restrict(#[from] BuildRulesetError),
+}
+
+/// Stage of [`launch()`] that failed.
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum LaunchError {
+    #[error("no command to execute")]
+    NoCommand,
+    #[error("failed to parse the configuration: {0}")]
+    Parse(#[source] ParseFileError),
+    #[error("failed to resolve the configuration: {0}")]
+    Resolve(#[source] ResolveError),
+    /// Failed to build or enforce the ruleset, or to drop privileges.
+    #[error(transparent)]
+    DropPrivileges(#[from] DropPrivilegesError),
+    #[error("failed to execute {}: {source}", .program.to_string_lossy())]
+    Exec {
+        program: OsString,
+        source: io::Error,
+    },
+}
+
+fn check(ret: libc::c_int) -> io::Result<()> {
+    if ret == 0 {
+        Ok(())
+    } else {
+        Err(io::Error::last_os_error())
+    }
+}
+
+impl ResolvedConfig {
+    /// Enforces this configuration on the calling thread, and then drops the
+    /// privileges of the whole process to `uid` and `gid`.
+    ///
+    /// The order matters:
+    /// * The ruleset is enforced first, which also sets no_new_privs.  If a
+    ///   privilege drop then fails, the process is still sandboxed.  No
+    ///   privilege is required to enforce the ruleset, and no_new_privs only
+    ///   prevents gaining privileges with execve(2), not dropping them.
+    /// * The supplementary groups are cleared and the group ID is set before
+    ///   the user ID, because an unprivileged user cannot change them anymore.
+    ///
+    /// The libc applies the group and user IDs to all the threads of the
+    /// process, but the ruleset only restricts the calling thread (and its
+    /// future children).  This should then be called before spawning other
+    /// threads, as a launcher usually does.
+    ///
+    /// Nothing is rolled back on error: the process might be partially
+    /// restricted and should then exit.
+    pub fn restrict_self_and_drop_privileges(
+        &self,
+        uid: libc::uid_t,
+        gid: libc::gid_t,
+    ) -> Result<(RestrictionStatus, Vec<RuleError>), DropPrivilegesError> {
+        let ret = self.restrict_self()?;
+        check(unsafe { libc::setgroups(0, std::ptr::null()) })
+            .map_err(DropPrivilegesError::SetGroups)?;
+        check(unsafe { libc::setgid(gid) })
+            .map_err(|source| DropPrivilegesError::SetGid { gid, source })?;
+        check(unsafe { libc::setuid(uid) })
+            .map_err(|source| DropPrivilegesError::SetUid { uid, source })?;
+        Ok(ret)
+    }
+
+    /// Enforces this configuration on the thread `tid` (e.g. a process ID),
+    /// which must be the calling thread.
+    ///
+    /// Landlock cannot restrict another process or thread: a sandbox is only
+    /// inherited by the future children of the restricted thread.  To sandbox
+    /// another program, the launcher should restrict itself and then execute
+    /// it (see [`launch()`]), or the program should restrict itself.  This
+    /// returns [`RestrictThreadError::OtherThread`] with this guidance instead
+    /// of giving the false impression that another process is sandboxed.  A
+    /// process ID is the ID of its main thread.
+    pub fn restrict_thread(
+        &self,
+        tid: libc::pid_t,
+    ) -> Result<(RestrictionStatus, Vec<RuleError>), RestrictThreadError> {
+        if tid != unsafe { libc::gettid() } {
+            return Err(RestrictThreadError::OtherThread { tid });
+        }
+        Ok(self.restrict_self()?)
+    }
+}
+
+/// Parses the configuration file at `path`, enforces it, drops the privileges
+/// to `uid` and `gid`, and then executes `argv`, e.g. in a setuid launcher.
+///
+/// The stages are sequenced in the secure order:
+/// * The configuration is parsed and resolved with the current privileges.
+/// * The ruleset is built, which opens the rule paths with the current
+///   privileges (e.g. as root).
+/// * The ruleset is enforced, which also sets no_new_privs, and the
+///   privileges are dropped, like
+///   [`ResolvedConfig::restrict_self_and_drop_privileges()`].
+/// * `argv` is executed, with `argv[0]` searched in `$PATH` if it does not
+///   contain a slash.
+///
+/// This only returns on error, with the failing stage.  Rule errors are
+/// ignored because they can only leave the sandbox more restrictive: callers
+/// needing them should use
+/// [`restrict_self_and_drop_privileges()`](ResolvedConfig::restrict_self_and_drop_privileges)
+/// and execute the command themselves.  The process might be partially
+/// restricted on error and should then exit.
+pub fn launch<P, S>(
+    path: P,
+    format: ConfigFormat,
+    uid: libc::uid_t,
+    gid: libc::gid_t,
+    argv: &[S],
+) -> LaunchError
+where
+    P: AsRef<Path>,
+    S: AsRef<OsStr>,
+{
+    let Some((program, args)) = argv.split_first() else {
+        return LaunchError::NoCommand;
+    };
+    let resolved = match Config::parse_file(path, format) {
+        Ok(config) => match config.resolve() {
+            Ok(resolved) => resolved,
+            Err(e) => return LaunchError::Resolve(e),
+        },
+        Err(e) => return LaunchError::Parse(e),
+    };
+    if let Err(e) = resolved.restrict_self_and_drop_privileges(uid, gid) {
+        return e.into();
+    }
+    LaunchError::Exec {
+        program: program.as_ref().into(),
+        source: Command::new(program).args(args).exec(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{
+        dedicated_thread, restricted_thread, restricted_thread_with, TempDir,
+    };
+    use landlock::{AccessFs, RulesetStatus};
+    use std::os::unix::fs::PermissionsExt;
+    use std::path::PathBuf;
+    use std::{env, fs};
+
+    // Privileges are dropped for the whole process, which is then a dedicated
+    // instance of the test binary.
+    const CHILD_ENV: &str = "LANDLOCKCONFIG_TEST_DROP_PRIVILEGES";
+    const NOBODY: u32 = 65534;
+
+    fn child() {
+        let config = ResolvedConfig {
+            handled_fs: AccessFs::ReadFile.into(),
+            rules_path_beneath: [(PathBuf::from("/usr"), AccessFs::ReadFile.into())].into(),
+            ..Default::default()
+        };
+        let (status, rule_errors) = config
+            .restrict_self_and_drop_privileges(NOBODY, NOBODY)
+            .unwrap();
+        assert!(rule_errors.is_empty());
+
+        unsafe {
+            assert_eq!(libc::getuid(), NOBODY);
+            assert_eq!(libc::geteuid(), NOBODY);
+            assert_eq!(libc::getgid(), NOBODY);
+            assert_eq!(libc::getegid(), NOBODY);
+            assert_eq!(libc::getgroups(0, std::ptr::null_mut()), 0);
+        }
+        assert!(matches!(
+            config.restrict_self_and_drop_privileges(0, 0),
+            Err(DropPrivilegesError::SetGroups(_))
+        ));
+
+        if status.ruleset == RulesetStatus::NotEnforced {
+            eprintln!("Landlock is not supported by the running kernel");
+        } else {
+            // /etc/passwd is readable by everyone, but not allowed.
+            assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+        }
+    }
+
+    fn launch_child(path: &OsStr) {
+        let script =
+            "id -u; id -g; cat /etc/passwd >/dev/null 2>&1 && echo readable || echo denied";
+        let err = launch(
+            path,
+            ConfigFormat::Json,
+            NOBODY,
+            NOBODY,
+            &["/bin/sh", "-c", script],
+        );
+        panic!("{err}");
+    }
+
+    #[test]
+    fn test_launch() {
+        if let Some(path) = env::var_os(CHILD_ENV) {
+            return launch_child(&path);
+        }
+        if unsafe { libc::geteuid() } != 0 {
+            eprintln!("Dropping privileges requires to run as root");
+            return;
+        }
+        // The configuration is only readable by root.
+        let dir = TempDir::new("privilege-launch");
+        let path = dir.path().join("policy.json");
+        fs::write(
+            &path,
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file", "read_dir" ],
+                        "parent": [ "/bin", "/lib", "/lib64", "/usr" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        fs::set_permissions(&path, fs::Permissions::from_mode(0o600)).unwrap();
+        let output = Command::new(env::current_exe().unwrap())
+            .args(["--exact", "privilege::tests::test_launch"])
+            .env(CHILD_ENV, &path)
+            .output()
+            .unwrap();
+        assert!(output.status.success(), "{output:?}");
+
+        // Checks if Landlock is enforced with a dedicated thread.
+        let config = ResolvedConfig {
+            handled_fs: AccessFs::ReadFile.into(),
+            ..Default::default()
+        };
+        let readable = if restricted_thread(config, || ()).is_some() {
+            "denied"
+        } else {
+            "readable"
+        };
+        // The test harness is replaced by the executed command.
+        let stdout = String::from_utf8(output.stdout).unwrap();
+        assert!(
+            stdout.ends_with(&format!(" ... {NOBODY}\n{NOBODY}\n{readable}\n")),
+            "{stdout}"
+        );
+    }
+
+    #[test]
+    fn test_restrict_thread_other() {
+        let config = ResolvedConfig::default();
+        let pid = unsafe { libc::getppid() };
+        let err = config.restrict_thread(pid).unwrap_err();
+        assert!(matches!(err, RestrictThreadError::OtherThread { tid } if tid == pid));
+        assert!(err.to_string().contains("launch()"), "{err}");
+
+        // The main thread is another thread.
+        let pid = unsafe { libc::getpid() };
+        dedicated_thread(move || {
+            assert!(matches!(
+                ResolvedConfig::default().restrict_thread(pid),
+                Err(RestrictThreadError::OtherThread { .. })
+            ));
+        });
+    }
+
+    #[test]
+    fn test_restrict_thread_self() {
+        let config = ResolvedConfig {
+            handled_fs: AccessFs::ReadFile.into(),
+            ..Default::default()
+        };
+        restricted_thread_with(
+            move || config.restrict_thread(unsafe { libc::gettid() }).unwrap(),
+            || assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap()),
+        );
+    }
+
+    #[test]
+    fn test_launch_errors() {
+        let no_args: &[&str] = &[];
+        assert!(matches!(
+            launch("/nonexistent", ConfigFormat::Json, NOBODY, NOBODY, no_args),
+            LaunchError::NoCommand
+        ));
+        assert!(matches!(
+            launch(
+                "/nonexistent",
+                ConfigFormat::Json,
+                NOBODY,
+                NOBODY,
+                &["true"]
+            ),
+            LaunchError::Parse(ParseFileError::Io(_))
+        ));
+    }
+
+    #[test]
+    fn test_restrict_self_and_drop_privileges() {
+        if env::var_os(CHILD_ENV).is_some() {
+            return child();
+        }
+        if unsafe { libc::geteuid() } != 0 {
+            eprintln!("Dropping privileges requires to run as root");
+            return;
+        }
+        let status = Command::new(env::current_exe().unwrap())
+            .args([
+                "--exact",
+                "privilege::tests::test_restrict_self_and_drop_privileges",
+            ])
+            .env(CHILD_ENV, "1")
+            .status()
+            .unwrap();
+        assert!(status.success());
+    }
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use landlock::AccessFs;
+use std::fs::OpenOptions;
+use std::io;
+use std::os::unix::fs::OpenOptionsExt;
+use std::path::Path;
+
+/// Probes whether `access` is denied to the calling thread for `path`, e.g. to
+/// check in tests that a sandbox is enforced.
+///
+/// The probe only opens `path` (without creating nor truncating it) and closes
+/// it, which is free of side effects on the file.  Only `ReadFile`, `ReadDir`,
+/// and `WriteFile` can be probed this way; other access rights return an
+/// [`io::ErrorKind::Unsupported`] error.
+///
+/// This is only a probe: an open(2) call failing with `EACCES` may come from
+/// other access controls than Landlock (e.g. file permissions), and it cannot
+/// verify that a ruleset denies everything it should.  Other errors (e.g. a
+/// missing file) are returned as is.
+pub fn probe_denied<P>(path: P, access: AccessFs) -> io::Result<bool>
+where
+    P: AsRef<Path>,
+{
+    let mut options = OpenOptions::new();
+    // Never blocks on FIFOs nor acquires a controlling terminal.
+    let flags = libc::O_NONBLOCK | libc::O_NOCTTY;
+    match access {
+        AccessFs::ReadFile => options.read(true).custom_flags(flags),
+        AccessFs::ReadDir => options.read(true).custom_flags(flags | libc::O_DIRECTORY),
+        AccessFs::WriteFile => options.write(true).custom_flags(flags),
+        _ => {
+            return Err(io::Error::new(
+                io::ErrorKind::Unsupported,
+                format!("cannot probe {access:?}"),
+            ))
+        }
+    };
+    match options.open(path) {
+        Ok(_) => Ok(false),
+        Err(e) if e.raw_os_error() == Some(libc::EACCES) => Ok(true),
+        Err(e) => Err(e),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::{restricted_thread, TempDir};
+    use crate::ResolvedConfig;
+    use std::fs;
+
+    fn probe_dir(name: &str) -> TempDir {
+        let dir = TempDir::new(&format!("probe-{name}"));
+        let path = dir.path();
+        fs::create_dir(path.join("allowed")).unwrap();
+        fs::create_dir(path.join("denied")).unwrap();
+        fs::write(path.join("allowed/file"), "").unwrap();
+        fs::write(path.join("denied/file"), "").unwrap();
+        dir
+    }
+
+    #[test]
+    fn test_probe_allowed() {
+        let dir = probe_dir("allowed");
+        let file = dir.path().join("allowed/file");
+        assert!(!probe_denied(&file, AccessFs::ReadFile).unwrap());
+        assert!(!probe_denied(&file, AccessFs::WriteFile).unwrap());
+        assert!(!probe_denied(dir.path(), AccessFs::ReadDir).unwrap());
+    }
+
+    #[test]
+    fn test_probe_errors() {
+        let dir = probe_dir("errors");
+        assert_eq!(
+            probe_denied(dir.path().join("nonexistent"), AccessFs::ReadFile)
+                .unwrap_err()
+                .kind(),
+            io::ErrorKind::NotFound
+        );
+        assert_eq!(
+            probe_denied(dir.path().join("allowed/file"), AccessFs::Execute)
+                .unwrap_err()
+                .kind(),
+            io::ErrorKind::Unsupported
+        );
+    }
+
+    #[test]
+    fn test_probe_restricted() {
+        let dir = probe_dir("restricted");
+        let config = ResolvedConfig {
+            handled_fs: AccessFs::ReadFile | AccessFs::ReadDir | AccessFs::WriteFile,
+            rules_path_beneath: [(dir.path().join("allowed"), AccessFs::ReadFile.into())].into(),
+            ..Default::default()
+        };
+
+        let root = dir.path().to_path_buf();
+        restricted_thread(config, move || {
+            assert!(!probe_denied(root.join("allowed/file"), AccessFs::ReadFile).unwrap());
+            assert!(probe_denied(root.join("allowed/file"), AccessFs::WriteFile).unwrap());
+            assert!(probe_denied(root.join("denied/file"), AccessFs::ReadFile).unwrap());
+            assert!(probe_denied(&root, AccessFs::ReadDir).unwrap());
+        });
+    }
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::parser::TemplateString;
+use crate::Config;
+use landlock::{AccessFs, AccessNet, BitFlags};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::sync::{Mutex, MutexGuard, PoisonError};
+
+#[derive(Debug, Default)]
+struct Accesses {
+    // Thanks to PathBuf, paths are normalized and parents are sorted before
+    // their children.
+    path_beneath: BTreeMap<PathBuf, BitFlags<AccessFs>>,
+    net_port: BTreeMap<u16, BitFlags<AccessNet>>,
+}
+
+/// Accumulates observed accesses to build a minimal configuration.
+///
+/// A `Recorder` can be shared between threads, e.g. to learn the accesses
+/// requested by an instrumented process over time.  The resulting
+/// configuration only handles the access rights that were recorded: any other
+/// kind of access stays allowed.
+///
+/// Accesses to the same path or port are merged.  When generating the
+/// configuration, a path is omitted if one of its recorded parents already
+/// allows all its access rights.  Paths are never collapsed into a common
+/// parent that was not recorded, which would grant more than what was
+/// observed.
+#[derive(Debug, Default)]
+pub struct Recorder {
+    accesses: Mutex<Accesses>,
+}
+
+impl Recorder {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn lock(&self) -> MutexGuard<'_, Accesses> {
+        // Each update is complete once done, so the content of a poisoned
+        // mutex is still consistent.
+        self.accesses.lock().unwrap_or_else(PoisonError::into_inner)
+    }
+
+    /// Records the `access` rights requested on a file hierarchy.
+    pub fn record<P>(&self, path: P, access: BitFlags<AccessFs>)
+    where
+        P: AsRef<Path>,
+    {
+        if access.is_empty() {
+            return;
+        }
+        let path = path.as_ref().components().collect();
+        *self.lock().path_beneath.entry(path).or_default() |= access;
+    }
+
+    /// Records the `access` rights requested on a TCP port.
+    pub fn record_port(&self, port: u16, access: BitFlags<AccessNet>) {
+        if access.is_empty() {
+            return;
+        }
+        *self.lock().net_port.entry(port).or_default() |= access;
+    }
+
+    /// Builds the configuration allowing all the recorded accesses.
+    ///
+    /// Paths that are not valid UTF-8 cannot be part of a configuration and
+    /// are skipped.
+    pub fn config(&self) -> Config {
+        let accesses = self.lock();
+        let mut config = Config::empty();
+        let mut kept: BTreeMap<&Path, BitFlags<AccessFs>> = BTreeMap::new();
+
+        for (path, access) in &accesses.path_beneath {
+            config.handled_fs |= *access;
+            let covered = path
+                .ancestors()
+                .skip(1)
+                .any(|parent| kept.get(parent).is_some_and(|a| a.contains(*access)));
+            if covered {
+                continue;
+            }
+            kept.insert(path, *access);
+            if let Some(path) = path.to_str() {
+                config
+                    .rules_path_beneath
+                    .insert(TemplateString::from_text(path), *access);
+            }
+        }
+
+        for (port, access) in &accesses.net_port {
+            config.handled_net |= *access;
+            config.rules_net_port.insert((*port).into(), *access);
+        }
+        config
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use std::thread;
+
+    #[test]
+    fn test_empty() {
+        let recorder = Recorder::new();
+        recorder.record("/usr", BitFlags::EMPTY);
+        recorder.record_port(443, BitFlags::EMPTY);
+        assert_eq!(recorder.config(), Config::empty());
+    }
+
+    #[test]
+    fn test_merge() {
+        let recorder = Recorder::new();
+        recorder.record("/usr", AccessFs::Execute.into());
+        recorder.record("/usr/", AccessFs::ReadFile.into());
+        recorder.record("/tmp//foo", AccessFs::WriteFile.into());
+        recorder.record_port(443, AccessNet::ConnectTcp.into());
+        recorder.record_port(443, AccessNet::BindTcp.into());
+
+        let expected = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp/foo" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "bind_tcp", "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(recorder.config(), expected);
+    }
+
+    #[test]
+    fn test_minimize() {
+        let recorder = Recorder::new();
+        recorder.record("/usr/lib/foo", AccessFs::ReadFile.into());
+        recorder.record("/usr", AccessFs::ReadFile | AccessFs::Execute);
+        recorder.record("/usr/bin/bar", AccessFs::Execute.into());
+        recorder.record("/usr/lib/bar", AccessFs::WriteFile.into());
+        recorder.record("/usrlib", AccessFs::ReadFile.into());
+        recorder.record("/var/log/a", AccessFs::WriteFile.into());
+        recorder.record("/var/log/b", AccessFs::WriteFile.into());
+
+        let expected = parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usrlib" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/usr/lib/bar", "/var/log/a", "/var/log/b" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(recorder.config(), expected);
+    }
+
+    #[test]
+    fn test_escaped_dollar() {
+        let recorder = Recorder::new();
+        recorder.record("/a$b", AccessFs::ReadFile.into());
+
+        let resolved = recorder.config().resolve().unwrap();
+        assert_eq!(
+            resolved.rules_path_beneath,
+            [(PathBuf::from("/a$b"), AccessFs::ReadFile.into())].into()
+        );
+    }
+
+    #[test]
+    fn test_concurrent() {
+        const THREADS: u16 = 16;
+        const ITERATIONS: u16 = 1000;
+
+        let recorder = Recorder::new();
+        thread::scope(|s| {
+            for i in 0..THREADS {
+                let recorder = &recorder;
+                s.spawn(move || {
+                    for j in 0..ITERATIONS {
+                        let access = if j % 2 == 0 {
+                            AccessFs::ReadFile
+                        } else {
+                            AccessFs::ReadDir
+                        };
+                        recorder.record(format!("/{}", j % 10), access.into());
+                        recorder.record_port(i, AccessNet::ConnectTcp.into());
+                    }
+                });
+            }
+        });
+
+        let config = recorder.config();
+        assert_eq!(config.handled_fs, AccessFs::ReadFile | AccessFs::ReadDir);
+        assert_eq!(config.rules_path_beneath.len(), 10);
+        assert_eq!(config.rules_net_port.len(), usize::from(THREADS));
+        for (j, access) in config.rules_path_beneath.values().enumerate() {
+            let expected = if j % 2 == 0 {
+                AccessFs::ReadFile
+            } else {
+                AccessFs::ReadDir
+            };
+            assert_eq!(*access, expected.into());
+        }
+    }
+}
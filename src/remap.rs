@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::ResolvedConfig;
+use landlock::{AccessFs, BitFlags};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use thiserror::Error;
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum RemapError {
+    #[error("prefix is not an absolute path: {}", .0.display())]
+    RelativePrefix(PathBuf),
+    #[error("{} is remapped to {}, which does not exist", .path.display(), .mapped.display())]
+    Missing { path: PathBuf, mapped: PathBuf },
+}
+
+/// Rewrites `path` with the longest matching prefix of `map`, if any.
+fn remap_path(map: &BTreeMap<PathBuf, PathBuf>, path: &Path) -> Option<PathBuf> {
+    map.iter()
+        .filter_map(|(from, to)| path.strip_prefix(from).ok().map(|rest| (from, to, rest)))
+        // Prefixes are unique, so the longest one is the only one with the
+        // most components.
+        .max_by_key(|(from, _, _)| from.components().count())
+        .map(|(_, to, rest)| {
+            if rest.as_os_str().is_empty() {
+                to.clone()
+            } else {
+                to.join(rest)
+            }
+        })
+}
+
+fn remap_rules(
+    map: &BTreeMap<PathBuf, PathBuf>,
+    rules: &BTreeMap<PathBuf, BitFlags<AccessFs>>,
+) -> Result<BTreeMap<PathBuf, BitFlags<AccessFs>>, RemapError> {
+    let mut remapped = BTreeMap::new();
+    for (path, access) in rules {
+        let mapped = match remap_path(map, path) {
+            Some(mapped) => {
+                if mapped.symlink_metadata().is_err() {
+                    return Err(RemapError::Missing {
+                        path: path.clone(),
+                        mapped,
+                    });
+                }
+                mapped
+            }
+            None => path.clone(),
+        };
+        *remapped.entry(mapped).or_default() |= *access;
+    }
+    Ok(remapped)
+}
+
+impl ResolvedConfig {
+    /// Rewrites the paths of filesystem rules (including mount point rules)
+    /// according to `map`, e.g. to enforce a policy written with host paths in
+    /// a container or a chroot where they are under another root.
+    ///
+    /// Each key of `map` is a prefix replaced with its value.  Prefixes are
+    /// compared by path components (e.g. `/usr` matches `/usr/bin` but not
+    /// `/usrlib`), and only the longest matching prefix is applied, whatever
+    /// the order of `map`.  Paths without a matching prefix are left
+    /// unchanged, and paths remapped to the same one are merged.
+    ///
+    /// Prefixes must be absolute paths, and remapped paths must exist (without
+    /// following a final symbolic link), to detect a wrong mapping before
+    /// building the ruleset.  If an error is returned, `self` is left
+    /// unchanged.
+    pub fn remap_prefixes(&mut self, map: &BTreeMap<PathBuf, PathBuf>) -> Result<(), RemapError> {
+        if let Some(prefix) = map
+            .iter()
+            .flat_map(|(from, to)| [from, to])
+            .find(|prefix| !prefix.is_absolute())
+        {
+            return Err(RemapError::RelativePrefix(prefix.clone()));
+        }
+        let path_beneath = remap_rules(map, &self.rules_path_beneath)?;
+        let mount_point = remap_rules(map, &self.rules_mount_point)?;
+        self.rules_path_beneath = path_beneath;
+        self.rules_mount_point = mount_point;
+        self.required_paths = std::mem::take(&mut self.required_paths)
+            .into_iter()
+            .map(|path| remap_path(map, &path).unwrap_or(path))
+            .collect();
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::TempDir;
+    use std::fs;
+
+    fn config(paths: &[&Path]) -> ResolvedConfig {
+        ResolvedConfig {
+            handled_fs: AccessFs::ReadFile.into(),
+            rules_path_beneath: paths
+                .iter()
+                .map(|path| (path.to_path_buf(), AccessFs::ReadFile.into()))
+                .collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_remap_single() {
+        let root = TempDir::new("remap-single");
+        fs::create_dir_all(root.path().join("usr/bin")).unwrap();
+
+        let mut resolved = config(&[Path::new("/usr"), Path::new("/usr/bin")]);
+        let map = [("/usr".into(), root.path().join("usr"))].into();
+        resolved.remap_prefixes(&map).unwrap();
+        assert_eq!(
+            resolved,
+            config(&[&root.path().join("usr"), &root.path().join("usr/bin")])
+        );
+    }
+
+    #[test]
+    fn test_remap_longest_prefix() {
+        let root = TempDir::new("remap-longest");
+        let host = root.path().join("host");
+        let lib = root.path().join("lib");
+        fs::create_dir_all(host.join("usr/bin")).unwrap();
+        fs::create_dir_all(lib.join("x86_64")).unwrap();
+
+        let mut resolved = config(&[
+            Path::new("/usr/bin"),
+            Path::new("/usr/lib/x86_64"),
+            Path::new("/usr/lib"),
+        ]);
+        let map = [("/usr/lib".into(), lib.clone()), ("/".into(), host.clone())].into();
+        resolved.remap_prefixes(&map).unwrap();
+        assert_eq!(
+            resolved,
+            config(&[&host.join("usr/bin"), &lib.join("x86_64"), &lib])
+        );
+    }
+
+    #[test]
+    fn test_remap_unchanged() {
+        let root = TempDir::new("remap-unchanged");
+        fs::create_dir(root.path().join("usr")).unwrap();
+
+        let mut resolved = config(&[Path::new("/usrlib"), Path::new("/etc")]);
+        let map = [("/usr".into(), root.path().join("usr"))].into();
+        resolved.remap_prefixes(&map).unwrap();
+        assert_eq!(resolved, config(&[Path::new("/usrlib"), Path::new("/etc")]));
+    }
+
+    #[test]
+    fn test_remap_errors() {
+        let root = TempDir::new("remap-errors");
+        let mut resolved = config(&[Path::new("/usr/bin")]);
+
+        let map = [("/usr".into(), root.path().join("usr"))].into();
+        assert_eq!(
+            resolved.remap_prefixes(&map),
+            Err(RemapError::Missing {
+                path: "/usr/bin".into(),
+                mapped: root.path().join("usr/bin"),
+            })
+        );
+        assert_eq!(resolved, config(&[Path::new("/usr/bin")]));
+
+        let map = [("usr".into(), root.path().into())].into();
+        assert_eq!(
+            resolved.remap_prefixes(&map),
+            Err(RemapError::RelativePrefix("usr".into()))
+        );
+    }
+}
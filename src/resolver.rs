@@ -0,0 +1,1173 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::kernel;
+use crate::trace::Trace;
+use crate::variable::{Name, Variables};
+use landlock::{AccessFs, BitFlags, ABI};
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, BTreeSet};
+use std::env;
+use std::ffi::OsString;
+use std::fs;
+use std::io::ErrorKind;
+use std::path::{Component, Path, PathBuf};
+use std::str::FromStr;
+use std::sync::{Arc, Mutex, PoisonError};
+use thiserror::Error;
+
+#[derive(Debug, Error, PartialEq, Eq)]
+pub enum PathResolveError {
+    #[error("failed to get the home directory (HOME is not set)")]
+    HomeNotFound,
+    #[error("invalid glob pattern: {0}")]
+    InvalidPattern(String),
+    #[error("failed to read directory {}: {kind}", .path.display())]
+    ReadDir { path: PathBuf, kind: ErrorKind },
+    #[error("failed to get the executable path from /proc/self/exe: {kind}")]
+    SelfExe { kind: ErrorKind },
+    #[error("path too long (more than {max} bytes): {}", .path.display())]
+    TooLong { path: PathBuf, max: usize },
+    #[error("path too deep (more than {max} components): {}", .path.display())]
+    TooDeep { path: PathBuf, max: usize },
+    #[error("path escapes the base directory: {}", .path.display())]
+    EscapesBaseDir { path: PathBuf },
+    #[error("path not recorded in the replayed resolutions: {0}")]
+    NotRecorded(String),
+}
+
+/// Input path of the [`Resolution`] recording the target of `/proc/self/exe`,
+/// see [`PathResolver::expand_self()`].
+const SELF_EXE_LINK: &str = "/proc/self/exe";
+
+/// Decision of a [`PathResolver`] for one path, see
+/// [`PathResolver::snapshot()`].
+///
+/// Serialized as a JSON object with a `path` string (the path to resolve,
+/// once its variables are resolved) and a `resolved` array of strings (the
+/// resulting paths).  The target of `/proc/self/exe` (see
+/// [`PathResolver::expand_self()`]) is recorded as a resolution of
+/// `/proc/self/exe`.
+#[derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Resolution {
+    pub path: String,
+    pub resolved: Vec<PathBuf>,
+}
+
+/// Resolved paths of each path.
+type Resolutions = BTreeMap<String, Vec<PathBuf>>;
+
+/// Default maximum length of a resolved path, in bytes, i.e. `PATH_MAX`
+/// without the trailing NUL byte.
+pub const DEFAULT_MAX_PATH_LEN: usize = libc::PATH_MAX as usize - 1;
+
+/// Default maximum number of components of a resolved path.
+pub const DEFAULT_MAX_PATH_COMPONENTS: usize = 256;
+
+/// Converts the paths of a configuration, once their variables are resolved,
+/// to the paths used to build a ruleset.
+///
+/// The resolution is done in this order:
+/// 1. a leading `~` is replaced with the home directory (i.e. `$HOME` by
+///    default), if home expansion is enabled;
+/// 2. a relative path is joined to the base directory, if any;
+/// 3. the path is cleaned, if normalization is enabled;
+/// 4. the path is checked against the maximum length and number of components;
+/// 5. each path component containing a glob pattern (i.e. `*`, `?`, or
+///    `[...]`) is replaced with the matching entries of its parent directory,
+///    if glob expansion is enabled.  Like shells, wildcards do not match names
+///    starting with a dot unless the pattern explicitly starts with a dot.
+///    Matching nothing is not an error;
+/// 6. each missing path is replaced with an existing one differing only by
+///    case, if case-insensitive paths are enabled.
+///
+/// A replaying resolver (see [`replay()`](PathResolver::replay)) skips these
+/// steps.  The default resolver keeps paths as is.  Paths are not checked for
+/// existence, which is reported when building the ruleset.
+#[derive(Clone, Debug)]
+#[non_exhaustive]
+pub struct PathResolver {
+    base_dir: Option<PathBuf>,
+    home_dir: Option<PathBuf>,
+    expand_home: bool,
+    expand_globs: bool,
+    expand_self: bool,
+    expand_env: bool,
+    kernel_abi: Option<i32>,
+    // Replaces the process environment in tests, which must not call
+    // std::env::set_var() while other tests read the environment.
+    env: Option<BTreeMap<OsString, OsString>>,
+    case_insensitive: bool,
+    normalize: bool,
+    max_path_len: usize,
+    max_path_components: usize,
+    trace: Option<Arc<Trace>>,
+    // Shared between clones, like the trace.
+    recorded: Option<Arc<Mutex<Resolutions>>>,
+    replayed: Option<Arc<Resolutions>>,
+}
+
+impl Default for PathResolver {
+    fn default() -> Self {
+        Self {
+            base_dir: None,
+            home_dir: None,
+            expand_home: false,
+            expand_globs: false,
+            expand_self: false,
+            expand_env: false,
+            kernel_abi: None,
+            env: None,
+            case_insensitive: false,
+            normalize: false,
+            max_path_len: DEFAULT_MAX_PATH_LEN,
+            max_path_components: DEFAULT_MAX_PATH_COMPONENTS,
+            trace: None,
+            recorded: None,
+            replayed: None,
+        }
+    }
+}
+
+impl PathResolver {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Sets the directory relative paths are resolved from.
+    pub fn base_dir<P>(mut self, dir: P) -> Self
+    where
+        P: Into<PathBuf>,
+    {
+        self.base_dir = Some(dir.into());
+        self
+    }
+
+    /// Sets the home directory used by home expansion, instead of `$HOME`,
+    /// e.g. for hermetic tests.
+    pub fn home_dir<P>(mut self, dir: P) -> Self
+    where
+        P: Into<PathBuf>,
+    {
+        self.home_dir = Some(dir.into());
+        self
+    }
+
+    pub fn expand_home(mut self, enable: bool) -> Self {
+        self.expand_home = enable;
+        self
+    }
+
+    pub fn expand_globs(mut self, enable: bool) -> Self {
+        self.expand_globs = enable;
+        self
+    }
+
+    /// Defines the `${SELF_EXE}` and `${SELF_DIR}` variables, respectively the
+    /// path of the running executable and its parent directory, e.g. to allow
+    /// a program to read its own resources wherever it is installed.
+    ///
+    /// They are read from `/proc/self/exe` when resolving a configuration,
+    /// which then fails if `/proc` is not mounted, and they replace any
+    /// configuration variable with the same name.
+    pub fn expand_self(mut self, enable: bool) -> Self {
+        self.expand_self = enable;
+        self
+    }
+
+    /// Defines a variable for each environment variable (e.g.
+    /// `${XDG_RUNTIME_DIR}`) not already defined by the configuration, e.g.
+    /// to make a configuration portable across environments.  A reference can
+    /// have a default value used if the variable is undefined (e.g.
+    /// `${XDG_RUNTIME_DIR:-/run/user/1000}`).
+    ///
+    /// This is opt-in because the environment is often controlled by a less
+    /// trusted party than the configuration.  Environment variables with a
+    /// name or value that is not valid for a configuration variable are
+    /// ignored.  A reference to an undefined variable without default value
+    /// is an error, unless the configuration is resolved with
+    /// [`Config::resolve_lenient()`](crate::Config::resolve_lenient).
+    pub fn expand_env(mut self, enable: bool) -> Self {
+        self.expand_env = enable;
+        self
+    }
+
+    /// Sets the Landlock ABI version against which the `when` blocks of a
+    /// configuration are evaluated, instead of the one supported by the
+    /// running kernel, e.g. to resolve a configuration for another system.
+    pub fn kernel_abi(mut self, abi: ABI) -> Self {
+        self.kernel_abi = Some(abi as i32);
+        self
+    }
+
+    pub(crate) fn kernel_abi_version(&self) -> i32 {
+        self.kernel_abi.unwrap_or_else(kernel::abi_version)
+    }
+
+    /// Folds the case of paths, e.g. for configurations targeting
+    /// case-insensitive mounts: missing paths are replaced with existing ones
+    /// differing only by case, and rules for paths differing only by case are
+    /// merged when resolving a configuration.
+    ///
+    /// This is only a validation aid to avoid spurious missing path errors and
+    /// duplicate rules, not a security guarantee: the kernel still identifies
+    /// files the way the underlying filesystem does.
+    pub fn case_insensitive(mut self, enable: bool) -> Self {
+        self.case_insensitive = enable;
+        self
+    }
+
+    /// Cleans paths lexically, e.g. for configurations from untrusted
+    /// generators: `.` components and redundant slashes are removed, and `..`
+    /// components remove their preceding component.  A relative path that
+    /// would then escape the base directory is an error.
+    ///
+    /// Like any lexical cleaning, this is wrong if a removed component is a
+    /// symbolic link, which is why it is not enabled by default.
+    pub fn normalize(mut self, enable: bool) -> Self {
+        self.normalize = enable;
+        self
+    }
+
+    /// Sets the maximum length of a resolved path, in bytes, instead of
+    /// [`DEFAULT_MAX_PATH_LEN`].
+    pub fn max_path_len(mut self, max: usize) -> Self {
+        self.max_path_len = max;
+        self
+    }
+
+    /// Sets the maximum number of components of a resolved path, instead of
+    /// [`DEFAULT_MAX_PATH_COMPONENTS`].
+    pub fn max_path_components(mut self, max: usize) -> Self {
+        self.max_path_components = max;
+        self
+    }
+
+    /// Records the time spent resolving configurations in `trace`.
+    pub fn trace(mut self, trace: Arc<Trace>) -> Self {
+        self.trace = Some(trace);
+        self
+    }
+
+    pub(crate) fn tracer(&self) -> Option<&Trace> {
+        self.trace.as_deref()
+    }
+
+    /// Records each resolution decision, which can then be retrieved with
+    /// [`snapshot()`](Self::snapshot), e.g. to rebuild a policy in CI
+    /// without the filesystem it was first resolved on.
+    pub fn record(mut self, enable: bool) -> Self {
+        self.recorded = enable.then(Default::default);
+        self
+    }
+
+    /// Returns the resolutions recorded since [`record()`](Self::record) was
+    /// enabled, sorted by path.
+    pub fn snapshot(&self) -> Vec<Resolution> {
+        let Some(ref recorded) = self.recorded else {
+            return Vec::new();
+        };
+        recorded
+            .lock()
+            .unwrap_or_else(PoisonError::into_inner)
+            .iter()
+            .map(|(path, resolved)| Resolution {
+                path: path.clone(),
+                resolved: resolved.clone(),
+            })
+            .collect()
+    }
+
+    /// Resolves paths with the `resolutions` returned by
+    /// [`snapshot()`](Self::snapshot) instead of the other settings, without
+    /// reading the filesystem (nor `$HOME`), which makes the resolution of a
+    /// configuration deterministic.  A path that was not recorded is an
+    /// error.
+    ///
+    /// A manifest only contains the paths as they were resolved on the
+    /// recording host: it does not pin the files they referred to, which may
+    /// have been replaced since, and it must be trusted like the
+    /// configuration itself because it decides which paths rules apply to.
+    /// Case folding of rules still applies if enabled.
+    pub fn replay<I>(mut self, resolutions: I) -> Self
+    where
+        I: IntoIterator<Item = Resolution>,
+    {
+        self.replayed = Some(Arc::new(
+            resolutions
+                .into_iter()
+                .map(|r| (r.path, r.resolved))
+                .collect(),
+        ));
+        self
+    }
+
+    /// Returns the replayed resolution of `path`, if replaying.
+    fn replayed(&self, path: &str) -> Option<Result<Vec<PathBuf>, PathResolveError>> {
+        let replayed = self.replayed.as_ref()?;
+        Some(
+            replayed
+                .get(path)
+                .cloned()
+                .ok_or_else(|| PathResolveError::NotRecorded(path.into())),
+        )
+    }
+
+    fn record_resolution(&self, path: &str, resolved: &[PathBuf]) {
+        if let Some(ref recorded) = self.recorded {
+            recorded
+                .lock()
+                .unwrap_or_else(PoisonError::into_inner)
+                .insert(path.into(), resolved.to_vec());
+        }
+    }
+
+    fn read_self_exe(&self) -> Result<PathBuf, PathResolveError> {
+        let exe = match self.replayed(SELF_EXE_LINK) {
+            Some(resolved) => resolved?
+                .pop()
+                .ok_or(PathResolveError::NotRecorded(SELF_EXE_LINK.into()))?,
+            None => fs::read_link(SELF_EXE_LINK)
+                .map_err(|e| PathResolveError::SelfExe { kind: e.kind() })?,
+        };
+        self.record_resolution(SELF_EXE_LINK, std::slice::from_ref(&exe));
+        Ok(exe)
+    }
+
+    #[cfg(test)]
+    pub(crate) fn env<I, K, V>(mut self, vars: I) -> Self
+    where
+        I: IntoIterator<Item = (K, V)>,
+        K: Into<OsString>,
+        V: Into<OsString>,
+    {
+        self.env = Some(
+            vars.into_iter()
+                .map(|(k, v)| (k.into(), v.into()))
+                .collect(),
+        );
+        self
+    }
+
+    /// Adds the variables defined by the resolver, if any.
+    pub(crate) fn set_variables(&self, variables: &mut Variables) -> Result<(), PathResolveError> {
+        if self.expand_env {
+            let vars: Box<dyn Iterator<Item = (OsString, OsString)>> = match &self.env {
+                Some(vars) => Box::new(vars.clone().into_iter()),
+                None => Box::new(env::vars_os()),
+            };
+            for (name, value) in vars {
+                let (Some(name), Ok(value)) = (
+                    name.to_str().and_then(|n| Name::from_str(n).ok()),
+                    value.into_string(),
+                ) else {
+                    continue;
+                };
+                if !variables.contains(&name) {
+                    variables.set(name, value);
+                }
+            }
+        }
+        if !self.expand_self {
+            return Ok(());
+        }
+        let exe = self.read_self_exe()?;
+        // Variables are strings.
+        let to_string = |path: &Path| {
+            path.to_str()
+                .map(String::from)
+                .ok_or(PathResolveError::SelfExe {
+                    kind: ErrorKind::InvalidData,
+                })
+        };
+        let dir = to_string(exe.parent().unwrap_or(Path::new("/")))?;
+        let exe = to_string(&exe)?;
+        for (name, value) in [("SELF_EXE", exe), ("SELF_DIR", dir)] {
+            // These names are valid.
+            variables.set(Name::from_str(name).unwrap(), value);
+        }
+        Ok(())
+    }
+
+    pub fn resolve(&self, path: &str) -> Result<Vec<PathBuf>, PathResolveError> {
+        let resolved = match self.replayed(path) {
+            Some(resolved) => resolved?,
+            None => self.resolve_live(path)?,
+        };
+        self.record_resolution(path, &resolved);
+        Ok(resolved)
+    }
+
+    fn resolve_live(&self, path: &str) -> Result<Vec<PathBuf>, PathResolveError> {
+        let path = self.resolve_home(path)?;
+        let relative = path.is_relative();
+        let path = self.resolve_base_dir(path);
+        let path = self.check_path(path, relative)?;
+        let paths = if self.expand_globs {
+            expand_globs(&path)?
+        } else {
+            vec![path]
+        };
+        if self.case_insensitive {
+            Ok(paths.into_iter().map(|path| fold_case(&path)).collect())
+        } else {
+            Ok(paths)
+        }
+    }
+
+    /// Merges the rules of paths differing only by case, if case-insensitive
+    /// paths are enabled.  The first spelling in lexical order is kept.
+    pub(crate) fn merge_case(
+        &self,
+        rules: BTreeMap<PathBuf, BitFlags<AccessFs>>,
+    ) -> BTreeMap<PathBuf, BitFlags<AccessFs>> {
+        if !self.case_insensitive {
+            return rules;
+        }
+        let mut spellings: BTreeMap<String, PathBuf> = Default::default();
+        let mut merged: BTreeMap<PathBuf, BitFlags<AccessFs>> = Default::default();
+        for (path, access) in rules {
+            let path = match path.to_str() {
+                Some(name) => spellings
+                    .entry(name.to_lowercase())
+                    .or_insert_with(|| path.clone())
+                    .clone(),
+                // Paths that are not valid UTF-8 are kept as is.
+                None => path,
+            };
+            *merged.entry(path).or_default() |= access;
+        }
+        merged
+    }
+
+    /// Replaces each path of `paths` with its spelling kept by
+    /// [`merge_case()`](Self::merge_case) in `merged`, if case-insensitive
+    /// paths are enabled.
+    pub(crate) fn merge_case_paths<'a, I>(
+        &self,
+        paths: BTreeSet<PathBuf>,
+        merged: I,
+    ) -> BTreeSet<PathBuf>
+    where
+        I: IntoIterator<Item = &'a PathBuf>,
+    {
+        if !self.case_insensitive {
+            return paths;
+        }
+        let spellings: BTreeMap<String, &PathBuf> = merged
+            .into_iter()
+            .filter_map(|path| Some((path.to_str()?.to_lowercase(), path)))
+            .collect();
+        paths
+            .into_iter()
+            .map(|path| {
+                match path
+                    .to_str()
+                    .and_then(|name| spellings.get(&name.to_lowercase()))
+                {
+                    Some(spelling) => (*spelling).clone(),
+                    None => path,
+                }
+            })
+            .collect()
+    }
+
+    fn resolve_home(&self, path: &str) -> Result<PathBuf, PathResolveError> {
+        if self.expand_home {
+            if let Some(rest) = path.strip_prefix('~') {
+                if rest.is_empty() || rest.starts_with('/') {
+                    let mut home = match self.home_dir {
+                        Some(ref home) => home.clone(),
+                        None => env::var_os("HOME")
+                            .ok_or(PathResolveError::HomeNotFound)?
+                            .into(),
+                    };
+                    home.push(rest.trim_start_matches('/'));
+                    return Ok(home);
+                }
+            }
+        }
+        Ok(PathBuf::from(path))
+    }
+
+    fn resolve_base_dir(&self, path: PathBuf) -> PathBuf {
+        match self.base_dir {
+            Some(ref base_dir) if path.is_relative() => base_dir.join(path),
+            _ => path,
+        }
+    }
+
+    /// Normalizes `path` if enabled, and checks its size.  `relative` tells
+    /// if `path` was relative to the base directory.
+    fn check_path(&self, path: PathBuf, relative: bool) -> Result<PathBuf, PathResolveError> {
+        let path = if self.normalize {
+            let path = clean(&path);
+            if let Some(base_dir) = self.base_dir.as_ref().filter(|_| relative) {
+                if !path.starts_with(clean(base_dir)) {
+                    return Err(PathResolveError::EscapesBaseDir { path });
+                }
+            }
+            path
+        } else {
+            path
+        };
+        if path.as_os_str().len() > self.max_path_len {
+            return Err(PathResolveError::TooLong {
+                path,
+                max: self.max_path_len,
+            });
+        }
+        if path.components().count() > self.max_path_components {
+            return Err(PathResolveError::TooDeep {
+                path,
+                max: self.max_path_components,
+            });
+        }
+        Ok(path)
+    }
+}
+
+/// Cleans a path lexically, like Go's `filepath.Clean()`.
+fn clean(path: &Path) -> PathBuf {
+    let mut cleaned = PathBuf::new();
+    for component in path.components() {
+        match component {
+            Component::CurDir => {}
+            Component::ParentDir => match cleaned.components().next_back() {
+                Some(Component::Normal(_)) => {
+                    cleaned.pop();
+                }
+                // The parent of the root directory is itself.
+                Some(Component::RootDir) => {}
+                _ => cleaned.push(".."),
+            },
+            component => cleaned.push(component),
+        }
+    }
+    if cleaned.as_os_str().is_empty() {
+        cleaned.push(".");
+    }
+    cleaned
+}
+
+fn eq_case_insensitive(a: &str, b: &str) -> bool {
+    a.to_lowercase() == b.to_lowercase()
+}
+
+/// Returns `path` with each missing component replaced with the first entry of
+/// its parent directory differing only by case, if any.
+fn fold_case(path: &Path) -> PathBuf {
+    if path.symlink_metadata().is_ok() {
+        return path.into();
+    }
+    let mut folded = PathBuf::new();
+    for component in path.components() {
+        let name = match component {
+            Component::Normal(name) => name,
+            _ => {
+                folded.push(component);
+                continue;
+            }
+        };
+        let exact = folded.join(name);
+        if exact.symlink_metadata().is_ok() {
+            folded = exact;
+            continue;
+        }
+        let read_path = if folded.as_os_str().is_empty() {
+            Path::new(".")
+        } else {
+            folded.as_path()
+        };
+        let found = name.to_str().and_then(|name| {
+            let mut entries: Vec<_> = fs::read_dir(read_path)
+                .ok()?
+                .flatten()
+                .map(|entry| entry.file_name())
+                .filter(|entry| entry.to_str().is_some_and(|e| eq_case_insensitive(e, name)))
+                .collect();
+            entries.sort();
+            entries.into_iter().next()
+        });
+        match found {
+            Some(entry) => folded.push(entry),
+            // Nothing matches, the remaining components are kept as is.
+            None => folded = exact,
+        }
+    }
+    folded
+}
+
+fn is_pattern(component: &str) -> bool {
+    component.contains(['*', '?', '['])
+}
+
+fn expand_globs(path: &Path) -> Result<Vec<PathBuf>, PathResolveError> {
+    let mut paths = vec![PathBuf::new()];
+    let components: Vec<_> = path.components().collect();
+    for (i, component) in components.iter().copied().enumerate() {
+        // Only directories can have children.
+        let is_last = i + 1 == components.len();
+        let pattern = match component {
+            Component::Normal(name) => name.to_str().filter(|name| is_pattern(name)),
+            _ => None,
+        };
+        let Some(pattern) = pattern else {
+            for path in &mut paths {
+                path.push(component);
+            }
+            continue;
+        };
+
+        let pattern: Vec<char> = pattern.chars().collect();
+        if !is_valid_pattern(&pattern) {
+            return Err(PathResolveError::InvalidPattern(
+                pattern.into_iter().collect(),
+            ));
+        }
+
+        let mut matches = Vec::new();
+        for dir in &paths {
+            let read_path = if dir.as_os_str().is_empty() {
+                Path::new(".")
+            } else {
+                dir.as_path()
+            };
+            let entries = match fs::read_dir(read_path) {
+                Ok(entries) => entries,
+                Err(e) if matches!(e.kind(), ErrorKind::NotFound | ErrorKind::NotADirectory) => {
+                    continue;
+                }
+                Err(e) => {
+                    return Err(PathResolveError::ReadDir {
+                        path: read_path.into(),
+                        kind: e.kind(),
+                    });
+                }
+            };
+            for entry in entries.flatten() {
+                let file_name = entry.file_name();
+                let Some(name) = file_name.to_str() else {
+                    continue;
+                };
+                if name.starts_with('.') && pattern.first() != Some(&'.') {
+                    continue;
+                }
+                let name: Vec<char> = name.chars().collect();
+                if match_pattern(&pattern, &name) {
+                    let path = dir.join(&file_name);
+                    if is_last || path.is_dir() {
+                        matches.push(path);
+                    }
+                }
+            }
+        }
+        paths = matches;
+    }
+    paths.sort();
+    Ok(paths)
+}
+
+/// Parses a bracket expression, starting after the opening bracket, and
+/// returns whether `c` matches it and the rest of the pattern.
+fn match_class(pattern: &[char], c: Option<char>) -> Option<(bool, &[char])> {
+    let (negate, mut rest) = match pattern.first() {
+        Some('!' | '^') => (true, &pattern[1..]),
+        _ => (false, pattern),
+    };
+    let mut found = false;
+    let mut first = true;
+    loop {
+        match rest {
+            [] => return None,
+            [']', tail @ ..] if !first => return Some((found != negate, tail)),
+            [low, '-', high, tail @ ..] if *high != ']' => {
+                found |= c.is_some_and(|c| *low <= c && c <= *high);
+                rest = tail;
+            }
+            [x, tail @ ..] => {
+                found |= c == Some(*x);
+                rest = tail;
+            }
+        }
+        first = false;
+    }
+}
+
+fn is_valid_pattern(pattern: &[char]) -> bool {
+    let mut rest = pattern;
+    while let Some((c, tail)) = rest.split_first() {
+        rest = if *c == '[' {
+            match match_class(tail, None) {
+                Some((_, tail)) => tail,
+                None => return false,
+            }
+        } else {
+            tail
+        };
+    }
+    true
+}
+
+/// Matches the first element of `pattern`, which is not a star, against `c`,
+/// and returns the rest of the pattern.
+fn match_char(pattern: &[char], c: char) -> Option<&[char]> {
+    match pattern.split_first()? {
+        ('?', rest) => Some(rest),
+        ('[', rest) => match match_class(rest, Some(c))? {
+            (true, rest) => Some(rest),
+            (false, _) => None,
+        },
+        ('*', _) => None,
+        (x, rest) => (*x == c).then_some(rest),
+    }
+}
+
+/// Matches `name` against `pattern` in linear space and O(pattern × name)
+/// time, even for patterns with several stars: on a mismatch, only the last
+/// star is retried with one more character, because the previous ones can
+/// then match anything needed.
+fn match_pattern(pattern: &[char], name: &[char]) -> bool {
+    let (mut rest, mut n) = (pattern, 0);
+    // Pattern after the last star, and the name index it was tried at.
+    let mut star: Option<(&[char], usize)> = None;
+    while n < name.len() {
+        if let Some(('*', tail)) = rest.split_first() {
+            star = Some((tail, n));
+            rest = tail;
+        } else if let Some(tail) = match_char(rest, name[n]) {
+            rest = tail;
+            n += 1;
+        } else if let Some((tail, start)) = star {
+            star = Some((tail, start + 1));
+            rest = tail;
+            n = start + 1;
+        } else {
+            return false;
+        }
+    }
+    rest.iter().all(|c| *c == '*')
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::TempDir;
+
+    /// Creates a directory with files and subdirectories to match.
+    fn glob_dir(name: &str) -> TempDir {
+        let dir = TempDir::new(&format!("resolver-{name}"));
+        let path = dir.path();
+        for file in ["a.txt", "b.txt", "c.log", ".hidden.txt"] {
+            fs::write(path.join(file), "").unwrap();
+        }
+        for dir in ["d1", "d2", "e1"] {
+            fs::create_dir(path.join(dir)).unwrap();
+            fs::write(path.join(dir).join("f"), "").unwrap();
+        }
+        dir
+    }
+
+    fn names(base: &Path, paths: Vec<PathBuf>) -> Vec<String> {
+        paths
+            .into_iter()
+            .map(|p| p.strip_prefix(base).unwrap().to_str().unwrap().to_string())
+            .collect()
+    }
+
+    #[test]
+    fn test_default() {
+        let resolver = PathResolver::default();
+        for path in ["/usr", "relative", "~/foo", "/tmp/*"] {
+            assert_eq!(resolver.resolve(path), Ok(vec![PathBuf::from(path)]));
+        }
+    }
+
+    #[test]
+    fn test_base_dir() {
+        let resolver = PathResolver::new().base_dir("/base");
+        assert_eq!(
+            resolver.resolve("relative/path"),
+            Ok(vec![PathBuf::from("/base/relative/path")])
+        );
+        assert_eq!(resolver.resolve("."), Ok(vec![PathBuf::from("/base/.")]));
+        assert_eq!(resolver.resolve("/usr"), Ok(vec![PathBuf::from("/usr")]));
+    }
+
+    #[test]
+    fn test_normalize() {
+        let resolver = PathResolver::new().base_dir("/base/./dir").normalize(true);
+        for (path, cleaned) in [
+            ("relative//path/", "/base/dir/relative/path"),
+            ("./a/../b/.", "/base/dir/b"),
+            (".", "/base/dir"),
+            ("/usr/./lib/../bin", "/usr/bin"),
+            ("/../..//etc", "/etc"),
+            // Absolute paths cannot escape the base directory.
+            ("/base/..", "/"),
+        ] {
+            assert_eq!(resolver.resolve(path), Ok(vec![PathBuf::from(cleaned)]));
+        }
+        for path in ["..", "a/../../b", "../dir/../../dir2"] {
+            assert!(
+                matches!(
+                    resolver.resolve(path),
+                    Err(PathResolveError::EscapesBaseDir { .. })
+                ),
+                "{path}"
+            );
+        }
+        assert_eq!(
+            PathResolver::new().normalize(true).resolve("a/../../b"),
+            Ok(vec![PathBuf::from("../b")])
+        );
+    }
+
+    #[test]
+    fn test_max_path() {
+        let long = format!("/{}", "a".repeat(DEFAULT_MAX_PATH_LEN));
+        assert_eq!(
+            PathResolver::new().resolve(&long),
+            Err(PathResolveError::TooLong {
+                path: PathBuf::from(&long),
+                max: DEFAULT_MAX_PATH_LEN,
+            })
+        );
+        let deep = "/a".repeat(DEFAULT_MAX_PATH_COMPONENTS);
+        assert_eq!(
+            PathResolver::new().resolve(&deep),
+            Err(PathResolveError::TooDeep {
+                path: PathBuf::from(&deep),
+                max: DEFAULT_MAX_PATH_COMPONENTS,
+            })
+        );
+
+        let resolver = PathResolver::new().max_path_len(8).max_path_components(3);
+        assert!(resolver.resolve("/usr/lib").is_ok());
+        assert!(matches!(
+            resolver.resolve("/usr/lib64"),
+            Err(PathResolveError::TooLong { max: 8, .. })
+        ));
+        assert!(matches!(
+            resolver.resolve("/a/b/c"),
+            Err(PathResolveError::TooDeep { max: 3, .. })
+        ));
+        // Checked once cleaned.
+        assert!(resolver
+            .normalize(true)
+            .resolve("/usr/../usr/./lib")
+            .is_ok());
+    }
+
+    #[test]
+    fn test_expand_home() {
+        let home = PathBuf::from(env::var_os("HOME").expect("HOME is not set"));
+        let resolver = PathResolver::new().expand_home(true);
+        assert_eq!(resolver.resolve("~"), Ok(vec![home.clone()]));
+        assert_eq!(resolver.resolve("~/"), Ok(vec![home.clone()]));
+        assert_eq!(resolver.resolve("~/foo"), Ok(vec![home.join("foo")]));
+        // Other users' home directories are not supported.
+        assert_eq!(resolver.resolve("~foo"), Ok(vec![PathBuf::from("~foo")]));
+        assert_eq!(resolver.resolve("/~"), Ok(vec![PathBuf::from("/~")]));
+
+        // Home expansion happens before the base directory is used.
+        let resolver = resolver.base_dir("/base");
+        assert_eq!(resolver.resolve("~/foo"), Ok(vec![home.join("foo")]));
+    }
+
+    #[test]
+    fn test_home_dir() {
+        let resolver = PathResolver::new().home_dir("/fake/home");
+        // The home directory is only used with home expansion.
+        assert_eq!(resolver.resolve("~/foo"), Ok(vec![PathBuf::from("~/foo")]));
+
+        let resolver = resolver.expand_home(true);
+        assert_eq!(resolver.resolve("~"), Ok(vec![PathBuf::from("/fake/home")]));
+        assert_eq!(
+            resolver.resolve("~/foo"),
+            Ok(vec![PathBuf::from("/fake/home/foo")])
+        );
+    }
+
+    #[test]
+    fn test_expand_globs() {
+        let dir = glob_dir("globs");
+        let resolver = PathResolver::new().expand_globs(true);
+        let resolve = |pattern: &str| {
+            names(
+                dir.path(),
+                resolver
+                    .resolve(dir.path().join(pattern).to_str().unwrap())
+                    .unwrap(),
+            )
+        };
+
+        assert_eq!(resolve("*.txt"), ["a.txt", "b.txt"]);
+        assert_eq!(resolve(".*.txt"), [".hidden.txt"]);
+        assert_eq!(resolve("?.log"), ["c.log"]);
+        assert_eq!(resolve("[ab].txt"), ["a.txt", "b.txt"]);
+        assert_eq!(resolve("[!a].*"), ["b.txt", "c.log"]);
+        assert_eq!(resolve("[a-b].txt"), ["a.txt", "b.txt"]);
+        assert_eq!(resolve("d*/f"), ["d1/f", "d2/f"]);
+        assert_eq!(resolve("*/f"), ["d1/f", "d2/f", "e1/f"]);
+        assert_eq!(resolve("*.txt/f"), Vec::<String>::new());
+        assert_eq!(resolve("nomatch*"), Vec::<String>::new());
+        assert_eq!(resolve("missing/*"), Vec::<String>::new());
+        assert_eq!(resolve("a.txt"), ["a.txt"]);
+    }
+
+    #[test]
+    fn test_expand_globs_base_dir() {
+        let dir = glob_dir("globs-base-dir");
+        let resolver = PathResolver::new().base_dir(dir.path()).expand_globs(true);
+        assert_eq!(
+            names(dir.path(), resolver.resolve("d?").unwrap()),
+            ["d1", "d2"]
+        );
+    }
+
+    #[test]
+    fn test_case_insensitive() {
+        let dir = glob_dir("case-insensitive");
+        fs::create_dir(dir.path().join("Foo")).unwrap();
+        fs::write(dir.path().join("Foo").join("Bar.txt"), "").unwrap();
+        let resolve = |resolver: PathResolver, path: &str| {
+            names(
+                dir.path(),
+                resolver
+                    .resolve(dir.path().join(path).to_str().unwrap())
+                    .unwrap(),
+            )
+        };
+
+        let resolver = PathResolver::new().case_insensitive(true);
+        assert_eq!(resolve(resolver.clone(), "foo/bar.TXT"), ["Foo/Bar.txt"]);
+        assert_eq!(resolve(resolver.clone(), "Foo/Bar.txt"), ["Foo/Bar.txt"]);
+        assert_eq!(resolve(resolver.clone(), "A.TXT"), ["a.txt"]);
+        assert_eq!(resolve(resolver.clone(), "FOO/missing"), ["Foo/missing"]);
+        assert_eq!(resolve(resolver, "missing/bar.txt"), ["missing/bar.txt"]);
+
+        let resolver = PathResolver::new();
+        assert_eq!(resolve(resolver, "foo/bar.TXT"), ["foo/bar.TXT"]);
+    }
+
+    #[test]
+    fn test_merge_case() {
+        let rules: BTreeMap<PathBuf, BitFlags<AccessFs>> = [
+            ("/foo".into(), AccessFs::ReadFile.into()),
+            ("/Foo".into(), AccessFs::WriteFile.into()),
+            ("/bar".into(), AccessFs::Execute.into()),
+        ]
+        .into();
+        assert_eq!(PathResolver::new().merge_case(rules.clone()), rules);
+        assert_eq!(
+            PathResolver::new().case_insensitive(true).merge_case(rules),
+            [
+                ("/Foo".into(), AccessFs::ReadFile | AccessFs::WriteFile),
+                ("/bar".into(), AccessFs::Execute.into()),
+            ]
+            .into()
+        );
+    }
+
+    #[test]
+    fn test_invalid_pattern() {
+        let resolver = PathResolver::new().expand_globs(true);
+        assert_eq!(
+            resolver.resolve("/tmp/[abc"),
+            Err(PathResolveError::InvalidPattern("[abc".into()))
+        );
+        assert_eq!(
+            resolver.resolve("/tmp/[]"),
+            Err(PathResolveError::InvalidPattern("[]".into()))
+        );
+    }
+
+    #[test]
+    fn test_match_pattern() {
+        let matches = |pattern: &str, name: &str| {
+            let pattern: Vec<char> = pattern.chars().collect();
+            let name: Vec<char> = name.chars().collect();
+            match_pattern(&pattern, &name)
+        };
+        assert!(matches("*", ""));
+        assert!(matches("*", "foo"));
+        assert!(matches("f*o", "fo"));
+        assert!(matches("f*o", "foooo"));
+        assert!(!matches("f*o", "foa"));
+        assert!(matches("??", "ab"));
+        assert!(!matches("??", "a"));
+        assert!(matches("[]]", "]"));
+        assert!(matches("[!]]", "a"));
+        assert!(!matches("[!]]", "]"));
+        assert!(matches("[a-]", "-"));
+        assert!(matches("[^a]", "b"));
+        assert!(!matches("[a]", ""));
+        assert!(matches("*a*b", "xaxxb"));
+        assert!(!matches("*a*b", "xaxxa"));
+        assert!(matches("a*[bc]", "aab"));
+        assert!(matches("**", "a"));
+
+        // No exponential backtracking, e.g. with attacker-controlled names.
+        let name = "a".repeat(10_000);
+        assert!(!matches("*a*a*a*a*a*a*a*a*a*b", &name));
+        assert!(matches("*a*a*a*a*a*a*a*a*a*", &name));
+    }
+
+    #[test]
+    fn test_config_resolve_with() {
+        let json = r#"{
+            "variable": [
+                {
+                    "name": "dir",
+                    "literal": [ "bin", "lib" ]
+                }
+            ],
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute" ],
+                    "parent": [ "${dir}", "/etc" ]
+                }
+            ]
+        }"#;
+        let resolver = PathResolver::new().base_dir("/usr");
+        let resolved = crate::tests_helpers::parse_json(json)
+            .unwrap()
+            .resolve_with(&resolver)
+            .unwrap();
+        assert_eq!(
+            resolved.rules_path_beneath.keys().collect::<Vec<_>>(),
+            ["/etc", "/usr/bin", "/usr/lib"].map(Path::new)
+        );
+    }
+
+    #[test]
+    fn test_config_resolve_with_case_insensitive() {
+        let json = r#"{
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute" ],
+                    "parent": [ "/Foo" ]
+                },
+                {
+                    "allowedAccess": [ "read_file" ],
+                    "parent": [ "/foo", "/bar" ]
+                }
+            ]
+        }"#;
+        let config = crate::tests_helpers::parse_json(json).unwrap();
+        let resolve = |resolver: &PathResolver| {
+            config
+                .clone()
+                .resolve_with(resolver)
+                .unwrap()
+                .rules_path_beneath
+        };
+        assert_eq!(resolve(&PathResolver::new()).len(), 3);
+        assert_eq!(
+            resolve(&PathResolver::new().case_insensitive(true)),
+            [
+                (
+                    PathBuf::from("/Foo"),
+                    AccessFs::Execute | AccessFs::ReadFile
+                ),
+                (PathBuf::from("/bar"), AccessFs::ReadFile.into()),
+            ]
+            .into()
+        );
+    }
+
+    #[test]
+    fn test_snapshot_replay() {
+        let dir = glob_dir("snapshot");
+        let json = format!(
+            r#"{{
+                "pathBeneath": [
+                    {{
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "{}/*.txt", "~/data", "${{SELF_DIR}}/share" ]
+                    }}
+                ]
+            }}"#,
+            dir.path().display()
+        );
+        let config = crate::tests_helpers::parse_json(&json).unwrap();
+        let recorder = PathResolver::new()
+            .home_dir("/home/user")
+            .expand_home(true)
+            .expand_globs(true)
+            .expand_self(true)
+            .record(true);
+        assert_eq!(recorder.snapshot(), []);
+        let resolved = config.clone().resolve_with(&recorder.clone()).unwrap();
+        assert_eq!(resolved.rules_path_beneath.len(), 4);
+
+        // Clones record to the same snapshot, which can be serialized.
+        let snapshot = recorder.snapshot();
+        assert_eq!(snapshot.len(), 4);
+        assert_eq!(
+            snapshot
+                .iter()
+                .find(|r| r.path == "~/data")
+                .unwrap()
+                .resolved,
+            [PathBuf::from("/home/user/data")]
+        );
+        let manifest = serde_json::to_string(&snapshot).unwrap();
+        let snapshot: Vec<Resolution> = serde_json::from_str(&manifest).unwrap();
+
+        // Replaying does not depend on the filesystem anymore.
+        drop(dir);
+        let replayer = PathResolver::new().expand_self(true).replay(snapshot);
+        assert_eq!(config.clone().resolve_with(&replayer).unwrap(), resolved);
+
+        assert_eq!(
+            replayer.resolve("/usr"),
+            Err(PathResolveError::NotRecorded("/usr".into()))
+        );
+        // Replaying requires the target of /proc/self/exe.
+        assert_eq!(
+            config
+                .resolve_with(&PathResolver::new().expand_self(true).replay([]))
+                .unwrap_err()
+                .to_string(),
+            "path not recorded in the replayed resolutions: /proc/self/exe"
+        );
+    }
+
+    #[test]
+    fn test_config_resolve_with_expand_self() {
+        let json = r#"{
+            "variable": [
+                {
+                    "name": "SELF_DIR",
+                    "literal": [ "/overridden" ]
+                }
+            ],
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "read_file" ],
+                    "parent": [ "${SELF_DIR}/data", "${SELF_EXE}" ]
+                }
+            ]
+        }"#;
+        let config = crate::tests_helpers::parse_json(json).unwrap();
+        let exe = env::current_exe().unwrap();
+        let resolved = config
+            .clone()
+            .resolve_with(&PathResolver::new().expand_self(true))
+            .unwrap();
+        assert_eq!(
+            resolved.rules_path_beneath.keys().collect::<BTreeSet<_>>(),
+            [exe.parent().unwrap().join("data"), exe.clone()]
+                .iter()
+                .collect()
+        );
+
+        // Disabled by default.
+        let resolved = config.clone().resolve_with(&PathResolver::new());
+        assert_eq!(
+            resolved.unwrap_err().to_string(),
+            "variable 'SELF_EXE' not found"
+        );
+    }
+}
@@ -0,0 +1,359 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::Config;
+use serde_json::Value;
+
+/// JSON schema of the configuration format, as embedded in the library.
+///
+/// This is the exact schema the library parses configurations against, e.g.
+/// for editors or documentation generators to stay in sync with the installed
+/// library.  Its content is only stable for a given [`JSON_SCHEMA_VERSION`]:
+/// new versions may accept more configurations (e.g. new access rights), but
+/// configurations valid with a previous version stay valid.
+pub const JSON_SCHEMA: &str = include_str!("../schema/landlockconfig.json");
+
+/// Version of the embedded [`JSON_SCHEMA`], which is the version of the
+/// library.
+pub const JSON_SCHEMA_VERSION: &str = env!("CARGO_PKG_VERSION");
+
+/// Inserts the `default` annotations of `schema` in `json` for the omitted
+/// properties, recursively.
+fn fill_defaults(root: &Value, schema: &Value, json: &mut Value) {
+    let schema = match schema.get("$ref").and_then(Value::as_str) {
+        // Only local references are used.
+        Some(reference) => reference
+            .strip_prefix('#')
+            .and_then(|pointer| root.pointer(pointer))
+            .unwrap_or(&Value::Null),
+        None => schema,
+    };
+    match json {
+        Value::Object(object) => {
+            let Some(properties) = schema.get("properties").and_then(Value::as_object) else {
+                return;
+            };
+            for (name, property) in properties {
+                match object.get_mut(name) {
+                    Some(value) => fill_defaults(root, property, value),
+                    None => {
+                        if let Some(default) = property.get("default") {
+                            object.insert(name.clone(), default.clone());
+                        }
+                    }
+                }
+            }
+        }
+        Value::Array(items) => {
+            if let Some(schema) = schema.get("items") {
+                for item in items {
+                    fill_defaults(root, schema, item);
+                }
+            }
+        }
+        _ => {}
+    }
+}
+
+impl Config {
+    /// Serializes this configuration to JSON with all the defaults made
+    /// explicit, e.g. for authors to check what an omitted field means.
+    ///
+    /// Handled access rights are always serialized, which shows the ones
+    /// inferred from the rules, and the omitted optional fields are filled
+    /// with the `default` annotations of the embedded [`JSON_SCHEMA`], which
+    /// documents the default of each field.
+    pub fn to_json_with_defaults(&self) -> serde_json::Result<Value> {
+        let mut json = serde_json::to_value(self)?;
+        let schema = serde_json::from_str(JSON_SCHEMA).expect("Invalid embedded JSON schema");
+        fill_defaults(&schema, &schema, &mut json);
+        Ok(json)
+    }
+}
+
+#[cfg(feature = "schema")]
+pub use validate::{SchemaError, StrictSchemaError};
+
+#[cfg(feature = "schema")]
+pub(crate) use validate::{validate, validate_array};
+
+#[cfg(feature = "schema")]
+mod validate {
+    use super::JSON_SCHEMA;
+    use crate::{Config, ConfigFormat};
+    use jsonschema::Validator;
+    use serde_json::Value;
+    use std::sync::OnceLock;
+    use thiserror::Error;
+
+    /// Violation of the JSON schema found in a configuration.
+    #[derive(Debug, Error)]
+    #[error("schema violation at {pointer:?}: {message}")]
+    pub struct SchemaError {
+        pointer: String,
+        keyword: String,
+        message: String,
+    }
+
+    impl SchemaError {
+        /// Returns the JSON pointer (RFC 6901) of the invalid value, e.g.
+        /// `/pathBeneath/0/parent`, or an empty string for the whole document.
+        pub fn pointer(&self) -> &str {
+            &self.pointer
+        }
+
+        /// Returns the schema keyword which failed, e.g. `type`, `enum`, or
+        /// `additionalProperties`.
+        pub fn keyword(&self) -> &str {
+            &self.keyword
+        }
+
+        pub fn message(&self) -> &str {
+            &self.message
+        }
+    }
+
+    fn format_violations(violations: &[SchemaError]) -> String {
+        violations
+            .iter()
+            .map(ToString::to_string)
+            .collect::<Vec<_>>()
+            .join("\n")
+    }
+
+    #[derive(Debug, Error)]
+    #[non_exhaustive]
+    pub enum StrictSchemaError {
+        #[error(transparent)]
+        SerdeJson(#[from] serde_json::Error),
+        #[cfg(feature = "toml")]
+        #[error(transparent)]
+        SerdeToml(#[from] toml::de::Error),
+        /// All the violations, sorted by JSON pointer.
+        #[error("{} schema violation(s):\n{}", .0.len(), format_violations(.0))]
+        Violations(Vec<SchemaError>),
+    }
+
+    fn new_validator(schema: &Value) -> Validator {
+        jsonschema::draft202012::new(schema).expect("Invalid embedded JSON schema")
+    }
+
+    fn validator() -> &'static Validator {
+        static VALIDATOR: OnceLock<Validator> = OnceLock::new();
+        VALIDATOR.get_or_init(|| {
+            new_validator(&serde_json::from_str(JSON_SCHEMA).expect("Invalid embedded JSON schema"))
+        })
+    }
+
+    /// Converts a JSON property name to its TOML equivalent, e.g.
+    /// `handledAccessFs` to `handled_access_fs`.
+    #[cfg(feature = "toml")]
+    fn snake_case(name: &str) -> String {
+        let mut snake = String::with_capacity(name.len() + 2);
+        for c in name.chars() {
+            if c.is_ascii_uppercase() {
+                snake.push('_');
+            }
+            snake.push(c.to_ascii_lowercase());
+        }
+        snake
+    }
+
+    /// Renames the properties (and the required ones) of `schema` to their TOML
+    /// names, recursively.
+    #[cfg(feature = "toml")]
+    fn toml_schema(schema: &mut Value) {
+        let Some(object) = schema.as_object_mut() else {
+            if let Some(items) = schema.as_array_mut() {
+                items.iter_mut().for_each(toml_schema);
+            }
+            return;
+        };
+        for (keyword, value) in object.iter_mut() {
+            match (keyword.as_str(), value) {
+                ("properties", Value::Object(properties)) => {
+                    *properties = std::mem::take(properties)
+                        .into_iter()
+                        .map(|(name, mut property)| {
+                            toml_schema(&mut property);
+                            (snake_case(&name), property)
+                        })
+                        .collect();
+                }
+                ("required", Value::Array(names)) => {
+                    for name in names.iter_mut() {
+                        if let Value::String(name) = name {
+                            *name = snake_case(name);
+                        }
+                    }
+                }
+                // Annotations and values are not schemas.
+                ("default" | "enum" | "const" | "description", _) => {}
+                (_, value) => toml_schema(value),
+            }
+        }
+    }
+
+    /// Validator of the TOML configurations, deserialized as JSON values.
+    #[cfg(feature = "toml")]
+    fn toml_validator() -> &'static Validator {
+        static VALIDATOR: OnceLock<Validator> = OnceLock::new();
+        VALIDATOR.get_or_init(|| {
+            let mut schema =
+                serde_json::from_str(JSON_SCHEMA).expect("Invalid embedded JSON schema");
+            toml_schema(&mut schema);
+            new_validator(&schema)
+        })
+    }
+
+    /// Returns the last segment of a schema location, which is the failed
+    /// keyword.
+    fn keyword(schema_path: &str) -> String {
+        schema_path.rsplit('/').next().unwrap_or_default().into()
+    }
+
+    pub(crate) fn validate(json: &Value) -> Result<(), SchemaError> {
+        validator().validate(json).map_err(|e| SchemaError {
+            pointer: e.instance_path.to_string(),
+            keyword: keyword(&e.schema_path.to_string()),
+            message: e.to_string(),
+        })
+    }
+
+    /// Validates each configuration of a JSON array.
+    pub(crate) fn validate_array(json: &Value) -> Result<(), SchemaError> {
+        let Some(items) = json.as_array() else {
+            return Err(SchemaError {
+                pointer: String::new(),
+                keyword: "type".into(),
+                message: "expected an array of configurations".into(),
+            });
+        };
+        for (index, item) in items.iter().enumerate() {
+            validate(item).map_err(|e| SchemaError {
+                pointer: format!("/{index}{}", e.pointer),
+                ..e
+            })?;
+        }
+        Ok(())
+    }
+
+    fn validate_all(validator: &Validator, json: &Value) -> Result<(), StrictSchemaError> {
+        let mut violations: Vec<_> = validator
+            .iter_errors(json)
+            .map(|e| SchemaError {
+                pointer: e.instance_path.to_string(),
+                keyword: keyword(&e.schema_path.to_string()),
+                message: e.to_string(),
+            })
+            .collect();
+        if violations.is_empty() {
+            return Ok(());
+        }
+        // The sort is stable, which keeps the schema order for the same value.
+        violations.sort_by(|a, b| a.pointer.cmp(&b.pointer));
+        Err(StrictSchemaError::Violations(violations))
+    }
+
+    impl Config {
+        /// Validates a configuration against the embedded
+        /// [`JSON_SCHEMA`](crate::JSON_SCHEMA) with the full semantic of JSON
+        /// Schema draft 2020-12, which is the draft of the schema, and reports
+        /// every violation with the JSON pointer of the invalid value and the
+        /// failed keyword, e.g. for authoring tools.
+        ///
+        /// Unlike [`ParseOptions::validate_schema()`](crate::ParseOptions::validate_schema),
+        /// which stops at the first violation, this only validates and does not
+        /// parse the configuration.  TOML configurations are validated as
+        /// their JSON data model, against the schema with the TOML names of the
+        /// properties (e.g. `handled_access_fs`), which are then the ones of
+        /// the pointers (e.g. `/path_beneath/0/allowed_access`).
+        pub fn validate_schema_strict(
+            data: &str,
+            format: ConfigFormat,
+        ) -> Result<(), StrictSchemaError> {
+            match format {
+                ConfigFormat::Json => validate_all(validator(), &serde_json::from_str(data)?),
+                #[cfg(feature = "toml")]
+                ConfigFormat::Toml => validate_all(toml_validator(), &toml::from_str(data)?),
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use std::path::Path;
+
+    #[test]
+    fn test_json_schema() {
+        let path = Path::new(env!("CARGO_MANIFEST_DIR")).join("schema/landlockconfig.json");
+        assert_eq!(JSON_SCHEMA, fs::read_to_string(path).unwrap());
+
+        let schema = serde_json::from_str(JSON_SCHEMA).unwrap();
+        assert!(jsonschema::meta::is_valid(&schema));
+    }
+
+    #[test]
+    fn test_to_json_with_defaults() {
+        let config = crate::tests_helpers::parse_json(
+            r#"{
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+        let json = config.to_json_with_defaults().unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "read_file" ],
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "allowNone": false
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr" ],
+                        "mountPoint": false,
+                        "required": false
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ],
+                        "required": false
+                    }
+                ]
+            })
+        );
+
+        // The documented defaults are the ones of the parser.
+        assert_eq!(
+            crate::tests_helpers::parse_json(&json.to_string()),
+            Ok(config)
+        );
+    }
+
+    #[test]
+    fn test_json_schema_version() {
+        let version: Vec<&str> = JSON_SCHEMA_VERSION.split('.').collect();
+        assert_eq!(version.len(), 3, "{JSON_SCHEMA_VERSION}");
+        assert!(version.iter().all(|n| n.parse::<u32>().is_ok()));
+    }
+}
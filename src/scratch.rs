@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::ResolvedConfig;
+use landlock::AccessFs;
+use std::ffi::OsString;
+use std::io;
+use std::os::unix::ffi::OsStringExt;
+use std::path::PathBuf;
+
+/// Creates a new directory only accessible by the current user, with a unique
+/// name in `dir`.
+fn make_temp_dir(dir: PathBuf) -> io::Result<PathBuf> {
+    let mut template = dir
+        .join("landlockconfig-scratch-XXXXXX")
+        .into_os_string()
+        .into_vec();
+    if template.contains(&0) {
+        return Err(io::Error::from(io::ErrorKind::InvalidInput));
+    }
+    template.push(0);
+    // mkdtemp(3) creates the directory with the 0700 mode.
+    if unsafe { libc::mkdtemp(template.as_mut_ptr().cast()) }.is_null() {
+        return Err(io::Error::last_os_error());
+    }
+    template.pop();
+    Ok(OsString::from_vec(template).into())
+}
+
+impl ResolvedConfig {
+    /// Creates a private scratch directory, and returns a copy of this
+    /// configuration allowing all its handled filesystem access rights beneath
+    /// it except `execute` (to keep W^X), with its path, e.g. to give a
+    /// sandboxed application a workspace that is always writable.
+    ///
+    /// The directory is created in [`std::env::temp_dir()`], only accessible
+    /// by the current user, before the configuration is enforced.  It is not
+    /// removed automatically: removing it (e.g. with
+    /// [`std::fs::remove_dir_all()`]) when it is no longer used is the
+    /// caller's responsibility.  This configuration is not modified.
+    pub fn with_scratch_dir(&self) -> io::Result<(Self, PathBuf)> {
+        let dir = make_temp_dir(std::env::temp_dir())?;
+        let mut config = self.clone();
+        let access = config.handled_fs & !AccessFs::Execute;
+        // Rules without access rights are ignored.
+        if !access.is_empty() {
+            *config.rules_path_beneath.entry(dir.clone()).or_default() |= access;
+        }
+        Ok((config, dir))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{parse_json, restricted_thread};
+    use std::fs;
+    use std::os::unix::fs::PermissionsExt;
+
+    #[test]
+    fn test_with_scratch_dir() {
+        let config = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "write_file", "make_dir", "make_reg" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "read_file", "read_dir" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap();
+
+        let (scratch, dir) = config.with_scratch_dir().unwrap();
+        assert!(dir.starts_with(std::env::temp_dir()));
+        assert_eq!(
+            fs::metadata(&dir).unwrap().permissions().mode() & 0o777,
+            0o700
+        );
+        assert_eq!(
+            scratch.rules_path_beneath[&dir],
+            config.handled_fs & !AccessFs::Execute
+        );
+        // The original configuration is not modified.
+        assert!(!config.rules_path_beneath.contains_key(&dir));
+
+        let file = dir.join("file");
+        restricted_thread(scratch, move || {
+            fs::write(&file, "scratch").unwrap();
+            fs::create_dir(file.with_file_name("subdir")).unwrap();
+            assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+            assert!(probe_denied(std::env::temp_dir(), AccessFs::ReadDir).unwrap());
+        });
+        fs::remove_dir_all(&dir).unwrap();
+
+        // Each directory is new.
+        let (_, other) = config.with_scratch_dir().unwrap();
+        assert_ne!(other, dir);
+        fs::remove_dir(&other).unwrap();
+    }
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, RuleError};
+use crate::kernel;
+use crate::ResolvedConfig;
+use std::fs;
+use std::io;
+use std::os::unix::fs::MetadataExt;
+use std::os::unix::io::{AsFd, OwnedFd};
+use std::path::PathBuf;
+
+/// Ruleset built once, which can then be enforced many times, e.g. on a hot
+/// fork/exec path.
+///
+/// Sealing opens all the rule paths, which pins the resolved inodes: renaming
+/// or replacing a rule path afterwards does not change what the sealed
+/// ruleset allows.  The access rights are already masked to the ones
+/// supported by the running kernel, and a sealed ruleset cannot be modified.
+/// Long-running services can instead track the rule paths with
+/// [`ResolvedConfig::seal_tracked()`], and rebuild the ruleset when they are
+/// replaced with [`SealedConfig::refresh()`].
+#[derive(Debug)]
+pub struct SealedConfig {
+    // None if Landlock is not supported by the running kernel.
+    fd: Option<OwnedFd>,
+    // Only set for a tracked sealed configuration.
+    tracked: Option<Tracked>,
+}
+
+#[derive(Debug)]
+struct Tracked {
+    config: ResolvedConfig,
+    inodes: Vec<(PathBuf, Option<Inode>)>,
+}
+
+/// Device and inode numbers of a file.
+pub type Inode = (u64, u64);
+
+/// Rule path whose inode changed since it was sealed, see
+/// [`SealedConfig::refresh()`].
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct InodeChange {
+    pub path: PathBuf,
+    /// Sealed inode, or `None` if the path did not exist.
+    pub previous: Option<Inode>,
+    /// Current inode, or `None` if the path does not exist anymore.
+    pub current: Option<Inode>,
+}
+
+fn stat_inodes(config: &ResolvedConfig) -> Vec<(PathBuf, Option<Inode>)> {
+    config
+        .planned_opens()
+        .into_iter()
+        .map(|open| {
+            let inode = fs::metadata(&open.path)
+                .ok()
+                .map(|metadata| (metadata.dev(), metadata.ino()));
+            (open.path, inode)
+        })
+        .collect()
+}
+
+impl ResolvedConfig {
+    /// Builds the ruleset like [`build_ruleset()`](ResolvedConfig::build_ruleset),
+    /// to then enforce it with [`SealedConfig::restrict_self()`].
+    pub fn seal(&self) -> Result<(SealedConfig, Vec<RuleError>), BuildRulesetError> {
+        let (ruleset, rule_errors) = self.build_ruleset()?;
+        Ok((
+            SealedConfig {
+                fd: ruleset.into(),
+                tracked: None,
+            },
+            rule_errors,
+        ))
+    }
+
+    /// Seals this configuration like [`seal()`](ResolvedConfig::seal), and
+    /// also records the inodes of the rule paths, to then detect their
+    /// replacement (e.g. by a package update) with
+    /// [`SealedConfig::refresh()`].
+    ///
+    /// The inodes are recorded after building the ruleset, so a path replaced
+    /// in between is only detected by the following refresh.
+    pub fn seal_tracked(&self) -> Result<(SealedConfig, Vec<RuleError>), BuildRulesetError> {
+        let (mut sealed, rule_errors) = self.seal()?;
+        sealed.tracked = Some(Tracked {
+            config: self.clone(),
+            inodes: stat_inodes(self),
+        });
+        Ok((sealed, rule_errors))
+    }
+}
+
+impl SealedConfig {
+    /// Enforces the sealed ruleset on the calling thread, and sets
+    /// no_new_privs.  Returns `false` if Landlock is not supported by the
+    /// running kernel, in which case nothing is enforced.
+    ///
+    /// This only makes two syscalls, without memory allocation, which makes it
+    /// usable after fork(2).  Like
+    /// [`ResolvedConfig::restrict_self()`], each call adds a new layer.
+    pub fn restrict_self(&self) -> io::Result<bool> {
+        let Some(fd) = &self.fd else {
+            return Ok(false);
+        };
+        kernel::restrict_self(fd.as_fd(), 0)?;
+        Ok(true)
+    }
+
+    /// Compares the inodes of the rule paths with the sealed ones, and
+    /// rebuilds the ruleset if any of them changed, calling `on_change` for
+    /// each changed path beforehand.  Returns the rule errors of the rebuilt
+    /// ruleset, which are empty if nothing changed.
+    ///
+    /// This is a no-op for a configuration not sealed with
+    /// [`ResolvedConfig::seal_tracked()`].  Callers should refresh
+    /// periodically (e.g. every few minutes), which only makes one stat(2)
+    /// per rule path when nothing changed.  The whole ruleset is rebuilt,
+    /// because a sealed ruleset cannot be modified.  This only affects the
+    /// next calls to [`restrict_self()`](SealedConfig::restrict_self): the
+    /// Landlock domains already enforced cannot be changed.  If the rebuild
+    /// fails, the previous ruleset is kept, and the changes are reported again
+    /// by the next refresh.
+    pub fn refresh<F>(&mut self, mut on_change: F) -> Result<Vec<RuleError>, BuildRulesetError>
+    where
+        F: FnMut(&InodeChange),
+    {
+        let Some(tracked) = &mut self.tracked else {
+            return Ok(Vec::new());
+        };
+        let inodes = stat_inodes(&tracked.config);
+        let changes: Vec<_> = tracked
+            .inodes
+            .iter()
+            .zip(&inodes)
+            .filter(|((_, previous), (_, current))| previous != current)
+            .map(|((_, previous), (path, current))| InodeChange {
+                path: path.clone(),
+                previous: *previous,
+                current: *current,
+            })
+            .collect();
+        if changes.is_empty() {
+            return Ok(Vec::new());
+        }
+        changes.iter().for_each(&mut on_change);
+        let (ruleset, rule_errors) = tracked.config.build_ruleset()?;
+        self.fd = ruleset.into();
+        tracked.inodes = inodes;
+        Ok(rule_errors)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::probe_denied;
+    use crate::tests_helpers::{parse_json, TempDir};
+    use landlock::AccessFs;
+    use std::path::Path;
+    use std::thread;
+
+    const JSON: &str = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "read_file", "read_dir" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file", "read_dir" ],
+                "parent": [ "/usr", "/tmp", "/dev", "/proc" ]
+            }
+        ]
+    }"#;
+
+    fn resolved() -> ResolvedConfig {
+        parse_json(JSON).unwrap().resolve().unwrap()
+    }
+
+    #[test]
+    fn test_sealed_restrict_self() {
+        let (sealed, rule_errors) = resolved().seal().unwrap();
+        assert!(rule_errors.is_empty());
+        for _ in 0..2 {
+            thread::scope(|s| {
+                s.spawn(|| {
+                    if !sealed.restrict_self().unwrap() {
+                        eprintln!("Landlock is not supported by the running kernel");
+                        return;
+                    }
+                    assert!(probe_denied("/etc/passwd", AccessFs::ReadFile).unwrap());
+                    assert!(!probe_denied("/usr", AccessFs::ReadDir).unwrap());
+                    // Another layer.
+                    assert!(sealed.restrict_self().unwrap());
+                });
+            });
+        }
+    }
+
+    #[test]
+    fn test_sealed_refresh() {
+        let dir = TempDir::new("seal-refresh");
+        let file = dir.path().join("file");
+        fs::write(&file, "old").unwrap();
+        let config = parse_json(&format!(
+            r#"{{ "pathBeneath": [ {{ "allowedAccess": [ "read_file" ], "parent": [ "{}", "/nonexistent/landlockconfig" ] }} ] }}"#,
+            file.display()
+        ))
+        .unwrap()
+        .resolve()
+        .unwrap();
+        let inode = |path: &Path| {
+            let metadata = fs::metadata(path).unwrap();
+            (metadata.dev(), metadata.ino())
+        };
+
+        // Untracked sealed configurations are not refreshed.
+        let (mut sealed, _) = config.seal().unwrap();
+        let (mut tracked, _) = config.seal_tracked().unwrap();
+        let mut changes = Vec::new();
+        assert!(tracked
+            .refresh(|change| changes.push(change.clone()))
+            .unwrap()
+            .is_empty());
+        assert!(changes.is_empty());
+
+        // Replaces the file with a new inode, e.g. like a package update.
+        let previous = inode(&file);
+        let new = dir.path().join("new");
+        fs::write(&new, "new").unwrap();
+        fs::rename(&new, &file).unwrap();
+        assert_ne!(inode(&file), previous);
+
+        sealed.refresh(|_| panic!("unexpected change")).unwrap();
+        tracked
+            .refresh(|change| changes.push(change.clone()))
+            .unwrap();
+        assert_eq!(
+            changes,
+            [InodeChange {
+                path: file.clone(),
+                previous: Some(previous),
+                current: Some(inode(&file)),
+            }]
+        );
+
+        // The new inode is now sealed.
+        changes.clear();
+        tracked
+            .refresh(|change| changes.push(change.clone()))
+            .unwrap();
+        assert!(changes.is_empty());
+
+        fs::remove_file(&file).unwrap();
+        tracked
+            .refresh(|change| changes.push(change.clone()))
+            .unwrap();
+        assert_eq!(changes.len(), 1);
+        assert_eq!(changes[0].current, None);
+    }
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use thiserror::Error;
+
+pub(crate) const SERVICES_PATH: &str = "/etc/services";
+
+#[derive(Debug, Error)]
+pub enum ServiceError {
+    #[error("failed to read the services database: {0}")]
+    Io(#[from] std::io::Error),
+    #[error("unknown TCP service name: {0}")]
+    NotFound(String),
+}
+
+/// TCP services database, see services(5).
+#[derive(Debug, Default)]
+pub(crate) struct Services(BTreeMap<String, u16>);
+
+impl Services {
+    pub(crate) fn load_from<P>(path: P) -> Result<Self, ServiceError>
+    where
+        P: AsRef<Path>,
+    {
+        Ok(Self::parse(&fs::read_to_string(path)?))
+    }
+
+    fn parse(data: &str) -> Self {
+        let mut services = BTreeMap::new();
+        for line in data.lines() {
+            let line = line.split('#').next().unwrap_or_default();
+            let mut fields = line.split_whitespace();
+            let (Some(name), Some(port_proto)) = (fields.next(), fields.next()) else {
+                continue;
+            };
+            let Some((port, "tcp")) = port_proto.split_once('/') else {
+                continue;
+            };
+            let Ok(port) = port.parse::<u16>() else {
+                continue;
+            };
+            // The first entry wins, like getservbyname(3).
+            for name in std::iter::once(name).chain(fields) {
+                services.entry(name.to_string()).or_insert(port);
+            }
+        }
+        Self(services)
+    }
+
+    pub(crate) fn tcp_port(&self, name: &str) -> Result<u16, ServiceError> {
+        self.0
+            .get(name)
+            .copied()
+            .ok_or_else(|| ServiceError::NotFound(name.to_string()))
+    }
+}
+
+/// Services database only read when a service name is looked up.
+#[derive(Debug)]
+pub(crate) struct LazyServices {
+    path: PathBuf,
+    services: Option<Services>,
+}
+
+impl LazyServices {
+    pub(crate) fn new(path: Option<&Path>) -> Self {
+        Self {
+            path: path.unwrap_or(SERVICES_PATH.as_ref()).into(),
+            services: None,
+        }
+    }
+
+    pub(crate) fn tcp_port(&mut self, name: &str) -> Result<u16, ServiceError> {
+        let services = match self.services {
+            Some(ref services) => services,
+            None => self.services.insert(Services::load_from(&self.path)?),
+        };
+        services.tcp_port(name)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const DATA: &str = "
+# Comment
+tcpmux		1/tcp				# TCP port service multiplexer
+http		80/tcp		www		# WorldWideWeb HTTP
+https		443/tcp
+https		443/udp
+domain		53/udp
+other		8080/tcp	http
+broken		foo/tcp
+";
+
+    #[test]
+    fn test_parse_name() {
+        let services = Services::parse(DATA);
+        assert_eq!(services.tcp_port("tcpmux").unwrap(), 1);
+        assert_eq!(services.tcp_port("http").unwrap(), 80);
+        assert_eq!(services.tcp_port("https").unwrap(), 443);
+    }
+
+    #[test]
+    fn test_parse_alias() {
+        let services = Services::parse(DATA);
+        assert_eq!(services.tcp_port("www").unwrap(), 80);
+    }
+
+    #[test]
+    fn test_parse_first_wins() {
+        let services = Services::parse(DATA);
+        assert_eq!(services.tcp_port("other").unwrap(), 8080);
+        assert_eq!(services.tcp_port("http").unwrap(), 80);
+    }
+
+    #[test]
+    fn test_parse_unknown() {
+        let services = Services::parse(DATA);
+        assert!(matches!(
+            services.tcp_port("domain"),
+            Err(ServiceError::NotFound(name)) if name == "domain"
+        ));
+        assert!(services.tcp_port("broken").is_err());
+        assert!(services.tcp_port("Comment").is_err());
+    }
+}
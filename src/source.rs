@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigFormat, ParseFileError, ParseOptions};
+use crate::Config;
+use std::fs;
+use std::path::Path;
+
+/// Parsed configuration with the format it was parsed from, and optionally its
+/// original data, e.g. for tools re-saving a configuration in its author's
+/// format.
+///
+/// The source is kept out of [`Config`], which only describes a policy: the
+/// same policy parsed from JSON and TOML is the same `Config`.
+#[derive(Clone, Debug)]
+pub struct ParsedConfig {
+    config: Config,
+    format: ConfigFormat,
+    raw_source: Option<Vec<u8>>,
+}
+
+impl ParsedConfig {
+    /// Parses `data` with the specified format.  `data` is only kept if
+    /// [`ParseOptions::retain_source()`] is enabled.
+    pub fn parse(
+        data: Vec<u8>,
+        format: ConfigFormat,
+        options: &ParseOptions,
+    ) -> Result<Self, ParseFileError> {
+        let config = match format {
+            ConfigFormat::Json => Config::parse_json_with(data.as_slice(), options)?,
+            #[cfg(feature = "toml")]
+            ConfigFormat::Toml => Config::parse_toml_with(
+                std::str::from_utf8(&data)
+                    .map_err(|e| std::io::Error::new(std::io::ErrorKind::InvalidData, e))?,
+                options,
+            )?,
+        };
+        Ok(Self {
+            config,
+            format,
+            raw_source: options.retain_source.then_some(data),
+        })
+    }
+
+    /// Reads and parses a configuration file like [`Config::parse_file()`].
+    pub fn parse_file<T>(
+        path: T,
+        format: ConfigFormat,
+        options: &ParseOptions,
+    ) -> Result<Self, ParseFileError>
+    where
+        T: AsRef<Path>,
+    {
+        Self::parse(fs::read(path)?, format, options)
+    }
+
+    pub fn config(&self) -> &Config {
+        &self.config
+    }
+
+    pub fn into_config(self) -> Config {
+        self.config
+    }
+
+    pub fn source_format(&self) -> ConfigFormat {
+        self.format
+    }
+
+    /// Returns the original data, if [`ParseOptions::retain_source()`] was
+    /// enabled, e.g. to re-emit it as is if the configuration is unchanged.
+    pub fn raw_source(&self) -> Option<&[u8]> {
+        self.raw_source.as_deref()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    #[cfg(feature = "toml")]
+    use crate::tests_helpers::TempDir;
+
+    const JSON: &str = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+
+    #[test]
+    fn test_parse_json() {
+        let parsed =
+            ParsedConfig::parse(JSON.into(), ConfigFormat::Json, &ParseOptions::new()).unwrap();
+        assert_eq!(parsed.source_format(), ConfigFormat::Json);
+        // Not retained by default.
+        assert_eq!(parsed.raw_source(), None);
+        assert_eq!(
+            parsed.into_config(),
+            Config::parse_json(JSON.as_bytes()).unwrap()
+        );
+
+        let options = ParseOptions::new().retain_source(true);
+        let parsed = ParsedConfig::parse(JSON.into(), ConfigFormat::Json, &options).unwrap();
+        assert_eq!(parsed.raw_source(), Some(JSON.as_bytes()));
+
+        assert!(matches!(
+            ParsedConfig::parse(b"{".to_vec(), ConfigFormat::Json, &options),
+            Err(ParseFileError::ParseJson(_))
+        ));
+    }
+
+    #[cfg(feature = "toml")]
+    #[test]
+    fn test_parse_file_toml() {
+        const TOML: &str = r#"
+            [[path_beneath]]
+            allowed_access = [ "read_file" ]
+            parent = [ "/usr" ]
+        "#;
+        let dir = TempDir::new("source-toml");
+        let path = dir.path().join("policy.toml");
+        fs::write(&path, TOML).unwrap();
+        let options = ParseOptions::new().retain_source(true);
+        let parsed = ParsedConfig::parse_file(&path, ConfigFormat::Toml, &options).unwrap();
+        assert_eq!(parsed.source_format(), ConfigFormat::Toml);
+        assert_eq!(parsed.raw_source(), Some(TOML.as_bytes()));
+        // Same policy as the JSON one.
+        assert_eq!(
+            parsed.config(),
+            &Config::parse_json(JSON.as_bytes()).unwrap()
+        );
+    }
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, RuleError};
+use crate::kernel;
+use crate::names::access_name;
+use crate::parser::{JsonFsAccessItem, JsonNetAccessItem, JsonScopeItem};
+use crate::ResolvedConfig;
+use landlock::{Access, AccessFs, AccessNet, BitFlags, RestrictionStatus, Scope, ABI};
+use std::fmt;
+use thiserror::Error;
+
+/// Feature of a configuration not supported by a Landlock ABI version, see
+/// [`ResolvedConfig::check_full_support()`].
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum UnsupportedFeature {
+    FsAccess(AccessFs),
+    NetAccess(AccessNet),
+    Scope(Scope),
+}
+
+impl fmt::Display for UnsupportedFeature {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let (kind, name) = match *self {
+            Self::FsAccess(access) => (
+                "filesystem access right",
+                access_name::<_, JsonFsAccessItem>(access),
+            ),
+            Self::NetAccess(access) => (
+                "network access right",
+                access_name::<_, JsonNetAccessItem>(access),
+            ),
+            Self::Scope(scope) => ("scope", access_name::<_, JsonScopeItem>(scope)),
+        };
+        match name {
+            Some(name) => write!(f, "{kind} {name}"),
+            None => write!(f, "{kind} {self:?}"),
+        }
+    }
+}
+
+fn features_list(features: &[UnsupportedFeature]) -> String {
+    features
+        .iter()
+        .map(ToString::to_string)
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum FullSupportError {
+    #[error(transparent)]
+    Build(#[from] BuildRulesetError),
+    /// The configuration uses features not supported by the running kernel,
+    /// and nothing is enforced.
+    #[error("not supported by the running kernel: {}", features_list(.0))]
+    Unsupported(Vec<UnsupportedFeature>),
+}
+
+impl ResolvedConfig {
+    /// Checks that `abi` supports all the handled access rights and scopes of
+    /// this configuration, or lists the unsupported ones, which are all of
+    /// them with [`ABI::Unsupported`].  They are sorted by kind (filesystem,
+    /// network, and then scopes), and then in bit order.
+    ///
+    /// Rules can only allow handled access rights, so they are covered too.
+    pub fn check_full_support(&self, abi: ABI) -> Result<(), FullSupportError> {
+        fn unsupported<A>(handled: BitFlags<A>, abi: ABI) -> impl Iterator<Item = A>
+        where
+            A: Access,
+        {
+            (handled & !A::from_all(abi)).iter()
+        }
+
+        let features: Vec<_> = unsupported(self.handled_fs, abi)
+            .map(UnsupportedFeature::FsAccess)
+            .chain(unsupported(self.handled_net, abi).map(UnsupportedFeature::NetAccess))
+            .chain(unsupported(self.scoped, abi).map(UnsupportedFeature::Scope))
+            .collect();
+        if features.is_empty() {
+            Ok(())
+        } else {
+            Err(FullSupportError::Unsupported(features))
+        }
+    }
+
+    /// Enforces this configuration like
+    /// [`restrict_self()`](ResolvedConfig::restrict_self), but only if the
+    /// running kernel supports all its features, e.g. for high-assurance
+    /// deployments which must refuse to start rather than run degraded.
+    ///
+    /// This replaces the best-effort default, which silently ignores the
+    /// access rights and scopes not supported by the running kernel (and then
+    /// reports the ruleset as partially enforced): the two are mutually
+    /// exclusive.  If a feature is not supported, nothing is enforced and
+    /// [`FullSupportError::Unsupported`] lists all the unsupported features
+    /// (see [`check_full_support()`](ResolvedConfig::check_full_support)).
+    /// Rule errors (e.g. a missing path) are still returned as such.
+    pub fn restrict_self_full_support(
+        &self,
+    ) -> Result<(RestrictionStatus, Vec<RuleError>), FullSupportError> {
+        self.check_full_support(kernel::abi_version().into())?;
+        Ok(self.restrict_self()?)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::{dedicated_thread, parse_json};
+    use landlock::RulesetStatus;
+
+    fn resolved() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "execute", "refer", "truncate" ],
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute", "refer" ],
+                        "parent": [ "/usr" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    fn unsupported(abi: ABI) -> Vec<UnsupportedFeature> {
+        match resolved().check_full_support(abi) {
+            Ok(()) => Vec::new(),
+            Err(FullSupportError::Unsupported(features)) => features,
+            Err(e) => panic!("unexpected error: {e}"),
+        }
+    }
+
+    #[test]
+    fn test_check_full_support() {
+        assert_eq!(
+            unsupported(ABI::V1),
+            [
+                UnsupportedFeature::FsAccess(AccessFs::Refer),
+                UnsupportedFeature::FsAccess(AccessFs::Truncate),
+                UnsupportedFeature::NetAccess(AccessNet::ConnectTcp),
+                UnsupportedFeature::Scope(Scope::Signal),
+            ]
+        );
+        assert_eq!(
+            unsupported(ABI::V4),
+            [UnsupportedFeature::Scope(Scope::Signal)]
+        );
+        assert!(unsupported(ABI::V6).is_empty());
+        assert_eq!(unsupported(ABI::Unsupported).len(), 5);
+    }
+
+    #[test]
+    fn test_full_support_error_display() {
+        assert_eq!(
+            FullSupportError::Unsupported(unsupported(ABI::V3)).to_string(),
+            "not supported by the running kernel: network access right connect_tcp, \
+             scope signal"
+        );
+    }
+
+    #[test]
+    fn test_restrict_self_full_support() {
+        let config = resolved();
+        let kernel_abi = kernel::abi_version().into();
+        dedicated_thread(move || match config.restrict_self_full_support() {
+            Ok((status, _)) => {
+                assert!(config.check_full_support(kernel_abi).is_ok());
+                // Never silently degraded.
+                assert_ne!(status.ruleset, RulesetStatus::PartiallyEnforced);
+            }
+            Err(FullSupportError::Unsupported(features)) => {
+                assert!(!features.is_empty());
+                assert!(config.check_full_support(kernel_abi).is_err());
+            }
+            Err(e) => panic!("unexpected error: {e}"),
+        });
+    }
+}
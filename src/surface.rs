@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::grant::PathGrant;
+use crate::names::access_name;
+use crate::parser::{JsonFsAccessItem, JsonNetAccessItem, JsonScopeItem, UnknownAccessError};
+use crate::ResolvedConfig;
+use landlock::{Access, AccessFs, AccessNet, BitFlags, Scope, ABI};
+use serde::Serialize;
+
+/// Everything a configuration leaves open, see
+/// [`ResolvedConfig::open_surface()`].
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Surface {
+    /// Filesystem access rights allowed for all paths, because they are not
+    /// handled or because they are allowed beneath the root directory.
+    pub any_path: BitFlags<AccessFs>,
+    /// Paths with a rule, sorted, like
+    /// [`granted_paths()`](ResolvedConfig::granted_paths).  `any_path` is
+    /// allowed too.
+    pub paths: Vec<PathGrant>,
+    /// Network access rights allowed for all ports, because they are not
+    /// handled.
+    pub any_port: BitFlags<AccessNet>,
+    /// Ports with a rule, sorted, with their allowed access rights.  `any_port`
+    /// is allowed too.
+    pub ports: Vec<(u64, BitFlags<AccessNet>)>,
+    /// Scopes which are not restricted.
+    pub unscoped: BitFlags<Scope>,
+}
+
+/// Returns the names of `access`, in bit order, separated with commas.
+fn names<A, I>(access: BitFlags<A>) -> String
+where
+    A: Access,
+    I: TryFrom<A, Error = UnknownAccessError> + Serialize,
+{
+    access
+        .iter()
+        .filter_map(access_name::<A, I>)
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+impl ResolvedConfig {
+    /// Summarizes what the sandboxed processes can still do, among the access
+    /// rights and scopes supported by `abi`, e.g. for a security review of
+    /// the residual risk.
+    ///
+    /// Unlike [`granted_paths()`](ResolvedConfig::granted_paths), which only
+    /// lists the filesystem rules, the surface also includes the allowed
+    /// ports, the access rights which are not handled (and then allowed
+    /// everywhere), and the scopes which are not restricted.  Like
+    /// [`denied()`](ResolvedConfig::denied), a filesystem access right allowed
+    /// beneath the root directory is allowed for any path.  The surface is
+    /// sorted, and only depends on this configuration and `abi`.
+    pub fn open_surface(&self, abi: ABI) -> Surface {
+        let (denied_fs, _, _) = self.denied();
+        Surface {
+            any_path: AccessFs::from_all(abi) & !denied_fs,
+            paths: self.granted_paths(),
+            any_port: AccessNet::from_all(abi) & !self.handled_net,
+            ports: self
+                .rules_net_port
+                .iter()
+                .map(|(port, access)| (*port, *access))
+                .collect(),
+            unscoped: Scope::from_all(abi) & !self.scoped,
+        }
+    }
+}
+
+impl Surface {
+    /// Renders the surface as plain text, with one line per path, per port,
+    /// and for the unrestricted scopes.  Lines without access rights are
+    /// omitted, except paths and ports with a rule.
+    pub fn to_text(&self) -> String {
+        let mut lines = Vec::new();
+        if !self.any_path.is_empty() {
+            lines.push(format!(
+                "any path: {}",
+                names::<_, JsonFsAccessItem>(self.any_path)
+            ));
+        }
+        for grant in &self.paths {
+            lines.push(format!(
+                "{}: {}",
+                grant.path.display(),
+                names::<_, JsonFsAccessItem>(grant.access)
+            ));
+        }
+        if !self.any_port.is_empty() {
+            lines.push(format!(
+                "any port: {}",
+                names::<_, JsonNetAccessItem>(self.any_port)
+            ));
+        }
+        for (port, access) in &self.ports {
+            lines.push(format!(
+                "port {port}: {}",
+                names::<_, JsonNetAccessItem>(*access)
+            ));
+        }
+        if !self.unscoped.is_empty() {
+            lines.push(format!(
+                "unscoped: {}",
+                names::<_, JsonScopeItem>(self.unscoped)
+            ));
+        }
+        lines.into_iter().map(|line| line + "\n").collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+    use std::path::PathBuf;
+
+    fn resolved() -> ResolvedConfig {
+        parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "execute", "read_dir", "read_file", "write_file" ],
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_dir" ],
+                        "parent": [ "/" ]
+                    },
+                    {
+                        "allowedAccess": [ "execute", "read_file" ],
+                        "parent": [ "/usr" ]
+                    },
+                    {
+                        "allowedAccess": [ "write_file" ],
+                        "parent": [ "/tmp" ]
+                    }
+                ],
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_open_surface() {
+        let config = resolved();
+        let surface = config.open_surface(ABI::V6);
+        assert_eq!(
+            surface.any_path,
+            AccessFs::from_all(ABI::V6)
+                & !(AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile)
+        );
+        assert!(surface.any_path.contains(AccessFs::ReadDir));
+        assert_eq!(
+            surface
+                .paths
+                .iter()
+                .map(|grant| (grant.path.clone(), grant.access))
+                .collect::<Vec<_>>(),
+            [
+                (PathBuf::from("/"), AccessFs::ReadDir.into()),
+                (
+                    PathBuf::from("/tmp"),
+                    AccessFs::ReadDir | AccessFs::WriteFile
+                ),
+                (
+                    PathBuf::from("/usr"),
+                    AccessFs::Execute | AccessFs::ReadDir | AccessFs::ReadFile
+                ),
+            ]
+        );
+        assert_eq!(surface.any_port, AccessNet::BindTcp.into());
+        assert_eq!(surface.ports, [(443, AccessNet::ConnectTcp.into())]);
+        assert_eq!(surface.unscoped, Scope::AbstractUnixSocket.into());
+
+        // No access right nor scope is supported without Landlock.
+        let surface = config.open_surface(ABI::Unsupported);
+        assert!(surface.any_path.is_empty());
+        assert!(surface.any_port.is_empty());
+        assert!(surface.unscoped.is_empty());
+        assert_eq!(surface.paths, config.granted_paths());
+    }
+
+    #[test]
+    fn test_surface_to_text() {
+        let surface = Surface {
+            any_path: AccessFs::ReadDir | AccessFs::Refer,
+            paths: resolved().granted_paths(),
+            any_port: AccessNet::BindTcp.into(),
+            ports: vec![(443, AccessNet::ConnectTcp.into())],
+            unscoped: Scope::AbstractUnixSocket.into(),
+        };
+        assert_eq!(
+            surface.to_text(),
+            "any path: read_dir, refer\n\
+             /: read_dir\n\
+             /tmp: write_file, read_dir\n\
+             /usr: execute, read_file, read_dir\n\
+             any port: bind_tcp\n\
+             port 443: connect_tcp\n\
+             unscoped: abstract_unix_socket\n"
+        );
+        assert_eq!(Surface::default().to_text(), "");
+    }
+}
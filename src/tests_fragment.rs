@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigError, ParseFileError, ParseJsonError};
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json_schema, validate_json, TempDir};
+use crate::{Config, FragmentError, ParseOptions};
+use landlock::{AccessFs, AccessNet};
+use serde_json::error::Category;
+use std::fs;
+use std::path::Path;
+
+/// Creates a directory containing the `fragments` files.
+fn fragment_dir(name: &str, fragments: &[(&str, &str)]) -> TempDir {
+    let dir = TempDir::new(&format!("fragment-{name}"));
+    for (file, content) in fragments {
+        fs::write(dir.path().join(file), content).unwrap();
+    }
+    dir
+}
+
+const X11_JSON: &str = r#"{
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "read_file", "write_file" ],
+            "parent": [ "/tmp/.X11-unix" ]
+        }
+    ]
+}"#;
+
+const DBUS_JSON: &str = r#"{
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "write_file" ],
+            "parent": [ "/run/dbus" ]
+        }
+    ],
+    "netPort": [
+        {
+            "allowedAccess": [ "connect_tcp" ],
+            "port": [ 443 ]
+        }
+    ]
+}"#;
+
+fn parse_json_dirs<P: AsRef<Path>>(json: &str, dirs: &[P]) -> Result<Config, ParseJsonError> {
+    Config::parse_json_with(
+        json.as_bytes(),
+        &ParseOptions::new().fragment_dirs(dirs.iter().map(|d| d.as_ref())),
+    )
+}
+
+fn fragment_error(result: Result<Config, ParseJsonError>) -> FragmentError {
+    match result {
+        Err(ParseJsonError::Config(ConfigError::Fragment(e))) => e,
+        ret => panic!("unexpected result: {ret:?}"),
+    }
+}
+
+#[test]
+fn test_include_fragment() {
+    let dir = fragment_dir(
+        "include",
+        &[("x11.json", X11_JSON), ("dbus.json", DBUS_JSON)],
+    );
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ],
+        "includeFragment": [ "x11", "dbus" ]
+    }"#;
+    assert_eq!(validate_json(json), Ok(()));
+
+    assert_eq!(
+        parse_json_dirs(json, &[dir.path()]).unwrap(),
+        Config {
+            handled_fs: AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile,
+            handled_net: AccessNet::ConnectTcp.into(),
+            rules_path_beneath: [
+                (TemplateString::from_text("/usr"), AccessFs::Execute.into()),
+                (
+                    TemplateString::from_text("/tmp/.X11-unix"),
+                    AccessFs::ReadFile | AccessFs::WriteFile
+                ),
+                (
+                    TemplateString::from_text("/run/dbus"),
+                    AccessFs::WriteFile.into()
+                ),
+            ]
+            .into(),
+            rules_net_port: [(443, AccessNet::ConnectTcp.into())].into(),
+            ..Default::default()
+        }
+    );
+}
+
+#[test]
+fn test_include_fragment_search_path() {
+    let first = fragment_dir("search-first", &[("x11.json", X11_JSON)]);
+    let second = fragment_dir(
+        "search-second",
+        &[("x11.json", DBUS_JSON), ("dbus.json", DBUS_JSON)],
+    );
+    let json = r#"{
+        "includeFragment": [ "x11", "dbus" ]
+    }"#;
+
+    // The first directory containing a fragment wins.
+    let x11_dbus = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file", "write_file" ],
+                "parent": [ "/tmp/.X11-unix" ]
+            },
+            {
+                "allowedAccess": [ "write_file" ],
+                "parent": [ "/run/dbus" ]
+            }
+        ],
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ]
+            }
+        ]
+    }"#;
+    assert_eq!(
+        parse_json_dirs(json, &[first.path(), second.path()]).unwrap(),
+        Config::parse_json(x11_dbus.as_bytes()).unwrap()
+    );
+}
+
+#[test]
+fn test_include_fragment_nested() {
+    let dir = fragment_dir(
+        "nested",
+        &[
+            ("desktop.json", r#"{ "includeFragment": [ "x11" ] }"#),
+            ("x11.json", X11_JSON),
+        ],
+    );
+    let json = r#"{
+        "includeFragment": [ "desktop" ]
+    }"#;
+    assert_eq!(
+        parse_json_dirs(json, &[dir.path()]).unwrap(),
+        Config::parse_json(X11_JSON.as_bytes()).unwrap()
+    );
+}
+
+#[test]
+fn test_include_fragment_not_found() {
+    let dir = fragment_dir("not-found", &[("x11.json", X11_JSON)]);
+    let json = r#"{
+        "includeFragment": [ "x11", "dbus" ]
+    }"#;
+    assert!(matches!(
+        fragment_error(parse_json_dirs(json, &[dir.path()])),
+        FragmentError::NotFound(name) if name == "dbus"
+    ));
+}
+
+#[test]
+fn test_include_fragment_default_dir() {
+    let json = r#"{
+        "includeFragment": [ "landlockconfig-nonexistent" ]
+    }"#;
+    assert!(matches!(
+        fragment_error(Config::parse_json(json.as_bytes())),
+        FragmentError::NotFound(_)
+    ));
+}
+
+#[test]
+fn test_include_fragment_cycle() {
+    let dir = fragment_dir(
+        "cycle",
+        &[
+            ("a.json", r#"{ "includeFragment": [ "b" ] }"#),
+            ("b.json", r#"{ "includeFragment": [ "a" ] }"#),
+        ],
+    );
+    let json = r#"{
+        "includeFragment": [ "a" ]
+    }"#;
+
+    // The cycle is detected while parsing the nested fragments.
+    let err = fragment_error(parse_json_dirs(json, &[dir.path()]));
+    let FragmentError::Parse { name, source } = err else {
+        panic!("unexpected error: {err:?}");
+    };
+    assert_eq!(name, "a");
+    let ParseFileError::ParseJson(ParseJsonError::Config(ConfigError::Fragment(
+        FragmentError::Parse { name, source },
+    ))) = *source
+    else {
+        panic!("unexpected error: {source:?}");
+    };
+    assert_eq!(name, "b");
+    assert!(matches!(
+        *source,
+        ParseFileError::ParseJson(ParseJsonError::Config(ConfigError::Fragment(
+            FragmentError::Cycle(cycle),
+        ))) if cycle == ["a", "b", "a"]
+    ));
+}
+
+#[test]
+fn test_include_fragment_invalid_name() {
+    for name in ["../x11", "/tmp/x11", ".x11", ""] {
+        let json = format!(r#"{{ "includeFragment": [ "{name}" ] }}"#);
+        assert_eq!(parse_json_schema(&json, true), Err(Category::Data));
+        assert!(matches!(
+            fragment_error(Config::parse_json(json.as_bytes())),
+            FragmentError::InvalidName(n) if n == name
+        ));
+    }
+}
+
+#[test]
+fn test_include_fragment_invalid() {
+    let dir = fragment_dir("invalid", &[("x11.json", r#"{ "foo": [] }"#)]);
+    let json = r#"{
+        "includeFragment": [ "x11" ]
+    }"#;
+    assert!(matches!(
+        fragment_error(parse_json_dirs(json, &[dir.path()])),
+        FragmentError::Parse { name, .. } if name == "x11"
+    ));
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_include_fragment_toml() {
+    let dir = fragment_dir(
+        "toml",
+        &[(
+            "x11.toml",
+            r#"
+                [[path_beneath]]
+                allowed_access = [ "read_file", "write_file" ]
+                parent = [ "/tmp/.X11-unix" ]
+            "#,
+        )],
+    );
+    let toml = r#"
+        include_fragment = [ "x11" ]
+    "#;
+    let config =
+        Config::parse_toml_with(toml, &ParseOptions::new().fragment_dirs([dir.path()])).unwrap();
+    assert_eq!(config, Config::parse_json(X11_JSON.as_bytes()).unwrap());
+}
@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigError, ParseJsonError};
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json, parse_json_schema, validate_json};
+use crate::{Config, GroupError};
+use landlock::{AccessFs, ABI};
+use serde_json::error::Category;
+
+fn group_error(json: &str) -> GroupError {
+    // The schema cannot check group references.
+    assert_eq!(parse_json_schema(json, false), Err(Category::Data));
+    match Config::parse_json(json.as_bytes()) {
+        Err(ParseJsonError::Config(ConfigError::Group(e))) => e,
+        ret => panic!("unexpected result: {ret:?}"),
+    }
+}
+
+#[test]
+fn test_group_multiple_uses() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "system-libs",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file", "execute" ],
+                        "parent": [ "/lib", "/usr/lib" ]
+                    }
+                ]
+            },
+            {
+                "name": "shell",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/bin/sh" ]
+                    }
+                ],
+                "use": [ "system-libs" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "/etc" ]
+            }
+        ],
+        "use": [ "system-libs" ],
+        "when": [
+            {
+                "minAbi": 2,
+                "use": [ "shell" ]
+            }
+        ]
+    }"#;
+    assert_eq!(validate_json(json), Ok(()));
+
+    let read_exec = AccessFs::ReadFile | AccessFs::Execute;
+    let without_shell = Config {
+        handled_fs: read_exec,
+        rules_path_beneath: [
+            (TemplateString::from_text("/etc"), AccessFs::ReadFile.into()),
+            (TemplateString::from_text("/lib"), read_exec),
+            (TemplateString::from_text("/usr/lib"), read_exec),
+        ]
+        .into(),
+        ..Default::default()
+    };
+    let mut with_shell = without_shell.clone();
+    with_shell.rules_path_beneath.insert(
+        TemplateString::from_text("/bin/sh"),
+        AccessFs::Execute.into(),
+    );
+
+    let parse = |abi| {
+        let mut config = Config::parse_json(json.as_bytes()).unwrap();
+        config.add_conditional_rules(abi as i32);
+        config
+    };
+    assert_eq!(parse(ABI::V1), without_shell);
+    assert_eq!(parse(ABI::V2), with_shell);
+}
+
+#[test]
+fn test_group_unused() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "system-libs",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr/lib" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Ok(Config::default()));
+}
+
+#[test]
+fn test_group_merged() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "libs",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/lib" ]
+                    }
+                ]
+            },
+            {
+                "name": "libs",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/lib" ]
+                    }
+                ]
+            }
+        ],
+        "use": [ "libs" ]
+    }"#;
+    assert_eq!(
+        parse_json(json),
+        Ok(Config {
+            handled_fs: AccessFs::ReadFile | AccessFs::Execute,
+            rules_path_beneath: [(
+                TemplateString::from_text("/lib"),
+                AccessFs::ReadFile | AccessFs::Execute
+            )]
+            .into(),
+            ..Default::default()
+        })
+    );
+}
+
+#[test]
+fn test_group_unknown() {
+    let json = r#"{
+        "use": [ "system-libs" ]
+    }"#;
+    assert_eq!(group_error(json), GroupError::Unknown("system-libs".into()));
+}
+
+#[test]
+fn test_group_unknown_unused() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "shell",
+                "use": [ "system-libs" ]
+            }
+        ]
+    }"#;
+    assert_eq!(group_error(json), GroupError::Unknown("system-libs".into()));
+}
+
+#[test]
+fn test_group_cycle() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "a",
+                "use": [ "b" ]
+            },
+            {
+                "name": "b",
+                "use": [ "c" ]
+            },
+            {
+                "name": "c",
+                "use": [ "b" ]
+            }
+        ]
+    }"#;
+    assert_eq!(
+        group_error(json),
+        GroupError::Cycle(vec!["b".into(), "c".into(), "b".into()])
+    );
+}
+
+#[test]
+fn test_group_self_reference() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "a",
+                "use": [ "a" ]
+            }
+        ]
+    }"#;
+    assert_eq!(
+        group_error(json),
+        GroupError::Cycle(vec!["a".into(), "a".into()])
+    );
+}
+
+#[test]
+fn test_group_empty() {
+    let json = r#"{
+        "group": [
+            {
+                "name": "a"
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_group_toml() {
+    let toml = r#"
+        use = [ "system-libs" ]
+
+        [[group]]
+        name = "system-libs"
+
+        [[group.path_beneath]]
+        allowed_access = [ "read_file" ]
+        parent = [ "/usr/lib" ]
+    "#;
+    let json = r#"{
+        "group": [
+            {
+                "name": "system-libs",
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file" ],
+                        "parent": [ "/usr/lib" ]
+                    }
+                ]
+            }
+        ],
+        "use": [ "system-libs" ]
+    }"#;
+    assert_eq!(
+        crate::tests_helpers::parse_toml(toml).unwrap(),
+        parse_json(json).unwrap()
+    );
+}
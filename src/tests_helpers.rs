@@ -1,12 +1,12 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
-use crate::config::{ParseJsonError, ParseTomlError};
-use crate::Config;
-use landlock::ABI;
+use crate::config::{ParseJsonError, ParseTomlError, RuleError};
+use crate::{Config, ResolvedConfig};
+use landlock::{RestrictionStatus, RulesetStatus, ABI};
 use serde_json::error::Category;
 use serde_json::Value;
-use std::path::PathBuf;
-use std::{env, fs};
+use std::path::{Path, PathBuf};
+use std::{env, fs, panic, thread};
 
 pub(crate) const LATEST_ABI: ABI = ABI::V6;
 
@@ -64,3 +64,66 @@ pub(crate) fn parse_toml(toml: &str) -> Result<Config, ParseTomlError> {
         e
     })
 }
+
+/// Temporary directory removed when dropped.
+pub(crate) struct TempDir(PathBuf);
+
+impl TempDir {
+    /// Creates an empty directory, whose name must be unique among the tests.
+    pub(crate) fn new(name: &str) -> Self {
+        let path = env::temp_dir().join(format!("landlockconfig-{}-{name}", std::process::id()));
+        let _ = fs::remove_dir_all(&path);
+        fs::create_dir(&path).unwrap();
+        Self(path)
+    }
+
+    pub(crate) fn path(&self) -> &Path {
+        &self.0
+    }
+}
+
+impl Drop for TempDir {
+    fn drop(&mut self) {
+        let _ = fs::remove_dir_all(&self.0);
+    }
+}
+
+/// Runs `f` in a dedicated thread, to only restrict this thread and not the
+/// other tests.
+pub(crate) fn dedicated_thread<F, T>(f: F) -> T
+where
+    F: FnOnce() -> T + Send + 'static,
+    T: Send + 'static,
+{
+    thread::spawn(f)
+        .join()
+        .unwrap_or_else(|e| panic::resume_unwind(e))
+}
+
+/// Enforces `config` in a dedicated thread and runs `f` in it, or returns
+/// `None` if Landlock is not supported by the running kernel.
+pub(crate) fn restricted_thread<F, T>(config: ResolvedConfig, f: F) -> Option<T>
+where
+    F: FnOnce() -> T + Send + 'static,
+    T: Send + 'static,
+{
+    restricted_thread_with(move || config.restrict_self().unwrap(), f)
+}
+
+/// Same as [`restricted_thread()`], but enforces a ruleset with `restrict`.
+pub(crate) fn restricted_thread_with<R, F, T>(restrict: R, f: F) -> Option<T>
+where
+    R: FnOnce() -> (RestrictionStatus, Vec<RuleError>) + Send + 'static,
+    F: FnOnce() -> T + Send + 'static,
+    T: Send + 'static,
+{
+    dedicated_thread(move || {
+        let (status, rule_errors) = restrict();
+        assert!(rule_errors.is_empty());
+        if status.ruleset == RulesetStatus::NotEnforced {
+            eprintln!("Landlock is not supported by the running kernel");
+            return None;
+        }
+        Some(f())
+    })
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::tests_helpers::TempDir;
+use crate::{Config, ConfigFormat, ParseDirectoryError, ResolvedConfig};
+use landlock::{AccessFs, BitFlags};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+const SYSTEM: &str = r#"{
+    "ruleset": [
+        {
+            "handledAccessFs": [ "execute", "read_file" ]
+        }
+    ],
+    "variable": [
+        {
+            "name": "data",
+            "literal": [ "/usr/share/app" ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "execute", "read_file" ],
+            "parent": [ "/usr/bin", "${data}" ]
+        }
+    ]
+}"#;
+
+const USER: &str = r#"{
+    "ruleset": [
+        {
+            "handledAccessFs": [ "write_file" ]
+        }
+    ],
+    "variable": [
+        {
+            "name": "data",
+            "literal": [ "/home/user/.local/share/app" ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "write_file" ],
+            "parent": [ "/tmp" ]
+        }
+    ]
+}"#;
+
+const OVERRIDE: &str = r#"{
+    "variable": [
+        {
+            "name": "data",
+            "literal": [ "/srv/app" ]
+        }
+    ]
+}"#;
+
+/// Writes the layers in a dedicated directory, and returns their paths.
+fn layers(name: &str, layers: &[(&str, Option<&str>)]) -> (TempDir, Vec<PathBuf>) {
+    let dir = TempDir::new(&format!("layered-{name}"));
+    let paths = layers
+        .iter()
+        .map(|(file_name, data)| {
+            let path = dir.path().join(file_name);
+            if let Some(data) = data {
+                fs::write(&path, data).unwrap();
+            }
+            path
+        })
+        .collect();
+    (dir, paths)
+}
+
+fn load(paths: &[PathBuf]) -> Result<ResolvedConfig, ParseDirectoryError> {
+    Ok(Config::load_layered(paths, ConfigFormat::Json)?
+        .resolve()
+        .unwrap())
+}
+
+fn rule(config: &ResolvedConfig, path: &str) -> Option<BitFlags<AccessFs>> {
+    config.rules_path_beneath.get(Path::new(path)).copied()
+}
+
+#[test]
+fn test_layered_all_present() {
+    let (_dir, paths) = layers(
+        "all",
+        &[
+            ("system.json", Some(SYSTEM)),
+            ("user.json", Some(USER)),
+            ("override.json", Some(OVERRIDE)),
+        ],
+    );
+    let config = load(&paths).unwrap();
+    // Restrictions and allowances of all the layers are kept.
+    assert_eq!(
+        config.handled_fs,
+        AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile
+    );
+    assert_eq!(rule(&config, "/tmp"), Some(AccessFs::WriteFile.into()));
+    assert!(rule(&config, "/usr/bin").is_some());
+    // The last definition of a variable wins.
+    assert!(rule(&config, "/srv/app").is_some());
+    assert_eq!(rule(&config, "/usr/share/app"), None);
+    assert_eq!(rule(&config, "/home/user/.local/share/app"), None);
+}
+
+#[test]
+fn test_layered_some_missing() {
+    let (_dir, paths) = layers(
+        "missing",
+        &[
+            ("system.json", Some(SYSTEM)),
+            ("user.json", None),
+            ("override.json", None),
+        ],
+    );
+    let system_only = load(&paths).unwrap();
+    assert_eq!(
+        system_only,
+        Config::parse_json(SYSTEM.as_bytes())
+            .unwrap()
+            .resolve()
+            .unwrap()
+    );
+    assert!(rule(&system_only, "/usr/share/app").is_some());
+
+    // Only missing files are skipped.
+    fs::write(&paths[2], "{ \"unknown\": [] }").unwrap();
+    match load(&paths) {
+        Err(ParseDirectoryError::ParseFiles(errors)) => {
+            assert_eq!(errors.keys().collect::<Vec<_>>(), [&paths[2]]);
+        }
+        ret => panic!("unexpected result: {ret:?}"),
+    }
+}
+
+#[test]
+fn test_layered_none_present() {
+    let (_dir, paths) = layers("none", &[("system.json", None), ("user.json", None)]);
+    assert!(matches!(
+        load(&paths),
+        Err(ParseDirectoryError::NoConfigFile)
+    ));
+    assert!(matches!(load(&[]), Err(ParseDirectoryError::NoConfigFile)));
+}
+
+#[test]
+fn test_layered_order() {
+    let (_dir, paths) = layers(
+        "order",
+        &[("system.json", Some(SYSTEM)), ("user.json", Some(USER))],
+    );
+    let user_last = load(&paths).unwrap();
+    assert!(rule(&user_last, "/home/user/.local/share/app").is_some());
+    assert_eq!(rule(&user_last, "/usr/share/app"), None);
+
+    let system_last = load(&[paths[1].clone(), paths[0].clone()]).unwrap();
+    assert!(rule(&system_last, "/usr/share/app").is_some());
+    assert_eq!(rule(&system_last, "/home/user/.local/share/app"), None);
+
+    // Only variables depend on the order.
+    assert_eq!(user_last.handled_fs, system_last.handled_fs);
+    assert_eq!(rule(&user_last, "/tmp"), rule(&system_last, "/tmp"));
+}
+
+#[test]
+fn test_xdg_layers() {
+    let layers = Config::xdg_layers("app", ConfigFormat::Json);
+    assert_eq!(layers[0], Path::new("/etc/app/landlock.json"));
+    assert!(layers.len() <= 2);
+    if let Some(user) = layers.get(1) {
+        assert!(user.is_absolute());
+        assert!(user.ends_with("app/landlock.json"));
+    }
+}
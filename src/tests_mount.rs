@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json, parse_toml};
+use crate::{Config, ResolvedConfig, RuleError};
+use landlock::AccessFs;
+use serde_json::error::Category;
+use std::path::PathBuf;
+
+const JSON: &str = r#"{
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "read_file" ],
+            "parent": [ "/proc/self" ],
+            "mountPoint": true
+        },
+        {
+            "allowedAccess": [ "execute" ],
+            "parent": [ "/usr" ],
+            "mountPoint": false
+        }
+    ]
+}"#;
+
+#[test]
+fn test_mount_point_json() {
+    assert_eq!(
+        parse_json(JSON),
+        Ok(Config {
+            handled_fs: AccessFs::ReadFile | AccessFs::Execute,
+            rules_path_beneath: [(TemplateString::from_text("/usr"), AccessFs::Execute.into())]
+                .into(),
+            rules_mount_point: [(
+                TemplateString::from_text("/proc/self"),
+                AccessFs::ReadFile.into()
+            )]
+            .into(),
+            ..Default::default()
+        })
+    );
+}
+
+#[test]
+fn test_mount_point_toml() {
+    let toml = r#"
+        [[path_beneath]]
+        allowed_access = [ "read_file" ]
+        parent = [ "/proc/self" ]
+        mount_point = true
+
+        [[path_beneath]]
+        allowed_access = [ "execute" ]
+        parent = [ "/usr" ]
+    "#;
+    assert_eq!(parse_toml(toml).unwrap(), parse_json(JSON).unwrap());
+}
+
+#[test]
+fn test_mount_point_invalid() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "/proc" ],
+                "mountPoint": 1
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[test]
+fn test_mount_point_serialize() {
+    let config = parse_json(JSON).unwrap();
+    let json = serde_json::to_string(&config).unwrap();
+    assert_eq!(parse_json(&json), Ok(config));
+}
+
+#[test]
+fn test_mount_point_compose() {
+    let mut config = parse_json(JSON).unwrap();
+    let other = Config {
+        handled_fs: AccessFs::ReadFile.into(),
+        ..Default::default()
+    };
+    config.compose(&other);
+    assert_eq!(
+        config,
+        Config {
+            handled_fs: AccessFs::ReadFile.into(),
+            rules_mount_point: [(
+                TemplateString::from_text("/proc/self"),
+                AccessFs::ReadFile.into()
+            )]
+            .into(),
+            ..Default::default()
+        }
+    );
+}
+
+#[test]
+fn test_mount_point_build() {
+    let resolved = ResolvedConfig {
+        handled_fs: AccessFs::ReadFile.into(),
+        rules_mount_point: [
+            (PathBuf::from("/proc"), AccessFs::ReadFile.into()),
+            (PathBuf::from("/proc/self"), AccessFs::ReadFile.into()),
+            (
+                PathBuf::from("/proc/landlockconfig-nonexistent"),
+                AccessFs::ReadFile.into(),
+            ),
+        ]
+        .into(),
+        ..Default::default()
+    };
+
+    let (_, rule_errors) = resolved.build_ruleset().unwrap();
+    let [RuleError::MountPoint { path: missing, .. }, RuleError::NotMountPoint { path, mount_point }] =
+        rule_errors.as_slice()
+    else {
+        panic!("unexpected rule errors: {rule_errors:?}");
+    };
+    assert_eq!(missing, &PathBuf::from("/proc/landlockconfig-nonexistent"));
+    assert_eq!(path, &PathBuf::from("/proc/self"));
+    assert_eq!(mount_point, &PathBuf::from("/proc"));
+}
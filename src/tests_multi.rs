@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::ParseJsonError;
+use crate::parser::TemplateString;
+use crate::{Config, ParseRulesError};
+use landlock::{AccessFs, AccessNet};
+use serde_json::error::Category;
+
+fn path_beneath() -> Config {
+    Config {
+        handled_fs: AccessFs::Execute.into(),
+        rules_path_beneath: [(TemplateString::from_text("/usr"), AccessFs::Execute.into())].into(),
+        ..Default::default()
+    }
+}
+
+fn net_port() -> Config {
+    Config {
+        handled_net: AccessNet::ConnectTcp.into(),
+        rules_net_port: [(443, AccessNet::ConnectTcp.into())].into(),
+        ..Default::default()
+    }
+}
+
+#[test]
+fn test_json_multi() {
+    let json = r#"[
+        {
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute" ],
+                    "parent": [ "/usr" ]
+                }
+            ]
+        },
+        {
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        }
+    ]"#;
+    assert_eq!(
+        Config::parse_json_multi(json.as_bytes()).unwrap(),
+        [path_beneath(), net_port()]
+    );
+}
+
+#[test]
+fn test_json_multi_empty() {
+    assert_eq!(Config::parse_json_multi("[]".as_bytes()).unwrap(), []);
+}
+
+#[test]
+fn test_json_multi_invalid() {
+    for json in ["{}", "[{}]", r#"[{ "foo": [] }]"#] {
+        assert!(matches!(
+            Config::parse_json_multi(json.as_bytes()),
+            Err(ParseJsonError::SerdeJson(e)) if e.classify() == Category::Data
+        ));
+    }
+}
+
+#[cfg(feature = "schema")]
+#[test]
+fn test_json_multi_schema() {
+    use crate::ParseOptions;
+
+    let json = r#"[
+        {
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        },
+        {
+            "netPort": []
+        }
+    ]"#;
+    let options = ParseOptions::new().validate_schema(true);
+    let Err(ParseJsonError::Schema(e)) = Config::parse_json_multi_with(json.as_bytes(), &options)
+    else {
+        panic!("expected a schema error");
+    };
+    assert_eq!(e.pointer(), "/1/netPort");
+}
+
+#[cfg(feature = "toml")]
+mod toml {
+    use super::*;
+
+    #[test]
+    fn test_toml_multi() {
+        let toml = r#"
+            [[path_beneath]]
+            allowed_access = [ "execute" ]
+            parent = [ "/usr" ]
+---
+            [[net_port]]
+            allowed_access = [ "connect_tcp" ]
+            port = [ 443 ]
+        "#;
+        assert_eq!(
+            Config::parse_toml_multi(toml).unwrap(),
+            [path_beneath(), net_port()]
+        );
+    }
+
+    #[test]
+    fn test_toml_multi_empty_documents() {
+        let toml = r#"---
+            [[path_beneath]]
+            allowed_access = [ "execute" ]
+            parent = [ "/usr" ]
+---
+            # Nothing here.
+
+---
+        "#;
+        assert_eq!(Config::parse_toml_multi(toml).unwrap(), [path_beneath()]);
+        assert_eq!(Config::parse_toml_multi("").unwrap(), []);
+    }
+
+    #[test]
+    fn test_toml_multi_single() {
+        let toml = r#"
+            [[path_beneath]]
+            allowed_access = [ "execute" ]
+            parent = [ "/usr" ]
+        "#;
+        assert_eq!(
+            Config::parse_toml_multi(toml).unwrap(),
+            [Config::parse_toml(toml).unwrap()]
+        );
+    }
+
+    #[test]
+    fn test_toml_multi_error_line() {
+        let toml = "\
+[[net_port]]
+allowed_access = [ \"connect_tcp\" ]
+port = [ 443 ]
+---
+[[net_port]]
+port = [ 443 ]
+foo = 1
+";
+        let err = Config::parse_toml_multi(toml).unwrap_err();
+        assert!(err.to_string().contains("line 7"), "{err}");
+
+        // The offset accumulates over the documents.
+        let toml = "\
+[[net_port]]
+allowed_access = [ \"connect_tcp\" ]
+port = [ 443 ]
+---
+---
+[[net_port]]
+allowed_access = [ \"connect_tcp\" ]
+port = [ 80 ]
+---
+foo = 1
+";
+        let err = Config::parse_toml_multi(toml).unwrap_err();
+        assert!(err.to_string().contains("line 10"), "{err}");
+    }
+}
+
+#[test]
+fn test_json_rules() {
+    let ndjson = r#"{"path": "/usr", "access": ["execute"]}
+
+{"path": "/tmp", "access": ["write_file"]}
+  {"path": "/usr", "access": ["read_file", "execute"]}
+"#;
+    assert_eq!(
+        Config::parse_json_rules(ndjson.as_bytes()).unwrap(),
+        Config {
+            handled_fs: AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile,
+            rules_path_beneath: [
+                (
+                    TemplateString::from_text("/usr"),
+                    AccessFs::Execute | AccessFs::ReadFile
+                ),
+                (
+                    TemplateString::from_text("/tmp"),
+                    AccessFs::WriteFile.into()
+                ),
+            ]
+            .into(),
+            ..Default::default()
+        }
+    );
+    assert_eq!(
+        Config::parse_json_rules("".as_bytes()).unwrap(),
+        Config::default()
+    );
+}
+
+#[test]
+fn test_json_rules_invalid() {
+    for (ndjson, expected_line) in [
+        (
+            "{\"path\": \"/usr\", \"access\": [\"execute\"]}\n\n{\"path\": \"/tmp\"",
+            3,
+        ),
+        ("{\"path\": \"/usr\", \"access\": []}", 1),
+        ("\n{\"path\": \"/usr\", \"access\": [\"foo\"]}", 2),
+        (
+            "{\"path\": \"/usr\", \"access\": [\"execute\"], \"foo\": 1}",
+            1,
+        ),
+        ("{\"path\": \"/usr\", \"access\": [\"abi.all\"]}", 1),
+    ] {
+        let err = Config::parse_json_rules(ndjson.as_bytes()).unwrap_err();
+        assert!(
+            matches!(&err, ParseRulesError::Line { line, .. } if *line == expected_line),
+            "{ndjson:?}: {err}"
+        );
+        assert!(err
+            .to_string()
+            .starts_with(&format!("line {expected_line}: ")));
+    }
+}
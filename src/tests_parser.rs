@@ -1,8 +1,11 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
-use crate::config::ResolvedConfig;
-use crate::tests_helpers::{parse_json, parse_toml, validate_json, LATEST_ABI};
-use crate::Config;
+use crate::config::{ConfigError, ParseJsonError, ResolvedConfig};
+use crate::parser::TemplateString;
+use crate::tests_helpers::{
+    parse_json, parse_json_schema, parse_toml, validate_json, TempDir, LATEST_ABI,
+};
+use crate::{Config, ParseOptions, ServiceError};
 use landlock::{Access, AccessFs, AccessNet, Scope, ABI};
 use serde_json::error::Category;
 use std::path::PathBuf;
@@ -762,6 +765,157 @@ fn test_overlap_net_port() {
     );
 }
 
+/// Uses a fixture instead of the host's services database, which may not
+/// exist or may differ.
+fn services_options() -> ParseOptions {
+    ParseOptions::new()
+        .services_file(PathBuf::from(env!("CARGO_MANIFEST_DIR")).join("tests/services/services"))
+}
+
+#[test]
+fn test_net_port_service_name() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ "https", "ssh", 8080 ]
+            }
+        ]
+    }"#;
+    let toml = r#"
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ "https", "ssh", 8080 ]
+    "#;
+    let config = Config {
+        handled_net: AccessNet::ConnectTcp.into(),
+        rules_net_port: [
+            (22, AccessNet::ConnectTcp.into()),
+            (443, AccessNet::ConnectTcp.into()),
+            (8080, AccessNet::ConnectTcp.into()),
+        ]
+        .into(),
+        ..Default::default()
+    };
+    let options = services_options();
+    assert_eq!(validate_json(json), Ok(()));
+    assert_eq!(
+        Config::parse_json_with(json.as_bytes(), &options).unwrap(),
+        config
+    );
+    assert_eq!(Config::parse_toml_with(toml, &options).unwrap(), config);
+}
+
+#[test]
+fn test_net_port_service_name_and_number() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "bind_tcp" ],
+                "port": [ "https", 443 ]
+            }
+        ]
+    }"#;
+    assert_eq!(validate_json(json), Ok(()));
+    assert_eq!(
+        Config::parse_json_with(json.as_bytes(), &services_options()).unwrap(),
+        Config {
+            handled_net: AccessNet::BindTcp.into(),
+            rules_net_port: [(443, AccessNet::BindTcp.into())].into(),
+            ..Default::default()
+        }
+    );
+}
+
+#[test]
+fn test_net_port_service_name_unknown() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ "landlockconfig-unknown-service" ]
+            }
+        ]
+    }"#;
+    let toml = r#"
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ "landlockconfig-unknown-service" ]
+    "#;
+
+    // The schema cannot know about the host's services database.
+    assert_eq!(parse_json_schema(json, false), Err(Category::Data));
+    assert!(parse_toml(toml).is_err());
+}
+
+#[test]
+fn test_net_port_services_file() {
+    let dir = TempDir::new("parser-services");
+    let path = dir.path().join("services");
+    std::fs::write(&path, "fake\t1234/tcp\talias\n").unwrap();
+    let options = ParseOptions::new().services_file(&path);
+    let parse = |port: &str| {
+        let json = format!(
+            r#"{{ "netPort": [ {{ "allowedAccess": [ "connect_tcp" ], "port": [ "{port}" ] }} ] }}"#
+        );
+        Config::parse_json_with(json.as_bytes(), &options)
+    };
+
+    let config = Config {
+        handled_net: AccessNet::ConnectTcp.into(),
+        rules_net_port: [(1234, AccessNet::ConnectTcp.into())].into(),
+        ..Default::default()
+    };
+    assert_eq!(parse("fake").unwrap(), config);
+    assert_eq!(parse("alias").unwrap(), config);
+    // The host's services database is not used.
+    assert!(matches!(
+        parse("https"),
+        Err(ParseJsonError::Config(ConfigError::Service(ServiceError::NotFound(name)))) if name == "https"
+    ));
+    std::fs::remove_file(&path).unwrap();
+
+    // A missing database is only an error if a service name is used.
+    assert!(matches!(
+        parse("fake"),
+        Err(ParseJsonError::Config(ConfigError::Service(
+            ServiceError::Io(_)
+        )))
+    ));
+}
+
+#[test]
+fn test_net_port_service_name_empty() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ "" ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[test]
+fn test_net_port_negative() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ -1 ]
+            }
+        ]
+    }"#;
+    let toml = r#"
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ -1 ]
+    "#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+    assert!(parse_toml(toml).is_err());
+}
+
 /* Test ruleset's properties. */
 
 #[test]
@@ -1039,3 +1193,425 @@ fn test_net_port_alone() {
         })
     );
 }
+
+#[test]
+fn test_infer_equivalent_explicit() {
+    let implicit = r#"{
+        "abi": 1,
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "abi.read_execute" ],
+                "parent": [ "/usr" ]
+            },
+            {
+                "allowedAccess": [ "write_file" ],
+                "parent": [ "/tmp" ]
+            }
+        ],
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ]
+            }
+        ]
+    }"#;
+    let explicit = r#"{
+        "abi": 1,
+        "ruleset": [
+            {
+                "handledAccessFs": [ "execute", "read_file", "read_dir", "write_file" ],
+                "handledAccessNet": [ "connect_tcp" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute", "read_file", "read_dir" ],
+                "parent": [ "/usr" ]
+            },
+            {
+                "allowedAccess": [ "write_file" ],
+                "parent": [ "/tmp" ]
+            }
+        ],
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(implicit), parse_json(explicit));
+}
+
+#[test]
+fn test_infer_equivalent_explicit_toml() {
+    let implicit = r#"
+        [[path_beneath]]
+        allowed_access = [ "read_file" ]
+        parent = [ "/usr" ]
+    "#;
+    let explicit = r#"
+        [[ruleset]]
+        handled_access_fs = [ "read_file" ]
+
+        [[path_beneath]]
+        allowed_access = [ "read_file" ]
+        parent = [ "/usr" ]
+    "#;
+    assert_eq!(parse_toml(implicit).unwrap(), parse_toml(explicit).unwrap());
+}
+
+#[test]
+fn test_exec_composites() {
+    let composites = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "exec_only" ],
+                "parent": [ "/usr/bin" ]
+            },
+            {
+                "allowedAccess": [ "exec_read" ],
+                "parent": [ "/usr/share" ]
+            }
+        ]
+    }"#;
+    let explicit = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr/bin" ]
+            },
+            {
+                "allowedAccess": [ "execute", "read_file" ],
+                "parent": [ "/usr/share" ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(composites), parse_json(explicit));
+}
+
+#[test]
+fn test_handled_fs_kernel() {
+    let json = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "*" ]
+            }
+        ]
+    }"#;
+    validate_json(json).unwrap();
+
+    // Resolved with the running kernel's ABI, without any abi variable.
+    let config = parse_json(json).unwrap();
+    assert_eq!(
+        config.handled_fs,
+        AccessFs::from_all(crate::kernel::abi_version().into())
+    );
+
+    for abi in [ABI::V1, ABI::V2, LATEST_ABI] {
+        let options = ParseOptions::new().kernel_abi(abi);
+        let config = Config::parse_json_with(json.as_bytes(), &options).unwrap();
+        assert_eq!(config.handled_fs, AccessFs::from_all(abi));
+    }
+
+    // Unlike "abi.all", which follows the configured ABI.
+    let json = r#"{
+        "abi": 1,
+        "ruleset": [
+            {
+                "handledAccessFs": [ "*", "abi.all" ]
+            }
+        ]
+    }"#;
+    let options = ParseOptions::new().kernel_abi(ABI::V2);
+    let config = Config::parse_json_with(json.as_bytes(), &options).unwrap();
+    assert_eq!(config.handled_fs, AccessFs::from_all(ABI::V2));
+}
+
+#[test]
+fn test_toml_array_syntax() {
+    // Comments, multiline arrays, and trailing commas, as allowed by TOML 1.0.
+    let generated = r#"
+        # Generated configuration.
+        [[ruleset]] # Inline comment.
+        handled_access_fs = [
+            "execute", # Comment between elements.
+            # Comment on its own line.
+            "read_file",
+        ]
+
+        [[path_beneath]]
+        allowed_access = [ "execute", "read_file", ]
+        parent = [
+            "/usr",
+
+            "/bin",
+        ]
+
+        [[net_port]]
+        allowed_access = [
+            "connect_tcp"
+            , # Separated from the element.
+        ]
+        port = [ 443, ] # Trailing comment.
+    "#;
+    let compact = r#"
+        [[ruleset]]
+        handled_access_fs = [ "execute", "read_file" ]
+
+        [[path_beneath]]
+        allowed_access = [ "execute", "read_file" ]
+        parent = [ "/usr", "/bin" ]
+
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ 443 ]
+    "#;
+    assert_eq!(parse_toml(generated).unwrap(), parse_toml(compact).unwrap());
+
+    // A trailing comma without any element is not valid TOML.
+    let toml = r#"
+        [[net_port]]
+        allowed_access = [ , ]
+        port = [ 443 ]
+    "#;
+    assert!(parse_toml(toml).is_err());
+}
+
+#[test]
+fn test_duplicate_keys() {
+    let json = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "execute" ],
+                "handledAccessFs": [ "read_file" ]
+            }
+        ]
+    }"#;
+    let err = Config::parse_json(json.as_bytes()).unwrap_err();
+    let ParseJsonError::SerdeJson(e) = &err else {
+        panic!("unexpected error: {err}");
+    };
+    assert_eq!(e.classify(), Category::Data);
+    assert_eq!(e.line(), 5, "{e}");
+    assert!(e.to_string().contains("duplicate field `handledAccessFs`"));
+
+    let options = ParseOptions::new().json_last_key_wins(true);
+    let config = Config::parse_json_with(json.as_bytes(), &options).unwrap();
+    assert_eq!(config.handled_fs, AccessFs::ReadFile.into());
+
+    let toml = r#"
+        [[ruleset]]
+        handled_access_fs = [ "execute" ]
+        handled_access_fs = [ "read_file" ]
+    "#;
+    let err = parse_toml(toml).unwrap_err();
+    assert!(err.to_string().contains("line 4"), "{err}");
+}
+
+#[test]
+fn test_net_port_number_string() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ "443", 8080, "0", "65535" ]
+            }
+        ]
+    }"#;
+    let toml = r#"
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ "443", 8080, "0", "65535" ]
+    "#;
+    let config = Config {
+        handled_net: AccessNet::ConnectTcp.into(),
+        rules_net_port: [
+            (0, AccessNet::ConnectTcp.into()),
+            (443, AccessNet::ConnectTcp.into()),
+            (8080, AccessNet::ConnectTcp.into()),
+            (65535, AccessNet::ConnectTcp.into()),
+        ]
+        .into(),
+        ..Default::default()
+    };
+    assert_eq!(parse_json(json), Ok(config.clone()));
+    assert_eq!(parse_toml(toml).unwrap(), config);
+}
+
+#[test]
+fn test_net_port_number_string_invalid() {
+    // Not a number, hence an (unknown) service name.
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ "443a" ]
+            }
+        ]
+    }"#;
+    assert!(matches!(
+        Config::parse_json(json.as_bytes()),
+        Err(ParseJsonError::Config(ConfigError::Service(ServiceError::NotFound(name)))) if name == "443a"
+    ));
+}
+
+#[test]
+fn test_net_port_out_of_range() {
+    for port in [
+        "70000",
+        r#""70000""#,
+        "18446744073709551616",
+        r#""99999999999999999999""#,
+    ] {
+        let json = format!(
+            r#"{{ "netPort": [ {{ "allowedAccess": [ "connect_tcp" ], "port": [ {port} ] }} ] }}"#
+        );
+        assert_eq!(parse_json(&json), Err(Category::Data), "{port}");
+        let toml =
+            format!("[[net_port]]\nallowed_access = [ \"connect_tcp\" ]\nport = [ {port} ]\n");
+        // TOML integers are signed 64-bit.
+        assert!(parse_toml(&toml).is_err(), "{port}");
+    }
+
+    let error = Config::parse_json(
+        r#"{ "netPort": [ { "allowedAccess": [ "connect_tcp" ], "port": [ 70000 ] } ] }"#
+            .as_bytes(),
+    )
+    .unwrap_err();
+    assert!(
+        error.to_string().starts_with(
+            "invalid value: integer `70000`, expected a port number between 0 and 65535"
+        ),
+        "{error}"
+    );
+}
+
+#[test]
+fn test_default_access() {
+    let json = r#"{
+        "ruleset": [
+            {
+                "defaultAccess": [ "execute", "read_file" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "parent": [ "/usr", "/etc" ]
+            },
+            {
+                "allowedAccess": [ "write_file" ],
+                "parent": [ "/tmp" ]
+            }
+        ]
+    }"#;
+    let toml = r#"
+        [[ruleset]]
+        default_access = [ "execute", "read_file" ]
+
+        [[path_beneath]]
+        parent = [ "/usr", "/etc" ]
+
+        [[path_beneath]]
+        allowed_access = [ "write_file" ]
+        parent = [ "/tmp" ]
+    "#;
+    let config = Config {
+        // The default access rights are only handled because they are used.
+        handled_fs: AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile,
+        rules_path_beneath: [
+            (
+                TemplateString::from_text("/etc"),
+                AccessFs::Execute | AccessFs::ReadFile,
+            ),
+            (
+                TemplateString::from_text("/tmp"),
+                AccessFs::WriteFile.into(),
+            ),
+            (
+                TemplateString::from_text("/usr"),
+                AccessFs::Execute | AccessFs::ReadFile,
+            ),
+        ]
+        .into(),
+        ..Default::default()
+    };
+    assert_eq!(parse_json(json), Ok(config.clone()));
+    assert_eq!(parse_toml(toml).unwrap(), config);
+}
+
+#[test]
+fn test_default_access_when() {
+    // Top-level default access rights also apply to conditional rules, which
+    // can extend them.
+    let json = r#"{
+        "ruleset": [
+            {
+                "defaultAccess": [ "read_file" ]
+            }
+        ],
+        "when": [
+            {
+                "ruleset": [
+                    {
+                        "defaultAccess": [ "read_dir" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    let mut config = parse_json(json).unwrap();
+    config.add_conditional_rules(0);
+    assert_eq!(
+        config.rules_path_beneath,
+        [(
+            TemplateString::from_text("/usr"),
+            AccessFs::ReadFile | AccessFs::ReadDir
+        )]
+        .into()
+    );
+}
+
+#[test]
+fn test_default_access_unhandled() {
+    let json = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "read_file" ],
+                "defaultAccess": [ "execute", "read_file" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+    // The schema cannot compare the two sets.
+    assert!(matches!(
+        Config::parse_json(json.as_bytes()),
+        Err(ParseJsonError::Config(ConfigError::UnhandledDefaultAccess(access))) if access == AccessFs::Execute.into()
+    ));
+    assert_eq!(parse_json_schema(json, false), Err(Category::Data));
+}
+
+#[test]
+fn test_default_access_missing() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+    assert!(matches!(
+        Config::parse_json(json.as_bytes()),
+        Err(ParseJsonError::Config(ConfigError::MissingAccess(parent))) if parent == "/usr"
+    ));
+    assert_eq!(parse_json_schema(json, false), Err(Category::Data));
+}
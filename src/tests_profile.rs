@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{ConfigError, ParseJsonError};
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json, parse_json_schema};
+use crate::{Config, GroupError, ParseOptions};
+use landlock::{AccessFs, AccessNet};
+use serde_json::error::Category;
+
+const JSON: &str = r#"{
+    "group": [
+        {
+            "name": "tmp",
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "write_file" ],
+                    "parent": [ "/tmp" ]
+                }
+            ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "execute", "read_file" ],
+            "parent": [ "/usr" ]
+        }
+    ],
+    "profile": [
+        {
+            "name": "strict",
+            "ruleset": [
+                {
+                    "handledAccessNet": [ "connect_tcp" ]
+                }
+            ]
+        },
+        {
+            "name": "permissive",
+            "use": [ "tmp" ],
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        }
+    ]
+}"#;
+
+fn parse_profile(json: &str, name: &str) -> Result<Config, ParseJsonError> {
+    Config::parse_json_with(json.as_bytes(), &ParseOptions::new().profile(name))
+}
+
+fn base() -> Config {
+    Config {
+        handled_fs: AccessFs::Execute | AccessFs::ReadFile,
+        rules_path_beneath: [(
+            TemplateString::from_text("/usr"),
+            AccessFs::Execute | AccessFs::ReadFile,
+        )]
+        .into(),
+        ..Default::default()
+    }
+}
+
+#[test]
+fn test_profile_none() {
+    // Profiles are ignored if none is selected.
+    assert_eq!(parse_json(JSON), Ok(base()));
+}
+
+#[test]
+fn test_profile_select() {
+    let strict = parse_profile(JSON, "strict").unwrap();
+    assert_eq!(
+        strict,
+        Config {
+            handled_net: AccessNet::ConnectTcp.into(),
+            ..base()
+        }
+    );
+
+    let permissive = parse_profile(JSON, "permissive").unwrap();
+    assert_eq!(
+        permissive,
+        Config {
+            handled_fs: AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile,
+            handled_net: AccessNet::ConnectTcp.into(),
+            rules_path_beneath: [
+                (
+                    TemplateString::from_text("/usr"),
+                    AccessFs::Execute | AccessFs::ReadFile,
+                ),
+                (
+                    TemplateString::from_text("/tmp"),
+                    AccessFs::WriteFile.into()
+                ),
+            ]
+            .into(),
+            rules_net_port: [(443, AccessNet::ConnectTcp.into())].into(),
+            ..Default::default()
+        }
+    );
+    assert_ne!(strict.resolve().unwrap(), permissive.resolve().unwrap());
+}
+
+#[test]
+fn test_profile_unknown() {
+    assert!(matches!(
+        parse_profile(JSON, "debug"),
+        Err(ParseJsonError::Config(ConfigError::UnknownProfile(name))) if name == "debug"
+    ));
+
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+    assert!(matches!(
+        parse_profile(json, "strict"),
+        Err(ParseJsonError::Config(ConfigError::UnknownProfile(_)))
+    ));
+}
+
+#[test]
+fn test_profile_unknown_group() {
+    // Unselected profiles must still use known groups.
+    let json = r#"{
+        "profile": [
+            {
+                "name": "debug",
+                "use": [ "foo" ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json_schema(json, false), Err(Category::Data));
+    assert!(matches!(
+        Config::parse_json(json.as_bytes()),
+        Err(ParseJsonError::Config(ConfigError::Group(GroupError::Unknown(name)))) if name == "foo"
+    ));
+}
+
+#[test]
+fn test_profile_invalid() {
+    let json = r#"{
+        "profile": [
+            {
+                "name": "strict"
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+
+    let json = r#"{
+        "profile": [
+            {
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_profile_toml() {
+    let toml = r#"
+        [[group]]
+        name = "tmp"
+
+        [[group.path_beneath]]
+        allowed_access = [ "write_file" ]
+        parent = [ "/tmp" ]
+
+        [[path_beneath]]
+        allowed_access = [ "execute", "read_file" ]
+        parent = [ "/usr" ]
+
+        [[profile]]
+        name = "strict"
+
+        [[profile.ruleset]]
+        handled_access_net = [ "connect_tcp" ]
+
+        [[profile]]
+        name = "permissive"
+        use = [ "tmp" ]
+
+        [[profile.net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ 443 ]
+    "#;
+    for name in ["strict", "permissive"] {
+        let options = ParseOptions::new().profile(name);
+        assert_eq!(
+            Config::parse_toml_with(toml, &options).unwrap(),
+            parse_profile(JSON, name).unwrap()
+        );
+    }
+}
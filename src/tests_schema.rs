@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::ParseJsonError;
+use crate::{Config, ConfigFormat, ParseOptions, SchemaError, StrictSchemaError};
+use serde_json::error::Category;
+
+fn parse_json_validated(json: &str) -> Result<Config, ParseJsonError> {
+    Config::parse_json_with(json.as_bytes(), &ParseOptions::new().validate_schema(true))
+}
+
+fn schema_error(result: Result<Config, ParseJsonError>) -> SchemaError {
+    match result {
+        Err(ParseJsonError::Schema(e)) => e,
+        ret => panic!("unexpected result: {ret:?}"),
+    }
+}
+
+#[test]
+fn test_schema_valid() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+    assert_eq!(
+        parse_json_validated(json).unwrap(),
+        Config::parse_json(json.as_bytes()).unwrap()
+    );
+}
+
+#[test]
+fn test_schema_wrong_type() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": "/usr"
+            }
+        ]
+    }"#;
+    let err = schema_error(parse_json_validated(json));
+    assert_eq!(err.pointer(), "/pathBeneath/0/parent");
+    assert!(err.to_string().contains("\"/pathBeneath/0/parent\""));
+
+    // Without validation, the same configuration is only a data error.
+    assert!(matches!(
+        Config::parse_json(json.as_bytes()),
+        Err(ParseJsonError::SerdeJson(e)) if e.classify() == Category::Data
+    ));
+}
+
+#[test]
+fn test_schema_unknown_property() {
+    let json = r#"{
+        "netPort": [
+            {
+                "allowedAccess": [ "bind_tcp" ],
+                "port": [ 80 ]
+            },
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ],
+                "foo": true
+            }
+        ]
+    }"#;
+    assert_eq!(
+        schema_error(parse_json_validated(json)).pointer(),
+        "/netPort/1"
+    );
+}
+
+#[test]
+fn test_schema_syntax_error() {
+    // Syntax errors are still reported by the JSON parser.
+    assert!(matches!(
+        parse_json_validated("{"),
+        Err(ParseJsonError::SerdeJson(e)) if e.classify() == Category::Eof
+    ));
+}
+
+#[test]
+fn test_schema_embedded() {
+    let schema: serde_json::Value = serde_json::from_str(crate::JSON_SCHEMA).unwrap();
+    assert_eq!(
+        schema["$schema"],
+        "https://json-schema.org/draft/2020-12/schema"
+    );
+}
+
+fn strict_violations(data: &str, format: ConfigFormat) -> Vec<(String, String)> {
+    match Config::validate_schema_strict(data, format) {
+        Err(StrictSchemaError::Violations(violations)) => violations
+            .iter()
+            .map(|e| (e.pointer().to_owned(), e.keyword().to_owned()))
+            .collect(),
+        ret => panic!("unexpected result: {ret:?}"),
+    }
+}
+
+fn violations(expected: &[(&str, &str)]) -> Vec<(String, String)> {
+    expected
+        .iter()
+        .map(|(pointer, keyword)| (pointer.to_string(), keyword.to_string()))
+        .collect()
+}
+
+#[test]
+fn test_schema_strict_valid() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ]
+    }"#;
+    assert!(Config::validate_schema_strict(json, ConfigFormat::Json).is_ok());
+}
+
+#[test]
+fn test_schema_strict_all_violations() {
+    // Type mismatch, enum violation, and unknown property, all reported.
+    let json = r#"{
+        "ruleset": [
+            {
+                "handledAccessFs": [ "execute", "fly" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": "/usr"
+            }
+        ],
+        "netPort": [
+            {
+                "allowedAccess": [ "connect_tcp" ],
+                "port": [ 443 ],
+                "foo": true
+            }
+        ]
+    }"#;
+    assert_eq!(
+        strict_violations(json, ConfigFormat::Json),
+        violations(&[
+            ("/netPort/0", "additionalProperties"),
+            ("/pathBeneath/0/parent", "type"),
+            ("/ruleset/0/handledAccessFs/1", "enum"),
+        ])
+    );
+
+    let err = Config::validate_schema_strict(json, ConfigFormat::Json).unwrap_err();
+    assert!(err.to_string().starts_with("3 schema violation(s):\n"));
+    assert!(err.to_string().contains("\"/pathBeneath/0/parent\""));
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_schema_strict_toml() {
+    let toml = r#"
+        [[path_beneath]]
+        allowed_access = ["execute"]
+        parent = ["/usr"]
+    "#;
+    assert!(Config::validate_schema_strict(toml, ConfigFormat::Toml).is_ok());
+
+    // Pointers use the TOML names.
+    let toml = r#"
+        [[ruleset]]
+        handled_access_fs = ["fly"]
+
+        [[path_beneath]]
+        allowed_access = ["execute"]
+        parent = "/usr"
+
+        [[net_port]]
+        allowed_access = ["connect_tcp"]
+        port = [443]
+        allowedAccess = ["connect_tcp"]
+    "#;
+    assert_eq!(
+        strict_violations(toml, ConfigFormat::Toml),
+        violations(&[
+            ("/net_port/0", "additionalProperties"),
+            ("/path_beneath/0/parent", "type"),
+            ("/ruleset/0/handled_access_fs/0", "enum"),
+        ])
+    );
+
+    // Required properties are renamed too.
+    assert_eq!(
+        strict_violations("[[net_port]]\nport = [443]\n", ConfigFormat::Toml),
+        violations(&[("/net_port/0", "required")])
+    );
+}
+
+#[test]
+fn test_schema_strict_syntax_error() {
+    assert!(matches!(
+        Config::validate_schema_strict("{", ConfigFormat::Json),
+        Err(StrictSchemaError::SerdeJson(e)) if e.classify() == Category::Eof
+    ));
+    #[cfg(feature = "toml")]
+    assert!(matches!(
+        Config::validate_schema_strict("abi = ", ConfigFormat::Toml),
+        Err(StrictSchemaError::SerdeToml(_))
+    ));
+}
@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json, parse_toml};
+use crate::Config;
+use landlock::{AccessFs, ABI};
+
+const JSON: &str = r#"{
+    "abi": 4,
+    "variable": [
+        {
+            "name": "tmp",
+            "literal": [ "/tmp", "/var/tmp" ]
+        }
+    ],
+    "ruleset": [
+        {
+            "handledAccessFs": [ "execute" ],
+            "scoped": [ "signal" ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "abi.read_execute" ],
+            "parent": [ "/usr", "/bin" ]
+        },
+        {
+            "allowedAccess": [ "read_file", "write_file" ],
+            "parent": [ "${tmp}" ]
+        }
+    ],
+    "netPort": [
+        {
+            "allowedAccess": [ "connect_tcp" ],
+            "port": [ 443, 80 ]
+        }
+    ]
+}"#;
+
+const TOML: &str = r#"
+    abi = 4
+
+    [[variable]]
+    name = "tmp"
+    literal = [ "/tmp", "/var/tmp" ]
+
+    [[ruleset]]
+    handled_access_fs = [ "execute" ]
+    scoped = [ "signal" ]
+
+    [[path_beneath]]
+    allowed_access = [ "abi.read_execute" ]
+    parent = [ "/usr", "/bin" ]
+
+    [[path_beneath]]
+    allowed_access = [ "read_file", "write_file" ]
+    parent = [ "${tmp}" ]
+
+    [[net_port]]
+    allowed_access = [ "connect_tcp" ]
+    port = [ 443, 80 ]
+"#;
+
+const GOLDEN_CONFIG: &str = r#"{
+  "abi": 4,
+  "variable": [
+    {
+      "name": "tmp",
+      "literal": [
+        "/tmp",
+        "/var/tmp"
+      ]
+    }
+  ],
+  "ruleset": [
+    {
+      "handledAccessFs": [
+        "execute",
+        "write_file",
+        "read_file",
+        "read_dir",
+        "refer"
+      ],
+      "handledAccessNet": [
+        "connect_tcp"
+      ],
+      "scoped": [
+        "signal"
+      ]
+    }
+  ],
+  "pathBeneath": [
+    {
+      "allowedAccess": [
+        "execute",
+        "read_file",
+        "read_dir",
+        "refer"
+      ],
+      "parent": [
+        "/bin",
+        "/usr"
+      ]
+    },
+    {
+      "allowedAccess": [
+        "write_file",
+        "read_file"
+      ],
+      "parent": [
+        "${tmp}"
+      ]
+    }
+  ],
+  "netPort": [
+    {
+      "allowedAccess": [
+        "connect_tcp"
+      ],
+      "port": [
+        80,
+        443
+      ]
+    }
+  ]
+}"#;
+
+const GOLDEN_RESOLVED: &str = r#"{
+  "ruleset": [
+    {
+      "handledAccessFs": [
+        "execute",
+        "write_file",
+        "read_file",
+        "read_dir",
+        "refer"
+      ],
+      "handledAccessNet": [
+        "connect_tcp"
+      ],
+      "scoped": [
+        "signal"
+      ]
+    }
+  ],
+  "pathBeneath": [
+    {
+      "allowedAccess": [
+        "execute",
+        "read_file",
+        "read_dir",
+        "refer"
+      ],
+      "parent": [
+        "/bin",
+        "/usr"
+      ]
+    },
+    {
+      "allowedAccess": [
+        "write_file",
+        "read_file"
+      ],
+      "parent": [
+        "/tmp",
+        "/var/tmp"
+      ]
+    }
+  ],
+  "netPort": [
+    {
+      "allowedAccess": [
+        "connect_tcp"
+      ],
+      "port": [
+        80,
+        443
+      ]
+    }
+  ]
+}"#;
+
+#[test]
+fn test_serialize_config_json() {
+    let config = parse_json(JSON).unwrap();
+    let serialized = serde_json::to_string_pretty(&config).unwrap();
+    assert_eq!(serialized, GOLDEN_CONFIG);
+    assert_eq!(parse_json(&serialized).unwrap(), config);
+}
+
+#[test]
+fn test_serialize_config_toml() {
+    let config = parse_toml(TOML).unwrap();
+    let serialized = serde_json::to_string_pretty(&config).unwrap();
+    assert_eq!(serialized, GOLDEN_CONFIG);
+}
+
+#[test]
+fn test_serialize_resolved_config() {
+    let resolved = parse_json(JSON).unwrap().resolve().unwrap();
+    let serialized = serde_json::to_string_pretty(&resolved).unwrap();
+    assert_eq!(serialized, GOLDEN_RESOLVED);
+    assert_eq!(
+        parse_json(&serialized).unwrap().resolve().unwrap(),
+        resolved
+    );
+}
+
+#[test]
+fn test_serialize_escaped_dollar() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/a$$b", "/c$d" ]
+            }
+        ]
+    }"#;
+    let config = parse_json(json).unwrap();
+    let serialized = serde_json::to_string(&config).unwrap();
+    assert_eq!(parse_json(&serialized).unwrap(), config);
+
+    let resolved = config.resolve().unwrap();
+    let serialized = serde_json::to_string(&resolved).unwrap();
+    assert_eq!(
+        parse_json(&serialized).unwrap().resolve().unwrap(),
+        resolved
+    );
+}
+
+#[test]
+fn test_serialize_empty() {
+    let mut config = parse_json(
+        r#"{
+            "ruleset": [
+                {
+                    "handledAccessFs": [ "execute" ]
+                }
+            ]
+        }"#,
+    )
+    .unwrap();
+    let other = parse_json(
+        r#"{
+            "ruleset": [
+                {
+                    "handledAccessNet": [ "connect_tcp" ]
+                }
+            ]
+        }"#,
+    )
+    .unwrap();
+    config.compose(&other);
+    assert_eq!(serde_json::to_string(&config).unwrap(), "{}");
+}
+
+const DOWNGRADE: &str = r#"{
+    "abi": 6,
+    "ruleset": [
+        {
+            "handledAccessFs": [ "execute", "refer", "ioctl_dev" ],
+            "scoped": [ "signal" ]
+        }
+    ],
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "execute", "refer" ],
+            "parent": [ "/usr" ]
+        },
+        {
+            "allowedAccess": [ "ioctl_dev" ],
+            "parent": [ "/dev" ]
+        }
+    ],
+    "netPort": [
+        {
+            "allowedAccess": [ "connect_tcp" ],
+            "port": [ 443 ]
+        }
+    ]
+}"#;
+
+#[test]
+fn test_serialize_downgrade_v1() {
+    let mut config = parse_json(DOWNGRADE).unwrap();
+    config.downgrade(ABI::V1);
+    assert_eq!(
+        serde_json::to_value(&config).unwrap(),
+        serde_json::json!({
+            "abi": 1,
+            "ruleset": [
+                {
+                    "handledAccessFs": [ "execute" ]
+                }
+            ],
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute" ],
+                    "parent": [ "/usr" ]
+                }
+            ]
+        })
+    );
+}
+
+#[test]
+fn test_serialize_downgrade_v4() {
+    let mut config = parse_json(DOWNGRADE).unwrap();
+    config.downgrade(ABI::V4);
+    assert_eq!(
+        serde_json::to_value(&config).unwrap(),
+        serde_json::json!({
+            "abi": 4,
+            "ruleset": [
+                {
+                    "handledAccessFs": [ "execute", "refer" ],
+                    "handledAccessNet": [ "connect_tcp" ]
+                }
+            ],
+            "pathBeneath": [
+                {
+                    "allowedAccess": [ "execute", "refer" ],
+                    "parent": [ "/usr" ]
+                }
+            ],
+            "netPort": [
+                {
+                    "allowedAccess": [ "connect_tcp" ],
+                    "port": [ 443 ]
+                }
+            ]
+        })
+    );
+}
+
+#[test]
+fn test_serialize_downgrade_unchanged() {
+    let config = parse_json(DOWNGRADE).unwrap();
+    let mut downgraded = config.clone();
+    downgraded.downgrade(ABI::V6);
+    assert_eq!(downgraded, config);
+
+    // Without a configured ABI, only the targeted version is added.
+    let mut config = parse_json(JSON).unwrap();
+    config.abi = None;
+    let mut downgraded = config.clone();
+    downgraded.downgrade(ABI::V6);
+    config.abi = Some(ABI::V6);
+    assert_eq!(downgraded, config);
+}
+
+#[test]
+fn test_serialize_writer_large() {
+    let mut config = Config::empty();
+    for i in 0..50_000 {
+        let access = if i % 2 == 0 {
+            AccessFs::ReadFile.into()
+        } else {
+            AccessFs::ReadFile | AccessFs::WriteFile
+        };
+        config
+            .rules_path_beneath
+            .insert(TemplateString::from_text(format!("/srv/{i}")), access);
+        config.handled_fs |= access;
+    }
+
+    let mut streamed = Vec::new();
+    serde_json::to_writer(&mut streamed, &config).unwrap();
+    assert_eq!(streamed, serde_json::to_vec(&config).unwrap());
+    assert_eq!(Config::parse_json(streamed.as_slice()).unwrap(), config);
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::parser::TemplateString;
+use crate::tests_helpers::parse_json;
+use crate::{Config, ParseOptions};
+use landlock::{AccessFs, AccessNet, BitFlags};
+use serde_json::error::Category;
+use std::collections::BTreeMap;
+
+const JSON: &str = r#"{
+    "pathBeneath": [
+        {
+            "allowedAccess": [ "execute", "read_file" ],
+            "parent": [ "/usr" ]
+        },
+        {
+            "allowedAccess": [ "write_file" ],
+            "parent": [ "/tmp" ],
+            "tag": [ "debug" ]
+        },
+        {
+            "allowedAccess": [ "read_file" ],
+            "parent": [ "/var/log" ],
+            "tag": [ "debug", "logs" ]
+        }
+    ],
+    "netPort": [
+        {
+            "allowedAccess": [ "connect_tcp" ],
+            "port": [ 443 ],
+            "tag": [ "network" ]
+        }
+    ]
+}"#;
+
+fn parse_tags(options: ParseOptions) -> Config {
+    Config::parse_json_with(JSON.as_bytes(), &options).unwrap()
+}
+
+fn rules(rules: &[(&str, BitFlags<AccessFs>)]) -> BTreeMap<TemplateString, BitFlags<AccessFs>> {
+    rules
+        .iter()
+        .map(|(path, access)| (TemplateString::from_text(*path), *access))
+        .collect()
+}
+
+fn expected_handled(config: &Config) {
+    // Filtered rules still handle their access rights.
+    assert_eq!(
+        config.handled_fs,
+        AccessFs::Execute | AccessFs::ReadFile | AccessFs::WriteFile
+    );
+    assert_eq!(config.handled_net, AccessNet::ConnectTcp.into());
+}
+
+#[test]
+fn test_tag_none() {
+    // All the rules are applied without filter.
+    let config = parse_json(JSON).unwrap();
+    assert_eq!(config, parse_tags(ParseOptions::new()));
+    assert_eq!(config.rules_path_beneath.len(), 3);
+    assert_eq!(config.rules_net_port.len(), 1);
+}
+
+#[test]
+fn test_tag_exclude() {
+    let config = parse_tags(ParseOptions::new().exclude_tags(["debug"]));
+    expected_handled(&config);
+    assert_eq!(
+        config.rules_path_beneath,
+        rules(&[("/usr", AccessFs::Execute | AccessFs::ReadFile)])
+    );
+    assert_eq!(config.rules_net_port.len(), 1);
+
+    let config = parse_tags(ParseOptions::new().exclude_tags(["logs", "network"]));
+    expected_handled(&config);
+    assert_eq!(
+        config.rules_path_beneath,
+        rules(&[
+            ("/tmp", AccessFs::WriteFile.into()),
+            ("/usr", AccessFs::Execute | AccessFs::ReadFile),
+        ])
+    );
+    assert!(config.rules_net_port.is_empty());
+}
+
+#[test]
+fn test_tag_include() {
+    // Untagged rules are not applied.
+    let config = parse_tags(ParseOptions::new().include_tags(["logs"]));
+    expected_handled(&config);
+    assert_eq!(
+        config.rules_path_beneath,
+        rules(&[("/var/log", AccessFs::ReadFile.into())])
+    );
+    assert!(config.rules_net_port.is_empty());
+
+    let config = parse_tags(ParseOptions::new().include_tags(["network", "unknown"]));
+    expected_handled(&config);
+    assert!(config.rules_path_beneath.is_empty());
+    assert_eq!(config.rules_net_port.len(), 1);
+
+    // An empty include filter applies no rule.
+    let config = parse_tags(ParseOptions::new().include_tags(Vec::<String>::new()));
+    expected_handled(&config);
+    assert!(config.rules_path_beneath.is_empty());
+    assert!(config.rules_net_port.is_empty());
+}
+
+#[test]
+fn test_tag_include_exclude() {
+    // Excluded tags take precedence.
+    let config = parse_tags(
+        ParseOptions::new()
+            .include_tags(["debug"])
+            .exclude_tags(["logs"]),
+    );
+    expected_handled(&config);
+    assert_eq!(
+        config.rules_path_beneath,
+        rules(&[("/tmp", AccessFs::WriteFile.into())])
+    );
+    assert!(config.rules_net_port.is_empty());
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_tag_toml() {
+    let toml = r#"
+        [[path_beneath]]
+        allowed_access = [ "write_file" ]
+        parent = [ "/tmp" ]
+        tag = [ "debug" ]
+
+        [[net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ 443 ]
+        tag = [ "network" ]
+    "#;
+    let options = ParseOptions::new().exclude_tags(["debug"]);
+    let config = Config::parse_toml_with(toml, &options).unwrap();
+    assert_eq!(config.handled_fs, AccessFs::WriteFile.into());
+    assert!(config.rules_path_beneath.is_empty());
+    assert_eq!(config.rules_net_port.len(), 1);
+}
+
+#[test]
+fn test_tag_invalid() {
+    // Tag lists cannot be empty.
+    assert_eq!(
+        parse_json(
+            r#"{ "pathBeneath": [ { "allowedAccess": [ "execute" ], "parent": [ "/usr" ], "tag": [] } ] }"#
+        ),
+        Err(Category::Data)
+    );
+    assert_eq!(
+        parse_json(
+            r#"{ "netPort": [ { "allowedAccess": [ "bind_tcp" ], "port": [ 80 ], "tag": "debug" } ] }"#
+        ),
+        Err(Category::Data)
+    );
+}
+
+#[test]
+fn test_tag_not_serialized() {
+    // Only the applied rules are kept, without their tags.
+    let config = parse_tags(ParseOptions::new().exclude_tags(["debug"]));
+    let json = serde_json::to_string(&config).unwrap();
+    assert!(!json.contains("tag"));
+    assert_eq!(
+        Config::parse_json(json.as_bytes())
+            .unwrap()
+            .rules_path_beneath,
+        rules(&[("/usr", AccessFs::Execute | AccessFs::ReadFile)])
+    );
+}
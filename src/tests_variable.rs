@@ -4,8 +4,8 @@ use crate::{
     config::ResolvedConfig,
     parser::{TemplateString, TemplateToken},
     tests_helpers::{parse_json, parse_json_schema, parse_toml},
-    variable::{Name, ResolveError, Variables},
-    Config,
+    variable::{Name, ResolveError, ResolveWarning, Variables},
+    Config, PathResolver,
 };
 use landlock::AccessFs;
 use serde_json::error::Category;
@@ -476,3 +476,121 @@ fn test_special_characters() {
         })
     );
 }
+
+#[test]
+fn test_variable_default() {
+    let json = r#"{
+        "variable": [
+            {
+                "name": "defined",
+                "literal": [ "/usr" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "${defined:-/opt}/bin", "${undefined:-/run/user/1000}" ]
+            }
+        ]
+    }"#;
+    assert_eq!(
+        parse_json(json).unwrap().resolve(),
+        Ok(ResolvedConfig {
+            handled_fs: AccessFs::Execute.into(),
+            rules_path_beneath: [
+                (PathBuf::from("/run/user/1000"), AccessFs::Execute.into()),
+                (PathBuf::from("/usr/bin"), AccessFs::Execute.into()),
+            ]
+            .into(),
+            ..Default::default()
+        })
+    );
+}
+
+#[test]
+fn test_expand_env() {
+    let json = r#"{
+        "variable": [
+            {
+                "name": "HOME",
+                "literal": [ "/home/config" ]
+            }
+        ],
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [
+                    "${LANDLOCKCONFIG_TEST_RUNTIME_DIR}",
+                    "${LANDLOCKCONFIG_TEST_UNSET:-/tmp}",
+                    "${HOME}"
+                ]
+            }
+        ]
+    }"#;
+    let config = parse_json(json).unwrap();
+    // Disabled by default.
+    assert_eq!(
+        config.clone().resolve(),
+        Err(ResolveError::VariableNotFound(
+            Name::from_str("LANDLOCKCONFIG_TEST_RUNTIME_DIR").unwrap()
+        ))
+    );
+    let resolved = config
+        .resolve_with(&PathResolver::new().expand_env(true).env([
+            ("LANDLOCKCONFIG_TEST_RUNTIME_DIR", "/run/user/42"),
+            ("HOME", "/home/user"),
+        ]))
+        .unwrap();
+    // Configuration variables take precedence.
+    assert_eq!(
+        resolved.rules_path_beneath.keys().collect::<Vec<_>>(),
+        ["/home/config", "/run/user/42", "/tmp"].map(std::path::Path::new)
+    );
+}
+
+#[test]
+fn test_resolve_lenient() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "/usr", "${LANDLOCKCONFIG_TEST_UNSET}/data" ]
+            }
+        ]
+    }"#;
+    let config = parse_json(json).unwrap();
+    let resolver = PathResolver::new().expand_env(true);
+    assert_eq!(
+        config.clone().resolve_with(&resolver),
+        Err(ResolveError::VariableNotFound(
+            Name::from_str("LANDLOCKCONFIG_TEST_UNSET").unwrap()
+        ))
+    );
+    let (resolved, warnings) = config.resolve_lenient(&resolver).unwrap();
+    assert_eq!(
+        resolved.rules_path_beneath,
+        [(PathBuf::from("/usr"), AccessFs::ReadFile.into())].into()
+    );
+    assert_eq!(
+        warnings,
+        [ResolveWarning::UndefinedVariable {
+            path: "${LANDLOCKCONFIG_TEST_UNSET}/data".into(),
+            name: Name::from_str("LANDLOCKCONFIG_TEST_UNSET").unwrap(),
+        }]
+    );
+
+    // Required rules are never dropped.
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "read_file" ],
+                "parent": [ "${LANDLOCKCONFIG_TEST_UNSET}" ],
+                "required": true
+            }
+        ]
+    }"#;
+    assert!(matches!(
+        parse_json(json).unwrap().resolve_lenient(&resolver),
+        Err(ResolveError::VariableNotFound(_))
+    ));
+}
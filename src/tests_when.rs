@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::parser::TemplateString;
+use crate::tests_helpers::{parse_json, validate_json};
+use crate::{Config, PathResolver};
+use landlock::{Access, AccessFs, AccessNet, ABI};
+use serde_json::error::Category;
+
+// Returns the configuration as resolved for a kernel supporting `abi`.
+fn parse_json_abi(json: &str, abi: ABI) -> Config {
+    assert_eq!(validate_json(json), Ok(()));
+    let mut config = parse_json(json).unwrap();
+    config.add_conditional_rules(abi as i32);
+    config
+}
+
+#[cfg(feature = "toml")]
+fn parse_toml_abi(toml: &str, abi: ABI) -> Config {
+    let mut config = Config::parse_toml(toml).unwrap();
+    config.add_conditional_rules(abi as i32);
+    config
+}
+
+#[test]
+fn test_when_min_abi() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ],
+        "when": [
+            {
+                "minAbi": 4,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    let without_net = Config {
+        handled_fs: AccessFs::Execute.into(),
+        rules_path_beneath: [(TemplateString::from_text("/usr"), AccessFs::Execute.into())].into(),
+        ..Default::default()
+    };
+    let with_net = Config {
+        handled_net: AccessNet::ConnectTcp.into(),
+        rules_net_port: [(443, AccessNet::ConnectTcp.into())].into(),
+        ..without_net.clone()
+    };
+
+    assert_eq!(parse_json_abi(json, ABI::V2), without_net);
+    assert_eq!(parse_json_abi(json, ABI::V3), without_net);
+    assert_eq!(parse_json_abi(json, ABI::V4), with_net);
+    assert_eq!(parse_json_abi(json, ABI::V6), with_net);
+}
+
+#[test]
+fn test_when_max_abi() {
+    let json = r#"{
+        "when": [
+            {
+                "maxAbi": 2,
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "refer" ]
+                    }
+                ]
+            },
+            {
+                "minAbi": 3,
+                "maxAbi": 5,
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "truncate" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    let handled_fs = |abi| parse_json_abi(json, abi).handled_fs;
+    assert_eq!(handled_fs(ABI::V1), AccessFs::Refer.into());
+    assert_eq!(handled_fs(ABI::V2), AccessFs::Refer.into());
+    assert_eq!(handled_fs(ABI::V3), AccessFs::Truncate.into());
+    assert_eq!(handled_fs(ABI::V5), AccessFs::Truncate.into());
+    assert!(handled_fs(ABI::V6).is_empty());
+}
+
+#[test]
+fn test_when_unsupported() {
+    let json = r#"{
+        "when": [
+            {
+                "minAbi": 1,
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "execute" ]
+                    }
+                ]
+            },
+            {
+                "maxAbi": 1,
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    // Without Landlock support, only blocks without minAbi match.
+    assert_eq!(
+        parse_json_abi(json, ABI::Unsupported),
+        Config {
+            handled_fs: AccessFs::Execute.into(),
+            rules_path_beneath: [(TemplateString::from_text("/usr"), AccessFs::Execute.into())]
+                .into(),
+            ..Default::default()
+        }
+    );
+}
+
+#[test]
+fn test_when_abi_group() {
+    let json = r#"{
+        "abi": 1,
+        "when": [
+            {
+                "minAbi": 6,
+                "ruleset": [
+                    {
+                        "handledAccessFs": [ "abi.all" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    // Groups are resolved with the configured ABI, not the kernel one.
+    assert_eq!(
+        parse_json_abi(json, ABI::V6).handled_fs,
+        AccessFs::from_all(ABI::V1)
+    );
+}
+
+#[test]
+fn test_when_resolve() {
+    let json = r#"{
+        "when": [
+            {
+                "minAbi": 4,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    // The when blocks are kept by the parsing, and only evaluated when
+    // resolving.
+    let config = parse_json(json).unwrap();
+    assert_eq!(config.when.len(), 1);
+    let resolve = |abi| {
+        config
+            .clone()
+            .resolve_with(&PathResolver::new().kernel_abi(abi))
+            .unwrap()
+    };
+    assert!(resolve(ABI::V3).rules_net_port.is_empty());
+    assert_eq!(
+        resolve(ABI::V4).rules_net_port,
+        [(443, AccessNet::ConnectTcp.into())].into()
+    );
+}
+
+#[test]
+fn test_when_serialize() {
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ],
+        "when": [
+            {
+                "minAbi": 4,
+                "maxAbi": 5,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    let config = parse_json(json).unwrap();
+    let serialized = serde_json::to_string(&config).unwrap();
+    assert_eq!(parse_json(&serialized).unwrap(), config);
+}
+
+#[test]
+fn test_when_compose() {
+    let json_a = r#"{
+        "ruleset": [
+            {
+                "handledAccessNet": [ "connect_tcp" ]
+            }
+        ],
+        "when": [
+            {
+                "minAbi": 4,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    let json_b = r#"{
+        "when": [
+            {
+                "minAbi": 5,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 80, 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    // Composing then evaluating is the same as evaluating then composing.
+    for abi in [ABI::V3, ABI::V4, ABI::V5] {
+        let mut composed = parse_json(json_a).unwrap();
+        composed.compose(&parse_json(json_b).unwrap());
+        composed.add_conditional_rules(abi as i32);
+
+        let mut evaluated = parse_json_abi(json_a, abi);
+        evaluated.compose(&parse_json_abi(json_b, abi));
+        assert_eq!(composed, evaluated);
+    }
+}
+
+#[cfg(feature = "toml")]
+#[test]
+fn test_when_toml() {
+    let toml = r#"
+        [[path_beneath]]
+        allowed_access = [ "execute" ]
+        parent = [ "/usr" ]
+
+        [[when]]
+        min_abi = 4
+
+        [[when.net_port]]
+        allowed_access = [ "connect_tcp" ]
+        port = [ 443 ]
+    "#;
+    let json = r#"{
+        "pathBeneath": [
+            {
+                "allowedAccess": [ "execute" ],
+                "parent": [ "/usr" ]
+            }
+        ],
+        "when": [
+            {
+                "minAbi": 4,
+                "netPort": [
+                    {
+                        "allowedAccess": [ "connect_tcp" ],
+                        "port": [ 443 ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+
+    for abi in [ABI::V2, ABI::V6] {
+        assert_eq!(parse_toml_abi(toml, abi), parse_json_abi(json, abi));
+    }
+    assert_ne!(parse_toml_abi(toml, ABI::V2), parse_toml_abi(toml, ABI::V6));
+}
+
+#[test]
+fn test_when_empty() {
+    let json = r#"{
+        "when": [
+            {
+                "minAbi": 4
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[test]
+fn test_when_unknown_field() {
+    let json = r#"{
+        "when": [
+            {
+                "minAbi": 4,
+                "variable": [
+                    {
+                        "name": "foo",
+                        "literal": [ "bar" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
+
+#[test]
+fn test_when_invalid_abi() {
+    let json = r#"{
+        "when": [
+            {
+                "minAbi": 0,
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "execute" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }
+        ]
+    }"#;
+    assert_eq!(parse_json(json), Err(Category::Data));
+}
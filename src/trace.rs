@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use std::sync::{Mutex, MutexGuard, PoisonError};
+use std::time::{Duration, Instant};
+
+/// Time spent in each phase of loading and enforcing configurations.
+///
+/// The phases are:
+/// * `read`: reading configuration files, without the included fragments;
+/// * `parse`: parsing configurations, including reading and parsing their
+///   fragments;
+/// * `resolve`: resolving variables and paths (e.g. expanding globs);
+/// * `build`: creating the ruleset, opening the rule paths, and adding the
+///   rules, which includes the Landlock syscalls.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Timings {
+    pub read: Duration,
+    pub parse: Duration,
+    pub resolve: Duration,
+    pub build: Duration,
+}
+
+impl Timings {
+    /// Returns the time spent in all the phases.
+    pub fn total(&self) -> Duration {
+        self.read + self.parse + self.resolve + self.build
+    }
+}
+
+#[derive(Clone, Copy, Debug)]
+pub(crate) enum Phase {
+    Read,
+    Parse,
+    Resolve,
+    Build,
+}
+
+/// Accumulates the [`Timings`] of the calls it is passed to, e.g. to profile
+/// huge configurations.
+///
+/// Tracing is disabled by default.  It is enabled for parsing with
+/// [`ParseOptions::trace()`](crate::ParseOptions::trace), for resolving with
+/// [`PathResolver::trace()`](crate::PathResolver::trace), and for building
+/// with
+/// [`ResolvedConfig::build_ruleset_traced()`](crate::ResolvedConfig::build_ruleset_traced).
+/// A `Trace` can be shared between threads, and the durations of each phase
+/// are summed.
+#[derive(Debug, Default)]
+pub struct Trace {
+    timings: Mutex<Timings>,
+}
+
+impl Trace {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn lock(&self) -> MutexGuard<'_, Timings> {
+        // Each update is complete once done, so the content of a poisoned
+        // mutex is still consistent.
+        self.timings.lock().unwrap_or_else(PoisonError::into_inner)
+    }
+
+    /// Returns the timings accumulated so far.
+    pub fn timings(&self) -> Timings {
+        self.lock().clone()
+    }
+
+    /// Calls `f` and adds its duration to `phase`.
+    pub(crate) fn time<T, F>(&self, phase: Phase, f: F) -> T
+    where
+        F: FnOnce() -> T,
+    {
+        let start = Instant::now();
+        let ret = f();
+        let elapsed = start.elapsed();
+        let mut timings = self.lock();
+        let duration = match phase {
+            Phase::Read => &mut timings.read,
+            Phase::Parse => &mut timings.parse,
+            Phase::Resolve => &mut timings.resolve,
+            Phase::Build => &mut timings.build,
+        };
+        *duration += elapsed;
+        ret
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{Config, ConfigFormat, ParseOptions, PathResolver};
+    use std::path::Path;
+    use std::sync::Arc;
+
+    #[test]
+    fn test_disabled() {
+        let trace = Trace::new();
+        assert_eq!(trace.timings(), Timings::default());
+        assert_eq!(trace.timings().total(), Duration::ZERO);
+    }
+
+    #[test]
+    fn test_time() {
+        let trace = Trace::new();
+        assert_eq!(trace.time(Phase::Resolve, || 42), 42);
+        let timings = trace.timings();
+        assert!(timings.resolve > Duration::ZERO);
+        assert_eq!(timings.total(), timings.resolve);
+    }
+
+    #[test]
+    fn test_phases() {
+        let path = Path::new(env!("CARGO_MANIFEST_DIR")).join("tests/composition/s.json");
+        let trace = Arc::new(Trace::new());
+
+        let start = Instant::now();
+        let options = ParseOptions::new().trace(trace.clone());
+        let config = Config::parse_file_with(path, ConfigFormat::Json, &options).unwrap();
+        let resolver = PathResolver::new().trace(trace.clone());
+        let resolved = config.resolve_with(&resolver).unwrap();
+        resolved.build_ruleset_traced(&trace).unwrap();
+        let elapsed = start.elapsed();
+
+        let timings = trace.timings();
+        assert!(timings.read > Duration::ZERO, "{timings:?}");
+        assert!(timings.parse > Duration::ZERO, "{timings:?}");
+        assert!(timings.resolve > Duration::ZERO, "{timings:?}");
+        assert!(timings.build > Duration::ZERO, "{timings:?}");
+        // The phases cover most of the work, without overlapping.
+        assert!(timings.total() <= elapsed, "{timings:?} > {elapsed:?}");
+    }
+}
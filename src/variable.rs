@@ -1,6 +1,7 @@
 // SPDX-License-Identifier: Apache-2.0 OR MIT
 
 use crate::parser::{TemplateString, TemplateToken};
+use crate::resolver::PathResolveError;
 use std::{
     collections::{BTreeMap, BTreeSet},
     fmt,
@@ -54,12 +55,25 @@ pub enum NameError {
 #[derive(Clone, Debug, Default, PartialEq, Eq)]
 pub(crate) struct Variables(BTreeMap<Name, BTreeSet<String>>);
 
+/// Part of a configuration ignored by
+/// [`Config::resolve_lenient()`](crate::Config::resolve_lenient).
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum ResolveWarning {
+    /// The rules of this path are dropped because it references an undefined
+    /// variable without default value.
+    #[error("rule dropped for {path} because of the undefined variable '{name}'")]
+    UndefinedVariable { path: String, name: Name },
+}
+
 #[derive(Debug, Error, PartialEq, Eq)]
 pub enum ResolveError {
     #[error("variable '{0}' not found")]
     VariableNotFound(Name),
     #[error(transparent)]
     InvalidName(#[from] NameError),
+    #[error(transparent)]
+    Path(#[from] PathResolveError),
 }
 
 impl Variables {
@@ -70,6 +84,19 @@ impl Variables {
         self.0.entry(key).or_default().extend(values);
     }
 
+    pub(crate) fn contains(&self, key: &Name) -> bool {
+        self.0.contains_key(key)
+    }
+
+    pub(crate) fn remove(&mut self, key: &Name) {
+        self.0.remove(key);
+    }
+
+    /// Replaces the values of `key` with `value`.
+    pub(crate) fn set(&mut self, key: Name, value: String) {
+        self.0.insert(key, [value].into());
+    }
+
     // TODO: Return references instead of cloning.
     pub(crate) fn resolve(
         &self,
@@ -85,6 +112,11 @@ impl Variables {
                     .get(name)
                     .cloned()
                     .ok_or_else(|| ResolveError::VariableNotFound(name.clone())),
+                TemplateToken::VarDefault(name, default) => Ok(self
+                    .0
+                    .get(name)
+                    .cloned()
+                    .unwrap_or_else(|| [default.clone()].into())),
             })
             .collect()
     }
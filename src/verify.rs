@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::config::{BuildRulesetError, RuleError};
+use crate::grant::Explanation;
+use crate::{probe_denied, ResolvedConfig};
+use landlock::{AccessFs, RestrictionStatus};
+use std::io;
+use std::path::{Path, PathBuf};
+use thiserror::Error;
+
+/// Common paths tried, in this order, to sample denied accesses.
+const SAMPLE_FILES: &[&str] = &["/etc/passwd", "/etc/hostname", "/etc/os-release"];
+const SAMPLE_DIRS: &[&str] = &["/", "/etc", "/usr", "/var", "/tmp"];
+
+#[derive(Debug, Error)]
+#[non_exhaustive]
+pub enum VerifyError {
+    #[error(transparent)]
+    Build(#[from] BuildRulesetError),
+    #[error("{access:?} is still allowed for {path} after enforcement")]
+    NotDenied { path: PathBuf, access: AccessFs },
+    #[error("failed to probe {path}: {source}")]
+    Probe {
+        path: PathBuf,
+        #[source]
+        source: io::Error,
+    },
+}
+
+impl ResolvedConfig {
+    /// Enforces this configuration like
+    /// [`restrict_self()`](ResolvedConfig::restrict_self), and then checks
+    /// with [`probe_denied()`] that a few accesses denied by the configuration
+    /// are actually denied, e.g. to fail closed when the running kernel does
+    /// not support Landlock.
+    ///
+    /// At most one path is sampled for each of `ReadFile` and `ReadDir`,
+    /// among common system paths which are denied by the configuration but
+    /// allowed before enforcement.  `WriteFile` is not sampled because opening
+    /// system files for writing (typically as root) would trigger file
+    /// monitoring (e.g. audit watches).  This is opt-in because each sample costs open(2) calls,
+    /// and it is not a proof: other access rights are not verified, paths are
+    /// compared lexically like [`why_denied()`](ResolvedConfig::why_denied),
+    /// and a configuration without any sampled path is not verified at all.
+    ///
+    /// The restrictions are still enforced if an error is returned after
+    /// building the ruleset.
+    pub fn restrict_self_verified(
+        &self,
+    ) -> Result<(RestrictionStatus, Vec<RuleError>), VerifyError> {
+        self.restrict_self_verified_with(|| Ok(self.restrict_self()?))
+    }
+
+    fn restrict_self_verified_with<T, F>(&self, restrict: F) -> Result<T, VerifyError>
+    where
+        F: FnOnce() -> Result<T, VerifyError>,
+    {
+        // Samples must be selected before enforcement, which might deny them.
+        let samples = self.denied_samples();
+        let ret = restrict()?;
+        for (path, access) in samples {
+            match probe_denied(&path, access) {
+                Ok(true) => {}
+                Ok(false) => return Err(VerifyError::NotDenied { path, access }),
+                Err(source) => return Err(VerifyError::Probe { path, source }),
+            }
+        }
+        Ok(ret)
+    }
+
+    /// Returns the sampled paths and access rights denied by this
+    /// configuration, and currently allowed.
+    fn denied_samples(&self) -> Vec<(PathBuf, AccessFs)> {
+        [
+            (AccessFs::ReadFile, SAMPLE_FILES),
+            (AccessFs::ReadDir, SAMPLE_DIRS),
+        ]
+        .into_iter()
+        .filter(|(access, _)| self.handled_fs.contains(*access))
+        .filter_map(|(access, paths)| {
+            paths
+                .iter()
+                .map(Path::new)
+                .find(|path| {
+                    self.why_denied(path, access.into()) != Explanation::Allowed
+                        && matches!(probe_denied(path, access), Ok(false))
+                })
+                .map(|path| (path.to_path_buf(), access))
+        })
+        .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::{dedicated_thread, parse_json};
+    use landlock::RulesetStatus;
+
+    fn resolved(parent: &str) -> ResolvedConfig {
+        parse_json(&format!(
+            r#"{{
+                "ruleset": [
+                    {{
+                        "handledAccessFs": [ "read_file", "read_dir" ]
+                    }}
+                ],
+                "pathBeneath": [
+                    {{
+                        "allowedAccess": [ "read_file", "read_dir" ],
+                        "parent": [ "{parent}" ]
+                    }}
+                ]
+            }}"#
+        ))
+        .unwrap()
+        .resolve()
+        .unwrap()
+    }
+
+    #[test]
+    fn test_denied_samples() {
+        assert_eq!(
+            resolved("/usr").denied_samples(),
+            [
+                (PathBuf::from("/etc/passwd"), AccessFs::ReadFile),
+                (PathBuf::from("/"), AccessFs::ReadDir),
+            ]
+        );
+        // Nothing to verify.
+        assert_eq!(resolved("/").denied_samples(), []);
+    }
+
+    #[test]
+    fn test_restrict_self_verified() {
+        dedicated_thread(|| match resolved("/usr").restrict_self_verified() {
+            Ok((status, rule_errors)) => {
+                assert!(rule_errors.is_empty());
+                assert_ne!(status.ruleset, RulesetStatus::NotEnforced);
+            }
+            Err(VerifyError::NotDenied { path, access }) => {
+                // Best-effort enforcement without Landlock is flagged.
+                eprintln!("Landlock is not supported by the running kernel");
+                assert_eq!(path, Path::new("/etc/passwd"));
+                assert_eq!(access, AccessFs::ReadFile);
+            }
+            Err(error) => panic!("{error}"),
+        });
+    }
+
+    #[test]
+    fn test_restrict_self_verified_no_op() {
+        // An enforcement without effect is flagged.
+        assert!(matches!(
+            resolved("/usr").restrict_self_verified_with(|| Ok(())),
+            Err(VerifyError::NotDenied { path, access: AccessFs::ReadFile })
+                if path == Path::new("/etc/passwd")
+        ));
+        assert!(resolved("/").restrict_self_verified_with(|| Ok(())).is_ok());
+    }
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0 OR MIT
+
+use crate::Config;
+use landlock::{AccessFs, AccessNet, BitFlags, Scope, ABI};
+use thiserror::Error;
+
+/// First upstream kernel version supporting each Landlock ABI version.
+///
+/// This table must be updated with each new ABI version supported by the
+/// landlock crate.
+const KERNEL_ABIS: &[((u32, u32), ABI)] = &[
+    ((5, 13), ABI::V1),
+    ((5, 19), ABI::V2),
+    ((6, 2), ABI::V3),
+    ((6, 7), ABI::V4),
+    ((6, 10), ABI::V5),
+    ((6, 12), ABI::V6),
+];
+
+#[derive(Debug, Error, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum KernelVersionError {
+    #[error("invalid kernel version: {0}")]
+    Invalid(String),
+    #[error("Landlock is not supported by kernel {0} (requires 5.13)")]
+    Unsupported(String),
+}
+
+/// Handled access rights and scopes removed from a configuration, with their
+/// rules.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Dropped {
+    pub fs: BitFlags<AccessFs>,
+    pub net: BitFlags<AccessNet>,
+    pub scope: BitFlags<Scope>,
+}
+
+impl Dropped {
+    pub fn is_empty(&self) -> bool {
+        self.fs.is_empty() && self.net.is_empty() && self.scope.is_empty()
+    }
+}
+
+/// Returns the Landlock ABI version of an upstream kernel version, e.g.
+/// `6.8` or `5.15.0-91-generic`.
+///
+/// Only the major and minor numbers are used: distribution kernels backporting
+/// Landlock features are not detected.  Versions newer than the latest one
+/// known get the latest ABI version supported by the landlock crate.
+pub fn kernel_version_abi(version: &str) -> Result<ABI, KernelVersionError> {
+    let invalid = || KernelVersionError::Invalid(version.into());
+    // Ignores any patch number or suffix.
+    let mut numbers = version
+        .split(|c: char| !c.is_ascii_digit())
+        .map(|n| n.parse::<u32>().map_err(|_| invalid()));
+    let major = numbers.next().ok_or_else(invalid)??;
+    let minor = numbers.next().ok_or_else(invalid)??;
+    if !version[major.to_string().len()..].starts_with('.') {
+        return Err(invalid());
+    }
+    KERNEL_ABIS
+        .iter()
+        .rev()
+        .find(|(first, _)| *first <= (major, minor))
+        .map(|(_, abi)| *abi)
+        .ok_or_else(|| KernelVersionError::Unsupported(version.into()))
+}
+
+impl Config {
+    /// Returns this configuration downgraded to the features supported by a
+    /// kernel version (see [`kernel_version_abi()`]), with what was dropped,
+    /// e.g. to check in a test matrix how a policy degrades on older kernels.
+    pub fn for_kernel_version(&self, version: &str) -> Result<(Self, Dropped), KernelVersionError> {
+        let mut config = self.clone();
+        config.downgrade(kernel_version_abi(version)?);
+        let dropped = Dropped {
+            fs: self.handled_fs & !config.handled_fs,
+            net: self.handled_net & !config.handled_net,
+            scope: self.scoped & !config.scoped,
+        };
+        Ok((config, dropped))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::tests_helpers::parse_json;
+
+    #[test]
+    fn test_kernel_version_abi() {
+        for (version, abi) in [
+            ("5.13", ABI::V1),
+            ("5.15", ABI::V1),
+            ("5.15.0-91-generic", ABI::V1),
+            ("5.19", ABI::V2),
+            ("6.1.55", ABI::V2),
+            ("6.2", ABI::V3),
+            ("6.7", ABI::V4),
+            ("6.8", ABI::V4),
+            ("6.10", ABI::V5),
+            ("6.12", ABI::V6),
+            ("7.0", ABI::V6),
+            ("10.1", ABI::V6),
+        ] {
+            assert_eq!(kernel_version_abi(version), Ok(abi), "{version}");
+        }
+    }
+
+    #[test]
+    fn test_kernel_version_abi_errors() {
+        for version in ["5.12", "4.19.0", "3.0"] {
+            assert_eq!(
+                kernel_version_abi(version),
+                Err(KernelVersionError::Unsupported(version.into()))
+            );
+        }
+        for version in ["", "6", "6.", ".8", "6-8", "v6.8", "6.x"] {
+            assert_eq!(
+                kernel_version_abi(version),
+                Err(KernelVersionError::Invalid(version.into())),
+                "{version:?}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_for_kernel_version() {
+        let config = parse_json(
+            r#"{
+                "ruleset": [
+                    {
+                        "handledAccessNet": [ "connect_tcp" ],
+                        "scoped": [ "signal" ]
+                    }
+                ],
+                "pathBeneath": [
+                    {
+                        "allowedAccess": [ "read_file", "refer", "truncate" ],
+                        "parent": [ "/usr" ]
+                    }
+                ]
+            }"#,
+        )
+        .unwrap();
+
+        let (v1, dropped) = config.for_kernel_version("5.15").unwrap();
+        assert_eq!(v1.handled_fs, AccessFs::ReadFile.into());
+        assert_eq!(
+            dropped,
+            Dropped {
+                fs: AccessFs::Refer | AccessFs::Truncate,
+                net: AccessNet::ConnectTcp.into(),
+                scope: Scope::Signal.into(),
+            }
+        );
+
+        let (v4, dropped) = config.for_kernel_version("6.8").unwrap();
+        assert_eq!(v4.handled_net, AccessNet::ConnectTcp.into());
+        assert_eq!(
+            dropped,
+            Dropped {
+                scope: Scope::Signal.into(),
+                ..Default::default()
+            }
+        );
+
+        let (latest, dropped) = config.for_kernel_version("6.12").unwrap();
+        // Only the configured ABI version changes.
+        assert_eq!(
+            latest,
+            Config {
+                abi: Some(ABI::V6),
+                ..config.clone()
+            }
+        );
+        assert!(dropped.is_empty());
+
+        assert!(config.for_kernel_version("5.10").is_err());
+    }
+}